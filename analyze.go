@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+func analyzeMain(argv []string) {
+	fs := newFlagSet("analyze", "[flags] [results.csv ...]")
+	var timeSeries timeSeriesOptions
+	timeSeriesFlags(fs, &timeSeries)
+	var args profiler.Config
+	var opts runOptions
+	parquetFlag(fs, &opts.Parquet)
+	mode := fs.String("mode", "", "Only analyze the requests of this mode, e.g. call in the results of a script")
+	blocks := fs.String("blocks", "", "Fetch block times from this remote, e.g. localhost:26657, and break transaction latency down by when in the block interval each was submitted")
+	assertFlags(fs, &args, &opts)
+	parseFlags(fs, argv)
+	if timeSeries.Bucket <= 0 {
+		fmt.Println("Error: bucket must be positive.")
+		os.Exit(1)
+	}
+	paths := resultsArgs(fs.Args())
+	logs, err := loadResults(paths)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *mode != "" {
+		_, byMode := profiler.GroupByMode(logs)
+		if logs = byMode[*mode]; len(logs) == 0 {
+			fmt.Println("Error: no", *mode, "requests in", strings.Join(paths, ", "))
+			os.Exit(1)
+		}
+	}
+	profiler.WriteSummary(os.Stdout, logs)
+	if *blocks != "" {
+		heights := profiler.BlockHeights(logs)
+		if len(heights) == 0 {
+			fmt.Println("Error: no committed transactions in", strings.Join(paths, ", "))
+			os.Exit(1)
+		}
+		times, err := profiler.BlockTimes(*blocks, heights)
+		if err != nil {
+			fmt.Println("Error: fetching block times:", err)
+			os.Exit(1)
+		}
+		profiler.WriteBlockPhases(os.Stdout, profiler.SummarizeBlockPhases(logs, times))
+	}
+	timeSeries.save(logs)
+	saveParquet(opts.Parquet, logs)
+
+	for _, a := range args.Assert {
+		if _, err := profiler.ParseAssertion(a); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	stats := profiler.Summarize(logs)
+	assertions, passed := printAssertions(args.Assert, stats)
+	if opts.JUnit != "" {
+		var summary bytes.Buffer
+		profiler.WriteSummary(&summary, logs)
+		var elapsed time.Duration
+		if len(logs) > 0 {
+			elapsed = logs[len(logs)-1].Timestamp.Sub(logs[0].Timestamp)
+		}
+		saveJUnit(opts.JUnit, strings.Join(paths, " "), elapsed, summary.String(), "", assertions)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+func compareMain(argv []string) {
+	fs := newFlagSet("compare", "baseline.csv candidate.csv | ab-results.csv")
+	parseFlags(fs, argv)
+	if fs.NArg() == 1 {
+		compareTargets(fs.Arg(0))
+		return
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	baseline, err := profiler.LoadResults(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	candidate, err := profiler.LoadResults(fs.Arg(1))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	writeComparison(os.Stdout, profiler.Summarize(baseline), profiler.Summarize(candidate))
+}
+
+// compareTargets compares the two remotes of an A/B run (-compareRemote) recorded in
+// one results file, taking the first one seen as the baseline.
+func compareTargets(path string) {
+	logs, err := profiler.LoadResults(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	var targets []string
+	for _, log := range logs {
+		if !slices.Contains(targets, log.Target) {
+			targets = append(targets, log.Target)
+		}
+	}
+	if len(targets) != 2 || slices.Contains(targets, "") {
+		fmt.Println("Error:", path, "is not the results of an A/B run; pass two results files to compare them.")
+		os.Exit(1)
+	}
+	fmt.Printf("Baseline %s, candidate %s:\n", targets[0], targets[1])
+	writeComparison(os.Stdout, profiler.Summarize(profiler.FilterTarget(logs, targets[0])),
+		profiler.Summarize(profiler.FilterTarget(logs, targets[1])))
+}
+
+// writeComparison prints the summaries of two runs side by side with the change from the
+// first to the second.
+func writeComparison(w io.Writer, baseline, candidate profiler.Summary) {
+	fmt.Fprintf(w, "%-12s %14s %14s %10s\n", "", "baseline", "candidate", "change")
+	fmt.Fprintf(w, "%-12s %14d %14d %10s\n", "Requests", baseline.Requests, candidate.Requests,
+		relativeChange(float64(baseline.Requests), float64(candidate.Requests)))
+	fmt.Fprintf(w, "%-12s %13.2f%% %13.2f%% %+9.2fpp\n", "Error rate",
+		100*baseline.ErrorRate(), 100*candidate.ErrorRate(), 100*(candidate.ErrorRate()-baseline.ErrorRate()))
+	latencies := []struct {
+		name                string
+		baseline, candidate time.Duration
+	}{
+		{"Latency p50", baseline.P50, candidate.P50},
+		{"Latency p95", baseline.P95, candidate.P95},
+		{"Latency p99", baseline.P99, candidate.P99},
+		{"Latency max", baseline.Max, candidate.Max},
+	}
+	for _, l := range latencies {
+		fmt.Fprintf(w, "%-12s %14v %14v %10s\n", l.name,
+			profiler.FormatDuration(l.baseline), profiler.FormatDuration(l.candidate),
+			relativeChange(float64(l.baseline), float64(l.candidate)))
+	}
+}
+
+func relativeChange(from, to float64) string {
+	if from == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*(to-from)/from)
+}
+
+// defaultResults returns the results file of the last run in this directory, which is
+// compressed if it was run with -compress.
+func defaultResults() string {
+	if _, err := os.Stat(csvFile); os.IsNotExist(err) {
+		if _, err := os.Stat(csvFile + ".gz"); err == nil {
+			return csvFile + ".gz"
+		}
+	}
+	return csvFile
+}
+
+// resultsArgs returns the results files given on the command line, or the default one.
+func resultsArgs(args []string) []string {
+	if len(args) == 0 {
+		return []string{defaultResults()}
+	}
+	return args
+}
+
+// loadResults reads the results files one after the other, e.g. the ones a run with
+// -rotateSize split its results into.
+func loadResults(paths []string) ([]profiler.ExecutionLog, error) {
+	var logs []profiler.ExecutionLog
+	for _, path := range paths {
+		more, err := profiler.LoadResults(path)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, more...)
+	}
+	return logs, nil
+}
+
+func reportMain(argv []string) {
+	fs := newFlagSet("report", "[flags] [results.csv ...]")
+	metaPath := fs.String("meta", metadataFile, "Run metadata file written next to the results")
+	slowestPath := fs.String("slowest", slowestFile, "Slowest requests file written next to the results")
+	out := fs.String("out", "", "File to write the report to (default stdout)")
+	parseFlags(fs, argv)
+	logs, err := loadResults(resultsArgs(fs.Args()))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	// Reports are still useful without metadata, e.g. for merged or older results
+	var metadata *RunMetadata
+	if data, err := os.ReadFile(*metaPath); err == nil {
+		metadata = &RunMetadata{}
+		if err := json.Unmarshal(data, metadata); err != nil {
+			fmt.Println("Error: reading run metadata:", err)
+			os.Exit(1)
+		}
+	}
+
+	// Only runs started by this version keep their slowest requests
+	var slowest []profiler.SlowRequest
+	if data, err := os.ReadFile(*slowestPath); err == nil {
+		if err := json.Unmarshal(data, &slowest); err != nil {
+			fmt.Println("Error: reading slowest requests:", err)
+			os.Exit(1)
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+	writeReport(w, metadata, logs, slowest)
+}
+
+// writeReport writes a Markdown report of a run. metadata may be nil.
+func writeReport(w io.Writer, metadata *RunMetadata, logs []profiler.ExecutionLog, slowest []profiler.SlowRequest) {
+	fmt.Fprintln(w, "# realm-profiler report")
+	fmt.Fprintln(w)
+
+	if metadata != nil {
+		args := metadata.Args
+		fmt.Fprintln(w, "## Run")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Setting | Value |")
+		fmt.Fprintln(w, "|---------|-------|")
+		fmt.Fprintf(w, "| Mode | `%s` |\n", args.Mode)
+		if args.PackageName != "" {
+			fmt.Fprintf(w, "| Package | `%s` |\n", args.PackageName)
+		}
+		if args.FunctionName != "" {
+			fmt.Fprintf(w, "| Function | `%s` |\n", args.FunctionName)
+		}
+		fmt.Fprintf(w, "| Remote | `%s` |\n", args.Remote)
+		fmt.Fprintf(w, "| Threads | %d |\n", args.MaxThreads)
+		fmt.Fprintf(w, "| Queries per second per thread | %d |\n", args.MaxQPS)
+		fmt.Fprintf(w, "| Started | %s |\n", metadata.StartTime.Format(time.RFC3339))
+		fmt.Fprintf(w, "| Ended | %s |\n", metadata.EndTime.Format(time.RFC3339))
+		fmt.Fprintf(w, "| Seed | %d |\n", metadata.Seed)
+		if metadata.Aborted {
+			fmt.Fprintf(w, "| Aborted | %s |\n", metadata.AbortReason)
+		}
+		fmt.Fprintln(w)
+	}
+
+	stats := profiler.Summarize(logs)
+	fmt.Fprintln(w, "## Results")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Metric | Value |")
+	fmt.Fprintln(w, "|--------|-------|")
+	if stats.Warmup > 0 {
+		fmt.Fprintf(w, "| Warm-up requests (excluded) | %d |\n", stats.Warmup)
+	}
+	fmt.Fprintf(w, "| Requests | %d |\n", stats.Requests)
+	fmt.Fprintf(w, "| Failed | %d |\n", stats.Failed)
+	fmt.Fprintf(w, "| Logical failures | %d |\n", stats.Invalid)
+	fmt.Fprintf(w, "| Error rate | %.2f%% |\n", 100*stats.ErrorRate())
+	if stats.Requests > 0 {
+		fmt.Fprintf(w, "| Latency p50 | %s |\n", profiler.FormatDuration(stats.P50))
+		fmt.Fprintf(w, "| Latency p95 | %s |\n", profiler.FormatDuration(stats.P95))
+		fmt.Fprintf(w, "| Latency p99 | %s |\n", profiler.FormatDuration(stats.P99))
+		fmt.Fprintf(w, "| Latency max | %s |\n", profiler.FormatDuration(stats.Max))
+	}
+
+	if stats.Cost.Fee > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Cost")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Mode | Fees (ugnot) | Gas used | Deposited/sent (ugnot) |")
+		fmt.Fprintln(w, "|------|--------------|----------|------------------------|")
+		for _, mode := range slices.Sorted(maps.Keys(stats.Costs)) {
+			c := stats.Costs[mode]
+			fmt.Fprintf(w, "| `%s` | %d | %d | %d |\n", mode, c.Fee, c.GasUsed, c.Sent)
+		}
+		fmt.Fprintf(w, "| Total | %d | %d | %d |\n", stats.Cost.Fee, stats.Cost.GasUsed, stats.Cost.Sent)
+	}
+
+	if metadata != nil && len(metadata.Balances) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Balances")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Account | Before (ugnot) | After (ugnot) | Change | Unexplained by fees and deposits |")
+		fmt.Fprintln(w, "|---------|----------------|---------------|--------|----------------------------------|")
+		for _, b := range metadata.Balances {
+			unexplained := "none"
+			if d := b.Discrepancy(stats.Cost.Fee + stats.Cost.Sent); d != 0 {
+				unexplained = fmt.Sprintf("**%+d**", -d)
+			}
+			fmt.Fprintf(w, "| `%s` | %d | %d | %+d | %s |\n", b.Address, b.Before, b.After, b.After-b.Before, unexplained)
+		}
+	}
+
+	if metadata != nil && metadata.Resources != nil {
+		u := metadata.Resources
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Generator")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "|--------|-------|")
+		if u.Samples > 0 {
+			fmt.Fprintf(w, "| CPU mean | %.0f%% |\n", 100*u.MeanCPU)
+			fmt.Fprintf(w, "| CPU peak | %.0f%% |\n", 100*u.PeakCPU)
+		}
+		fmt.Fprintf(w, "| Peak resident memory | %s |\n", profiler.FormatSize(float64(u.PeakRSS)))
+		if u.Saturated > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "**Warning:** the profiler saturated its machine's CPU in %d of %d samples, so these results may reflect the generator rather than the node.\n", u.Saturated, u.Samples)
+		}
+	}
+
+	if len(stats.Errors) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Errors")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Category | Count |")
+		fmt.Fprintln(w, "|----------|-------|")
+		for _, code := range stats.ErrorCodes() {
+			fmt.Fprintf(w, "| `%s` | %d |\n", code, stats.Errors[code])
+		}
+	}
+
+	steps, byStep := profiler.SummarizeSteps(logs)
+	if len(steps) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Steps")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Step | Requests | Errors | p50 | p95 | p99 |")
+		fmt.Fprintln(w, "|------|----------|--------|-----|-----|-----|")
+		for _, step := range steps {
+			s := byStep[step]
+			fmt.Fprintf(w, "| `%s` | %d | %d | %s | %s | %s |\n", step, s.Requests, s.Failed+s.Invalid,
+				profiler.FormatDuration(s.P50), profiler.FormatDuration(s.P95), profiler.FormatDuration(s.P99))
+		}
+	}
+
+	if len(slowest) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Slowest requests")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| # | Time | Mode | Response time | Height | Error |")
+		fmt.Fprintln(w, "|---|------|------|---------------|--------|-------|")
+		for i, req := range slowest {
+			height := ""
+			if req.Height > 0 {
+				height = strconv.FormatInt(req.Height, 10)
+			}
+			fmt.Fprintf(w, "| %d | %s | `%s` | %v | %s | %s |\n", i+1, req.Timestamp.Format(time.RFC3339), req.Mode, req.ResponseTime, height, req.ErrorCode)
+		}
+		for i, req := range slowest {
+			fmt.Fprintf(w, "\n### %d. %v\n\n```\n%s\n```\n", i+1, req.ResponseTime, strings.TrimRight(req.Output, "\n"))
+		}
+	}
+}
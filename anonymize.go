@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// anonymizeMain writes copies of the files of a run with their addresses, key names,
+// package paths, remotes and chain IDs replaced with pseudonyms, for sharing.
+func anonymizeMain(argv []string) {
+	fs := newFlagSet("anonymize", "[flags] [file ...]")
+	out := fs.String("out", "anonymized", "Directory to write the anonymized copies to")
+	salt := fs.String("salt", "", "Secret the pseudonyms are derived from, to keep them the same across exports (default random)")
+	parseFlags(fs, argv)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		// The files a run writes, those that are there
+		for _, path := range []string{metadataFile, summaryJSON, defaultResults(), slowestFile, summaryFile} {
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			fmt.Println("Error: No results in the current directory. Pass the files to anonymize.")
+			os.Exit(1)
+		}
+	}
+	// Settings first, so that the remotes, chain IDs and key names they name are
+	// recognized in the text of the other files
+	slices.SortStableFunc(paths, func(a, b string) int {
+		return anonymizeOrder(a) - anonymizeOrder(b)
+	})
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	a := profiler.NewAnonymizer(*salt)
+	failed := false
+	for _, path := range paths {
+		dest := filepath.Join(*out, filepath.Base(path))
+		if err := anonymizeFile(a, path, dest); err != nil {
+			fmt.Println("Error:", err)
+			failed = true
+			continue
+		}
+		fmt.Println("INFO: Wrote", dest)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// anonymizeOrder ranks the files with a run's settings first.
+func anonymizeOrder(path string) int {
+	switch {
+	case strings.HasSuffix(path, "_meta.json"), strings.HasSuffix(path, "_summary.json"):
+		return 0
+	case strings.HasSuffix(path, ".csv"), strings.HasSuffix(path, ".csv.gz"):
+		return 1
+	}
+	return 2
+}
+
+// anonymizeFile writes an anonymized copy of the file at path to dest, by its kind:
+// results, metadata, summary or slowest requests, and otherwise text.
+func anonymizeFile(a *profiler.Anonymizer, path, dest string) error {
+	if src, err := filepath.Abs(path); err == nil {
+		if dst, err := filepath.Abs(dest); err == nil && src == dst {
+			return fmt.Errorf("%s would be overwritten. Pass -out another directory.", path)
+		}
+	}
+	if strings.HasSuffix(path, ".csv") || strings.HasSuffix(path, ".csv.gz") {
+		logs, err := profiler.LoadResults(path)
+		if err != nil {
+			return err
+		}
+		a.Logs(logs)
+		results, _, err := profiler.OpenResults(dest, false)
+		if err != nil {
+			return err
+		}
+		if err := results.Flush(logs); err != nil {
+			results.Close()
+			return err
+		}
+		return results.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var v any
+	switch {
+	case strings.HasSuffix(path, "_meta.json"):
+		var metadata RunMetadata
+		err = json.Unmarshal(data, &metadata)
+		anonymizeMetadata(a, &metadata)
+		v = metadata
+	case strings.HasSuffix(path, "_summary.json"):
+		var summary RunSummary
+		err = json.Unmarshal(data, &summary)
+		anonymizeMetadata(a, &summary.Metadata)
+		v = summary
+	case strings.HasSuffix(path, "_slowest.json"):
+		var slowest []profiler.SlowRequest
+		err = json.Unmarshal(data, &slowest)
+		a.SlowRequests(slowest)
+		v = slowest
+	default:
+		return os.WriteFile(dest, []byte(a.Text(string(data))), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if data, err = json.MarshalIndent(v, "", "  "); err != nil {
+		return fmt.Errorf("encoding %s: %w", path, err)
+	}
+	return os.WriteFile(dest, data, 0o644)
+}
+
+// anonymizeMetadata anonymizes the settings and balances of a run.
+func anonymizeMetadata(a *profiler.Anonymizer, metadata *RunMetadata) {
+	a.Config(&metadata.Args)
+	for i := range metadata.Balances {
+		metadata.Balances[i].Address = a.Address(metadata.Balances[i].Address)
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// command is a realm-profiler subcommand. Each one parses its own flags from argv.
+type command struct {
+	name    string
+	summary string
+	main    func(argv []string)
+}
+
+func commandList() []command {
+	return []command{
+		{"run", "Generate load against a node and record response times (the default)", runMain},
+		{"init", "Ask for a remote, key and workload and write a config file for a first benchmark", initMain},
+		{"calibrate", "Measure the overhead of spawning a command, to pass to run -overhead", calibrateMain},
+		{"suite", "Run each mode for a fixed time and print a scorecard comparing them", suiteMain},
+		{"contention", "Read a realm alone and then while writing to it, and print how much the writes slow the reads", contentionMain},
+		{"validate", "Check the settings of a run, its remotes and keys, reporting every problem", validateMain},
+		{"setup", "Deploy packages for later runs to target, recording them in a manifest", setupMain},
+		{"analyze", "Print the summary of a results file", analyzeMain},
+		{"compare", "Compare the summaries of two results files", compareMain},
+		{"report", "Write a Markdown report of a run from its results and metadata", reportMain},
+		{"anonymize", "Copy the files of a run with addresses, keys and package paths replaced, for sharing", anonymizeMain},
+		{"grafana", "Write a Grafana dashboard for the metrics a run sends", grafanaMain},
+	}
+}
+
+func runCommand(name string, argv []string) {
+	for _, c := range commandList() {
+		if c.name == name {
+			c.main(argv)
+			return
+		}
+	}
+	if name != "help" {
+		fmt.Printf("Error: unknown command %q\n\n", name)
+	}
+	printUsage()
+	if name != "help" {
+		os.Exit(2)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: realm-profiler [command] [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, c := range commandList() {
+		fmt.Printf("  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Println()
+	fmt.Println("Run realm-profiler <command> -h for the flags of a command.")
+	fmt.Println("Flags can also be set with environment variables, e.g. " + envName("maxThreads") + "=4, and the")
+	fmt.Println("gnokey password with " + passwordEnv + ".")
+}
+
+// envPrefix starts the name of the environment variable setting each flag, see envName.
+const envPrefix = "REALM_PROFILER_"
+
+// passwordEnv holds the gnokey password, instead of piping it to stdin.
+const passwordEnv = envPrefix + "PASSWORD"
+
+// envName returns the environment variable setting the flag name, e.g.
+// REALM_PROFILER_MAX_THREADS for -maxThreads and REALM_PROFILER_NO_COLOR for -no-color.
+func envName(name string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, c := range name {
+		if c == '-' {
+			c = '_'
+		} else if i > 0 && c >= 'A' && c <= 'Z' && !(name[i-1] >= 'A' && name[i-1] <= 'Z') {
+			b.WriteByte('_')
+		}
+		b.WriteRune(c)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// parseFlags parses argv, then sets the flags it didn't give from their environment
+// variables, so that containers can be configured without a wrapper script, and then
+// the ones still unset from the -config file. Repeatable flags only get one value from
+// the environment.
+func parseFlags(fs *flag.FlagSet, argv []string) {
+	exitOnErrors(flagErrors(fs, argv))
+}
+
+// flagErrors is parseFlags returning every problem with the environment and the -config
+// file instead of exiting.
+func flagErrors(fs *flag.FlagSet, argv []string) []error {
+	fs.Parse(argv)
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", envName(f.Name), err))
+		}
+		given[f.Name] = true
+	})
+	if path := fs.Lookup("config").Value.String(); path != "" {
+		errs = append(errs, applyConfig(fs, path, given)...)
+	}
+	return errs
+}
+
+// newFlagSet returns the flag set of a subcommand, with the -config every subcommand
+// takes.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: realm-profiler %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	fs.String("config", "", "YAML file of flag values, e.g. 'maxThreads: 4', for the flags not given on the command line or in the environment")
+	return fs
+}
+
+// nodeFlags are the flags saying which node to talk to and as whom.
+func nodeFlags(fs *flag.FlagSet, args *profiler.Config) {
+	fs.StringVar(&args.Remote, "remote", args.Remote, "Remote endpoint, or the name of a public network to use its endpoint and chain ID: "+strings.Join(profiler.RemoteNames(), ", "))
+	fs.StringVar(&args.KeyName, "keyname", args.KeyName, "Key name")
+	fs.Int64Var(&args.GasWanted, "gasWanted", args.GasWanted, "Gas wanted by every transaction, unless estimated")
+	fs.StringVar(&args.GasEstimate, "gasEstimate", args.GasEstimate, "Set gas wanted by simulating transactions first: off, once per function or package directory, or each transaction")
+	fs.Float64Var(&args.GasAdjustment, "gasAdjustment", args.GasAdjustment, "Multiply the simulated gas by this to get gas wanted")
+	fs.Int64Var(&args.GasFee, "gasFee", args.GasFee, "Gas fee in ugnot offered by every transaction")
+	fs.Var(rangeFlag{&args.FuzzGasWanted}, "fuzzGasWanted", "Pick gas wanted per transaction at random in this range, e.g. 1000-2000000, to include insufficient values")
+	fs.Var(rangeFlag{&args.FuzzGasFee}, "fuzzGasFee", "Pick the gas fee in ugnot per transaction at random in this range, e.g. 1-10000000")
+	fs.StringVar(&args.Memo, "memo", args.Memo, "Memo attached to every transaction, to find them on-chain; $run, $request and $mode are expanded, e.g. 'realm-profiler $run #$request'")
+	fs.StringVar(&args.Home, "home", args.Home, "gnokey home directory holding the keybase (default gnokey's own)")
+	fs.StringVar(&args.Keybase, "keybase", args.Keybase, "How concurrent transactions use the keybase: shared by every gnokey process, serialize signing to one at a time, or copy the home for each worker thread at startup (one of "+strings.Join(profiler.Keybases, ", ")+")")
+	fs.StringVar(&args.Address, "address", args.Address, "Address of the key, for checking its balance (default: looked up with gnokey list)")
+	fs.StringVar(&args.BalanceCheck, "balanceCheck", args.BalanceCheck, "Before transactional runs, compare the key's balance with the estimated fees and warn, abort if they aren't covered, or skip the check (one of "+strings.Join(profiler.BalanceChecks, ", ")+")")
+	fs.StringVar(&args.ChainID, "chainid", args.ChainID, "Chain ID")
+}
+
+// packageFlags are the flags choosing what addpkg deploys and under which name.
+func packageFlags(fs *flag.FlagSet, args *profiler.Config) {
+	fs.StringVar(&args.PkgDir, "pkgdir", args.PkgDir, "Package directory")
+	fs.StringVar(&args.Deposit, "deposit", args.Deposit, "Storage deposit of every addpkg, e.g. 1000000ugnot, for chains that require one")
+	fs.StringVar(&args.PkgPrefix, "pkgPrefix", args.PkgPrefix, "Prefix for generated package names, e.g. loadtest_")
+	fs.StringVar(&args.Namespace, "namespace", args.Namespace, "Namespace generated package paths are created under, e.g. r/, p/ or r/<user>/")
+	fs.IntVar(&args.NameLength, "nameLength", args.NameLength, "Length of the random part of generated package names")
+	fs.BoolVar(&args.WorkerPrefix, "workerPrefix", args.WorkerPrefix, "Give the package names of each worker thread a prefix of its own, e.g. w3_, so concurrent deploys never race on the same path")
+	fs.StringVar(&args.NamesFile, "namesFile", args.NamesFile, "File of the package paths generated by earlier runs, which are not reused and to which new ones are added")
+	fs.BoolVar(&args.Generate, "generate", args.Generate, "Deploy a freshly generated synthetic package instead of pkgdir")
+	fs.IntVar(&args.GenFuncs, "genFuncs", args.GenFuncs, "Number of functions in generated packages")
+	fs.IntVar(&args.GenSize, "genSize", args.GenSize, "Pad generated packages with comments up to this many bytes of source")
+	fs.Var(rangeFlag{&args.GenSizeRange}, "genSizeRange", "Pad each generated package to a random size in this range of bytes instead, e.g. 1000-2000000, to find how large a package can be deployed")
+	fs.IntVar(&args.GenImports, "genImports", args.GenImports, fmt.Sprintf("Number of standard library packages generated packages import (max %d)", profiler.MaxGenImports))
+	fs.StringVar(&args.Workload, "workload", args.Workload, "Deploy a built-in realm instead of pkgdir: "+strings.Join(profiler.WorkloadNames(), ", "))
+}
+
+// loadFlags are the flags shaping how much load is generated, when, and how results are
+// kept.
+func loadFlags(fs *flag.FlagSet, args *profiler.Config) {
+	fs.IntVar(&args.MaxThreads, "maxThreads", args.MaxThreads, "Max number of simultaneous threads")
+	fs.IntVar(&args.MaxQPS, "maxQueriesPerSec", args.MaxQPS, "Max queries per second per thread")
+	fs.Var(warmupFlag{&args.WarmupDuration, &args.WarmupRequests}, "warmup", "Warm-up period excluded from the summary, as a duration (30s) or a number of requests (100)")
+	fs.DurationVar(&args.ThinkTime, "thinkTime", args.ThinkTime, "Pause between each worker's requests, e.g. 2s")
+	fs.StringVar(&args.ThinkDist, "thinkDist", args.ThinkDist, "Distribution of think time around its mean: "+strings.Join(profiler.ThinkDistributions, ", "))
+	fs.StringVar(&args.Arrival, "arrival", args.Arrival, "Request arrival process: fixed (up to maxQueriesPerSec each second) or poisson (random gaps averaging maxQueriesPerSec)")
+	fs.StringVar(&args.Shape, "shape", args.Shape, "Load shape: steady, spike (short peaks every period), sine (smooth wave) or burst (peaks at random times)")
+	fs.DurationVar(&args.ShapePeriod, "shapePeriod", args.ShapePeriod, "Period of the load shape")
+	fs.Float64Var(&args.ShapeFactor, "shapeFactor", args.ShapeFactor, "Peak rate of the load shape as a multiple of maxQueriesPerSec")
+	fs.IntVar(&args.StartThreads, "startThreads", args.StartThreads, "Number of threads to start with when ramping up to maxThreads (default maxThreads, or 1 with rampStep)")
+	fs.IntVar(&args.RampStep, "rampStep", args.RampStep, "Threads to add every rampInterval until maxThreads are running (0 starts them all at once)")
+	fs.DurationVar(&args.RampInterval, "rampInterval", args.RampInterval, "How often to add rampStep threads")
+	fs.DurationVar(&args.Duration, "duration", args.Duration, "Stop the run after this long, e.g. 10m (0 runs until interrupted)")
+	fs.IntVar(&args.MaxRequests, "maxRequests", args.MaxRequests, "Stop the run once this many requests have completed; requests in flight still finish (0 sends until -duration or interrupted)")
+	fs.IntVar(&args.MaxInflight, "maxInflight", args.MaxInflight, "Requests in flight at once across all worker threads; in replay mode, later requests wait for one to complete (0 is unlimited)")
+	fs.IntVar(&args.MaxProcs, "maxProcs", args.MaxProcs, "gnokey subprocesses running at once with the exec backend; further requests queue for one, which the QueueWait column and the summary report (0 is unlimited)")
+	fs.Float64Var(&args.AbortErrorRate, "abortErrorRate", args.AbortErrorRate, fmt.Sprintf("Stop the run when this fraction of the last %d requests failed, e.g. 0.5 (0 disables)", profiler.AbortWindow))
+	fs.IntVar(&args.AbortConsecutiveErrors, "abortConsecutiveErrors", args.AbortConsecutiveErrors, "Stop the run after this many failed requests in a row (0 disables)")
+	fs.Float64Var(&args.SpikeThreshold, "spikeThreshold", args.SpikeThreshold, fmt.Sprintf("Warn about responses this many median absolute deviations slower than the median of the last %d (0 disables)", profiler.AnomalyWindow))
+	fs.Float64Var(&args.ErrorBurst, "errorBurst", args.ErrorBurst, fmt.Sprintf("Warn when this fraction of the last %d requests failed (0 disables)", profiler.AnomalyWindow))
+	fs.Float64Var(&args.BackoffErrorRate, "backoffErrorRate", args.BackoffErrorRate, fmt.Sprintf("Slow down when this fraction of the last %d requests timed out, were refused or found the mempool full, e.g. 0.2, and speed back up once under half of it (0 disables)", profiler.BackoffWindow))
+	fs.Float64Var(&args.BackoffFactor, "backoffFactor", args.BackoffFactor, "Scale the target rate by this much each time -backoffErrorRate is reached, and by its inverse on recovery")
+	fs.DurationVar(&args.StateInterval, "stateInterval", args.StateInterval, "Sample the chain's height and transaction count this often, e.g. 1m, to report transaction latency as the state grows in soak runs (0 disables)")
+	fs.DurationVar(&args.RequestTimeout, "requestTimeout", args.RequestTimeout, "Give up on a request after this long and record it as a timeout, e.g. 5s (0 waits as long as gnokey or the RPC client does)")
+	fs.Var((*stringList)(&args.Webhooks), "webhook", "URL to post a JSON alert to, e.g. a Slack incoming webhook, when an -alert threshold is crossed, the run aborts or an -assert fails (repeatable)")
+	fs.Float64Var(&args.AlertErrorRate, "alertErrorRate", args.AlertErrorRate, fmt.Sprintf("Alert when this fraction of the last %d requests failed, e.g. 0.1, and again when it recovers (0 disables)", profiler.AlertWindow))
+	fs.DurationVar(&args.AlertLatency, "alertLatency", args.AlertLatency, fmt.Sprintf("Alert when the p95 of the last %d requests reaches this, e.g. 2s, and again when it recovers (0 disables)", profiler.AlertWindow))
+	fs.StringVar(&args.StatsdAddr, "statsd", args.StatsdAddr, "Send a timing and counters for every request to this statsd server over UDP, e.g. localhost:8125")
+	fs.StringVar(&args.StatsdPrefix, "statsdPrefix", args.StatsdPrefix, "Prefix of the -statsd metric names")
+	fs.DurationVar(&args.Checkpoint, "checkpoint", args.Checkpoint, "Flush results and an intermediate summary to disk this often, e.g. 1m (0 only saves at the end)")
+	fs.IntVar(&args.CheckpointRequests, "checkpointRequests", args.CheckpointRequests, "Also flush results every this many requests (0 disables)")
+	fs.BoolVar(&args.Resume, "resume", args.Resume, "Append to the existing results file instead of overwriting it, e.g. after a crash")
+	fs.Var(byteSizeFlag{&args.RotateSize}, "rotateSize", "Start a new results file (pc_profiler-0001.csv, ...) and capture subdirectory after this much, e.g. 500MB (0 disables)")
+	fs.DurationVar(&args.RotateEvery, "rotateEvery", args.RotateEvery, "Also start a new results file and capture subdirectory this often, e.g. 24h (0 disables)")
+	fs.BoolVar(&args.Compress, "compress", args.Compress, "Gzip the results file as it is written (pc_profiler.csv.gz)")
+	fs.Float64Var(&args.Malformed, "malformed", args.Malformed, "Fraction of requests to break on purpose, e.g. 0.05, with a bad pkgpath, a nonexistent function or the wrong chain ID, to check the node rejects them and stays healthy")
+	fs.Float64Var(&args.SampleRate, "sampleRate", args.SampleRate, "Fraction of requests to keep in the results file, e.g. 0.01 at very high QPS (the summary still counts every request)")
+	fs.IntVar(&args.MaxSamples, "maxSamples", args.MaxSamples, "Keep at most this many samples in memory, writing the older half to the results file and dropping it when reached (0 keeps them all)")
+	fs.Var(byteSizeFlag{&args.MemoryLimit}, "memoryLimit", "Warn when the profiler's resident memory reaches 80% of this, e.g. 2GB, and stop keeping samples in memory once it is crossed (0 disables)")
+	fs.IntVar(&args.Reservoir, "reservoir", args.Reservoir, "Keep at most this many samples, chosen uniformly at random over the whole run (0 keeps them all)")
+	fs.IntVar(&args.Slowest, "slowest", args.Slowest, "Keep the full command and output of this many of the slowest requests for the report")
+	fs.StringVar(&args.CaptureDir, "captureDir", args.CaptureDir, "Write the full stdout/stderr of every request to its own file in this directory")
+}
+
+func runMain(argv []string) {
+	args, preset, err := presetConfig(argv)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	var opts runOptions
+	fs := newFlagSet("run", "[flags]")
+	agentAddr, pprofAddr := runFlags(fs, &args, &opts, preset)
+	parseFlags(fs, argv)
+	if err := loadModes(opts); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if *pprofAddr != "" {
+		go servePprof(*pprofAddr)
+	}
+	// Agents get everything else from the controller
+	if *agentAddr != "" {
+		if err := profiler.ServeAgent(*agentAddr, readPassword(), opts.AgentSecret); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	args.Normalize()
+	if opts.Repeat != "" {
+		validateArgs(args, opts)
+		repeatRuns(argv, args, opts)
+		return
+	}
+	startRun(args, opts)
+}
+
+// presetConfig returns the defaults of the run flags, from the -profile preset in argv
+// or the environment if there is one. Flag defaults are taken from the config, so the
+// preset has to be applied before the flags are defined for the ones given on the
+// command line to override it.
+func presetConfig(argv []string) (profiler.Config, string, error) {
+	args := profiler.DefaultConfig()
+	preset := presetArg(argv)
+	if preset == "" {
+		preset = os.Getenv(envName("profile"))
+	}
+	if preset != "" {
+		if err := profiler.ApplyPreset(&args, preset); err != nil {
+			return args, preset, err
+		}
+	}
+	return args, preset, nil
+}
+
+// runFlags defines the flags of run, returning those that aren't part of args or opts.
+func runFlags(fs *flag.FlagSet, args *profiler.Config, opts *runOptions, preset string) (agentAddr, pprofAddr *string) {
+	fs.String("profile", preset, "Preset durations, rates and assertions to start from: "+presetUsage())
+	fs.StringVar(&args.Mode, "mode", args.Mode, "Mode: addpkg, addpkg+call, call, run, balanceQuery, qrender, qdoc, custom, verify, journey, script or replay, or one added by -modeFile or -plugin")
+	fs.StringVar(&opts.ModeFile, "modeFile", "", "File of extra modes, one \"name: command template\" per line, e.g. \"qeval: gnokey query vm/qeval --data '{{.Package}}.Count()' --remote {{.Remote}}\"")
+	fs.Var((*stringList)(&opts.Plugins), "plugin", "Go plugin (.so) to load, whose init registers extra modes with profiler.RegisterMode (repeatable)")
+	fs.StringVar(&args.RunFile, "runFile", args.RunFile, "Gno script for run mode to execute with gnokey maketx run")
+	fs.StringVar(&args.PackageName, "package", args.PackageName, "Package name (required for addpkg mode or qrender and qdoc modes)")
+	fs.StringVar(&args.FunctionName, "function", args.FunctionName, "Function name (required for call modes)")
+	fs.StringVar(&args.RenderPath, "renderPath", args.RenderPath, "Path to pass to the realm's Render in qrender mode, e.g. \"page/2\"")
+	fs.BoolVar(&args.CacheProbe, "cacheProbe", args.CacheProbe, "In qrender mode, vary the render path of half the requests with a random query parameter, to compare repeated queries with ones no cache has seen")
+	fs.StringVar(&args.Command, "command", args.Command, "Command custom mode runs, a Go template of {{.Package}}, {{.Function}}, {{.Remote}}, {{.ChainID}}, {{.KeyName}}, {{.Render}} and {{.RandString 8}}, e.g. \"gnokey query vm/qrender --data '{{.Package}}:{{.RandString 8}}' --remote {{.Remote}}\"")
+	fs.StringVar(&args.Send, "send", args.Send, "Coins to attach to every call, e.g. 100ugnot, for payable functions")
+	fs.BoolVar(&args.FuzzArgs, "fuzzArgs", args.FuzzArgs, "Call -function, or a random function of the realm if it is empty, with random arguments of the types it takes")
+	fs.IntVar(&args.FuzzArgSize, "fuzzArgSize", args.FuzzArgSize, "Maximum bytes of each random string argument with -fuzzArgs")
+	fs.StringVar(&args.Backend, "backend", args.Backend, "Backend: exec (gnokey subprocess) or rpc (direct JSON-RPC, query modes only)")
+	fs.DurationVar(&args.Overhead, "overhead", args.Overhead, "Subprocess overhead (as measured by the calibrate command) to subtract from each gnokey command's response time")
+	fs.StringVar(&args.ManifestFile, "manifest", args.ManifestFile, "File to record successfully deployed package paths in (addpkg modes)")
+	fs.StringVar(&args.TargetsFile, "targets", args.TargetsFile, "File of package paths (and optionally functions) for call/qrender/qdoc modes to spread load over, e.g. a manifest from setup or an earlier run")
+	fs.StringVar(&args.TargetOrder, "targetOrder", args.TargetOrder, "Order targets are used in: roundrobin or random")
+	fs.Var((*commaList)(&args.Steps), "steps", "Comma-separated steps each virtual user runs in order in journey mode, e.g. addpkg,call,qrender,balanceQuery")
+	fs.Var((*commaList)(&args.Remotes), "remotes", "Comma-separated remotes to spread requests over in turn instead of -remote, e.g. replicas behind a load balancer, breaking the summary down by endpoint")
+	fs.Var((*chainList)(&args.Chains), "chain", "Profile this chain at the same time as the others, as remote[,chainid[,key[,qps]]], e.g. test5,,loadtest,2; empty fields default to the other flags (repeatable, requires -duration)")
+	fs.StringVar(&args.CompareRemote, "compareRemote", args.CompareRemote, "Send every request to this remote too, at the same time, and compare the two at the end (A/B run)")
+	fs.StringVar(&args.Record, "record", args.Record, "Save every request sent and when to this schedule file, for replay mode")
+	fs.StringVar(&args.Schedule, "schedule", args.Schedule, "Schedule written by -record to resend with the same timing (replay mode)")
+	fs.StringVar(&args.Script, "script", args.Script, "Script of requests each worker runs per iteration (script mode)")
+	fs.IntVar(&args.VerifyCount, "verifyCount", args.VerifyCount, "Number of increments to send in verify mode")
+	fs.Var((*stringList)(&args.Expect), "expect", "Substring every response must contain, optionally scoped to a mode as mode=substring (repeatable)")
+	fs.Var((*stringList)(&args.Extract), "extract", "Number to parse from every response into the Fields column and summary, as name:regex whose first group (or whole match) is the number, optionally scoped to a mode as mode=name:regex, e.g. call=events:(\\d+) events (repeatable)")
+	fs.Var((*stringList)(&args.ExpectRegex), "expectRegex", "Regular expression every response must match, optionally scoped to a mode as mode=regex (repeatable)")
+	nodeFlags(fs, args)
+	packageFlags(fs, args)
+	loadFlags(fs, args)
+	agentAddr = fs.String("agent", "", "Run as an agent listening on this address for runs sent by a controller, e.g. 0.0.0.0:7070 (without a host, only on localhost)")
+	fs.StringVar(&opts.AgentSecret, "agentSecret", "", "Secret shared by agents and their controller, required by both; best set as "+envName("agentSecret"))
+	fs.Var((*commaList)(&opts.Agents), "agents", "Comma-separated agent addresses to fan this run out to as a controller (requires -duration)")
+	fs.StringVar(&opts.ControlAddr, "controlAddr", "", "Serve the HTTP control API (change QPS, pause/resume, dump stats) on this address, e.g. :8080 (without a host, only on 127.0.0.1)")
+	fs.StringVar(&opts.ControlSecret, "controlSecret", "", "Secret the control API requires as a bearer token, required with -controlAddr; best set as "+envName("controlSecret"))
+	pprofAddr = fs.String("pprof", "", "Serve Go pprof profiles of the profiler itself on this address, e.g. localhost:6060, to find out why it can't keep up")
+	fs.Int64Var(&opts.Seed, "seed", 0, "Random seed for generated package names (0 picks one from the clock)")
+	fs.BoolVar(&opts.Progress, "progress", true, "Show a progress bar with the ETA on stderr in runs with -duration or -maxRequests")
+	fs.BoolVar(&opts.Silent, "silent", false, "Print nothing while the run goes, only a line with its totals at the end, e.g. for scripts and cron jobs (errors setting it up are still printed)")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "Print the summary without colors, e.g. for logs (also when stdout isn't a terminal or NO_COLOR is set)")
+	fs.BoolVar(&opts.DryRun, "dryRun", false, "Print the command (or RPC request) each request would run with these flags, then exit without executing anything")
+	timeSeriesFlags(fs, &opts.TimeSeries)
+	parquetFlag(fs, &opts.Parquet)
+	fs.BoolVar(&opts.SplitModes, "splitModes", false, "Also write the results of each mode to its own file, e.g. pc_profiler_call.csv and pc_profiler_qrender.csv")
+	fs.StringVar(&opts.Pushgateway, "pushgateway", "", "Push the summary metrics to this Prometheus Pushgateway at the end, e.g. http://pushgateway:9091, for CI jobs too short to scrape")
+	fs.StringVar(&opts.PushJob, "pushJob", "realm_profiler", "Job label of the metrics pushed to -pushgateway")
+	fs.Var((*stringList)(&opts.PushLabels), "pushLabel", "Grouping label of the metrics pushed to -pushgateway as name=value, e.g. branch=main, on top of mode and remote (repeatable)")
+	fs.StringVar(&opts.Repeat, "repeat", "", "Run again on this schedule until interrupted, appending the results to "+historyFile+" with a RunID: an interval such as 1h or a cron expression such as \"0 * * * *\" (requires -duration)")
+	assertFlags(fs, args, opts)
+	return agentAddr, pprofAddr
+}
+
+func calibrateMain(argv []string) {
+	args := profiler.DefaultConfig()
+	var opts runOptions
+	fs := newFlagSet("calibrate", "[flags]")
+	fs.StringVar(&args.CalibrateCmd, "cmd", args.CalibrateCmd, "No-op command to time, e.g. 'gnokey --help'")
+	loadFlags(fs, &args)
+	timeSeriesFlags(fs, &opts.TimeSeries)
+	parquetFlag(fs, &opts.Parquet)
+	assertFlags(fs, &args, &opts)
+	parseFlags(fs, argv)
+
+	args.Mode = "calibrate"
+	args.Normalize()
+	startRun(args, opts)
+}
+
+// presetArg returns the value of the last -profile in argv, if any.
+func presetArg(argv []string) string {
+	preset := ""
+	for i, arg := range argv {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "profile" {
+			continue
+		}
+		if hasValue {
+			preset = value
+		} else if i+1 < len(argv) {
+			preset = argv[i+1]
+		}
+	}
+	return preset
+}
+
+func presetUsage() string {
+	var presets []string
+	for _, name := range profiler.PresetNames() {
+		presets = append(presets, fmt.Sprintf("%s (%s)", name, profiler.PresetSummary(name)))
+	}
+	return strings.Join(presets, "; ")
+}
+
+// assertFlags are the flags checking a run against SLAs, e.g. in CI.
+func assertFlags(fs *flag.FlagSet, args *profiler.Config, opts *runOptions) {
+	fs.Var((*stringList)(&args.Assert), "assert", "SLA the run must meet or exit non-zero, e.g. p95<500ms or errorRate<1% (repeatable; metrics: "+strings.Join(profiler.AssertionMetrics, ", ")+")")
+	fs.StringVar(&opts.JUnit, "junit", "", "Write the run and each assertion as test cases to this JUnit XML file, for CI systems")
+}
+
+func parquetFlag(fs *flag.FlagSet, path *string) {
+	fs.StringVar(path, "parquet", "", "Also write the results to this Parquet file, for DuckDB, pandas or Spark")
+}
+
+// timeSeriesOptions ask for an aggregated time series of the results to be written.
+type timeSeriesOptions struct {
+	Path   string
+	Bucket time.Duration
+}
+
+func timeSeriesFlags(fs *flag.FlagSet, opts *timeSeriesOptions) {
+	fs.StringVar(&opts.Path, "timeseries", "", "Also write achieved QPS, errors and latency percentiles per bucket to this CSV file, for plotting long runs")
+	fs.DurationVar(&opts.Bucket, "bucket", time.Second, "Width of each time series bucket")
+}
+
+// save writes the time series of logs if one was asked for.
+func (opts timeSeriesOptions) save(logs []profiler.ExecutionLog) {
+	if opts.Path == "" {
+		return
+	}
+	file, err := os.Create(opts.Path)
+	if err != nil {
+		fmt.Println("Failed to create time series file:", err)
+		return
+	}
+	defer file.Close()
+	if err := profiler.WriteTimeSeries(file, logs, opts.Bucket); err != nil {
+		fmt.Println("Failed to write time series:", err)
+	}
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// chainList is a flag.Value collecting every -chain.
+type chainList []profiler.Chain
+
+func (l *chainList) String() string {
+	var chains []string
+	for _, c := range *l {
+		chains = append(chains, c.String())
+	}
+	return strings.Join(chains, " ")
+}
+
+func (l *chainList) Set(v string) error {
+	c, err := profiler.ParseChain(v)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, c)
+	return nil
+}
+
+// commaList is a flag.Value holding a comma-separated list.
+type commaList []string
+
+func (l *commaList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *commaList) Set(v string) error {
+	*l = strings.Split(v, ",")
+	return nil
+}
+
+// byteSizeFlag accepts a number of bytes with an optional KB, MB or GB suffix.
+type byteSizeFlag struct {
+	size *int64
+}
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+func (f byteSizeFlag) String() string {
+	if f.size == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*f.size, 10)
+}
+
+func (f byteSizeFlag) Set(v string) error {
+	unit := int64(1)
+	upper := strings.ToUpper(v)
+	for _, u := range byteSizeUnits {
+		if number, ok := strings.CutSuffix(upper, u.suffix); ok {
+			upper, unit = number, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n < 0 {
+		return errors.New("size must be a number of bytes like 500MB")
+	}
+	*f.size = n * unit
+	return nil
+}
+
+// rangeFlag accepts a range like 1000-2000000.
+type rangeFlag struct {
+	rg *profiler.Range
+}
+
+func (f rangeFlag) String() string {
+	if f.rg == nil {
+		return ""
+	}
+	return f.rg.String()
+}
+
+func (f rangeFlag) Set(v string) error {
+	rg, err := profiler.ParseRange(v)
+	if err != nil {
+		return err
+	}
+	*f.rg = rg
+	return nil
+}
+
+// warmupFlag accepts either a duration ("30s") or a number of requests ("100").
+type warmupFlag struct {
+	duration *time.Duration
+	requests *int
+}
+
+func (f warmupFlag) String() string {
+	if f.requests != nil && *f.requests > 0 {
+		return strconv.Itoa(*f.requests)
+	}
+	if f.duration != nil && *f.duration > 0 {
+		return f.duration.String()
+	}
+	return "0"
+}
+
+func (f warmupFlag) Set(v string) error {
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 {
+			return errors.New("warmup cannot be negative")
+		}
+		*f.requests = n
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return errors.New("warmup must be a duration like 30s or a number of requests")
+	}
+	if d < 0 {
+		return errors.New("warmup cannot be negative")
+	}
+	*f.duration = d
+	return nil
+}
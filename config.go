@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configEntry is one flag set by a config file, with every value of a list.
+type configEntry struct {
+	line   int
+	name   string
+	values []string
+}
+
+// readConfig reads a config file of flag values: the subset of YAML made of top-level
+// name: value pairs, with lists as [a, b] or as indented "- item" lines, e.g.
+//
+//	mode: call
+//	maxThreads: 4
+//	expect:
+//	  - OK!
+func readConfig(path string) ([]configEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []configEntry
+	inList := false // the last name had no value, so list items may follow
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(stripComment(scanner.Text()), " \t")
+		trimmed := strings.TrimLeft(text, " \t")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if text != trimmed {
+			item, ok := strings.CutPrefix(trimmed, "-")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: nested mappings are not supported", path, line)
+			}
+			if !inList {
+				return nil, fmt.Errorf("%s:%d: list item without a name", path, line)
+			}
+			value, err := configScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			entries[len(entries)-1].values = append(entries[len(entries)-1].values, value)
+			continue
+		}
+
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected name: value", path, line)
+		}
+		entry := configEntry{line: line, name: name}
+		value = strings.TrimSpace(value)
+		inList = value == ""
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				if item, err = configScalar(item); err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+				}
+				entry.values = append(entry.values, item)
+			}
+		} else if !inList {
+			if value, err = configScalar(value); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			entry.values = []string{value}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// stripComment removes a # comment from line, unless the # is quoted or part of a word.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// configScalar returns the value of a plain, single-quoted or double-quoted scalar.
+func configScalar(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		return value, nil
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// applyConfig sets the flags of fs named in the config file at path, except those in
+// skip, which were given more directly. Lists set repeatable flags once per item, and
+// comma-separated ones to all the items. It returns every problem with the file.
+func applyConfig(fs *flag.FlagSet, path string, skip map[string]bool) []error {
+	entries, err := readConfig(path)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range entries {
+		f := fs.Lookup(e.name)
+		switch {
+		case f == nil:
+			errs = append(errs, fmt.Errorf("%s:%d: unknown flag %q", path, e.line, e.name))
+			continue
+		case e.name == "config" || e.name == "profile":
+			errs = append(errs, fmt.Errorf("%s:%d: %s can only be given on the command line", path, e.line, e.name))
+			continue
+		case skip[e.name]:
+			continue
+		}
+		values := e.values
+		if _, ok := f.Value.(*commaList); ok {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := fs.Set(e.name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: invalid %s: %w", path, e.line, e.name, err))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// writeConfig writes entries as a config file readConfig reads back.
+func writeConfig(path string, entries []configEntry) error {
+	var b strings.Builder
+	for _, e := range entries {
+		if len(e.values) == 1 {
+			fmt.Fprintf(&b, "%s: %s\n", e.name, configQuote(e.values[0]))
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", e.name)
+		for _, value := range e.values {
+			fmt.Fprintf(&b, "  - %s\n", configQuote(value))
+		}
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// configQuote quotes s if it would otherwise read back differently.
+func configQuote(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], `"'[-`) || strings.Contains(s, " #") {
+		return strconv.Quote(s)
+	}
+	return s
+}
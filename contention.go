@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// contentionMain reads a realm with qrender alone and then while calls write to it, at
+// independent rates, and prints how much the writes slowed the reads down.
+func contentionMain(argv []string) {
+	args := profiler.DefaultConfig()
+	args.Duration = 30 * time.Second
+	rates := profiler.ContentionRates{ReadThreads: 1, ReadQPS: 10, WriteThreads: 1, WriteQPS: 1}
+	fs := newFlagSet("contention", "[flags]")
+	fs.StringVar(&args.PackageName, "package", args.PackageName, "Realm to read with qrender and write to with calls")
+	fs.StringVar(&args.FunctionName, "function", args.FunctionName, "Function writing to the realm to call")
+	fs.StringVar(&args.RenderPath, "renderPath", args.RenderPath, "Path to pass to the realm's Render")
+	fs.IntVar(&rates.ReadThreads, "readThreads", rates.ReadThreads, "Number of threads reading")
+	fs.IntVar(&rates.ReadQPS, "readQPS", rates.ReadQPS, "Max reads per second per thread")
+	fs.IntVar(&rates.WriteThreads, "writeThreads", rates.WriteThreads, "Number of threads writing")
+	fs.IntVar(&rates.WriteQPS, "writeQPS", rates.WriteQPS, "Max calls per second per thread")
+	fs.DurationVar(&args.Duration, "duration", args.Duration, "How long to read alone, and then to read and write")
+	seed := fs.Int64("seed", 0, "Random seed (0 picks one from the clock)")
+	nodeFlags(fs, &args)
+	parseFlags(fs, argv)
+
+	args.Normalize()
+	if args.Duration <= 0 {
+		fmt.Println("Error: duration must be positive.")
+		os.Exit(1)
+	}
+	if args.PackageName == "" || args.FunctionName == "" {
+		fmt.Println("Error: package and function are required.")
+		os.Exit(1)
+	}
+	reads, writes := profiler.ContentionArgs(args, rates)
+	exitOnErrors(append(reads.Validate(), writes.Validate()...))
+	useSeed(*seed)
+
+	stop := make(chan struct{})
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalChan
+		fmt.Println("\nStopping the experiment...")
+		close(stop)
+	}()
+
+	readLogs, writeLogs, err := profiler.RunContention(args, rates, readPassword(), stop)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+	results, _, ferr := profiler.OpenResults(csvFile, false)
+	if ferr == nil {
+		ferr = results.Flush(append(readLogs, writeLogs...))
+		results.Close()
+	}
+	if ferr != nil {
+		fmt.Println("Failed to write CSV file:", ferr)
+	}
+	fmt.Println()
+	profiler.WriteContention(os.Stdout, profiler.SummarizeContention(readLogs, writeLogs))
+	if err != nil {
+		os.Exit(1)
+	}
+}
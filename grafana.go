@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// grafanaMain writes a Grafana dashboard for the metrics a run sends, taking the
+// datasource from its -pushgateway or -statsd flags, e.g. from the same -config file.
+func grafanaMain(argv []string) {
+	args, preset, err := presetConfig(argv)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	var opts runOptions
+	fs := newFlagSet("grafana", "[-config file] [run flags]")
+	runFlags(fs, &args, &opts, preset)
+	datasource := fs.String("datasource", "", "Datasource to plot: "+strings.Join(profiler.GrafanaDatasources, " or ")+" (default from -pushgateway or -statsd)")
+	out := fs.String("out", "", "File to write the dashboard to (default stdout)")
+	parseFlags(fs, argv)
+
+	if *datasource == "" {
+		switch {
+		case opts.Pushgateway != "" && args.StatsdAddr != "":
+			fmt.Println("Error: Both -pushgateway and -statsd are set. Pass -datasource prometheus or graphite to choose.")
+			os.Exit(1)
+		case opts.Pushgateway != "":
+			*datasource = "prometheus"
+		case args.StatsdAddr != "":
+			*datasource = "graphite"
+		default:
+			fmt.Println("Error: No metrics are sent. Pass -pushgateway, -statsd or -datasource.")
+			os.Exit(1)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := profiler.WriteGrafanaDashboard(w, *datasource, opts.PushJob, args.StatsdPrefix); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *out != "" {
+		fmt.Println("INFO: Wrote", *out+". Import it in Grafana under Dashboards > New > Import.")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// wizard asks the questions of init, offering a default for each.
+type wizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask prints question and returns the answer, or def if it is left empty.
+func (w wizard) ask(question, def string) string {
+	fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	if !w.in.Scan() {
+		fmt.Fprintln(w.out)
+		return def
+	}
+	if answer := strings.TrimSpace(w.in.Text()); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// choose asks until the answer is one of choices.
+func (w wizard) choose(question, def string, choices []string) string {
+	for {
+		answer := w.ask(question+" ("+strings.Join(choices, ", ")+")", def)
+		if slices.Contains(choices, answer) {
+			return answer
+		}
+		fmt.Fprintln(w.out, "Please answer one of", strings.Join(choices, ", "))
+	}
+}
+
+// confirm asks a yes or no question.
+func (w wizard) confirm(question string, def bool) bool {
+	choice := "n"
+	if def {
+		choice = "y"
+	}
+	return w.choose(question, choice, []string{"y", "n"}) == "y"
+}
+
+func initMain(argv []string) {
+	fs := newFlagSet("init", "[flags]")
+	out := fs.String("out", "realm-profiler.yaml", "Config file to write, for run -config")
+	offline := fs.Bool("offline", false, "Don't check that the remote answers and that gnokey has the key")
+	parseFlags(fs, argv)
+
+	w := wizard{in: bufio.NewScanner(os.Stdin), out: os.Stdout}
+	if _, err := os.Stat(*out); err == nil && !w.confirm(*out+" exists. Overwrite it?", false) {
+		return
+	}
+	check := checkSetup
+	if *offline {
+		check = nil
+	}
+	entries := runWizard(w, check)
+	if err := writeConfig(*out, entries); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	fmt.Println("INFO: Wrote", *out)
+	fmt.Println("INFO: Check it with:  realm-profiler validate -config", *out)
+	fmt.Println("INFO: Start it with:  realm-profiler run -config", *out)
+}
+
+// runWizard asks for the settings of a first benchmark and returns them as config
+// entries. check, if not nil, reports what is wrong with the remote and key chosen.
+func runWizard(w wizard, check func(args profiler.Config) []error) []configEntry {
+	fmt.Fprintln(w.out, "This writes a config file for a first benchmark. Press enter to accept the default in brackets.")
+	args := profiler.DefaultConfig()
+	var entries []configEntry
+	set := func(name, value string) {
+		entries = append(entries, configEntry{name: name, values: []string{value}})
+	}
+
+	for {
+		previous := args.Remote
+		args.Remote = w.ask("Remote, as host:port or one of "+strings.Join(profiler.RemoteNames(), ", "), args.Remote)
+		if args.Remote != previous {
+			args.ChainID = profiler.RemoteChainID(args.Remote)
+		}
+		args.ChainID = w.ask("Chain ID", args.ChainID)
+		args.KeyName = w.ask("Key to sign transactions with", args.KeyName)
+		var errs []error
+		if check != nil {
+			errs = check(args)
+		}
+		for _, err := range errs {
+			fmt.Fprintln(w.out, "WARNING:", err)
+		}
+		if len(errs) == 0 || !w.confirm("Change the remote or key?", true) {
+			break
+		}
+	}
+	set("remote", args.Remote)
+	if args.ChainID != profiler.RemoteChainID(args.Remote) {
+		set("chainid", args.ChainID)
+	}
+	set("keyname", args.KeyName)
+
+	workloads := append(profiler.WorkloadNames(), "none")
+	if workload := w.choose("Workload to deploy and call, or none to only query balances", "counter", workloads); workload == "none" {
+		set("mode", "balanceQuery")
+	} else {
+		set("mode", "addpkg+call")
+		set("workload", workload)
+	}
+	set("maxThreads", strconv.Itoa(askNumber(w, "Threads", 1)))
+	set("maxQueriesPerSec", strconv.Itoa(askNumber(w, "Queries per second per thread", 1)))
+	for {
+		answer := w.ask("Duration", "5m")
+		if d, err := time.ParseDuration(answer); err == nil && d > 0 {
+			set("duration", d.String())
+			break
+		}
+		fmt.Fprintln(w.out, "Please answer a duration such as 30s or 5m")
+	}
+	return entries
+}
+
+// askNumber asks until the answer is a positive number.
+func askNumber(w wizard, question string, def int) int {
+	for {
+		n, err := strconv.Atoi(w.ask(question, strconv.Itoa(def)))
+		if err == nil && n > 0 {
+			return n
+		}
+		fmt.Fprintln(w.out, "Please answer a positive number")
+	}
+}
+
+// checkSetup checks that the remote of args answers and that gnokey has its key.
+func checkSetup(args profiler.Config) []error {
+	args.Normalize()
+	return append(checkRemotes(args), checkKeys(args)...)
+}
@@ -0,0 +1,188 @@
+package profiler
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// agentRun is what a controller sends to each agent. Every agent gets its own seed so
+// they don't generate the same package names.
+type agentRun struct {
+	Args Config
+	Seed int64
+}
+
+// ServeAgent waits for runs from a controller, executes them one at a time and replies
+// with the results as CSV. Controllers must send secret. An address without a host, e.g.
+// :7070, only listens on localhost.
+func ServeAgent(addr, password, secret string) error {
+	if secret == "" {
+		return errors.New("agents need a secret shared with the controller, see -agentSecret")
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	fmt.Println("INFO: Agent listening on", addr)
+	return http.ListenAndServe(addr, agentHandler(password, secret))
+}
+
+// authorized reports whether req carries secret as its bearer token.
+func authorized(req *http.Request, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+secret)) == 1
+}
+
+func agentHandler(password, secret string) http.Handler {
+	var busy sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /run", func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req, secret) {
+			http.Error(w, "wrong or missing agent secret", http.StatusUnauthorized)
+			return
+		}
+		if !busy.TryLock() {
+			http.Error(w, "agent is already running a scenario", http.StatusConflict)
+			return
+		}
+		defer busy.Unlock()
+
+		var ar agentRun
+		if err := json.NewDecoder(req.Body).Decode(&ar); err != nil {
+			http.Error(w, "invalid run: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ar.Args.Duration <= 0 {
+			http.Error(w, "runs sent to agents need a duration", http.StatusBadRequest)
+			return
+		}
+		if err := errors.Join(AgentErrors(ar.Args)...); err != nil {
+			http.Error(w, "run refused: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		// The controller validated them too
+		if err := errors.Join(ar.Args.Validate()...); err != nil {
+			http.Error(w, "invalid run: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		SeedRandom(ar.Seed)
+		r, err := NewRun(ar.Args, password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Println("INFO: Running", ar.Args.Mode, "for", ar.Args.Duration, "for controller", req.RemoteAddr)
+		logs := runFor(r)
+		r.Close()
+		fmt.Println("INFO: Run finished with", len(logs), "requests")
+
+		w.Header().Set("Content-Type", "text/csv")
+		WriteLogs(w, logs)
+	})
+	return mux
+}
+
+// AgentErrors returns why agents refuse args: a controller may make an agent send load
+// with its key, but not run commands of its choosing or read and write its files.
+func AgentErrors(args Config) []error {
+	var errs []error
+	defaults := DefaultConfig()
+	if args.Command != "" || args.CalibrateCmd != defaults.CalibrateCmd {
+		errs = append(errs, errors.New("runs sent to agents cannot set command or cmd."))
+	}
+	if len(args.Webhooks) > 0 || args.StatsdAddr != "" {
+		errs = append(errs, errors.New("runs sent to agents cannot set webhook or statsd, which the controller reports to."))
+	}
+	paths := []struct{ flag, path, fallback string }{
+		{"pkgdir", args.PkgDir, defaults.PkgDir}, {"runFile", args.RunFile, ""}, {"home", args.Home, ""},
+		{"namesFile", args.NamesFile, ""}, {"manifest", args.ManifestFile, ""}, {"targets", args.TargetsFile, ""},
+		{"script", args.Script, ""}, {"record", args.Record, ""}, {"schedule", args.Schedule, ""},
+		{"captureDir", args.CaptureDir, ""},
+	}
+	for _, p := range paths {
+		if p.path != p.fallback {
+			errs = append(errs, fmt.Errorf("runs sent to agents cannot name files, such as %s.", p.flag))
+		}
+	}
+	return errs
+}
+
+// runFor runs r's workers until its duration is up or the circuit breaker trips.
+func runFor(r *Run) []ExecutionLog {
+	go func() {
+		select {
+		case <-time.After(r.args.Duration):
+		case reason := <-r.abort:
+			fmt.Println("INFO: Aborting run after", reason)
+		}
+		r.Stop()
+	}()
+	r.Start()
+	return r.Logs()
+}
+
+// RunController sends the run to every agent at once and merges their results in
+// timestamp order, tagging each sample with the agent it came from.
+func RunController(agents []string, args Config, seed int64, secret string) ([]ExecutionLog, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var merged []ExecutionLog
+	var errs []error
+
+	fmt.Println("INFO: Sending run to", len(agents), "agents...")
+	for i, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logs, err := sendToAgent(agent, secret, agentRun{Args: args, Seed: seed + int64(i)})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("agent %s: %w", agent, err))
+				return
+			}
+			fmt.Println("INFO: Agent", agent, "returned", len(logs), "requests")
+			for j := range logs {
+				logs[j].Agent = agent
+			}
+			merged = append(merged, logs...)
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp.Before(merged[j].Timestamp) })
+	return merged, errors.Join(errs...)
+}
+
+func sendToAgent(agent, secret string, ar agentRun) ([]ExecutionLog, error) {
+	body, err := json.Marshal(ar)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, httpURL(agent)+"/run", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return ReadLogs(resp.Body)
+}
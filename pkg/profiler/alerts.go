@@ -0,0 +1,141 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// The error rate and p95 are measured over this many of the most recent requests...
+	AlertWindow = 100
+	// ...once at least this many have completed.
+	alertMinRequests = 20
+)
+
+// Alert is the JSON body posted to every -webhook. Slack incoming webhooks show Text and
+// ignore the rest.
+type Alert struct {
+	Text   string    `json:"text"`
+	Event  string    `json:"event"` // threshold, recovered, aborted or assertions
+	Remote string    `json:"remote"`
+	Mode   string    `json:"mode"`
+	Time   time.Time `json:"time"`
+}
+
+// sinkClient posts alerts to webhooks and metrics to the Pushgateway.
+var sinkClient = &http.Client{Timeout: 10 * time.Second}
+
+// SendAlert posts alert to each of urls and returns every failure.
+func SendAlert(urls []string, alert Alert) []error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, url := range urls {
+		resp, err := sinkClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", url, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			errs = append(errs, fmt.Errorf("webhook %s: %s", url, resp.Status))
+		}
+	}
+	return errs
+}
+
+// alertMonitor watches the rolling error rate and p95 for -alertErrorRate and
+// -alertLatency. Each alerts once when crossed and once more when it recovers, rather
+// than for every request in between.
+type alertMonitor struct {
+	maxErrorRate float64       // 0 disables
+	maxP95       time.Duration // 0 disables
+
+	latencies  [AlertWindow]time.Duration
+	failed     [AlertWindow]bool
+	next       int
+	filled     int
+	failures   int
+	errorAlert bool
+	p95Alert   bool
+}
+
+// observe records a request and returns the events and descriptions of any threshold it
+// crossed, in either direction.
+func (m *alertMonitor) observe(log ExecutionLog) (events, texts []string) {
+	if m.maxErrorRate == 0 && m.maxP95 == 0 {
+		return nil, nil
+	}
+	failed := !log.Success || !log.Valid
+	if m.filled == AlertWindow && m.failed[m.next] {
+		m.failures--
+	}
+	m.latencies[m.next], m.failed[m.next] = log.ResponseTime, failed
+	if failed {
+		m.failures++
+	}
+	m.next = (m.next + 1) % AlertWindow
+	m.filled = min(m.filled+1, AlertWindow)
+	if m.filled < alertMinRequests {
+		return nil, nil
+	}
+
+	if m.maxErrorRate > 0 {
+		rate := float64(m.failures) / float64(m.filled)
+		if above := rate >= m.maxErrorRate; above != m.errorAlert {
+			m.errorAlert = above
+			events = append(events, crossing(above))
+			texts = append(texts, fmt.Sprintf("%serror rate %.0f%% over the last %d requests (threshold %.0f%%)", recovered(above), rate*100, m.filled, m.maxErrorRate*100))
+		}
+	}
+	if m.maxP95 > 0 {
+		sorted := slices.Clone(m.latencies[:m.filled])
+		slices.Sort(sorted)
+		p95 := sorted[m.filled*95/100]
+		if above := p95 >= m.maxP95; above != m.p95Alert {
+			m.p95Alert = above
+			events = append(events, crossing(above))
+			texts = append(texts, fmt.Sprintf("%sp95 %s over the last %d requests (threshold %v)", recovered(above), FormatDuration(p95), m.filled, m.maxP95))
+		}
+	}
+	return events, texts
+}
+
+// crossing returns the event of a threshold being crossed upwards or back down.
+func crossing(above bool) string {
+	if above {
+		return "threshold"
+	}
+	return "recovered"
+}
+
+// recovered prefixes the description of a threshold that is no longer crossed.
+func recovered(above bool) string {
+	if above {
+		return ""
+	}
+	return "recovered: "
+}
+
+// alert prints an alert about the run and posts it to the -webhooks in the background.
+// Close waits for it to be sent.
+func (r *Run) alert(event, text string) {
+	fmt.Printf("ALERT: %s\n", text)
+	if len(r.args.Webhooks) == 0 {
+		return
+	}
+	alert := Alert{Text: "realm-profiler: " + text, Event: event, Remote: r.args.Remote, Mode: r.args.Mode, Time: time.Now()}
+	r.alerting.Add(1)
+	go func() {
+		defer r.alerting.Done()
+		for _, err := range SendAlert(r.args.Webhooks, alert) {
+			fmt.Println("WARNING: Failed to send alert:", err)
+		}
+	}()
+}
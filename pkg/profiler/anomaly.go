@@ -0,0 +1,78 @@
+package profiler
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// Latency and errors are compared with this many of the most recent requests...
+	AnomalyWindow = 100
+	// ...once at least this many have completed.
+	anomalyMinRequests = 20
+)
+
+// anomalyDetector flags latency spikes and error bursts as they happen, so they can be
+// matched with the node's logs afterwards. A spike is a response time more than
+// spikeThreshold median absolute deviations above the rolling median; a burst starts when
+// the rolling error rate reaches errorBurst, and is only reported again once it has
+// dropped back below.
+type anomalyDetector struct {
+	spikeThreshold float64 // 0 disables
+	errorBurst     float64 // 0 disables
+
+	latencies [AnomalyWindow]time.Duration
+	failed    [AnomalyWindow]bool
+	next      int
+	filled    int
+	failures  int
+	inBurst   bool
+}
+
+// observe records a request and returns a description of any anomaly it shows.
+func (d *anomalyDetector) observe(log ExecutionLog) []string {
+	var anomalies []string
+	failed := !log.Success || !log.Valid
+	if d.spikeThreshold > 0 && d.filled >= anomalyMinRequests && !failed {
+		median, mad := medianAbsoluteDeviation(d.latencies[:d.filled])
+		// Don't flag jitter around a very steady median
+		mad = max(mad, median/20)
+		if mad > 0 && log.ResponseTime > median+time.Duration(d.spikeThreshold*float64(mad)) {
+			anomalies = append(anomalies, fmt.Sprintf("latency spike: %v is %.1f MADs above the rolling median of %v",
+				log.ResponseTime, float64(log.ResponseTime-median)/float64(mad), median))
+		}
+	}
+
+	if d.filled == AnomalyWindow && d.failed[d.next] {
+		d.failures--
+	}
+	d.latencies[d.next], d.failed[d.next] = log.ResponseTime, failed
+	if failed {
+		d.failures++
+	}
+	d.next = (d.next + 1) % AnomalyWindow
+	d.filled = min(d.filled+1, AnomalyWindow)
+
+	if d.errorBurst > 0 && d.filled >= anomalyMinRequests {
+		rate := float64(d.failures) / float64(d.filled)
+		if rate >= d.errorBurst && !d.inBurst {
+			anomalies = append(anomalies, fmt.Sprintf("error burst: %d of the last %d requests failed", d.failures, d.filled))
+		}
+		d.inBurst = rate >= d.errorBurst
+	}
+	return anomalies
+}
+
+// medianAbsoluteDeviation returns the median of durations and the median of their
+// distances from it.
+func medianAbsoluteDeviation(durations []time.Duration) (time.Duration, time.Duration) {
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	for i, d := range sorted {
+		sorted[i] = max(d-median, median-d)
+	}
+	slices.Sort(sorted)
+	return median, sorted[len(sorted)/2]
+}
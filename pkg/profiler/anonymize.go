@@ -0,0 +1,167 @@
+package profiler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// addressPattern matches a bech32 gno address.
+	addressPattern = regexp.MustCompile(`\bg1[02-9ac-hj-np-z]{38}\b`)
+	// pkgPathPattern matches a realm or package path, keeping its domain and kind.
+	pkgPathPattern = regexp.MustCompile(`\b([a-z0-9.-]+\.[a-z]+)/([rp])/[A-Za-z0-9_]+(/[A-Za-z0-9_]+)*`)
+)
+
+// Anonymizer replaces the addresses, key names, package paths, remotes and chain IDs
+// in results with pseudonyms, so that benchmark data can be shared without revealing
+// which testnet, accounts or realms it came from. The same value always gets the same
+// pseudonym from the same salt, so results can still be grouped and joined.
+type Anonymizer struct {
+	salt     []byte
+	literals map[string]string // values that are only recognized once seen, e.g. key names
+}
+
+// NewAnonymizer returns an Anonymizer whose pseudonyms depend on salt, or on a random
+// salt if it is empty, so that they can't be reversed by trying likely values.
+func NewAnonymizer(salt string) *Anonymizer {
+	a := &Anonymizer{salt: []byte(salt), literals: map[string]string{}}
+	if salt == "" {
+		a.salt = make([]byte, 32)
+		rand.Read(a.salt)
+	}
+	return a
+}
+
+// pseudonym returns n hex digits identifying value among those of its kind.
+func (a *Anonymizer) pseudonym(kind, value string, n int) string {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(kind + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil))[:n]
+}
+
+// literal returns the pseudonym of a value of kind, e.g. a remote, and remembers it so
+// that Text replaces it too.
+func (a *Anonymizer) literal(kind, value string) string {
+	if value == "" {
+		return ""
+	}
+	if p, ok := a.literals[value]; ok {
+		return p
+	}
+	p := kind + "-" + a.pseudonym(kind, value, 8)
+	a.literals[value] = p
+	return p
+}
+
+// Address returns the pseudonym of an address, which still looks like one.
+func (a *Anonymizer) Address(address string) string {
+	if address == "" {
+		return ""
+	}
+	return "g1anon" + a.pseudonym("address", address, 34)
+}
+
+// PackagePath returns the pseudonym of a realm or package path, which keeps its domain
+// and whether it is a realm, e.g. gno.land/r/anon/p1a2b3c4d.
+func (a *Anonymizer) PackagePath(path string) string {
+	m := pkgPathPattern.FindStringSubmatch(path)
+	if m == nil || m[0] != path {
+		return a.literal("pkg", path)
+	}
+	return m[1] + "/" + m[2] + "/anon/p" + a.pseudonym("pkg", path, 8)
+}
+
+// Remote returns the pseudonym of a remote, e.g. remote-1a2b3c4d.
+func (a *Anonymizer) Remote(remote string) string {
+	return a.literal("remote", remote)
+}
+
+// Text replaces the addresses and package paths in s, and the remotes, chain IDs and
+// key names seen so far, e.g. in the command and output of a slow request.
+func (a *Anonymizer) Text(s string) string {
+	s = addressPattern.ReplaceAllStringFunc(s, a.Address)
+	s = pkgPathPattern.ReplaceAllStringFunc(s, a.PackagePath)
+	// Longest first, so that a remote isn't replaced in part by a shorter chain ID
+	values := slices.Collect(maps.Keys(a.literals))
+	slices.SortFunc(values, func(x, y string) int { return len(y) - len(x) })
+	for _, v := range values {
+		s = replaceWord(s, v, a.literals[v])
+	}
+	return s
+}
+
+// replaceWord replaces old in s with new where it isn't part of a longer word, so that
+// a key named Dev leaves "Device" alone.
+func replaceWord(s, old, new string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			return b.String() + s
+		}
+		end := i + len(old)
+		if (i > 0 && isWordByte(s[i-1])) || (end < len(s) && isWordByte(s[end])) {
+			b.WriteString(s[:end])
+		} else {
+			b.WriteString(s[:i] + new)
+		}
+		s = s[end:]
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Config anonymizes the settings of a run. Webhook URLs, which are secrets, are dropped.
+func (a *Anonymizer) Config(c *Config) {
+	c.Remote = a.Remote(c.Remote)
+	for i := range c.Remotes {
+		c.Remotes[i] = a.Remote(c.Remotes[i])
+	}
+	c.CompareRemote = a.Remote(c.CompareRemote)
+	c.ChainID = a.literal("chain", c.ChainID)
+	c.KeyName = a.literal("key", c.KeyName)
+	c.Address = a.Address(c.Address)
+	if c.PackageName != "" {
+		c.PackageName = a.PackagePath(c.PackageName)
+	}
+	for i, chain := range c.Chains {
+		c.Chains[i].Remote = a.Remote(chain.Remote)
+		c.Chains[i].ChainID = a.literal("chain", chain.ChainID)
+		c.Chains[i].KeyName = a.literal("key", chain.KeyName)
+	}
+	c.Webhooks = nil
+	c.StatsdAddr = a.Remote(c.StatsdAddr)
+}
+
+// Logs anonymizes results: the remotes and agents they went to, and their transaction
+// hashes and fingerprints, which could be looked up.
+func (a *Anonymizer) Logs(logs []ExecutionLog) {
+	for i := range logs {
+		log := &logs[i]
+		log.Target = a.Remote(log.Target)
+		log.Agent = a.Remote(log.Agent)
+		if log.Fingerprint != "" {
+			log.Fingerprint = a.pseudonym("fingerprint", log.Fingerprint, 16)
+		}
+		var hashes []string
+		for _, hash := range strings.Fields(log.TxHash) {
+			hashes = append(hashes, a.pseudonym("tx", hash, 32))
+		}
+		log.TxHash = strings.Join(hashes, " ")
+	}
+}
+
+// SlowRequests anonymizes the commands and output of slow requests with Text.
+func (a *Anonymizer) SlowRequests(requests []SlowRequest) {
+	for i := range requests {
+		requests[i].Output = a.Text(requests[i].Output)
+	}
+}
@@ -0,0 +1,112 @@
+package profiler
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AssertionMetrics are the summary metrics -assert can check.
+var AssertionMetrics = []string{"p50", "p95", "p99", "max", "errorRate", "requests", "failed"}
+
+var assertionPattern = regexp.MustCompile(`^\s*(\w+)\s*(<=|>=|<|>)\s*(\S+)\s*$`)
+
+// Assertion is an SLA from -assert, e.g. p95<500ms or errorRate<1%.
+type Assertion struct {
+	Metric    string
+	Op        string
+	Threshold float64 // seconds for latencies, a fraction for errorRate
+}
+
+// AssertionResult is the outcome of checking an assertion against a run.
+type AssertionResult struct {
+	Assertion string
+	Value     string // the metric's actual value
+	Passed    bool
+}
+
+// ParseAssertion parses an assertion like p95<500ms, errorRate<=0.01, errorRate<1% or
+// requests>=1000.
+func ParseAssertion(s string) (Assertion, error) {
+	m := assertionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Assertion{}, fmt.Errorf("invalid assertion %q: expected metric, comparison and threshold, e.g. p95<500ms", s)
+	}
+	a := Assertion{Metric: m[1], Op: m[2]}
+	if !slices.Contains(AssertionMetrics, a.Metric) {
+		return a, fmt.Errorf("invalid assertion %q: metric must be one of %s", s, strings.Join(AssertionMetrics, ", "))
+	}
+	var err error
+	switch a.Metric {
+	case "p50", "p95", "p99", "max":
+		var d time.Duration
+		d, err = time.ParseDuration(m[3])
+		a.Threshold = d.Seconds()
+	case "errorRate":
+		if percent, ok := strings.CutSuffix(m[3], "%"); ok {
+			a.Threshold, err = strconv.ParseFloat(percent, 64)
+			a.Threshold /= 100
+		} else {
+			a.Threshold, err = strconv.ParseFloat(m[3], 64)
+		}
+	default:
+		a.Threshold, err = strconv.ParseFloat(m[3], 64)
+	}
+	if err != nil {
+		return a, fmt.Errorf("invalid assertion %q: bad threshold %q", s, m[3])
+	}
+	return a, nil
+}
+
+// value returns the metric in the assertion's unit, and formatted for people.
+func (a Assertion) value(stats Summary) (float64, string) {
+	switch a.Metric {
+	case "p50":
+		return stats.P50.Seconds(), stats.P50.String()
+	case "p95":
+		return stats.P95.Seconds(), stats.P95.String()
+	case "p99":
+		return stats.P99.Seconds(), stats.P99.String()
+	case "max":
+		return stats.Max.Seconds(), stats.Max.String()
+	case "errorRate":
+		return stats.ErrorRate(), fmt.Sprintf("%.2f%%", 100*stats.ErrorRate())
+	case "requests":
+		return float64(stats.Requests), strconv.Itoa(stats.Requests)
+	case "failed":
+		return float64(stats.Failed), strconv.Itoa(stats.Failed)
+	}
+	panic("unknown assertion metric " + a.Metric)
+}
+
+// Check reports whether stats meet the assertion, and the metric's actual value.
+func (a Assertion) Check(stats Summary) (bool, string) {
+	v, formatted := a.value(stats)
+	switch a.Op {
+	case "<":
+		return v < a.Threshold, formatted
+	case "<=":
+		return v <= a.Threshold, formatted
+	case ">":
+		return v > a.Threshold, formatted
+	default:
+		return v >= a.Threshold, formatted
+	}
+}
+
+// CheckAssertions checks every -assert against stats.
+func CheckAssertions(assertions []string, stats Summary) ([]AssertionResult, error) {
+	var results []AssertionResult
+	for _, s := range assertions {
+		a, err := ParseAssertion(s)
+		if err != nil {
+			return nil, err
+		}
+		passed, value := a.Check(stats)
+		results = append(results, AssertionResult{Assertion: strings.TrimSpace(s), Value: value, Passed: passed})
+	}
+	return results, nil
+}
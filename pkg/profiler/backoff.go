@@ -0,0 +1,72 @@
+package profiler
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// The overload rate is measured over this many of the most recent requests...
+	BackoffWindow = 50
+	// ...and only once at least this many have completed since the rate last changed.
+	backoffMinRequests = 20
+	// The rate is never backed off below this fraction of the target.
+	minBackoffScale = 1.0 / 64
+)
+
+// overloadCodes are the errors of a node that can't keep up, as opposed to ones the
+// requests themselves cause, such as insufficient funds or a realm panic.
+var overloadCodes = []string{ErrMempoolFull, ErrTimeout, ErrConnRefused}
+
+// backoffController scales the send rate down by factor when maxErrorRate of the recent
+// requests fail because the node is overloaded, and back up a step at a time once they
+// are below half of it, like a well-behaved client.
+type backoffController struct {
+	maxErrorRate float64 // 0 disables
+	factor       float64
+
+	scale    float64
+	window   [BackoffWindow]bool
+	next     int
+	filled   int
+	failures int
+}
+
+func newBackoffController(maxErrorRate, factor float64) backoffController {
+	return backoffController{maxErrorRate: maxErrorRate, factor: factor, scale: 1}
+}
+
+// observe records a request and, if the rate should change, returns the new scale of
+// the target rate and why.
+func (b *backoffController) observe(log ExecutionLog) (float64, string) {
+	if b.maxErrorRate == 0 {
+		return 0, ""
+	}
+	overloaded := slices.Contains(overloadCodes, log.ErrorCode)
+	if b.filled == BackoffWindow && b.window[b.next] {
+		b.failures--
+	}
+	b.window[b.next] = overloaded
+	if overloaded {
+		b.failures++
+	}
+	b.next = (b.next + 1) % BackoffWindow
+	b.filled = min(b.filled+1, BackoffWindow)
+	if b.filled < backoffMinRequests {
+		return 0, ""
+	}
+
+	rate := float64(b.failures) / float64(b.filled)
+	reason := fmt.Sprintf("%.0f%% of the last %d requests overloaded the node", rate*100, b.filled)
+	switch {
+	case rate >= b.maxErrorRate && b.scale > minBackoffScale:
+		b.scale = max(b.scale*b.factor, minBackoffScale)
+	case rate < b.maxErrorRate/2 && b.scale < 1:
+		b.scale = min(b.scale/b.factor, 1)
+	default:
+		return 0, ""
+	}
+	// Judge the new rate by the requests sent at it
+	b.window, b.next, b.filled, b.failures = [BackoffWindow]bool{}, 0, 0, 0
+	return b.scale, reason
+}
@@ -0,0 +1,156 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// BalanceChecks are the values of -balanceCheck.
+var BalanceChecks = []string{"warn", "abort", "off"}
+
+var (
+	// A key in the output of gnokey list, e.g. "0. Dev (local) - addr: g1... pub: ..."
+	keyListPattern = regexp.MustCompile(`(?m)^\d+\.\s+(\S+)\s+\(\w+\)\s+-\s+addr:\s+(g1[0-9a-z]+)`)
+	ugnotPattern   = regexp.MustCompile(`(\d+)ugnot`)
+)
+
+// BalanceEstimate compares the balance of the sending key with what the run is expected
+// to spend in gas fees.
+type BalanceEstimate struct {
+	Address string
+	Balance int64   // ugnot
+	TxRate  float64 // transactions per second at the full configured rate
+	TxFee   int64   // ugnot per transaction, at most
+	Cost    int64   // ugnot for the whole run, 0 if it has no -duration or known size
+}
+
+// Sufficient reports whether the balance covers the estimated cost of the run.
+func (e BalanceEstimate) Sufficient() bool {
+	return e.Cost <= e.Balance
+}
+
+// Lasts returns how long the balance lasts at the full configured rate.
+func (e BalanceEstimate) Lasts() time.Duration {
+	if e.TxRate == 0 {
+		return math.MaxInt64
+	}
+	return time.Duration(float64(e.Balance) / (e.TxRate * float64(e.TxFee)) * float64(time.Second))
+}
+
+// txsPerRequest returns the number of transactions each paced request sends: one
+// iteration of a script or journey, or one command otherwise.
+func (r *Run) txsPerRequest() float64 {
+	if r.script != nil {
+		var txs float64
+		for _, st := range r.script.statements {
+			if st.op == "addpkg" || st.op == "call" {
+				txs += st.chance
+			}
+		}
+		return txs
+	}
+	switch r.args.Mode {
+	case "addpkg", "call", "run", "verify":
+		return 1
+	case "addpkg+call":
+		return 2
+	}
+	return 0
+}
+
+// EstimateBalance queries the balance of the sending key, -address or the address gnokey
+// has for -key, and estimates what the run will spend. Runs that send no transactions
+// don't need any funds, and don't query anything.
+func (r *Run) EstimateBalance() (BalanceEstimate, error) {
+	args := r.args
+	e := BalanceEstimate{TxRate: r.txsPerRequest() * float64(args.MaxThreads*args.MaxQPS)}
+	var txs float64
+	switch {
+	case args.Mode == "replay":
+		for _, req := range r.schedule {
+			if req.Mode == "addpkg" || req.Mode == "call" {
+				txs++
+			}
+		}
+		e.TxRate = 0
+		if len(r.schedule) > 0 {
+			if last := r.schedule[len(r.schedule)-1].Offset; last > 0 {
+				e.TxRate = txs / last.Seconds()
+			}
+		}
+	case args.Mode == "verify":
+		txs = float64(args.VerifyCount)
+	case args.Duration > 0:
+		txs = e.TxRate * args.Duration.Seconds()
+		if args.MaxRequests > 0 {
+			txs = min(txs, float64(args.MaxRequests))
+		}
+	case args.MaxRequests > 0 && e.TxRate > 0:
+		// At most, as some of the requests may be queries
+		txs = float64(args.MaxRequests)
+	}
+	if e.TxRate == 0 && txs == 0 {
+		return e, nil
+	}
+	if e.TxFee = args.GasFee; !args.FuzzGasFee.IsZero() {
+		e.TxFee = args.FuzzGasFee.Max
+	} else if e.TxFee == 0 {
+		e.TxFee = gasFee
+	}
+	e.Cost = int64(math.Ceil(txs)) * e.TxFee
+
+	var err error
+	if e.Address = args.Address; e.Address == "" {
+		if e.Address, err = KeyAddress(args.KeyName, args.Home); err != nil {
+			return e, err
+		}
+	}
+	e.Balance, err = QueryBalance(args.Remote, e.Address)
+	return e, err
+}
+
+// KeyAddress returns the address of the gnokey key named name, in the keybase of home or
+// of gnokey's own home if it is empty.
+func KeyAddress(name, home string) (string, error) {
+	out, err := ExecuteCommand("gnokey list "+homeFlag(home), "")
+	if err != nil {
+		return "", fmt.Errorf("listing gnokey keys: %w", err)
+	}
+	for _, m := range keyListPattern.FindAllStringSubmatch(out, -1) {
+		if m[1] == name {
+			return m[2], nil
+		}
+	}
+	return "", fmt.Errorf("gnokey has no key named %q, pass -address", name)
+}
+
+// QueryBalance returns the ugnot balance of address, asking the node's JSON-RPC endpoint.
+func QueryBalance(remote, address string) (int64, error) {
+	out, _, err := executeQuery(remote, "bank/balances/"+address, nil, 0)
+	if err != nil {
+		return 0, fmt.Errorf("querying the balance of %s: %w", address, err)
+	}
+	m := ugnotPattern.FindSubmatch(out)
+	if m == nil {
+		// Accounts that never received anything have no balance at all
+		return 0, nil
+	}
+	return strconv.ParseInt(string(m[1]), 10, 64)
+}
+
+// BalanceChange is the balance of an account involved in a run, before and after it.
+type BalanceChange struct {
+	Address string
+	Before  int64 // ugnot
+	After   int64
+}
+
+// Discrepancy returns how much more the account lost than the run spent from it in fees,
+// deposits and coins sent, or gained if it is negative. Anything else sending from or to
+// the account during the run shows up here too.
+func (c BalanceChange) Discrepancy(spent int64) int64 {
+	return c.Before - c.After - spent
+}
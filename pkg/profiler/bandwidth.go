@@ -0,0 +1,103 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// isQueryMode reports whether mode reads from the node without sending a transaction,
+// so that what it costs is the size of the response rather than gas.
+func isQueryMode(mode string) bool {
+	return mode == "balanceQuery" || mode == "qrender" || mode == "qdoc"
+}
+
+// Bandwidth is how much the node sent back to the queries of a mode.
+type Bandwidth struct {
+	Mode     string
+	Requests int
+	Bytes    int64   // total of the responses
+	MaxBytes int64   // of the largest response
+	Rate     float64 // bytes per second over the span of the run
+}
+
+// Mean returns the mean size of a response in bytes.
+func (b Bandwidth) Mean() float64 {
+	if b.Requests == 0 {
+		return 0
+	}
+	return float64(b.Bytes) / float64(b.Requests)
+}
+
+// SummarizeBandwidth totals the ResponseSize of the queries of each mode, leaving out
+// warm-up and malformed requests, in the order of GroupByMode. Rates are over the span
+// of all the requests, from the first sent to the last answered, so that the modes add
+// up to what the node sent.
+func SummarizeBandwidth(logs []ExecutionLog) []Bandwidth {
+	span := logSpan(logs).Seconds()
+
+	var bandwidth []Bandwidth
+	modes, byMode := GroupByMode(logs)
+	for _, mode := range modes {
+		if !isQueryMode(mode) {
+			continue
+		}
+		b := Bandwidth{Mode: mode}
+		for _, log := range byMode[mode] {
+			if log.Warmup || log.Fault != "" {
+				continue
+			}
+			b.Requests++
+			b.Bytes += log.ResponseSize
+			b.MaxBytes = max(b.MaxBytes, log.ResponseSize)
+		}
+		if b.Bytes == 0 {
+			continue
+		}
+		if span > 0 {
+			b.Rate = float64(b.Bytes) / span
+		}
+		bandwidth = append(bandwidth, b)
+	}
+	return bandwidth
+}
+
+// logSpan returns the time from the first of logs sent to the last answered, leaving
+// out warm-up and malformed requests.
+func logSpan(logs []ExecutionLog) time.Duration {
+	var first, last time.Time
+	for _, log := range logs {
+		if log.Warmup || log.Fault != "" || log.Timestamp.IsZero() {
+			continue
+		}
+		if start := log.Started(); first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if log.Timestamp.After(last) {
+			last = log.Timestamp
+		}
+	}
+	return last.Sub(first)
+}
+
+// SummarizeResponseSizes buckets queries by ResponseSize like SummarizePackageSizes.
+func SummarizeResponseSizes(logs []ExecutionLog) []SizeBucket {
+	return summarizeBySize(logs, func(log ExecutionLog) (int64, bool) { return log.ResponseSize, isQueryMode(log.Mode) })
+}
+
+// writeBandwidth prints how much the queries read, and how their latency scales with
+// the size of the response, since a large Render is often slower than many small ones.
+func writeBandwidth(w io.Writer, logs []ExecutionLog) {
+	bandwidth := SummarizeBandwidth(logs)
+	if len(bandwidth) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Response bandwidth:\n  %-16s %8s %12s %12s %12s %12s\n", "", "requests", "total", "mean", "max", "per second")
+	for _, b := range bandwidth {
+		fmt.Fprintf(w, "  %-16s %8d %12s %12s %12s %12s\n", b.Mode, b.Requests, FormatSize(float64(b.Bytes)),
+			FormatSize(b.Mean()), FormatSize(float64(b.MaxBytes)), FormatSize(b.Rate))
+	}
+	if buckets := SummarizeResponseSizes(logs); len(buckets) > 0 {
+		writeSizes(w, "response size", buckets)
+	}
+}
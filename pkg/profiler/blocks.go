@@ -0,0 +1,139 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// BlockPhaseBuckets is how many parts the block interval is split into by
+// SummarizeBlockPhases.
+const BlockPhaseBuckets = 4
+
+// BlockPhase is the transactions submitted in one part of the block interval: phase 0
+// is just after a block, phase 1 just before the next one.
+type BlockPhase struct {
+	From, To  float64
+	Requests  int
+	Latency   time.Duration // mean response time
+	BlockWait time.Duration // mean time from submission to the block committing it
+}
+
+// BlockHeights returns the heights whose times SummarizeBlockPhases needs for logs: the
+// block committing each transaction, and the one before it.
+func BlockHeights(logs []ExecutionLog) []int64 {
+	seen := map[int64]bool{}
+	for _, log := range logs {
+		if log.Height > 1 && !log.Warmup && log.Fault == "" {
+			seen[log.Height] = true
+			seen[log.Height-1] = true
+		}
+	}
+	heights := make([]int64, 0, len(seen))
+	for h := range seen {
+		heights = append(heights, h)
+	}
+	slices.Sort(heights)
+	return heights
+}
+
+// BlockTimes fetches the time of each of heights from the node's JSON-RPC endpoint.
+func BlockTimes(remote string, heights []int64) (map[int64]time.Time, error) {
+	times := make(map[int64]time.Time, len(heights))
+	for _, h := range heights {
+		t, err := blockTime(remote, h)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", h, err)
+		}
+		times[h] = t
+	}
+	return times, nil
+}
+
+func blockTime(remote string, height int64) (time.Time, error) {
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      "realm-profiler",
+		Method:  "block",
+		Params:  map[string]string{"height": strconv.FormatInt(height, 10)},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := rpcClient.Post(httpURL(remote), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	var decoded struct {
+		Result struct {
+			BlockMeta struct {
+				Header struct {
+					Time time.Time `json:"time"`
+				} `json:"header"`
+			} `json:"block_meta"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return time.Time{}, fmt.Errorf("decoding RPC response: %w", err)
+	}
+	if decoded.Error != nil {
+		return time.Time{}, fmt.Errorf("RPC error: %s %s", decoded.Error.Message, decoded.Error.Data)
+	}
+	return decoded.Result.BlockMeta.Header.Time, nil
+}
+
+// SummarizeBlockPhases splits the committed transactions of logs by when in the block
+// interval they were submitted, from the block before the one committing them to that
+// block, to show how much of their latency is waiting for the next block. Block times
+// come from the proposer's clock, so skew against this machine's clock shifts phases.
+func SummarizeBlockPhases(logs []ExecutionLog, times map[int64]time.Time) []BlockPhase {
+	phases := make([]BlockPhase, BlockPhaseBuckets)
+	var latency, wait [BlockPhaseBuckets]time.Duration
+	for i := range phases {
+		phases[i].From = float64(i) / BlockPhaseBuckets
+		phases[i].To = float64(i+1) / BlockPhaseBuckets
+	}
+	for _, log := range logs {
+		committed, ok1 := times[log.Height]
+		previous, ok2 := times[log.Height-1]
+		if !ok1 || !ok2 || !committed.After(previous) || log.Warmup || log.Fault != "" {
+			continue
+		}
+		submitted := log.Started()
+		phase := float64(submitted.Sub(previous)) / float64(committed.Sub(previous))
+		i := min(max(int(phase*BlockPhaseBuckets), 0), BlockPhaseBuckets-1)
+		phases[i].Requests++
+		latency[i] += log.ResponseTime
+		wait[i] += max(committed.Sub(submitted), 0)
+	}
+	for i := range phases {
+		if n := phases[i].Requests; n > 0 {
+			phases[i].Latency = latency[i] / time.Duration(n)
+			phases[i].BlockWait = wait[i] / time.Duration(n)
+		}
+	}
+	return phases
+}
+
+// WriteBlockPhases prints the latency of transactions by when in the block interval they
+// were submitted.
+func WriteBlockPhases(w io.Writer, phases []BlockPhase) {
+	fmt.Fprintf(w, "Latency by position in the block interval:\n  %-16s %8s %12s %12s\n", "submitted", "requests", "latency", "block wait")
+	for _, p := range phases {
+		fmt.Fprintf(w, "  %-16s %8d %12v %12v\n", fmt.Sprintf("%.0f-%.0f%%", 100*p.From, 100*p.To), p.Requests,
+			FormatDuration(p.Latency), FormatDuration(p.BlockWait))
+	}
+}
@@ -0,0 +1,52 @@
+package profiler
+
+import "fmt"
+
+const (
+	// The error rate is measured over this many of the most recent requests...
+	AbortWindow = 100
+	// ...and only once at least this many have completed.
+	abortMinRequests = 20
+)
+
+// circuitBreaker decides when the node is unhealthy enough to stop the run early.
+type circuitBreaker struct {
+	maxErrorRate   float64 // 0 disables
+	maxConsecutive int     // 0 disables
+
+	consecutive int
+	window      [AbortWindow]bool
+	next        int
+	filled      int
+	failures    int
+}
+
+// observe records a request's outcome and returns a reason if the run should be aborted.
+func (b *circuitBreaker) observe(failed bool) string {
+	if failed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+	if b.maxConsecutive > 0 && b.consecutive >= b.maxConsecutive {
+		return fmt.Sprintf("%d consecutive errors", b.consecutive)
+	}
+
+	if b.filled == AbortWindow && b.window[b.next] {
+		b.failures--
+	}
+	b.window[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % AbortWindow
+	b.filled = min(b.filled+1, AbortWindow)
+
+	if b.maxErrorRate > 0 && b.filled >= abortMinRequests {
+		rate := float64(b.failures) / float64(b.filled)
+		if rate >= b.maxErrorRate {
+			return fmt.Sprintf("error rate %.0f%% over the last %d requests", rate*100, b.filled)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The Cache of a qrender request with -cacheProbe: the same query again, or one varied
+// so that no cache the node keeps can answer it.
+const (
+	CacheRepeat = "repeat"
+	CacheBust   = "bust"
+)
+
+// Repeated queries this much faster at the median than cache-busting ones are taken as
+// a sign the node caches reads.
+const cacheEffectThreshold = 0.1
+
+// cacheBust varies a render path with a random query parameter, which realms that route
+// on the path alone render the same, but which no cache keyed on the query has seen.
+func cacheBust(renderPath string) string {
+	sep := "?"
+	if strings.Contains(renderPath, "?") {
+		sep = "&"
+	}
+	return renderPath + sep + "nocache=" + randomString(8)
+}
+
+// CacheEffect compares the latency of repeated queries to that of cache-busting ones.
+type CacheEffect struct {
+	Repeat, Bust Summary
+}
+
+// Speedup returns how much faster repeated queries were at the median, as a fraction of
+// the latency of cache-busting ones.
+func (c CacheEffect) Speedup() float64 {
+	if c.Bust.P50 == 0 {
+		return 0
+	}
+	return 1 - float64(c.Repeat.P50)/float64(c.Bust.P50)
+}
+
+// SummarizeCaching splits the requests of a -cacheProbe run by Cache. It returns false
+// unless there were requests of both kinds.
+func SummarizeCaching(logs []ExecutionLog) (CacheEffect, bool) {
+	var repeat, bust []ExecutionLog
+	for _, log := range logs {
+		switch log.Cache {
+		case CacheRepeat:
+			repeat = append(repeat, log)
+		case CacheBust:
+			bust = append(bust, log)
+		}
+	}
+	c := CacheEffect{Repeat: Summarize(repeat), Bust: Summarize(bust)}
+	return c, c.Repeat.Requests > 0 && c.Bust.Requests > 0
+}
+
+// writeCaching prints how repeated queries fared against cache-busting ones, and whether
+// the difference points to a cache on the read path.
+func writeCaching(w io.Writer, logs []ExecutionLog) {
+	c, ok := SummarizeCaching(logs)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "Latency by cache probe:\n  %-16s %8s %8s %12s %12s %12s\n", "", "requests", "errors", "p50", "p95", "p99")
+	for _, row := range []struct {
+		name string
+		s    Summary
+	}{{"repeated", c.Repeat}, {"cache-busting", c.Bust}} {
+		fmt.Fprintf(w, "  %-16s %8d %8d %12v %12v %12v\n", row.name, row.s.Requests, row.s.Failed+row.s.Invalid,
+			FormatDuration(row.s.P50), FormatDuration(row.s.P95), FormatDuration(row.s.P99))
+	}
+	if speedup := c.Speedup(); speedup >= cacheEffectThreshold {
+		fmt.Fprintf(w, "Repeated queries were %.0f%% faster at the median: the node likely caches reads.\n", speedup*100)
+	} else {
+		fmt.Fprintf(w, "Repeated queries were no more than %.0f%% faster at the median: no sign of caching.\n", cacheEffectThreshold*100)
+	}
+}
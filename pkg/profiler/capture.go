@@ -0,0 +1,86 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// captureSection formats one command or query and everything it printed, for -captureDir.
+func captureSection(command, out string, err error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n", command)
+	if err != nil {
+		fmt.Fprintf(&b, "error: %v\n", err)
+	}
+	fmt.Fprintf(&b, "--- stdout ---\n%s\n", out)
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		fmt.Fprintf(&b, "--- stderr ---\n%s\n", cmdErr.stderr)
+	}
+	return b.String()
+}
+
+// capture writes the raw output of a request to its own file in -captureDir and returns
+// the file name, which is recorded in the Capture column. It does nothing unless
+// -captureDir is set.
+func (r *Run) capture(sections ...string) string {
+	if r.args.CaptureDir == "" {
+		return ""
+	}
+	data := []byte(strings.Join(sections, "\n"))
+	name := fmt.Sprintf("%06d.txt", r.captured.Add(1))
+	if r.captureRotate != nil {
+		dir, err := r.captureSubdir(int64(len(data)))
+		if err != nil {
+			fmt.Println("WARNING: Failed to capture output: ", err)
+			return ""
+		}
+		name = filepath.Join(dir, name)
+	}
+	if err := os.WriteFile(filepath.Join(r.args.CaptureDir, name), data, 0o644); err != nil {
+		fmt.Println("WARNING: Failed to capture output: ", err)
+		return ""
+	}
+	return name
+}
+
+// lastCapture returns the number of the last capture file in dir, so that a resumed run
+// numbers its captures after those of the run it resumes instead of overwriting them.
+func lastCapture(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var last int64
+	for _, entry := range entries {
+		if number, ok := strings.CutSuffix(entry.Name(), ".txt"); ok {
+			if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+				last = max(last, n)
+			}
+		}
+	}
+	return last, nil
+}
+
+// captureSubdir returns the numbered subdirectory of -captureDir to write size more bytes
+// of output to, moving on to the next one when the current one is due for rotation, so
+// that a week-long run doesn't put millions of files in one directory.
+func (r *Run) captureSubdir(size int64) (string, error) {
+	r.captureMutex.Lock()
+	defer r.captureMutex.Unlock()
+	rot := r.captureRotate
+	now := time.Now()
+	if rot.n == 0 || rot.due(now) {
+		rot.next(now)
+		if err := os.MkdirAll(filepath.Join(r.args.CaptureDir, fmt.Sprintf("%04d", rot.n)), 0o755); err != nil {
+			return "", err
+		}
+	}
+	rot.size += size
+	return fmt.Sprintf("%04d", rot.n), nil
+}
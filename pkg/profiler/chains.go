@@ -0,0 +1,106 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chain is one of the networks a -chain run profiles at the same time as the others,
+// each with its own key and rate. Empty fields are taken from the rest of the run's
+// settings.
+type Chain struct {
+	Remote  string
+	ChainID string `json:",omitempty"`
+	KeyName string `json:",omitempty"`
+	MaxQPS  int    `json:",omitempty"`
+}
+
+// ParseChain parses a -chain of the form remote[,chainid[,key[,qps]]], e.g.
+// test5,,loadtest,2. The remote may be the name of a public network.
+func ParseChain(s string) (Chain, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) > 4 || fields[0] == "" {
+		return Chain{}, fmt.Errorf("invalid chain %q: expected remote[,chainid[,key[,qps]]]", s)
+	}
+	fields = append(fields, make([]string, 4-len(fields))...)
+	c := Chain{Remote: fields[0], ChainID: fields[1], KeyName: fields[2]}
+	if fields[3] != "" {
+		qps, err := strconv.Atoi(fields[3])
+		if err != nil || qps < 1 {
+			return Chain{}, fmt.Errorf("invalid chain %q: qps must be a positive number", s)
+		}
+		c.MaxQPS = qps
+	}
+	return c, nil
+}
+
+func (c Chain) String() string {
+	s := c.Remote + "," + c.ChainID + "," + c.KeyName
+	if c.MaxQPS > 0 {
+		s += "," + strconv.Itoa(c.MaxQPS)
+	}
+	return strings.TrimRight(s, ",")
+}
+
+// apply returns args for profiling the chain on its own. Public networks get their own
+// chain ID unless the chain sets one.
+func (c Chain) apply(args Config) Config {
+	args.Chains = nil
+	args.Remote = c.Remote
+	if c.ChainID != "" {
+		args.ChainID = c.ChainID
+	} else if _, ok := remotes[c.Remote]; ok {
+		args.ChainID = DefaultChainId
+	}
+	if c.KeyName != "" {
+		args.KeyName = c.KeyName
+	}
+	if c.MaxQPS > 0 {
+		args.MaxQPS = c.MaxQPS
+	}
+	args.Normalize()
+	return args
+}
+
+// RunChains profiles every one of args.Chains at once for args.Duration, each as its own
+// run, and merges their results in timestamp order with the remote of each as its Target.
+func RunChains(args Config, password string) ([]ExecutionLog, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var merged []ExecutionLog
+	var errs []error
+
+	fmt.Println("INFO: Profiling", len(args.Chains), "chains for", args.Duration)
+	for _, chain := range args.Chains {
+		chainArgs := chain.apply(args)
+		r, err := NewRun(chainArgs, password)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chain %s: %w", chainArgs.ChainID, err))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.AfterFunc(args.Duration, r.Stop)
+			r.Start()
+			r.Close()
+			logs := r.Logs()
+			for i := range logs {
+				logs[i].Target = chainArgs.Remote
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Println("INFO: Chain", chainArgs.ChainID, "at", chainArgs.Remote, "completed", len(logs), "requests")
+			merged = append(merged, logs...)
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp.Before(merged[j].Timestamp) })
+	return merged, errors.Join(errs...)
+}
@@ -0,0 +1,158 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The Step of the qrender requests of a contention experiment: sent alone, or while
+// calls were writing to the same realm.
+const (
+	ContentionBaseline  = "baseline"
+	ContentionContended = "contended"
+)
+
+// ContentionRates are the independent loads of a contention experiment: qrender reads
+// and calls writing to the same realm, each at Threads threads of QPS requests a second.
+type ContentionRates struct {
+	ReadThreads, ReadQPS   int
+	WriteThreads, WriteQPS int
+}
+
+// ContentionArgs returns args for the reads and the writes of a contention experiment on
+// args.PackageName, which the writes call args.FunctionName of.
+func ContentionArgs(args Config, rates ContentionRates) (reads, writes Config) {
+	reads = SuiteArgs(args, "qrender")
+	reads.MaxThreads, reads.MaxQPS = rates.ReadThreads, rates.ReadQPS
+	writes = SuiteArgs(args, "call")
+	writes.MaxThreads, writes.MaxQPS = rates.WriteThreads, rates.WriteQPS
+	return reads, writes
+}
+
+// RunContention measures how writes to a realm degrade reads of it: qrender alone for
+// args.Duration, then qrender and calls at the same time for as long again. The reads
+// are returned with their Step set to the phase they ran in. Closing stop ends the phase
+// running and skips the rest.
+func RunContention(args Config, rates ContentionRates, password string, stop <-chan struct{}) (reads, writes []ExecutionLog, err error) {
+	readArgs, writeArgs := ContentionArgs(args, rates)
+	fmt.Printf("INFO: Reading alone for %v\n", args.Duration)
+	baseline, err := runPhase(stop, args.Duration, password, readArgs)
+	reads = append(reads, withStep(baseline[0], ContentionBaseline)...)
+	if err != nil {
+		return reads, nil, fmt.Errorf("reads: %w", err)
+	}
+	select {
+	case <-stop:
+		return reads, nil, nil
+	default:
+	}
+
+	fmt.Printf("INFO: Reading and writing for %v\n", args.Duration)
+	contended, err := runPhase(stop, args.Duration, password, readArgs, writeArgs)
+	reads = append(reads, withStep(contended[0], ContentionContended)...)
+	return reads, contended[1], err
+}
+
+// runPhase runs a Run of each of args at the same time, for duration or until stop is
+// closed, and returns their results in the same order.
+func runPhase(stop <-chan struct{}, duration time.Duration, password string, args ...Config) ([][]ExecutionLog, error) {
+	logs := make([][]ExecutionLog, len(args))
+	runs := make([]*Run, len(args))
+	for i, a := range args {
+		r, err := NewRun(a, password)
+		if err != nil {
+			for _, started := range runs[:i] {
+				started.Close()
+			}
+			return logs, fmt.Errorf("%s: %w", a.Mode, err)
+		}
+		runs[i] = r
+	}
+	stopAll := func() {
+		for _, r := range runs {
+			r.Stop()
+		}
+	}
+	timer := time.AfterFunc(duration, stopAll)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			stopAll()
+		case <-done:
+		}
+	}()
+	var wg sync.WaitGroup
+	for _, r := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Start()
+		}()
+	}
+	wg.Wait()
+	close(done)
+	timer.Stop()
+	for i, r := range runs {
+		r.Close()
+		logs[i] = r.Logs()
+	}
+	return logs, nil
+}
+
+// withStep sets the Step of logs.
+func withStep(logs []ExecutionLog, step string) []ExecutionLog {
+	for i := range logs {
+		logs[i].Step = step
+	}
+	return logs
+}
+
+// Contention is how the reads of a contention experiment fared without writes and with.
+type Contention struct {
+	Baseline, Contended, Writes Summary
+}
+
+// SummarizeContention splits the reads of a contention experiment by phase.
+func SummarizeContention(reads, writes []ExecutionLog) Contention {
+	var baseline, contended []ExecutionLog
+	for _, log := range reads {
+		if log.Step == ContentionBaseline {
+			baseline = append(baseline, log)
+		} else {
+			contended = append(contended, log)
+		}
+	}
+	return Contention{Baseline: Summarize(baseline), Contended: Summarize(contended), Writes: Summarize(writes)}
+}
+
+// Slowdown returns how much slower the contended reads were than the baseline at the
+// latency percentile picks out, as a fraction of the baseline.
+func (c Contention) Slowdown(pick func(Summary) time.Duration) float64 {
+	if pick(c.Baseline) == 0 {
+		return 0
+	}
+	return float64(pick(c.Contended))/float64(pick(c.Baseline)) - 1
+}
+
+// WriteContention prints the reads without writes and with, the writes, and how much
+// the writes slowed the reads down.
+func WriteContention(w io.Writer, c Contention) {
+	fmt.Fprintf(w, "%-20s %8s %12s %12s %12s %8s\n", "", "requests", "p50", "p95", "p99", "err%")
+	for _, row := range []struct {
+		name string
+		s    Summary
+	}{{"reads alone", c.Baseline}, {"reads with writes", c.Contended}, {"writes", c.Writes}} {
+		fmt.Fprintf(w, "%-20s %8d %12v %12v %12v %7.1f%%\n", row.name, row.s.Requests,
+			FormatDuration(row.s.P50), FormatDuration(row.s.P95), FormatDuration(row.s.P99), 100*row.s.ErrorRate())
+	}
+	if c.Baseline.Requests == 0 || c.Contended.Requests == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Writes changed read latency by %+.0f%% at p50, %+.0f%% at p95 and %+.0f%% at p99.\n",
+		100*c.Slowdown(func(s Summary) time.Duration { return s.P50 }),
+		100*c.Slowdown(func(s Summary) time.Duration { return s.P95 }),
+		100*c.Slowdown(func(s Summary) time.Duration { return s.P99 }))
+}
@@ -0,0 +1,73 @@
+package profiler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ServeControl serves the HTTP API for tuning a run while it is in progress. It only
+// accepts requests with secret as their bearer token, and an address without a host
+// only listens on 127.0.0.1.
+func ServeControl(addr, secret string, r *Run) {
+	addr = controlAddr(addr)
+	fmt.Println("INFO: Control API listening on", addr)
+	if err := http.ListenAndServe(addr, controlHandler(r, secret)); err != nil {
+		fmt.Println("WARNING: Control API stopped:", err)
+	}
+}
+
+// controlAddr returns addr with 127.0.0.1 as its host if it has none.
+func controlAddr(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+func controlHandler(r *Run, secret string) http.Handler {
+	mux := http.NewServeMux()
+
+	// POST /qps?value=N sets the per-thread target rate
+	mux.HandleFunc("POST /qps", func(w http.ResponseWriter, req *http.Request) {
+		qps, err := strconv.Atoi(req.FormValue("value"))
+		if err != nil || qps < 1 {
+			http.Error(w, "value must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		old := r.qps.Swap(int64(qps))
+		fmt.Println("INFO: Target rate changed from", old, "to", qps, "queries per second per thread")
+		fmt.Fprintln(w, "OK")
+	})
+
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, req *http.Request) {
+		if !r.paused.Swap(true) {
+			fmt.Println("INFO: Paused load generation")
+		}
+		fmt.Fprintln(w, "OK")
+	})
+
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, req *http.Request) {
+		if r.paused.Swap(false) {
+			fmt.Println("INFO: Resumed load generation")
+		}
+		fmt.Fprintln(w, "OK")
+	})
+
+	// GET /stats dumps the summary of everything recorded so far
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, "Paused:          ", r.paused.Load())
+		fmt.Fprintln(w, "Target QPS:      ", r.qps.Load(), "per thread")
+		fmt.Fprintln(w, "Active workers:  ", r.activeWorkers.Load())
+		WriteStats(w, r.Summary(), r.Logs())
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req, secret) {
+			http.Error(w, "wrong or missing control secret", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,62 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// DeployPackages deploys count packages one after another, the same way addpkg mode
+// does, and records the ones that made it into a block in args.ManifestFile.
+func DeployPackages(args Config, count int, password string) (int, error) {
+	m, err := openManifest(args.ManifestFile)
+	if err != nil {
+		return 0, fmt.Errorf("creating manifest: %w", err)
+	}
+	defer m.close()
+
+	names, err := newNameRegistry(args.NamesFile)
+	if err != nil {
+		return 0, fmt.Errorf("loading names: %w", err)
+	}
+	defer names.close()
+
+	e, err := newExecutor(args, password)
+	if err != nil {
+		return 0, err
+	}
+
+	deployed := 0
+	for i := 0; i < count; i++ {
+		name, err := names.newName(args)
+		if err != nil {
+			return deployed, err
+		}
+		taskArgs := args
+		if args.Generate || args.Workload != "" {
+			dir, _, err := writeTaskPackage(args, path.Base(pkgPath(args, name)))
+			if err != nil {
+				return deployed, fmt.Errorf("generating package: %w", err)
+			}
+			taskArgs.PkgDir = dir
+		}
+
+		out, _, err := e.Execute("addpkg", name, taskArgs)
+		if args.Generate || args.Workload != "" {
+			os.RemoveAll(taskArgs.PkgDir)
+		}
+		txHash, height, ok := parseTxResult(out)
+		if err != nil || !ok {
+			reason := classifyError(out, err, nil)
+			if err == nil {
+				reason = "no tx hash in output"
+			}
+			fmt.Printf("WARNING: Failed to deploy %s: %s\n", pkgPath(args, name), reason)
+			continue
+		}
+		m.add(pkgPath(args, name), txHash, height)
+		deployed++
+		fmt.Printf("INFO: Deployed %s (%d/%d)\n", pkgPath(args, name), i+1, count)
+	}
+	return deployed, nil
+}
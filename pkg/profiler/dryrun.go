@@ -0,0 +1,81 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDryRun writes what a run with args would send, without executing any of it. With
+// -targets only the first target is shown, and generated packages are shown with a
+// placeholder pkgdir since they are written to a new temporary directory per request.
+func WriteDryRun(w io.Writer, args Config) error {
+	name := args.PackageName
+	if args.TargetsFile != "" {
+		targets, err := loadTargets(args.TargetsFile, false)
+		if err != nil {
+			return fmt.Errorf("loading targets: %w", err)
+		}
+		t := targets.pick()
+		name = t.PkgPath
+		if t.Function != "" {
+			args.FunctionName = t.Function
+		}
+		fmt.Fprintf(w, "# first of %d targets\n", len(targets.targets))
+	}
+	if args.Generate || args.Workload != "" {
+		args.PkgDir = "<generated package dir>"
+	}
+
+	e, err := newExecutor(args, "")
+	if err != nil {
+		return err
+	}
+	if name == "" && (args.Mode == "addpkg" || args.Mode == "addpkg+call") {
+		name = randomPackageName(args)
+	}
+	if args.CompareRemote != "" {
+		fmt.Fprintf(w, "# every request is also sent to %s\n", args.CompareRemote)
+	}
+	if len(args.Remotes) > 1 {
+		fmt.Fprintf(w, "# requests take turns going to %s\n", strings.Join(args.Remotes, ", "))
+	}
+	switch args.Mode {
+	case "script":
+		s, err := LoadScript(args.Script)
+		if err != nil {
+			return fmt.Errorf("loading script: %w", err)
+		}
+		writeScriptDryRun(w, e, s, args)
+	case "replay":
+		schedule, err := LoadSchedule(args.Schedule)
+		if err != nil {
+			return fmt.Errorf("loading schedule: %w", err)
+		}
+		for _, req := range schedule {
+			fmt.Fprintf(w, "# at %v:\n", req.Offset)
+			fmt.Fprintln(w, e.Describe(req.Mode, req.Package, req.requestArgs(args)))
+		}
+	case "journey":
+		s, err := journeyScript(args)
+		if err != nil {
+			return err
+		}
+		writeScriptDryRun(w, e, s, args)
+	case "addpkg+call":
+		fmt.Fprintln(w, e.Describe("addpkg", name, args))
+		fmt.Fprintln(w, e.Describe("call", name, args))
+	case "verify":
+		name = randomPackageName(args)
+		args.PkgDir = "<counter package dir>"
+		fmt.Fprintln(w, e.Describe("addpkg", name, args))
+		callArgs := args
+		callArgs.FunctionName = workloads["counter"].Function
+		fmt.Fprintf(w, "# %d times:\n", args.VerifyCount)
+		fmt.Fprintln(w, e.Describe("call", name, callArgs))
+		fmt.Fprintln(w, e.Describe("qrender", name, args))
+	default:
+		fmt.Fprintln(w, e.Describe(args.Mode, name, args))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TxStats counts what became of the transactions of a run, by their TxHash.
+type TxStats struct {
+	Committed         int // distinct transactions committed
+	AcceptedTwice     int // extra times a committed transaction was reported committed again
+	RejectedDuplicate int // requests the node rejected as a transaction it already had
+	Unconfirmed       int // requests that timed out, whose transactions may or may not have made it
+}
+
+// CountTxs computes the TxStats of logs, warm-up included: a transaction committed twice
+// is worth knowing about whenever it happened.
+func CountTxs(logs []ExecutionLog) TxStats {
+	var stats TxStats
+	seen := map[string]bool{}
+	for _, log := range logs {
+		for _, hash := range strings.Fields(log.TxHash) {
+			if seen[hash] {
+				stats.AcceptedTwice++
+			} else {
+				seen[hash] = true
+			}
+		}
+		switch {
+		case log.ErrorCode == ErrDuplicateTx:
+			stats.RejectedDuplicate++
+		case log.ErrorCode == ErrTimeout && (isTxMode(log.Mode) || log.Mode == "addpkg+call"):
+			stats.Unconfirmed++
+		}
+	}
+	stats.Committed = len(seen)
+	return stats
+}
+
+// writeTxs prints the TxStats of logs, if they have any transactions.
+func writeTxs(w io.Writer, logs []ExecutionLog) {
+	stats := CountTxs(logs)
+	if stats == (TxStats{}) {
+		return
+	}
+	fmt.Fprintf(w, "Transactions:     %d committed, %d accepted twice, %d rejected as duplicates, %d unconfirmed\n",
+		stats.Committed, stats.AcceptedTwice, stats.RejectedDuplicate, stats.Unconfirmed)
+}
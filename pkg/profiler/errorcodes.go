@@ -0,0 +1,71 @@
+package profiler
+
+import (
+	"errors"
+	"regexp"
+)
+
+// Normalized error codes recorded per request
+const (
+	ErrInsufficientFunds = "insufficient_funds"
+	ErrOutOfGas          = "out_of_gas"
+	ErrSequenceMismatch  = "sequence_mismatch"
+	ErrPackageExists     = "package_exists"
+	ErrDuplicateTx       = "duplicate_tx"
+	ErrMempoolFull       = "mempool_full"
+	ErrConnRefused       = "connection_refused"
+	ErrTimeout           = "timeout"
+	ErrKeybaseLocked     = "keybase_locked"
+	ErrRealmPanic        = "realm_panic"
+	ErrValidation        = "validation_failed"
+	ErrUnknown           = "unknown"
+)
+
+// errorSignatures are matched against a failed request's stdout and stderr, in order.
+var errorSignatures = []struct {
+	code    string
+	pattern *regexp.Regexp
+}{
+	{ErrInsufficientFunds, regexp.MustCompile(`(?i)insufficient (funds|coins)`)},
+	{ErrOutOfGas, regexp.MustCompile(`(?i)out of gas`)},
+	{ErrSequenceMismatch, regexp.MustCompile(`(?i)(sequence mismatch|invalid sequence|wrong sequence|account sequence)`)},
+	{ErrPackageExists, regexp.MustCompile(`(?i)package already exists`)},
+	{ErrDuplicateTx, regexp.MustCompile(`(?i)(tx already exists in cache|duplicate tx)`)},
+	{ErrMempoolFull, regexp.MustCompile(`(?i)mempool is full`)},
+	{ErrConnRefused, regexp.MustCompile(`(?i)connection refused`)},
+	// gnokey's keybase is a leveldb, which another gnokey holds the LOCK file of
+	{ErrKeybaseLocked, regexp.MustCompile(`(?i)\bLOCK: (resource temporarily unavailable|.*being used by another process)`)},
+	{ErrTimeout, regexp.MustCompile(`(?i)(timed? ?out|deadline exceeded)`)},
+	{ErrRealmPanic, regexp.MustCompile(`(?i)\bpanic\b`)},
+}
+
+// commandError is returned by ExecuteCommand so callers can look at the command's stderr.
+type commandError struct {
+	err    error
+	stderr string
+}
+
+func (e *commandError) Error() string { return e.err.Error() }
+func (e *commandError) Unwrap() error { return e.err }
+
+// classifyError returns the normalized error code for a request, or "" if it succeeded.
+func classifyError(out string, err error, validationErr error) string {
+	if err == nil {
+		if validationErr != nil {
+			return ErrValidation
+		}
+		return ""
+	}
+
+	text := out + "\n" + err.Error()
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		text += "\n" + cmdErr.stderr
+	}
+	for _, sig := range errorSignatures {
+		if sig.pattern.MatchString(text) {
+			return sig.code
+		}
+	}
+	return ErrUnknown
+}
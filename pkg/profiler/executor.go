@@ -0,0 +1,96 @@
+package profiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Executor sends requests to the node. Each request is one mode ("addpkg", "call", "run",
+// "balanceQuery", "qrender", "qdoc" or "calibrate") against packageName, which is a bare
+// name or a full gno.land/... path.
+type Executor interface {
+	// Describe returns what Execute sends, e.g. the gnokey command line, for logs,
+	// -captureDir and -dryRun.
+	Describe(mode, packageName string, args Config) string
+	// Execute sends the request and returns the node's response. The timing breakdown is
+	// only filled in by backends that make the HTTP request themselves.
+	Execute(mode, packageName string, args Config) (string, HTTPTiming, error)
+}
+
+// executors create the Executor for each -backend. They get the gnokey password the run
+// was started with.
+var executors = map[string]func(password string) Executor{
+	"exec": func(password string) Executor { return gnokeyExecutor{password: password} },
+	"rpc":  func(string) Executor { return rpcExecutor{} },
+}
+
+// RegisterExecutor makes a backend available as Config.Backend, e.g. a fake one in tests.
+// It must be called before any run starts.
+func RegisterExecutor(name string, newExecutor func(password string) Executor) {
+	executors[name] = newExecutor
+}
+
+// Backends returns the names of the registered backends, sorted.
+func Backends() []string {
+	names := make([]string, 0, len(executors))
+	for name := range executors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newExecutor(args Config, password string) (Executor, error) {
+	newExecutor, ok := executors[args.Backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q", args.Backend)
+	}
+	return newExecutor(password), nil
+}
+
+// fingerprint identifies requests as Described, so that requests sending the same
+// commands can be grouped even when packages and arguments are randomized: the first 8
+// bytes of a SHA-256, in hex.
+func fingerprint(requests ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(requests, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// gnokeyExecutor runs gnokey in a subprocess, the way users of the node do.
+type gnokeyExecutor struct {
+	password string
+}
+
+func (e gnokeyExecutor) Describe(mode, packageName string, args Config) string {
+	if mode == "calibrate" {
+		return args.CalibrateCmd
+	}
+	return GenerateCommand(mode, packageName, args)
+}
+
+func (e gnokeyExecutor) Execute(mode, packageName string, args Config) (string, HTTPTiming, error) {
+	out, err := executeCommand(e.Describe(mode, packageName, args), e.password, args.RequestTimeout)
+	return out, HTTPTiming{}, err
+}
+
+// rpcExecutor sends query modes straight to the node's JSON-RPC endpoint, bypassing
+// gnokey.
+type rpcExecutor struct{}
+
+func (rpcExecutor) Describe(mode, packageName string, args Config) string {
+	path, data := generateQuery(mode, pkgPath(args, packageName), args.RenderPath)
+	body, err := queryBody(path, data)
+	if err != nil {
+		return fmt.Sprintf("abci_query %s %q", path, data)
+	}
+	return fmt.Sprintf("POST %s %s", httpURL(args.Remote), body)
+}
+
+func (rpcExecutor) Execute(mode, packageName string, args Config) (string, HTTPTiming, error) {
+	path, data := generateQuery(mode, pkgPath(args, packageName), args.RenderPath)
+	out, timing, err := executeQuery(args.Remote, path, data, args.RequestTimeout)
+	return string(out), timing, err
+}
@@ -0,0 +1,170 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parser extracts named numbers from the output of a request, e.g. the height a query
+// was answered at or the bytes a realm rendered, into its Fields.
+type Parser func(out string) map[string]float64
+
+// parsers are the registered Parsers, by mode.
+var parsers = map[string][]Parser{
+	"qrender": {renderedBytes},
+}
+
+// RegisterParser adds p to the parsers of the output of mode's requests. It must be
+// called before any run starts, e.g. from the init function of a plugin.
+func RegisterParser(mode string, p Parser) {
+	parsers[mode] = append(parsers[mode], p)
+}
+
+// renderedBytes measures what a realm's Render returned, from the "data: " gnokey
+// prints it after.
+func renderedBytes(out string) map[string]float64 {
+	_, data, ok := strings.Cut(out, "data: ")
+	if !ok {
+		return nil
+	}
+	return map[string]float64{"renderedBytes": float64(len(strings.TrimSuffix(data, "\n")))}
+}
+
+// RegexParser returns a Parser setting field name to the number the first submatch of
+// pattern captures, or its whole match if it has none. Thousands separators are ignored,
+// and output that doesn't match or isn't a number leaves the field unset.
+func RegexParser(name string, pattern *regexp.Regexp) Parser {
+	return func(out string) map[string]float64 {
+		match := pattern.FindStringSubmatch(out)
+		if match == nil {
+			return nil
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		n, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", ""), 64)
+		if err != nil {
+			return nil
+		}
+		return map[string]float64{name: n}
+	}
+}
+
+// compileExtractors turns -extract rules, each "name:regex" optionally scoped to a mode
+// as "mode=name:regex", into RegexParsers by mode ("" for every mode).
+func compileExtractors(rules []string) (map[string][]Parser, error) {
+	extractors := map[string][]Parser{}
+	for _, rule := range rules {
+		mode, extract := splitRuleMode(rule)
+		name, expr, ok := strings.Cut(extract, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " =") {
+			return nil, fmt.Errorf("invalid extract %q: expected name:regex", rule)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extract %q: %w", rule, err)
+		}
+		extractors[mode] = append(extractors[mode], RegexParser(name, re))
+	}
+	return extractors, nil
+}
+
+// parseFields returns the fields the registered parsers of mode and the -extract rules
+// find in out, or nil if there are none.
+func (r *Run) parseFields(mode, out string) map[string]float64 {
+	var fields map[string]float64
+	for _, list := range [][]Parser{parsers[mode], r.extractors[""], r.extractors[mode]} {
+		for _, p := range list {
+			found := p(out)
+			if len(found) > 0 && fields == nil {
+				fields = map[string]float64{}
+			}
+			maps.Copy(fields, found)
+		}
+	}
+	return fields
+}
+
+// formatFields writes fields as space-separated name=value pairs, sorted by name.
+func formatFields(fields map[string]float64) string {
+	pairs := make([]string, 0, len(fields))
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		pairs = append(pairs, name+"="+strconv.FormatFloat(fields[name], 'f', -1, 64))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// parseFieldsColumn reads fields written by formatFields, skipping malformed pairs.
+func parseFieldsColumn(s string) map[string]float64 {
+	var fields map[string]float64
+	for _, pair := range strings.Fields(s) {
+		name, value, ok := strings.Cut(pair, "=")
+		n, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil {
+			continue
+		}
+		if fields == nil {
+			fields = map[string]float64{}
+		}
+		fields[name] = n
+	}
+	return fields
+}
+
+// FieldStats summarizes the values a field took in the requests of a mode.
+type FieldStats struct {
+	Mode, Name     string
+	Requests       int
+	Mean, P50, Max float64
+}
+
+// SummarizeFields returns the stats of every field parsed from the output of logs, by
+// mode and then name.
+func SummarizeFields(logs []ExecutionLog) []FieldStats {
+	values := map[[2]string][]float64{}
+	for _, log := range logs {
+		if log.Warmup || log.Fault != "" {
+			continue
+		}
+		for name, v := range log.Fields {
+			key := [2]string{log.Mode, name}
+			values[key] = append(values[key], v)
+		}
+	}
+	stats := make([]FieldStats, 0, len(values))
+	for key, vs := range values {
+		sort.Float64s(vs)
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		stats = append(stats, FieldStats{Mode: key[0], Name: key[1], Requests: len(vs),
+			Mean: sum / float64(len(vs)), P50: vs[(len(vs)-1)/2], Max: vs[len(vs)-1]})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Mode != stats[j].Mode {
+			return stats[i].Mode < stats[j].Mode
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// writeFields prints the stats of the fields parsed from the output of the requests.
+func writeFields(w io.Writer, logs []ExecutionLog) {
+	stats := SummarizeFields(logs)
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Fields parsed from responses:\n  %-16s %-16s %8s %14s %14s %14s\n", "", "", "requests", "mean", "p50", "max")
+	for _, s := range stats {
+		fmt.Fprintf(w, "  %-16s %-16s %8d %14.6g %14.6g %14.6g\n", s.Mode, s.Name, s.Requests, s.Mean, s.P50, s.Max)
+	}
+}
@@ -0,0 +1,62 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatDuration formats d for people to read, to three significant digits in the
+// largest unit below a minute it reaches, e.g. 850µs, 12.3ms or 1.05s, and to the second
+// above, e.g. 2m3s. Machine formats keep the exact value instead.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + FormatDuration(-d)
+	}
+	if d < time.Microsecond {
+		return d.String()
+	}
+	// Round first, so that e.g. 999.7µs becomes 1ms rather than 1000µs
+	if d < time.Minute {
+		d = d.Round(time.Duration(math.Pow10(int(math.Floor(math.Log10(float64(d)))) - 2)))
+	}
+	if d >= time.Minute {
+		return d.Round(time.Second).String()
+	}
+	for _, u := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"s", time.Second}, {"ms", time.Millisecond}, {"µs", time.Microsecond}} {
+		if d >= u.size {
+			return formatSignificant(float64(d)/float64(u.size)) + u.suffix
+		}
+	}
+	return d.String()
+}
+
+// formatSignificant formats v, from 1 to 1000, to three significant digits without
+// trailing zeros.
+func formatSignificant(v float64) string {
+	decimals := max(0, 2-int(math.Floor(math.Log10(v))))
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// FormatSize formats a number of bytes with one decimal in the largest binary unit it
+// reaches, e.g. 1.5KB.
+func FormatSize(n float64) string {
+	for _, u := range []struct {
+		suffix string
+		size   float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= u.size {
+			return fmt.Sprintf("%.1f%s", n/u.size, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%.0fB", n)
+}
@@ -0,0 +1,161 @@
+package profiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// realmFuncs caches the functions of each realm for -fuzzArgs.
+type realmFuncs struct {
+	mu    sync.Mutex
+	funcs map[string][]FuncSignature
+}
+
+// FuncSignature is a function of a realm, as vm/qfuncs describes it.
+type FuncSignature struct {
+	FuncName string
+	Params   []struct {
+		Name string
+		Type string
+	}
+}
+
+// fuzzable reports whether random arguments can be generated for every parameter of f.
+func (f FuncSignature) fuzzable() bool {
+	for _, p := range f.Params {
+		if !fuzzableType(p.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryFuncs returns the exported functions of the realm at pkgPath.
+func QueryFuncs(remote, pkgPath string) ([]FuncSignature, error) {
+	out, _, err := executeQuery(remote, "vm/qfuncs", []byte(pkgPath), 0)
+	if err != nil {
+		return nil, fmt.Errorf("querying the functions of %s: %w", pkgPath, err)
+	}
+	var funcs []FuncSignature
+	if err := json.Unmarshal(out, &funcs); err != nil {
+		return nil, fmt.Errorf("parsing the functions of %s: %w", pkgPath, err)
+	}
+	return funcs, nil
+}
+
+// withFuzzedArgs returns args calling -function, or a random function of the realm if
+// it is empty, with random arguments of the types it takes. The functions of each realm
+// are queried once.
+func (r *Run) withFuzzedArgs(packageName string, args Config) (Config, error) {
+	path := pkgPath(args, packageName)
+	r.funcs.mu.Lock()
+	funcs, ok := r.funcs.funcs[path]
+	if !ok {
+		all, err := QueryFuncs(args.Remote, path)
+		if err != nil {
+			r.funcs.mu.Unlock()
+			return args, err
+		}
+		for _, f := range all {
+			if f.fuzzable() && (args.FunctionName == "" || f.FuncName == args.FunctionName) {
+				funcs = append(funcs, f)
+			}
+		}
+		if r.funcs.funcs == nil {
+			r.funcs.funcs = map[string][]FuncSignature{}
+		}
+		// Cache realms without anything to fuzz too, so they aren't queried again
+		r.funcs.funcs[path] = funcs
+	}
+	r.funcs.mu.Unlock()
+	if len(funcs) == 0 {
+		return args, errors.New("no function of " + path + " takes only arguments that can be fuzzed")
+	}
+
+	f := funcs[randomIntn(len(funcs))]
+	args.FunctionName = f.FuncName
+	args.CallArgs = make([]string, len(f.Params))
+	for i, p := range f.Params {
+		args.CallArgs[i] = randomArg(p.Type, args.FuzzArgSize)
+	}
+	return args, nil
+}
+
+// argSize returns the bytes of arguments a call passes.
+func argSize(args Config) int64 {
+	var n int64
+	for _, arg := range args.CallArgs {
+		n += int64(len(arg))
+	}
+	return n
+}
+
+var intBits = map[string]int{"int": 64, "int8": 8, "int16": 16, "int32": 32, "rune": 32, "int64": 64}
+var uintBits = map[string]int{"uint": 64, "uint8": 8, "byte": 8, "uint16": 16, "uint32": 32, "uint64": 64}
+
+// fuzzableType reports whether gnokey can pass an argument of type typ, so that
+// randomArg can generate one.
+func fuzzableType(typ string) bool {
+	_, isInt := intBits[typ]
+	_, isUint := uintBits[typ]
+	switch typ {
+	case "string", "bool", "float32", "float64", "std.Address", "address":
+		return true
+	}
+	return isInt || isUint
+}
+
+// fuzzRunes are what random strings are made of, including multi-byte and special
+// characters.
+var fuzzRunes = []rune("abcXYZ019 _-./:'\"\\$`%{}<>\n\téü中文🙂")
+
+// randomArg returns a random value of type typ, as gnokey takes it. Edge values like 0
+// and the limits of numeric types come up often, and strings are up to maxSize bytes,
+// picked over every order of magnitude.
+func randomArg(typ string, maxSize int) string {
+	edge := randomIntn(4) == 0
+	if bits, ok := intBits[typ]; ok {
+		lo, hi := int64(-1)<<(bits-1), int64(1)<<(bits-1)-1
+		if edge {
+			return strconv.FormatInt([]int64{0, -1, 1, lo, hi}[randomIntn(5)], 10)
+		}
+		return strconv.FormatInt(int64(rangeFloat(float64(lo), float64(hi))), 10)
+	}
+	if bits, ok := uintBits[typ]; ok {
+		hi := uint64(math.MaxUint64) >> (64 - bits)
+		if edge {
+			return strconv.FormatUint([]uint64{0, 1, hi}[randomIntn(3)], 10)
+		}
+		return strconv.FormatUint(uint64(randomFloat64()*float64(hi)), 10)
+	}
+	switch typ {
+	case "bool":
+		return strconv.FormatBool(randomIntn(2) == 0)
+	case "float32", "float64":
+		if edge {
+			return []string{"0", "-0", "1e-300", "-1e300", "3.4028235e38"}[randomIntn(5)]
+		}
+		return strconv.FormatFloat(rangeFloat(-1e9, 1e9), 'g', -1, 64)
+	case "std.Address", "address":
+		// Most random addresses fail the bech32 checksum, which is worth testing too
+		return "g1" + randomString(38)
+	}
+	size := 0
+	if maxSize > 0 {
+		size = int(Range{1, int64(maxSize) + 1}.random()) - 1
+	}
+	var b strings.Builder
+	for b.Len() < size {
+		b.WriteRune(fuzzRunes[randomIntn(len(fuzzRunes))])
+	}
+	return b.String()
+}
+
+func rangeFloat(lo, hi float64) float64 {
+	return lo + randomFloat64()*(hi-lo)
+}
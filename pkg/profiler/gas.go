@@ -0,0 +1,181 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GasEstimates are the values of -gasEstimate: off uses -gasWanted, once simulates the
+// first transaction of each kind and each simulates every transaction.
+var GasEstimates = []string{"off", "once", "each"}
+
+// gasEstimates caches the gas wanted per kind of transaction for -gasEstimate once.
+type gasEstimates struct {
+	mu     sync.Mutex
+	wanted map[string]int64
+}
+
+// gasKey identifies the kind of a transaction: calls of the same function, or packages
+// deployed from the same directory, use about the same gas.
+func gasKey(mode, packageName string, args Config) string {
+	if mode == "addpkg" {
+		return mode + " " + args.PkgDir + " " + args.Workload
+	}
+	if mode == "run" {
+		return mode + " " + args.RunFile
+	}
+	return mode + " " + pkgPath(args, packageName) + " " + args.FunctionName
+}
+
+// withGas returns args with the gas wanted and fee of the transaction: picked at random
+// with -fuzzGasWanted and -fuzzGasFee, or with -gasEstimate the gas used by a simulation
+// of the transaction times -gasAdjustment. The simulation happens before the request is
+// timed. If it fails, args are left alone and -gasWanted is used.
+func (r *Run) withGas(mode, packageName string, args Config) Config {
+	if !isTxMode(mode) {
+		return args
+	}
+	if !args.FuzzGasWanted.IsZero() {
+		args.GasWanted = args.FuzzGasWanted.random()
+	}
+	if !args.FuzzGasFee.IsZero() {
+		args.GasFee = args.FuzzGasFee.random()
+	}
+	if args.GasEstimate == "" || args.GasEstimate == "off" {
+		return args
+	}
+	key := gasKey(mode, packageName, args)
+	if args.GasEstimate == "once" {
+		r.gas.mu.Lock()
+		defer r.gas.mu.Unlock()
+		if wanted, ok := r.gas.wanted[key]; ok {
+			args.GasWanted = wanted
+			return args
+		}
+	}
+
+	simulate := args
+	simulate.Simulate = true
+	out, _, err := r.executor.Execute(mode, packageName, simulate)
+	m := gasUsedPattern.FindStringSubmatch(out)
+	if err != nil || m == nil {
+		fmt.Println("WARNING: Failed to estimate gas, using gasWanted:", err)
+		return args
+	}
+	used, _ := strconv.ParseInt(m[1], 10, 64)
+	args.GasWanted = int64(math.Ceil(float64(used) * args.GasAdjustment))
+	if args.GasEstimate == "once" {
+		if r.gas.wanted == nil {
+			r.gas.wanted = map[string]int64{}
+		}
+		r.gas.wanted[key] = args.GasWanted
+		fmt.Printf("INFO: Estimated %d gas for %s, using %d\n", used, key, args.GasWanted)
+	}
+	return args
+}
+
+// Range is an inclusive range of integers, e.g. of gas for -fuzzGasWanted. The zero
+// Range is unset.
+type Range struct {
+	Min, Max int64
+}
+
+// ParseRange parses a range like 1000-2000000, or a single number.
+func ParseRange(s string) (Range, error) {
+	lo, hi, found := strings.Cut(s, "-")
+	if !found {
+		hi = lo
+	}
+	var rg Range
+	var err1, err2 error
+	rg.Min, err1 = strconv.ParseInt(strings.TrimSpace(lo), 10, 64)
+	rg.Max, err2 = strconv.ParseInt(strings.TrimSpace(hi), 10, 64)
+	if err1 != nil || err2 != nil {
+		return Range{}, fmt.Errorf("invalid range %q: expected MIN-MAX, e.g. 1000-2000000", s)
+	}
+	if rg.Min <= 0 || rg.Max < rg.Min {
+		return Range{}, errors.New("range must be positive with MIN at most MAX")
+	}
+	return rg, nil
+}
+
+func (rg Range) String() string {
+	if rg.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", rg.Min, rg.Max)
+}
+
+// IsZero reports whether the range is unset.
+func (rg Range) IsZero() bool {
+	return rg == Range{}
+}
+
+// random picks a value log-uniformly, so that a range over several orders of magnitude
+// tries small values, which are the ones that get rejected, as often as large ones.
+func (rg Range) random() int64 {
+	if rg.Min == rg.Max {
+		return rg.Min
+	}
+	lo, hi := math.Log(float64(rg.Min)), math.Log(float64(rg.Max))
+	return min(max(int64(math.Round(math.Exp(lo+randomFloat64()*(hi-lo)))), rg.Min), rg.Max)
+}
+
+// WriteGasFuzz prints how the node handled the transactions of a -fuzzGasWanted or
+// -fuzzGasFee run: for each outcome, how many there were, how quickly they were answered
+// and the gas and fees they offered and paid.
+func WriteGasFuzz(w io.Writer, logs []ExecutionLog) {
+	type outcome struct {
+		durations        []time.Duration
+		wanted, fee      Range
+		gasUsed, feePaid int64
+	}
+	widen := func(rg *Range, v int64) {
+		if rg.IsZero() {
+			*rg = Range{v, v}
+		}
+		rg.Min, rg.Max = min(rg.Min, v), max(rg.Max, v)
+	}
+	outcomes := map[string]*outcome{}
+	for _, log := range logs {
+		if log.Warmup || log.GasWanted == 0 {
+			continue
+		}
+		code := log.ErrorCode
+		if code == "" {
+			code = "ok"
+		}
+		o := outcomes[code]
+		if o == nil {
+			o = &outcome{}
+			outcomes[code] = o
+		}
+		o.durations = append(o.durations, log.ResponseTime)
+		widen(&o.wanted, log.GasWanted)
+		widen(&o.fee, log.GasFee)
+		o.gasUsed += log.GasUsed
+		o.feePaid += log.Fee
+	}
+	if len(outcomes) == 0 {
+		return
+	}
+	codes := make([]string, 0, len(outcomes))
+	for code := range outcomes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	fmt.Fprintf(w, "Gas fuzzing by outcome:\n  %-20s %8s %12s %22s %26s %14s\n", "", "requests", "p50", "gas wanted", "gas fee offered", "fees paid")
+	for _, code := range codes {
+		o := outcomes[code]
+		sort.Slice(o.durations, func(i, j int) bool { return o.durations[i] < o.durations[j] })
+		fmt.Fprintf(w, "  %-20s %8d %12v %22s %26s %14d\n", code, len(o.durations),
+			FormatDuration(percentile(o.durations, 50)), o.wanted, o.fee.String()+"ugnot", o.feePaid)
+	}
+}
@@ -0,0 +1,75 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// packageSpec describes the synthetic package deployed by addpkg modes with -generate.
+type packageSpec struct {
+	Funcs   int // number of exported functions besides Main
+	Size    int // pad the source with comments up to this many bytes
+	Imports int // number of standard library packages imported
+}
+
+// generatorImports are standard library packages the generator can import, each with an
+// expression that uses it so the package compiles.
+var generatorImports = []struct {
+	path string
+	use  string
+}{
+	{"strings", `strings.ToUpper("a")`},
+	{"strconv", `strconv.Itoa(1)`},
+	{"errors", `errors.New("a")`},
+	{"bytes", `bytes.ToUpper([]byte("a"))`},
+	{"math", `math.Abs(-1)`},
+	{"sort", `sort.IntsAreSorted([]int{1})`},
+	{"unicode/utf8", `utf8.RuneLen('a')`},
+}
+
+// MaxGenImports is the largest number of imports generated packages can have.
+var MaxGenImports = len(generatorImports)
+
+func generatePackage(name string, spec packageSpec) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by realm-profiler. DO NOT EDIT.\npackage %s\n\n", name)
+
+	if spec.Imports > 0 {
+		b.WriteString("import (\n")
+		for _, imp := range generatorImports[:spec.Imports] {
+			fmt.Fprintf(&b, "\t%q\n", imp.path)
+		}
+		b.WriteString(")\n\nfunc useImports() {\n")
+		for _, imp := range generatorImports[:spec.Imports] {
+			fmt.Fprintf(&b, "\t_ = %s\n", imp.use)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	for i := 0; i < spec.Funcs; i++ {
+		fmt.Fprintf(&b, "func F%d(x int) int {\n\treturn x*%d + %d\n}\n\n", i, i+1, i)
+	}
+	b.WriteString("func main() {}\n\nfunc Main() { main() }\n")
+
+	const filler = "// padding to reach the requested source size\n"
+	for b.Len()+len(filler) <= spec.Size {
+		b.WriteString(filler)
+	}
+	return b.String()
+}
+
+// writePackage writes a single file package to a new temporary directory, which the
+// caller must remove.
+func writePackage(name, src string) (string, error) {
+	dir, err := os.MkdirTemp("", "realm-profiler-")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".gno"), []byte(src), 0o644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
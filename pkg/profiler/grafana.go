@@ -0,0 +1,120 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GrafanaDatasources are the kinds of datasource a dashboard can be generated for:
+// prometheus for the metrics of -pushgateway, graphite for those of -statsd.
+var GrafanaDatasources = []string{"prometheus", "graphite"}
+
+// grafanaPanel is a time series panel and the queries it plots.
+type grafanaPanel struct {
+	title   string
+	unit    string
+	queries []grafanaQuery
+}
+
+// grafanaQuery is a PromQL expression or a Graphite target. Graphite names its series
+// with aliasByNode instead of a legend.
+type grafanaQuery struct {
+	expr   string
+	legend string
+}
+
+// WriteGrafanaDashboard writes a dashboard to import into Grafana, plotting the metrics
+// a run sends to datasource. job is the -pushJob of the Prometheus metrics and prefix
+// the -statsdPrefix of the Graphite ones. The datasource itself is asked for on import.
+func WriteGrafanaDashboard(w io.Writer, datasource, job, prefix string) error {
+	var panels []grafanaPanel
+	switch datasource {
+	case "prometheus":
+		panels = prometheusPanels(job)
+	case "graphite":
+		panels = graphitePanels(prefix)
+	default:
+		return fmt.Errorf("datasource must be one of %s", strings.Join(GrafanaDatasources, ", "))
+	}
+
+	ds := map[string]any{"type": datasource, "uid": "${DS}"}
+	var list []map[string]any
+	for i, p := range panels {
+		var targets []map[string]any
+		for j, q := range p.queries {
+			target := map[string]any{"refId": string(rune('A' + j)), "datasource": ds}
+			if datasource == "prometheus" {
+				target["expr"], target["legendFormat"] = q.expr, q.legend
+			} else {
+				target["target"] = q.expr
+			}
+			targets = append(targets, target)
+		}
+		list = append(list, map[string]any{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       p.title,
+			"datasource":  ds,
+			"gridPos":     map[string]int{"h": 8, "w": 12, "x": i % 2 * 12, "y": i / 2 * 8},
+			"fieldConfig": map[string]any{"defaults": map[string]any{"unit": p.unit}, "overrides": []any{}},
+			"targets":     targets,
+		})
+	}
+	name := map[string]string{"prometheus": "Prometheus", "graphite": "Graphite"}[datasource]
+	dashboard := map[string]any{
+		"__inputs": []map[string]string{{
+			"name":        "DS",
+			"label":       name,
+			"description": "Where realm-profiler's metrics are stored",
+			"type":        "datasource",
+			"pluginId":    datasource,
+			"pluginName":  name,
+		}},
+		"title":         "realm-profiler (" + name + ")",
+		"uid":           "realm-profiler-" + datasource,
+		"tags":          []string{"realm-profiler"},
+		"schemaVersion": 39,
+		"editable":      true,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"panels":        list,
+	}
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// prometheusPanels plot the summary of each run pushed by -pushgateway.
+func prometheusPanels(job string) []grafanaPanel {
+	sel := fmt.Sprintf(`{job=%q}`, job)
+	return []grafanaPanel{
+		{"Latency", "s", []grafanaQuery{{"realm_profiler_latency_seconds" + sel, "{{mode}} {{remote}} q{{quantile}}"}}},
+		{"Error rate", "percentunit", []grafanaQuery{{"realm_profiler_error_rate" + sel, "{{mode}} {{remote}}"}}},
+		{"Throughput", "reqps", []grafanaQuery{{"realm_profiler_throughput" + sel, "{{mode}} {{remote}}"}}},
+		{"Errors by code", "short", []grafanaQuery{{"realm_profiler_errors" + sel, "{{mode}} {{code}}"}}},
+		{"Requests", "short", []grafanaQuery{
+			{"realm_profiler_requests" + sel, "{{mode}} requests"},
+			{"realm_profiler_failed" + sel, "{{mode}} failed"},
+			{"realm_profiler_invalid" + sel, "{{mode}} invalid"},
+		}},
+		{"Fees", "short", []grafanaQuery{{"realm_profiler_fee_ugnot" + sel, "{{mode}} ugnot"}}},
+	}
+}
+
+// graphitePanels plot what statsd makes of the metrics of -statsd, with its default
+// settings: timers under stats.timers with a 90th percentile, per-second counter rates
+// under stats and gauges under stats.gauges.
+func graphitePanels(prefix string) []grafanaPanel {
+	n := strings.Count(prefix, ".") + 1 // nodes of the prefix, for aliasByNode
+	return []grafanaPanel{
+		{"Latency", "ms", []grafanaQuery{{expr: fmt.Sprintf("aliasByNode(stats.timers.%s.*.responseTime.{median,upper_90}, %d, %d)", prefix, n+2, n+4)}}},
+		{"Throughput", "reqps", []grafanaQuery{{expr: fmt.Sprintf("aliasByNode(stats.%s.*.requests, %d)", prefix, n+1)}}},
+		{"Errors by code", "reqps", []grafanaQuery{{expr: fmt.Sprintf("aliasByNode(stats.%s.*.errors.*, %d, %d)", prefix, n+1, n+3)}}},
+		{"Active workers", "short", []grafanaQuery{{expr: fmt.Sprintf("aliasByNode(stats.gauges.%s.activeWorkers, %d)", prefix, n+2)}}},
+	}
+}
@@ -0,0 +1,105 @@
+package profiler
+
+import (
+	"maps"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histogramSubBuckets is the number of buckets per power of two of microseconds. Below
+// that many microseconds buckets are exact; above, they are within 1/32 of the value.
+const histogramSubBuckets = 64
+
+// latencyHistogram counts response times in a bounded number of buckets, so percentiles
+// can be estimated without keeping every sample.
+type latencyHistogram struct {
+	counts []int64
+	total  int64
+	max    time.Duration
+}
+
+func histogramBucket(d time.Duration) int {
+	v := uint64(max(d, 0) / time.Microsecond)
+	if v < histogramSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - bits.Len64(histogramSubBuckets-1)
+	return shift*histogramSubBuckets + int(v>>shift)
+}
+
+// histogramUpperBound returns the largest duration in bucket i.
+func histogramUpperBound(i int) time.Duration {
+	shift, m := i/histogramSubBuckets, i%histogramSubBuckets
+	return time.Duration((m+1)<<shift)*time.Microsecond - 1
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	i := histogramBucket(d)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile estimates the nearest-rank percentile p (0-100), never above the maximum.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := max(int64(math.Ceil(p/100*float64(h.total))), 1)
+	var seen int64
+	for i, n := range h.counts {
+		if seen += n; seen >= rank {
+			return min(histogramUpperBound(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// aggregate keeps the summary of every request of a run, for when -sampleRate or
+// -reservoir drop most of the samples themselves.
+type aggregate struct {
+	stats Summary
+	hist  latencyHistogram
+}
+
+func newAggregate() *aggregate {
+	return &aggregate{stats: Summary{Errors: map[string]int{}, Costs: map[string]Cost{}}}
+}
+
+func (a *aggregate) add(log ExecutionLog) {
+	a.stats.addCost(log)
+	if log.Warmup {
+		a.stats.Warmup++
+		return
+	}
+	if log.Fault != "" {
+		a.stats.Malformed++
+		return
+	}
+	a.stats.Requests++
+	switch {
+	case !log.Success:
+		a.stats.Failed++
+	case !log.Valid:
+		a.stats.Invalid++
+	}
+	if log.ErrorCode != "" {
+		a.stats.Errors[log.ErrorCode]++
+	}
+	a.hist.add(log.ResponseTime)
+}
+
+func (a *aggregate) summary() Summary {
+	stats := a.stats
+	stats.Errors = maps.Clone(a.stats.Errors)
+	stats.Costs = maps.Clone(a.stats.Costs)
+	stats.P50 = a.hist.percentile(50)
+	stats.P95 = a.hist.percentile(95)
+	stats.P99 = a.hist.percentile(99)
+	stats.Max = a.hist.max
+	return stats
+}
@@ -0,0 +1,87 @@
+package profiler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// inflightLimit caps the requests in flight across all workers of a run at -maxInflight,
+// so that a node that stalls doesn't pile up goroutines and gnokey processes on the
+// machine generating the load. Workers only send one request at a time, but replay
+// starts every scheduled request on its own goroutine whether the ones before it have
+// completed or not.
+type inflightLimit struct {
+	slots  chan struct{} // nil without -maxInflight
+	waited atomic.Int64  // requests that had to wait for a slot
+}
+
+func newInflightLimit(n int) *inflightLimit {
+	l := &inflightLimit{}
+	if n > 0 {
+		l.slots = make(chan struct{}, n)
+	}
+	return l
+}
+
+// acquire waits for a free slot. It returns false if done is closed first.
+func (l *inflightLimit) acquire(done <-chan struct{}) bool {
+	if l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	l.waited.Add(1)
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// release frees the slot acquire took.
+func (l *inflightLimit) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// acquireSlot waits until fewer than -maxInflight requests are in flight, to the node
+// and to -compareRemote, and then for one of the -maxProcs subprocesses if set, and
+// takes a slot for the next request. It returns how long the request queued for a
+// subprocess, or false if the run is stopped first.
+func (r *Run) acquireSlot() (time.Duration, bool) {
+	if !r.inflight.acquire(r.done) {
+		return 0, false
+	}
+	if r.mirror != nil && !r.mirror.reserve() {
+		r.inflight.release()
+		return 0, false
+	}
+	if r.procs == nil {
+		return 0, true
+	}
+	return r.procs.acquire(), true
+}
+
+// releaseSlot frees the slots acquireSlot took once the request has completed. The slot
+// of its -compareRemote copy is freed once that completes.
+func (r *Run) releaseSlot() {
+	if r.procs != nil {
+		r.procs.release()
+	}
+	r.inflight.release()
+}
+
+// InflightWaits returns how many requests had to wait for another to complete because
+// -maxInflight were already in flight, to the node or to -compareRemote.
+func (r *Run) InflightWaits() int64 {
+	n := r.inflight.waited.Load()
+	if r.mirror != nil {
+		n += r.mirror.inflight.waited.Load()
+	}
+	return n
+}
@@ -0,0 +1,37 @@
+package profiler
+
+import (
+	"fmt"
+	"slices"
+)
+
+// JourneySteps are the modes a -steps journey can be made of.
+var JourneySteps = []string{"addpkg", "call", "qrender", "qdoc", "balanceQuery"}
+
+// journeyScript turns the -steps of a journey into the script every virtual user runs.
+// Steps after an addpkg target the package it deployed; steps before one target
+// -package. Calls use -function, or Main without it.
+func journeyScript(args Config) (*Script, error) {
+	function := args.FunctionName
+	if function == "" {
+		function = "Main"
+	}
+	s := &Script{}
+	for i, step := range args.Steps {
+		if !slices.Contains(JourneySteps, step) {
+			return nil, fmt.Errorf("unknown journey step %q", step)
+		}
+		st := scriptStatement{op: step, chance: 1, step: fmt.Sprintf("%d:%s", i+1, step)}
+		switch step {
+		case "call":
+			st.words = []string{"$package", function}
+		case "qrender", "qdoc":
+			st.words = []string{"$package"}
+		}
+		s.statements = append(s.statements, st)
+	}
+	if len(s.statements) == 0 {
+		return nil, fmt.Errorf("a journey needs at least one step")
+	}
+	return s, nil
+}
@@ -0,0 +1,72 @@
+package profiler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+// junitOutput is CDATA so that the summary keeps its line breaks readable.
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a run as a JUnit XML test suite for CI systems: one test case for the
+// scenario itself, which fails with failure if that isn't empty (e.g. the run was
+// aborted), and one per -assert.
+func WriteJUnit(w io.Writer, scenario string, elapsed time.Duration, summary string, failure string, assertions []AssertionResult) error {
+	seconds := fmt.Sprintf("%.3f", elapsed.Seconds())
+	run := junitCase{Name: scenario, ClassName: "realm-profiler.scenario", Time: seconds, SystemOut: &junitOutput{summary}}
+	if failure != "" {
+		run.Failure = &junitFailure{Message: failure, Text: failure}
+	}
+	suite := junitSuite{Name: "realm-profiler", Time: seconds, Cases: []junitCase{run}}
+	for _, a := range assertions {
+		c := junitCase{Name: a.Assertion, ClassName: "realm-profiler.assertion", Time: "0"}
+		if !a.Passed {
+			message := fmt.Sprintf("%s failed: actual value %s", a.Assertion, a.Value)
+			c.Failure = &junitFailure{Message: message, Text: message}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,138 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Keybases are the values of -keybase.
+var Keybases = []string{"shared", "serialize", "copy"}
+
+// keybase hands out the gnokey home directories transactions are signed with. gnokey
+// locks its on-disk keybase while it runs, so concurrent transactions can fail on one
+// another's lock. gnokey maketx --broadcast only returns once the transaction is
+// committed, so a home is held for the whole transaction, not only while it is signed:
+// with -keybase serialize one transaction is in flight at a time, and with -keybase copy
+// one per worker thread, each with its own copy of the home made at startup.
+type keybase struct {
+	homes  chan string // free homes; nil with -keybase shared
+	copies string      // temporary directory of the copies, if any
+	locked atomic.Int64
+	waited atomic.Int64
+	wait   atomic.Int64 // nanoseconds
+}
+
+// KeybaseStats is how often transactions of a run contended for the keybase.
+type KeybaseStats struct {
+	Locked int64         // transactions that failed because the keybase was locked
+	Waited int64         // transactions that waited for a keybase to be free
+	Wait   time.Duration // waited in total
+}
+
+func newKeybase(args Config) (*keybase, error) {
+	k := &keybase{}
+	switch args.Keybase {
+	case "serialize":
+		k.homes = make(chan string, 1)
+		k.homes <- args.Home
+	case "copy":
+		src := args.Home
+		if src == "" {
+			src = gnoHome()
+		}
+		dir, err := os.MkdirTemp("", "realm-profiler-keybase-")
+		if err != nil {
+			return nil, err
+		}
+		k.copies = dir
+		k.homes = make(chan string, args.MaxThreads)
+		for i := range args.MaxThreads {
+			home := filepath.Join(dir, strconv.Itoa(i))
+			if err := os.CopyFS(home, os.DirFS(src)); err != nil {
+				k.close()
+				return nil, fmt.Errorf("copying gnokey home %s: %w", src, err)
+			}
+			k.homes <- home
+		}
+		fmt.Println("INFO: Copied gnokey home", src, "for", args.MaxThreads, "worker threads")
+	}
+	return k, nil
+}
+
+// gnoHome returns the home directory gnokey uses when it isn't given --home.
+func gnoHome() string {
+	if home := os.Getenv("GNOHOME"); home != "" {
+		return home
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gno")
+}
+
+// close removes the copies of the home.
+func (k *keybase) close() {
+	if k.copies != "" {
+		os.RemoveAll(k.copies)
+	}
+}
+
+// keybaseExecutor signs every transaction with a home of the keybase, waiting for one to
+// be free, and counts the transactions that failed on a locked keybase. The wait is part
+// of the response time, since it is how long the transaction took to send.
+type keybaseExecutor struct {
+	Executor
+	keybase *keybase
+}
+
+func (e keybaseExecutor) Execute(mode, packageName string, args Config) (string, HTTPTiming, error) {
+	if !isTxMode(mode) {
+		return e.Executor.Execute(mode, packageName, args)
+	}
+	if k := e.keybase; k.homes != nil {
+		select {
+		case args.Home = <-k.homes:
+		default:
+			start := time.Now()
+			args.Home = <-k.homes
+			k.waited.Add(1)
+			k.wait.Add(int64(time.Since(start)))
+		}
+		defer func() { k.homes <- args.Home }()
+	}
+	out, timing, err := e.Executor.Execute(mode, packageName, args)
+	if err != nil && classifyError(out, err, nil) == ErrKeybaseLocked {
+		e.keybase.locked.Add(1)
+	}
+	return out, timing, err
+}
+
+// Keybase returns how often the transactions of the run contended for the keybase.
+func (r *Run) Keybase() KeybaseStats {
+	return KeybaseStats{
+		Locked: r.keybase.locked.Load(),
+		Waited: r.keybase.waited.Load(),
+		Wait:   time.Duration(r.keybase.wait.Load()),
+	}
+}
+
+// WriteKeybase prints how often transactions contended for the keybase under -keybase
+// mode, if they did at all.
+func WriteKeybase(w io.Writer, s KeybaseStats, mode string) {
+	if s.Locked > 0 {
+		fmt.Fprintf(w, "Keybase lock contention: %d transactions failed on a locked keybase\n", s.Locked)
+		if mode == "shared" {
+			fmt.Fprintln(w, "WARNING: Concurrent gnokey processes contended for the keybase; use -keybase serialize or -keybase copy.")
+		}
+	}
+	if s.Waited > 0 {
+		fmt.Fprintf(w, "Keybase waits: %d transactions waited for the keybase with -keybase %s, %s on average, included in their response times\n",
+			s.Waited, mode, FormatDuration(s.Wait/time.Duration(s.Waited)))
+	}
+}
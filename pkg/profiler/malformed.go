@@ -0,0 +1,76 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Faults -malformed breaks requests with, recorded in the Fault column.
+const (
+	FaultPkgPath  = "badPkgPath"  // a package that doesn't exist, or can't be deployed
+	FaultFunction = "badFunction" // a function the realm doesn't have
+	FaultChainID  = "badChainID"  // signed for another chain
+)
+
+// malform breaks a request in mode with one of the faults that apply to it, picked at
+// random, and returns the broken package name and args with the fault.
+func malform(mode, packageName string, args Config) (string, Config, string) {
+	faults := []string{FaultPkgPath}
+	if mode == "call" {
+		faults = append(faults, FaultFunction)
+	}
+	if mode != "qrender" && mode != "qdoc" {
+		faults = append(faults, FaultChainID)
+	}
+	fault := faults[randomIntn(len(faults))]
+	switch fault {
+	case FaultPkgPath:
+		if mode == "addpkg" {
+			// Only r/ and p/ packages can be deployed
+			packageName = "gno.land/x/" + randomPackageName(args)
+		} else {
+			packageName = pkgPath(args, "missing_"+randomString(8))
+		}
+	case FaultFunction:
+		args.FunctionName = "Missing" + randomString(8)
+	case FaultChainID:
+		args.ChainID += "-wrong"
+	}
+	return packageName, args, fault
+}
+
+// SummarizeFaults computes a summary per Fault of the requests -malformed broke, returning
+// the faults sorted. It returns nothing for runs without any.
+func SummarizeFaults(logs []ExecutionLog) ([]string, map[string]Summary) {
+	byFault := map[string][]ExecutionLog{}
+	for _, log := range logs {
+		if fault := log.Fault; fault != "" {
+			log.Fault = ""
+			byFault[fault] = append(byFault[fault], log)
+		}
+	}
+	faults := make([]string, 0, len(byFault))
+	summaries := make(map[string]Summary, len(byFault))
+	for fault, faultLogs := range byFault {
+		faults = append(faults, fault)
+		summaries[fault] = Summarize(faultLogs)
+	}
+	sort.Strings(faults)
+	return faults, summaries
+}
+
+// writeFaults prints how the node answered the requests -malformed broke. Each of them
+// should be rejected, and quickly.
+func writeFaults(w io.Writer, logs []ExecutionLog) {
+	faults, byFault := SummarizeFaults(logs)
+	if len(faults) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Malformed requests by fault:\n  %-16s %8s %8s %12s %12s %12s\n", "", "requests", "accepted", "p50", "p95", "p99")
+	for _, fault := range faults {
+		s := byFault[fault]
+		fmt.Fprintf(w, "  %-16s %8d %8d %12v %12v %12v\n", fault, s.Requests, s.Requests-s.Failed,
+			FormatDuration(s.P50), FormatDuration(s.P95), FormatDuration(s.P99))
+	}
+}
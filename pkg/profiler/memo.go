@@ -0,0 +1,31 @@
+package profiler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// isTxMode reports whether requests in mode send a single transaction.
+func isTxMode(mode string) bool {
+	return mode == "addpkg" || mode == "call" || mode == "run"
+}
+
+// txArgs returns args for sending a transaction in mode, with its -memo and gas.
+func (r *Run) txArgs(mode, packageName string, args Config) Config {
+	return r.withGas(mode, packageName, r.withMemo(mode, args))
+}
+
+// withMemo returns args with -memo expanded for the next transaction: $run becomes the
+// start time of the run, $request the number of the transaction in the run and $mode
+// the mode, so that the transactions of a run can be told apart on-chain.
+func (r *Run) withMemo(mode string, args Config) Config {
+	if args.Memo == "" || !isTxMode(mode) {
+		return args
+	}
+	args.Memo = strings.NewReplacer(
+		"$run", r.start.UTC().Format("20060102T150405Z"),
+		"$request", strconv.FormatInt(r.memos.Add(1), 10),
+		"$mode", mode,
+	).Replace(args.Memo)
+	return args
+}
@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mirrorExecutor sends every request to -compareRemote as well, at the same moment, so
+// that two nodes can be compared on identical load. The caller records the primary
+// result as usual; the mirrored one is recorded as its own sample with its Target set.
+// Mirrored requests are capped at -maxInflight of their own, and a request waits to be
+// sent while they are, so that a stalling -compareRemote holds the load back instead of
+// piling up goroutines and gnokey processes.
+type mirrorExecutor struct {
+	Executor
+	mirror   Executor
+	args     Config // args with Remote set to -compareRemote
+	run      *Run
+	inflight *inflightLimit
+	reserved atomic.Int64 // slots taken by acquireSlot for the next requests
+	wg       sync.WaitGroup
+
+	// Mirrored requests to a package wait for the previous one to it, so that e.g. a
+	// journey's call doesn't overtake the addpkg deploying its package
+	mu      sync.Mutex
+	pending map[string]chan struct{} // by package path, closed when the request is done
+}
+
+// reserve takes a slot for the mirrored copy of the next request, before its clock
+// starts. It returns false if the run is stopped first.
+func (e *mirrorExecutor) reserve() bool {
+	if !e.inflight.acquire(e.run.done) {
+		return false
+	}
+	e.reserved.Add(1)
+	return true
+}
+
+// takeSlot uses a reserved slot if there is one, and otherwise waits for one, e.g. for
+// the gas simulations sent outside acquireSlot.
+func (e *mirrorExecutor) takeSlot() bool {
+	for n := e.reserved.Load(); n > 0; n = e.reserved.Load() {
+		if e.reserved.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+	return e.inflight.acquire(e.run.done)
+}
+
+func (e *mirrorExecutor) Execute(mode, packageName string, args Config) (string, HTTPTiming, error) {
+	if !e.takeSlot() {
+		return e.Executor.Execute(mode, packageName, args)
+	}
+	req := newScheduledRequest(time.Since(e.run.start), mode, packageName, args)
+	var previous chan struct{}
+	done := make(chan struct{})
+	if req.Package != "" {
+		e.mu.Lock()
+		previous = e.pending[req.Package]
+		e.pending[req.Package] = done
+		e.mu.Unlock()
+	}
+	e.wg.Add(1)
+	go func() {
+		defer func() {
+			e.inflight.release()
+			e.wg.Done()
+		}()
+		if previous != nil {
+			<-previous
+		}
+		var wait time.Duration
+		if e.run.procs != nil {
+			wait = e.run.procs.acquire()
+		}
+		e.run.sendScheduled(e.mirror, e.args, req, e.args.Remote, wait)
+		if e.run.procs != nil {
+			e.run.procs.release()
+		}
+		close(done)
+		e.mu.Lock()
+		if e.pending[req.Package] == done {
+			delete(e.pending, req.Package)
+		}
+		e.mu.Unlock()
+	}()
+	return e.Executor.Execute(mode, packageName, args)
+}
+
+// FilterTarget returns the samples of an A/B run that were sent to target.
+func FilterTarget(logs []ExecutionLog, target string) []ExecutionLog {
+	var filtered []ExecutionLog
+	for _, log := range logs {
+		if log.Target == target {
+			filtered = append(filtered, log)
+		}
+	}
+	return filtered
+}
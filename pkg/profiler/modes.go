@@ -0,0 +1,354 @@
+package profiler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Mode is a kind of request that one command sends, e.g. a gnokey subcommand. New ones
+// are added with RegisterMode, e.g. from a plugin, without changing the profiler.
+type Mode interface {
+	// Command returns the command line sending a request against path, the full path
+	// of the package the request is for.
+	Command(path string, args Config) string
+	// Validate returns the problems with args in the mode, e.g. missing flags.
+	Validate(args Config) []error
+	// ParseResult returns an error if out, the output of a command that exited
+	// successfully, shows the request failed anyway.
+	ParseResult(out string) error
+}
+
+// RunModes are the modes a Run carries out itself, by combining the requests of other
+// modes or sending other commands, rather than through a registered Mode.
+var RunModes = []string{"addpkg+call", "calibrate", "verify", "journey", "script", "replay"}
+
+// modes are the registered Modes, by name.
+var modes = map[string]Mode{
+	"addpkg": commandMode{
+		command: func(path string, args Config) string {
+			deposit := ""
+			if args.Deposit != "" {
+				deposit = "--deposit " + args.Deposit + " "
+			}
+			return fmt.Sprintf("gnokey maketx addpkg --pkgpath '%s' --pkgdir %s %s", path, args.PkgDir, deposit) + txFlags(args)
+		},
+		validate: func(args Config) []error {
+			if args.FunctionName != "" {
+				return []error{errors.New("function argument should not be provided in addpkg mode")}
+			}
+			return nil
+		},
+	},
+	"call": commandMode{
+		command: func(path string, args Config) string {
+			functionName := args.FunctionName
+			if functionName == "" {
+				functionName = "Main"
+			}
+			var callArgs strings.Builder
+			for _, arg := range args.CallArgs {
+				fmt.Fprintf(&callArgs, "--args %s ", shellQuote(arg))
+			}
+			if args.Send != "" {
+				fmt.Fprintf(&callArgs, "--send %s ", args.Send)
+			}
+			return fmt.Sprintf("gnokey maketx call --pkgpath '%s' --func %s %s", path, functionName, callArgs.String()) + txFlags(args)
+		},
+		validate: func(args Config) []error {
+			if args.PackageName == "" && args.TargetsFile == "" {
+				return []error{errors.New("package or targets argument must be specified in call mode.")}
+			}
+			return nil
+		},
+	},
+	"run": commandMode{
+		command: func(path string, args Config) string {
+			return "gnokey maketx run " + txFlags(args) + " " + shellQuote(args.RunFile)
+		},
+		validate: func(args Config) []error {
+			var errs []error
+			if args.RunFile == "" {
+				errs = append(errs, errors.New("runFile must be specified in run mode."))
+			} else if _, err := os.Stat(args.RunFile); err != nil {
+				errs = append(errs, err)
+			}
+			if args.PackageName != "" || args.FunctionName != "" || args.TargetsFile != "" {
+				errs = append(errs, errors.New("Cannot specify package, function or targets in run mode; the script says what it calls."))
+			}
+			if args.Record != "" {
+				errs = append(errs, errors.New("Cannot record run mode."))
+			}
+			return errs
+		},
+	},
+	"balanceQuery": commandMode{
+		command: func(string, Config) string { return BalanceQuery },
+		validate: func(args Config) []error {
+			var errs []error
+			if args.PackageName != "" {
+				errs = append(errs, errors.New("Cannot specify packageName in balanceQuery mode."))
+			}
+			if args.FunctionName != "" {
+				errs = append(errs, errors.New("Cannot specify function in balanceQuery mode."))
+			}
+			if args.PkgDir != "." {
+				errs = append(errs, errors.New("Cannot specify pkgDir in balanceQuery mode."))
+			}
+			return errs
+		},
+	},
+	"qrender": commandMode{
+		command: func(path string, args Config) string {
+			return fmt.Sprintf("gnokey query vm/qrender --data '%s:%s' --remote %s", path, args.RenderPath, args.Remote)
+		},
+		validate: validateQuery,
+	},
+	"qdoc": commandMode{
+		command: func(path string, args Config) string {
+			return fmt.Sprintf("gnokey query vm/qdoc --data '%s' --remote %s", path, args.Remote)
+		},
+		validate: validateQuery,
+	},
+	"custom": &customMode{parsed: map[string]*template.Template{}},
+}
+
+// RegisterMode makes a mode available as Config.Mode, replacing any registered under
+// the same name. It must be called before any run starts, e.g. from the init function
+// of a plugin.
+func RegisterMode(name string, m Mode) {
+	modes[name] = m
+}
+
+// Modes returns the names of the registered modes and RunModes, sorted.
+func Modes() []string {
+	names := append([]string(nil), RunModes...)
+	for name := range modes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// validateMode returns the problems with the mode of args: that it is unknown, or what
+// the Mode says is wrong with args.
+func validateMode(args Config) []error {
+	if m, ok := modes[args.Mode]; ok {
+		return m.Validate(args)
+	}
+	if slices.Contains(RunModes, args.Mode) {
+		return nil
+	}
+	return []error{fmt.Errorf("mode must be one of %s.", strings.Join(Modes(), ", "))}
+}
+
+// validateQuery checks the settings of the vm/qrender and vm/qdoc queries.
+func validateQuery(args Config) []error {
+	var errs []error
+	if args.PackageName == "" && args.TargetsFile == "" {
+		errs = append(errs, fmt.Errorf("package or targets must be specified in %s mode.", args.Mode))
+	}
+	if args.ChainID != RemoteChainID(args.Remote) {
+		// TODO: Verify this is true of gnokey
+		errs = append(errs, fmt.Errorf("Chain ID cannot be specified in %s mode.", args.Mode))
+	}
+	return errs
+}
+
+// parseResult returns the error the Mode of mode makes of out, if it is registered.
+func parseResult(mode, out string) error {
+	if m, ok := modes[mode]; ok {
+		return m.ParseResult(out)
+	}
+	return nil
+}
+
+// commandMode is a built-in Mode, whose commands exiting successfully is all there is
+// to their success.
+type commandMode struct {
+	command  func(path string, args Config) string
+	validate func(args Config) []error // nil if every setting goes
+}
+
+func (m commandMode) Command(path string, args Config) string {
+	return m.command(path, args)
+}
+
+func (m commandMode) Validate(args Config) []error {
+	if m.validate == nil {
+		return nil
+	}
+	return m.validate(args)
+}
+
+func (m commandMode) ParseResult(string) error {
+	return nil
+}
+
+// templateMode is a Mode whose command is a text/template of the fields of modeData,
+// e.g. "gnokey query vm/qeval --data '{{.Package}}.Count()' --remote {{.Remote}}".
+type templateMode struct {
+	tmpl *template.Template
+}
+
+// modeData are the settings a templateMode's command can use.
+type modeData struct {
+	Package  string // the full path, gno.land/r/...
+	Function string
+	Remote   string
+	ChainID  string
+	KeyName  string
+	Render   string // -renderPath
+}
+
+// RandString returns a random string of n lowercase letters, e.g. for an argument that
+// differs on every request.
+func (modeData) RandString(n int) string {
+	return randomString(n)
+}
+
+func (m templateMode) command(path string, args Config) (string, error) {
+	var b strings.Builder
+	err := m.tmpl.Execute(&b, modeData{
+		Package:  path,
+		Function: args.FunctionName,
+		Remote:   args.Remote,
+		ChainID:  args.ChainID,
+		KeyName:  args.KeyName,
+		Render:   args.RenderPath,
+	})
+	return b.String(), err
+}
+
+func (m templateMode) Command(path string, args Config) string {
+	command, err := m.command(path, args)
+	if err != nil {
+		panic("Programming error: template mode not validated: " + err.Error())
+	}
+	return command
+}
+
+func (m templateMode) Validate(args Config) []error {
+	if _, err := m.command(pkgPath(args, "example"), args); err != nil {
+		return []error{fmt.Errorf("%s mode: %w", args.Mode, err)}
+	}
+	return nil
+}
+
+func (m templateMode) ParseResult(string) error {
+	return nil
+}
+
+// customMode runs the command template of -command, for requests none of the other
+// modes send.
+type customMode struct {
+	mu     sync.Mutex
+	parsed map[string]*template.Template // by -command, which may differ between runs
+}
+
+// mode returns the templateMode of command, parsing it the first time.
+func (m *customMode) mode(command string) (templateMode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tmpl, ok := m.parsed[command]; ok {
+		return templateMode{tmpl}, nil
+	}
+	tmpl, err := template.New("custom").Parse(command)
+	if err != nil {
+		return templateMode{}, err
+	}
+	m.parsed[command] = tmpl
+	return templateMode{tmpl}, nil
+}
+
+func (m *customMode) Command(path string, args Config) string {
+	t, err := m.mode(args.Command)
+	if err != nil {
+		panic("Programming error: custom mode not validated: " + err.Error())
+	}
+	return t.Command(path, args)
+}
+
+func (m *customMode) Validate(args Config) []error {
+	if args.Command == "" {
+		return []error{errors.New("command must be specified in custom mode.")}
+	}
+	t, err := m.mode(args.Command)
+	if err != nil {
+		return []error{fmt.Errorf("command: %w", err)}
+	}
+	return t.Validate(args)
+}
+
+func (m *customMode) ParseResult(string) error {
+	return nil
+}
+
+// LoadModeFile registers the modes of a file of lines "name: command template", where
+// the template is a text/template of the fields of modeData. Blank lines and lines
+// starting with # are skipped.
+func LoadModeFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, command, ok := strings.Cut(text, ":")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || name == "" || command == "" {
+			return fmt.Errorf("%s:%d: expected \"name: command template\"", path, line)
+		}
+		if slices.Contains(RunModes, name) {
+			return fmt.Errorf("%s:%d: %s mode cannot be replaced", path, line, name)
+		}
+		tmpl, err := template.New(name).Parse(command)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		RegisterMode(name, templateMode{tmpl})
+	}
+	return scanner.Err()
+}
+
+// txFlags returns the flags gnokey maketx needs to sign and broadcast a transaction for
+// args, ending with the key name.
+func txFlags(args Config) string {
+	gas, fee := args.GasWanted, args.GasFee
+	if gas == 0 {
+		gas = gasWanted
+	}
+	if fee == 0 {
+		fee = gasFee
+	}
+	broadcast := "--broadcast "
+	if args.Simulate {
+		broadcast += "--simulate only "
+	}
+	if args.Memo != "" {
+		broadcast = "--memo " + shellQuote(args.Memo) + " " + broadcast
+	}
+	return fmt.Sprintf(
+		"--gas-fee %dugnot --gas-wanted %d %s"+
+			"--chainid %s --remote %s %s--insecure-password-stdin=true %s",
+		fee, gas, broadcast, args.ChainID, args.Remote, homeFlag(args.Home), args.KeyName,
+	)
+}
+
+// homeFlag returns the --home flag of gnokey commands with home, or "" for gnokey's own.
+func homeFlag(home string) string {
+	if home == "" {
+		return ""
+	}
+	return "--home " + shellQuote(home) + " "
+}
@@ -0,0 +1,89 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxNameAttempts is how many random names newName tries before giving up on finding an
+// unused one, which only happens when -nameLength is too short for the run.
+const maxNameAttempts = 100
+
+// nameRegistry remembers the package paths generated for addpkg, so that a name isn't
+// deployed twice and fails with package_exists. With -namesFile, it remembers those of
+// earlier runs too, e.g. ones restarted with the same -seed.
+type nameRegistry struct {
+	mu       sync.Mutex
+	used     map[string]bool
+	file     *os.File // nil unless -namesFile is set
+	collided int
+}
+
+// newNameRegistry returns a registry of the paths in path, which it appends new ones to,
+// or an empty one kept in memory if path is empty.
+func newNameRegistry(path string) (*nameRegistry, error) {
+	n := &nameRegistry{used: map[string]bool{}}
+	if path == "" {
+		return n, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			n.used[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	n.file = file
+	return n, nil
+}
+
+// newName returns a random package name whose path under args hasn't been used, drawing
+// again on every collision.
+func (n *nameRegistry) newName(args Config) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for range maxNameAttempts {
+		name := randomPackageName(args)
+		path := pkgPath(args, name)
+		if n.used[path] {
+			n.collided++
+			continue
+		}
+		n.used[path] = true
+		if n.file != nil {
+			if _, err := fmt.Fprintln(n.file, path); err != nil {
+				fmt.Println("WARNING: Failed to write to names file:", err)
+			}
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("no unused package name in %d attempts; raise -nameLength", maxNameAttempts)
+}
+
+// NameCollisions returns how many of the package names generated for addpkg had already
+// been used, and were drawn again.
+func (r *Run) NameCollisions() int {
+	return r.names.collisions()
+}
+
+func (n *nameRegistry) collisions() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.collided
+}
+
+func (n *nameRegistry) close() {
+	if n.file != nil {
+		n.file.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package profiler
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// ArrivalProcesses are the values accepted by -arrival.
+var ArrivalProcesses = []string{"fixed", "poisson"}
+
+// pacer decides when a worker sends its next request.
+type pacer interface {
+	wait()
+}
+
+// newPacer returns the pacer for -arrival. rate is read continuously so that the target
+// rate per worker can change during the run.
+func newPacer(args Config, rate func() float64) pacer {
+	if args.Arrival == "poisson" {
+		return &poissonPacer{rate: rate}
+	}
+	return newRateLimiter(rate)
+}
+
+// rateLimiter lets a worker make up to rate() requests in each one second window. Rates
+// below 1 carry the fraction of a request over from window to window until it adds up
+// to one, e.g. one request every 2s at 0.5, so that a rate that picks up again is seen
+// within a second.
+type rateLimiter struct {
+	rate        func() float64
+	limit       int
+	credit      float64 // fraction of a request carried over, below 1 a second
+	count       int
+	windowStart time.Time
+}
+
+func newRateLimiter(rate func() float64) *rateLimiter {
+	l := &rateLimiter{rate: rate, credit: 1, windowStart: time.Now()}
+	l.limit = l.windowLimit()
+	return l
+}
+
+// windowLimit returns how many requests the next window allows.
+func (l *rateLimiter) windowLimit() int {
+	rate := l.rate()
+	if rate >= 1 {
+		l.credit = 1
+		return int(math.Round(rate))
+	}
+	if rate <= 0 {
+		return 0 // nothing is sent while the rate is down to 0
+	}
+	l.credit = min(l.credit+rate, 1)
+	if l.credit < 1-1e-9 {
+		return 0
+	}
+	l.credit = 0
+	return 1
+}
+
+// wait blocks until the next request is allowed.
+func (l *rateLimiter) wait() {
+	for {
+		if time.Since(l.windowStart) >= time.Second {
+			l.count = 0
+			l.limit = l.windowLimit()
+			l.windowStart = time.Now()
+		}
+		if l.count < l.limit {
+			l.count++
+			return
+		}
+		time.Sleep(time.Until(l.windowStart.Add(time.Second)))
+	}
+}
+
+// poissonPacer spaces requests with exponentially distributed gaps, so that arrivals
+// form a Poisson process with the given mean rate per second.
+type poissonPacer struct {
+	rate func() float64
+	next time.Time
+}
+
+func (p *poissonPacer) wait() {
+	now := time.Now()
+	if p.next.IsZero() {
+		p.next = now
+	}
+	time.Sleep(time.Until(p.next))
+	// Nothing is sent while the rate is down to 0
+	rate := p.rate()
+	for ; rate <= 0; rate = p.rate() {
+		time.Sleep(time.Second)
+	}
+	// Don't burst to catch up if the previous request overran its slot
+	gap := randomExpFloat64() / rate * float64(time.Second)
+	p.next = maxTime(p.next, now).Add(time.Duration(gap))
+}
+
+// LoadShapes are the values accepted by -shape.
+var LoadShapes = []string{"steady", "spike", "sine", "burst"}
+
+// loadShape varies the configured rate over time, between 1x and factor x:
+//
+//   - spike: factor x for the first tenth of every period
+//   - sine: a smooth wave peaking at factor x halfway through every period
+//   - burst: factor x for a tenth of a period, at random times averaging one per period
+type loadShape struct {
+	kind   string
+	period time.Duration
+	factor float64
+	start  time.Time
+
+	mu         sync.Mutex
+	burstStart time.Time
+}
+
+func newLoadShape(kind string, period time.Duration, factor float64) *loadShape {
+	s := &loadShape{kind: kind, period: period, factor: factor, start: time.Now()}
+	if kind == "burst" {
+		s.burstStart = s.start.Add(s.randomGap())
+	}
+	return s
+}
+
+func (s *loadShape) randomGap() time.Duration {
+	return time.Duration(randomExpFloat64() * float64(s.period))
+}
+
+// multiplier returns how much to scale the configured rate by at time now.
+func (s *loadShape) multiplier(now time.Time) float64 {
+	burstLength := s.period / 10
+	switch s.kind {
+	case "spike":
+		if now.Sub(s.start)%s.period < burstLength {
+			return s.factor
+		}
+	case "sine":
+		phase := float64(now.Sub(s.start)%s.period) / float64(s.period)
+		return 1 + (s.factor-1)*(1-math.Cos(2*math.Pi*phase))/2
+	case "burst":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for now.Sub(s.burstStart) >= burstLength {
+			s.burstStart = s.burstStart.Add(burstLength + s.randomGap())
+		}
+		if !now.Before(s.burstStart) {
+			return s.factor
+		}
+	}
+	return 1
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// ThinkDistributions are the values accepted by -thinkDist.
+var ThinkDistributions = []string{"fixed", "uniform", "exponential"}
+
+// thinkTime returns how long a worker pauses between requests: exactly mean, uniformly
+// distributed in [0, 2*mean), or exponentially distributed with the given mean.
+func thinkTime(mean time.Duration, distribution string) time.Duration {
+	switch distribution {
+	case "uniform":
+		return time.Duration(randomFloat64() * 2 * float64(mean))
+	case "exponential":
+		return time.Duration(randomExpFloat64() * float64(mean))
+	}
+	return mean
+}
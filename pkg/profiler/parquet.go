@@ -0,0 +1,363 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Parquet physical types, repetitions, encodings and codecs used by WriteParquet. See
+// https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetPlain    = 0
+	parquetRLE      = 3
+	parquetGzip     = 2
+	parquetDataPage = 0
+
+	parquetUTF8            = 0  // converted type of strings
+	parquetTimestampMicros = 10 // converted type of timestamps
+)
+
+// parquetColumn is a column of the Parquet results, and how to encode its values.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 for none
+	logical   func(w *thriftWriter)
+	encode    func(logs []ExecutionLog) []byte
+}
+
+func int64Column(name string, value func(ExecutionLog) int64) parquetColumn {
+	return parquetColumn{name: name, typ: parquetInt64, converted: -1, encode: func(logs []ExecutionLog) []byte {
+		data := make([]byte, 0, 8*len(logs))
+		for _, log := range logs {
+			data = binary.LittleEndian.AppendUint64(data, uint64(value(log)))
+		}
+		return data
+	}}
+}
+
+func doubleColumn(name string, value func(ExecutionLog) float64) parquetColumn {
+	return parquetColumn{name: name, typ: parquetDouble, converted: -1, encode: func(logs []ExecutionLog) []byte {
+		data := make([]byte, 0, 8*len(logs))
+		for _, log := range logs {
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(value(log)))
+		}
+		return data
+	}}
+}
+
+func timestampColumn(name string, value func(ExecutionLog) time.Time) parquetColumn {
+	col := int64Column(name, func(log ExecutionLog) int64 { return value(log).UnixMicro() })
+	col.converted = parquetTimestampMicros
+	col.logical = func(w *thriftWriter) {
+		w.beginStruct(8) // TIMESTAMP
+		w.boolean(1, true)
+		w.beginStruct(2)
+		w.beginStruct(2) // MICROS
+		w.endStruct()
+		w.endStruct()
+		w.endStruct()
+	}
+	return col
+}
+
+// durationColumn holds nanoseconds, as Parquet has no duration type.
+func durationColumn(name string, value func(ExecutionLog) int64) parquetColumn {
+	return int64Column(name, value)
+}
+
+func int32Column(name string, value func(ExecutionLog) int) parquetColumn {
+	return parquetColumn{name: name, typ: parquetInt32, converted: -1, encode: func(logs []ExecutionLog) []byte {
+		data := make([]byte, 0, 4*len(logs))
+		for _, log := range logs {
+			data = binary.LittleEndian.AppendUint32(data, uint32(int32(min(value(log), math.MaxInt32))))
+		}
+		return data
+	}}
+}
+
+func boolColumn(name string, value func(ExecutionLog) bool) parquetColumn {
+	return parquetColumn{name: name, typ: parquetBoolean, converted: -1, encode: func(logs []ExecutionLog) []byte {
+		data := make([]byte, (len(logs)+7)/8)
+		for i, log := range logs {
+			if value(log) {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return data
+	}}
+}
+
+func stringColumn(name string, value func(ExecutionLog) string) parquetColumn {
+	return parquetColumn{name: name, typ: parquetByteArray, converted: parquetUTF8,
+		logical: func(w *thriftWriter) {
+			w.beginStruct(1) // STRING
+			w.endStruct()
+		},
+		encode: func(logs []ExecutionLog) []byte {
+			var data []byte
+			for _, log := range logs {
+				v := value(log)
+				data = binary.LittleEndian.AppendUint32(data, uint32(len(v)))
+				data = append(data, v...)
+			}
+			return data
+		}}
+}
+
+// parquetColumns are the columns of the CSV results, with timestamps in microseconds and
+// durations in nanoseconds.
+var parquetColumns = []parquetColumn{
+	timestampColumn("Timestamp", func(log ExecutionLog) time.Time { return log.Timestamp }),
+	durationColumn("ResponseTime", func(log ExecutionLog) int64 { return int64(log.ResponseTime) }),
+	durationColumn("DNS", func(log ExecutionLog) int64 { return int64(log.HTTP.DNS) }),
+	durationColumn("Connect", func(log ExecutionLog) int64 { return int64(log.HTTP.Connect) }),
+	durationColumn("TLSHandshake", func(log ExecutionLog) int64 { return int64(log.HTTP.TLSHandshake) }),
+	durationColumn("TTFB", func(log ExecutionLog) int64 { return int64(log.HTTP.TTFB) }),
+	durationColumn("Transfer", func(log ExecutionLog) int64 { return int64(log.HTTP.Transfer) }),
+	boolColumn("Success", func(log ExecutionLog) bool { return log.Success }),
+	boolColumn("Valid", func(log ExecutionLog) bool { return log.Valid }),
+	stringColumn("ErrorCode", func(log ExecutionLog) string { return log.ErrorCode }),
+	boolColumn("Warmup", func(log ExecutionLog) bool { return log.Warmup }),
+	int32Column("ActiveWorkers", func(log ExecutionLog) int { return log.ActiveWorkers }),
+	stringColumn("Agent", func(log ExecutionLog) string { return log.Agent }),
+	stringColumn("Capture", func(log ExecutionLog) string { return log.Capture }),
+	stringColumn("Step", func(log ExecutionLog) string { return log.Step }),
+	stringColumn("Target", func(log ExecutionLog) string { return log.Target }),
+	int64Column("Height", func(log ExecutionLog) int64 { return log.Height }),
+	int64Column("GasUsed", func(log ExecutionLog) int64 { return log.GasUsed }),
+	stringColumn("Mode", func(log ExecutionLog) string { return log.Mode }),
+	int64Column("Fee", func(log ExecutionLog) int64 { return log.Fee }),
+	int64Column("GasWanted", func(log ExecutionLog) int64 { return log.GasWanted }),
+	int64Column("GasFee", func(log ExecutionLog) int64 { return log.GasFee }),
+	stringColumn("Fault", func(log ExecutionLog) string { return log.Fault }),
+	int64Column("PkgSize", func(log ExecutionLog) int64 { return log.PkgSize }),
+	int64Column("ArgSize", func(log ExecutionLog) int64 { return log.ArgSize }),
+	stringColumn("TxHash", func(log ExecutionLog) string { return log.TxHash }),
+	int64Column("Sent", func(log ExecutionLog) int64 { return log.Sent }),
+	doubleColumn("TargetQPS", func(log ExecutionLog) float64 { return log.TargetQPS }),
+	timestampColumn("Start", func(log ExecutionLog) time.Time { return log.Started() }),
+	stringColumn("Fingerprint", func(log ExecutionLog) string { return log.Fingerprint }),
+	stringColumn("RunID", func(log ExecutionLog) string { return log.RunID }),
+	int64Column("ResponseSize", func(log ExecutionLog) int64 { return log.ResponseSize }),
+	stringColumn("Cache", func(log ExecutionLog) string { return log.Cache }),
+	stringColumn("Worker", func(log ExecutionLog) string { return log.Worker }),
+	stringColumn("Fields", func(log ExecutionLog) string { return formatFields(log.Fields) }),
+	durationColumn("QueueWait", func(log ExecutionLog) int64 { return int64(log.QueueWait) }),
+}
+
+// WriteParquet writes logs as a Parquet file, for loading into DuckDB, pandas or Spark.
+// All rows go into one row group, with one gzipped page per column.
+func WriteParquet(w io.Writer, logs []ExecutionLog) error {
+	out := &countingWriter{w: w}
+	out.Write([]byte("PAR1"))
+
+	var chunks thriftWriter
+	var totalSize int64
+	for _, col := range parquetColumns {
+		data := col.encode(logs)
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		var header thriftWriter
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(compressed.Len()))
+		header.beginStruct(5) // DataPageHeader
+		header.i32(1, int32(len(logs)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header.stop()
+
+		offset := out.n
+		out.Write(header.buf.Bytes())
+		out.Write(compressed.Bytes())
+		totalSize += int64(header.buf.Len() + len(data))
+
+		chunks.beginElement() // ColumnChunk
+		chunks.i64(2, offset)
+		chunks.beginStruct(3) // ColumnMetaData
+		chunks.i32(1, col.typ)
+		chunks.list(2, thriftI32, 1)
+		chunks.varint(zigzag(parquetPlain))
+		chunks.list(3, thriftBinary, 1)
+		chunks.binary(col.name)
+		chunks.i32(4, parquetGzip)
+		chunks.i64(5, int64(len(logs)))
+		chunks.i64(6, int64(header.buf.Len()+len(data)))
+		chunks.i64(7, int64(header.buf.Len()+compressed.Len()))
+		chunks.i64(9, offset)
+		chunks.endStruct()
+		chunks.endStruct()
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1) // version
+	meta.list(2, thriftStruct, len(parquetColumns)+1)
+	meta.beginElement()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(parquetColumns)))
+	meta.endStruct()
+	for _, col := range parquetColumns {
+		meta.beginElement()
+		meta.i32(1, col.typ)
+		meta.i32(3, parquetRequired)
+		meta.str(4, col.name)
+		if col.converted >= 0 {
+			meta.i32(6, col.converted)
+		}
+		if col.logical != nil {
+			meta.beginStruct(10)
+			col.logical(&meta)
+			meta.endStruct()
+		}
+		meta.endStruct()
+	}
+	meta.i64(3, int64(len(logs)))
+	meta.list(4, thriftStruct, 1)
+	meta.beginElement() // RowGroup
+	meta.list(1, thriftStruct, len(parquetColumns))
+	meta.buf.Write(chunks.buf.Bytes())
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(len(logs)))
+	meta.endStruct()
+	meta.str(6, "realm-profiler")
+	meta.stop()
+
+	out.Write(meta.buf.Bytes())
+	out.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.buf.Len())))
+	out.Write([]byte("PAR1"))
+	return out.err
+}
+
+// countingWriter tracks the offset in the file, and the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// Thrift compact protocol types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Thrift compact protocol used by Parquet metadata, just enough
+// of it for WriteParquet.
+type thriftWriter struct {
+	buf   bytes.Buffer
+	last  int16   // id of the previous field of the current struct
+	stack []int16 // last of the enclosing structs
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(zigzag(int64(id)))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		w.field(id, thriftTrue)
+	} else {
+		w.field(id, thriftFalse)
+	}
+}
+
+func (w *thriftWriter) str(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.binary(s)
+}
+
+// binary writes s without a field header, e.g. as an element of a list.
+func (w *thriftWriter) binary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// list writes the header of a list field of n elements, which must follow.
+func (w *thriftWriter) list(id int16, elem byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		w.buf.WriteByte(0xf0 | elem)
+		w.varint(uint64(n))
+	}
+}
+
+func (w *thriftWriter) beginStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.beginElement()
+}
+
+// beginElement starts a struct without a field header, e.g. as an element of a list.
+func (w *thriftWriter) beginElement() {
+	w.stack = append(w.stack, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) endStruct() {
+	w.stop()
+	w.last = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+func (w *thriftWriter) stop() {
+	w.buf.WriteByte(0)
+}
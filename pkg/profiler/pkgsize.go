@@ -0,0 +1,115 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// SizeBucket is the summary of the requests that sent Size bytes up to twice that.
+type SizeBucket struct {
+	Size int64
+	Summary
+}
+
+// SummarizePackageSizes buckets the deploys of generated packages by PkgSize, in powers
+// of two, returning the buckets from small to large. It returns nothing unless packages
+// of more than one size were deployed.
+func SummarizePackageSizes(logs []ExecutionLog) []SizeBucket {
+	return summarizeBySize(logs, func(log ExecutionLog) (int64, bool) { return log.PkgSize, log.PkgSize > 0 })
+}
+
+// SummarizeArgSizes buckets calls by ArgSize like SummarizePackageSizes.
+func SummarizeArgSizes(logs []ExecutionLog) []SizeBucket {
+	return summarizeBySize(logs, func(log ExecutionLog) (int64, bool) { return log.ArgSize, log.Mode == "call" })
+}
+
+// summarizeBySize buckets the logs size returns a size for in powers of two, with a
+// bucket of its own for 0.
+func summarizeBySize(logs []ExecutionLog, size func(ExecutionLog) (int64, bool)) []SizeBucket {
+	byBucket := map[int64][]ExecutionLog{}
+	sizes := map[int64]bool{}
+	for _, log := range logs {
+		if n, ok := size(log); ok {
+			sizes[n] = true
+			bucket := int64(0)
+			if n > 0 {
+				bucket = int64(1) << (bits.Len64(uint64(n)) - 1)
+			}
+			byBucket[bucket] = append(byBucket[bucket], log)
+		}
+	}
+	if len(sizes) < 2 {
+		return nil
+	}
+	buckets := make([]SizeBucket, 0, len(byBucket))
+	for size, bucketLogs := range byBucket {
+		buckets = append(buckets, SizeBucket{Size: size, Summary: Summarize(bucketLogs)})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Size < buckets[j].Size })
+	return buckets
+}
+
+// PackageSizeLimit returns the largest package deployed and the smallest one that failed
+// to deploy, either 0 if there was none. A limit lies between the two if the second is
+// larger.
+func PackageSizeLimit(logs []ExecutionLog) (largestDeployed, smallestFailed int64) {
+	for _, log := range logs {
+		if log.PkgSize == 0 || log.Warmup || log.Fault != "" {
+			continue
+		}
+		if log.Success {
+			largestDeployed = max(largestDeployed, log.PkgSize)
+		} else if smallestFailed == 0 || log.PkgSize < smallestFailed {
+			smallestFailed = log.PkgSize
+		}
+	}
+	return largestDeployed, smallestFailed
+}
+
+// writeSizes prints how latency and errors scale with the size of what requests sent.
+func writeSizes(w io.Writer, title string, buckets []SizeBucket) {
+	fmt.Fprintf(w, "Latency by %s:\n  %-16s %8s %8s %12s %12s %12s\n", title, "", "requests", "errors", "p50", "p95", "p99")
+	for _, b := range buckets {
+		fmt.Fprintf(w, "  %-16s %8d %8d %12v %12v %12v\n", formatBytes(b.Size)+"+", b.Requests, b.Failed+b.Invalid,
+			FormatDuration(b.P50), FormatDuration(b.P95), FormatDuration(b.P99))
+	}
+}
+
+// writePackageSizes prints how deploy latency and errors scale with package size, and
+// what size the node stopped accepting.
+func writePackageSizes(w io.Writer, logs []ExecutionLog) {
+	buckets := SummarizePackageSizes(logs)
+	if len(buckets) == 0 {
+		return
+	}
+	writeSizes(w, "package size", buckets)
+	largest, smallestFailed := PackageSizeLimit(logs)
+	fmt.Fprintf(w, "Largest package deployed: %d bytes", largest)
+	if smallestFailed > 0 {
+		fmt.Fprintf(w, ", smallest that failed: %d bytes", smallestFailed)
+	}
+	fmt.Fprintln(w)
+}
+
+// writeArgSizes prints how call latency and errors scale with the size of the arguments.
+func writeArgSizes(w io.Writer, logs []ExecutionLog) {
+	if buckets := SummarizeArgSizes(logs); len(buckets) > 0 {
+		writeSizes(w, "argument size", buckets)
+	}
+}
+
+// formatBytes formats a number of bytes in the largest binary unit it is a whole
+// multiple of, e.g. 64KB.
+func formatBytes(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= u.size && n%u.size == 0 {
+			return fmt.Sprintf("%d%s", n/u.size, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,80 @@
+package profiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// preset is a named starting point for a run selectable with -profile. Flags given
+// alongside it override its settings, and -assert adds to its assertions.
+type preset struct {
+	Summary string
+	apply   func(*Config)
+}
+
+var presets = map[string]preset{
+	"smoke": {
+		Summary: "one thread at 1 QPS for 30s, to check the setup works",
+		apply: func(c *Config) {
+			c.MaxThreads, c.MaxQPS = 1, 1
+			c.Duration = 30 * time.Second
+			c.Assert = []string{"errorRate<1%"}
+		},
+	},
+	"stress": {
+		Summary: "ramp up to 20 threads over 10m, stopping if half the requests fail",
+		apply: func(c *Config) {
+			c.MaxThreads, c.MaxQPS = 20, 5
+			c.StartThreads, c.RampStep, c.RampInterval = 1, 2, 30*time.Second
+			c.Duration = 10 * time.Minute
+			c.AbortErrorRate = 0.5
+			c.Assert = []string{"errorRate<5%", "p95<2s"}
+		},
+	},
+	"soak": {
+		Summary: "4 threads at 1 QPS for 2h with checkpoints, to find leaks and drift",
+		apply: func(c *Config) {
+			c.MaxThreads, c.MaxQPS = 4, 1
+			c.Duration = 2 * time.Hour
+			c.WarmupDuration = time.Minute
+			c.Checkpoint = 5 * time.Minute
+			c.Assert = []string{"errorRate<1%", "p99<5s"}
+		},
+	},
+	"spike": {
+		Summary: "10 threads at 2 QPS with 5x peaks every 2m for 10m",
+		apply: func(c *Config) {
+			c.MaxThreads, c.MaxQPS = 10, 2
+			c.Shape, c.ShapePeriod, c.ShapeFactor = "spike", 2*time.Minute, 5
+			c.Duration = 10 * time.Minute
+			c.Assert = []string{"errorRate<5%"}
+		},
+	},
+}
+
+// PresetNames returns the names accepted by -profile, sorted.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetSummary describes what preset name does.
+func PresetSummary(name string) string {
+	return presets[name].Summary
+}
+
+// ApplyPreset sets the durations, rates and assertions of preset name on c.
+func ApplyPreset(c *Config, name string) error {
+	p, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q: must be one of %s", name, strings.Join(PresetNames(), ", "))
+	}
+	p.apply(c)
+	return nil
+}
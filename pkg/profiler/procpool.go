@@ -0,0 +1,97 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// procPool bounds the gnokey subprocesses the exec backend runs at once at -maxProcs, and
+// measures the requests queued for one, to show when the machine generating the load
+// rather than the node is what holds the requests back.
+type procPool struct {
+	slots  chan struct{}
+	mu     sync.Mutex
+	queued int // requests waiting for a slot right now
+	stats  ProcPoolStats
+}
+
+// ProcPoolStats summarizes the subprocess pool of a run with -maxProcs.
+type ProcPoolStats struct {
+	Size     int           // -maxProcs
+	Started  int64         // subprocesses started
+	Queued   int64         // of those, the ones that waited for a free slot
+	MaxQueue int           // most requests waiting at once
+	Wait     time.Duration // waited in total
+	MaxWait  time.Duration
+}
+
+func newProcPool(size int) *procPool {
+	return &procPool{slots: make(chan struct{}, size), stats: ProcPoolStats{Size: size}}
+}
+
+// acquire waits for a free slot and returns how long that took.
+func (p *procPool) acquire() time.Duration {
+	select {
+	case p.slots <- struct{}{}:
+		p.mu.Lock()
+		p.stats.Started++
+		p.mu.Unlock()
+		return 0
+	default:
+	}
+	p.mu.Lock()
+	p.queued++
+	p.stats.MaxQueue = max(p.stats.MaxQueue, p.queued)
+	p.mu.Unlock()
+
+	start := time.Now()
+	p.slots <- struct{}{}
+	wait := time.Since(start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued--
+	p.stats.Started++
+	p.stats.Queued++
+	p.stats.Wait += wait
+	p.stats.MaxWait = max(p.stats.MaxWait, wait)
+	return wait
+}
+
+// release frees the slot of a subprocess that has exited.
+func (p *procPool) release() {
+	<-p.slots
+}
+
+// queueLength returns how many requests are waiting for a slot.
+func (p *procPool) queueLength() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued
+}
+
+// ProcPool returns the stats of the subprocess pool, or false without -maxProcs.
+func (r *Run) ProcPool() (ProcPoolStats, bool) {
+	if r.procs == nil {
+		return ProcPoolStats{}, false
+	}
+	r.procs.mu.Lock()
+	defer r.procs.mu.Unlock()
+	return r.procs.stats, true
+}
+
+// WriteProcPool prints how often requests queued for one of the -maxProcs subprocesses
+// and for how long.
+func WriteProcPool(w io.Writer, s ProcPoolStats) {
+	fmt.Fprintf(w, "Subprocess pool: %d of %d requests queued for one of %d processes", s.Queued, s.Started, s.Size)
+	if s.Queued > 0 {
+		fmt.Fprintf(w, ", up to %d at once, waiting %s on average and %s at most",
+			s.MaxQueue, FormatDuration(s.Wait/time.Duration(s.Queued)), FormatDuration(s.MaxWait))
+	}
+	fmt.Fprintln(w)
+	if s.Started > 0 && float64(s.Queued)/float64(s.Started) > 0.1 {
+		fmt.Fprintln(w, "WARNING: The local machine is limiting the load; raise -maxProcs or use -backend rpc for queries.")
+	}
+}
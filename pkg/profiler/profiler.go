@@ -0,0 +1,1270 @@
+// Package profiler generates load against a gno.land node, through gnokey or its
+// JSON-RPC endpoint, and records how long every request took.
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	gasFee           = 10000000
+	gasWanted        = 800000
+	MaxPackageLength = 20
+	BalanceAddress   = "g1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5"
+	BalanceQuery     = "gnokey query bank/balances/" + BalanceAddress
+	DefaultChainId   = "dev"
+)
+
+// ExecutionLog is the result of a single request.
+type ExecutionLog struct {
+	Timestamp     time.Time // when the request completed
+	ResponseTime  time.Duration
+	HTTP          HTTPTiming // only populated by the rpc backend
+	Success       bool       // the command or query completed without error
+	Valid         bool       // the response passed every -expect/-expectRegex rule
+	ErrorCode     string     // normalized failure reason, see errorcodes.go
+	Warmup        bool       // recorded during -warmup and left out of the summary
+	ActiveWorkers int
+	Agent         string // set by the controller when merging results from -agents
+	Capture       string // file in -captureDir holding the raw output
+	Step          string // position and mode of the request in a journey or script, e.g. 2:call, or its contention phase
+	Target        string // remote the request was sent to, in runs with -compareRemote or -remotes
+	Height        int64  // block a transaction was committed in
+	GasUsed       int64
+	Mode          string
+	Fee           int64   // ugnot paid in gas fees by the transactions of the request
+	GasWanted     int64   // offered by the transactions, which -fuzzGasWanted varies
+	GasFee        int64   // ugnot offered, which -fuzzGasFee varies
+	Fault         string  // how -malformed broke the request, left out of the summary
+	PkgSize       int64   // bytes of source of the generated or workload package deployed
+	ArgSize       int64   // bytes of arguments passed to the function called
+	TxHash        string  // of each transaction committed, separated by spaces
+	Sent          int64   // ugnot deposited or sent by the committed transactions, on top of fees
+	TargetQPS     float64 // rate requests to the same Target were paced at, all workers together
+	Start         time.Time
+	Fingerprint   string             // of the exact commands or payloads sent, see fingerprint
+	RunID         string             // of the repeated run the request was part of, in its history file
+	ResponseSize  int64              // bytes of the node's response to a query
+	Cache         string             // CacheRepeat or CacheBust, with -cacheProbe
+	Worker        string             // prefix of the package names of the worker, with -workerPrefix
+	Fields        map[string]float64 // parsed from the output by the mode's Parsers and -extract
+	QueueWait     time.Duration      // waited for one of -maxProcs subprocesses, left out of ResponseTime
+}
+
+// Started returns when the request was sent. Results from older versions only have the
+// completion time, so for them it is estimated from the response time, which leaves out
+// any -overhead.
+func (log ExecutionLog) Started() time.Time {
+	if !log.Start.IsZero() {
+		return log.Start
+	}
+	return log.Timestamp.Add(-log.ResponseTime)
+}
+
+// Run holds the state shared by all workers of a profiling run.
+type Run struct {
+	args       Config
+	logs       []ExecutionLog
+	logMutex   sync.Mutex      // held by the recorder while it adds a result
+	results    chan recordItem // results waiting for the recorder
+	closed     atomic.Bool     // set once Close has stopped the recorder
+	closeMutex sync.RWMutex    // read-held to send to results, held by Close to close it
+	deployed   *manifest       // nil unless -manifest is set
+	names      *nameRegistry   // package paths generated for addpkg
+	targets    *targetList     // nil unless -targets is set
+	rules      []validationRule
+	extractors map[string][]Parser // from -extract, by mode
+	breaker    circuitBreaker
+	anomalies  anomalyDetector
+	alerts     alertMonitor
+	alerting   sync.WaitGroup // alerts being posted to -webhooks
+	statsd     *statsdSink    // nil unless -statsd is set
+	backoff    backoffController
+	executor   Executor
+	abort      chan string   // receives the reason when the circuit breaker trips
+	flush      chan struct{} // signalled every -checkpointRequests requests
+	start      time.Time
+	shape      *loadShape
+
+	activeWorkers atomic.Int32
+	done          chan struct{} // closed to stop the workers
+	stopOnce      sync.Once
+	qps           atomic.Int64  // per-thread target rate, adjustable while running
+	rateScale     atomic.Uint64 // float64 bits of the fraction of qps -backoffErrorRate allows
+	paused        atomic.Bool
+	captured      atomic.Int64 // requests written to -captureDir so far
+	captureMutex  sync.Mutex
+	captureRotate *rotation // nil unless captures are rotated into subdirectories
+	gas           gasEstimates
+	memos         atomic.Int64 // transactions given a -memo so far
+	remoteIndex   atomic.Int64 // requests spread over -remotes so far
+	resources     resourceMonitor
+	spill         *ResultsWriter // where samples dropped from memory are written, if anywhere
+	spilled       int            // samples dropped from memory by -maxSamples or -memoryLimit
+	degraded      atomic.Bool    // set when -memoryLimit is crossed: keep no samples in memory
+	memoryWarned  bool           // only used by monitorResources
+	funcs         realmFuncs
+	script        *Script
+	schedule      []ScheduledRequest // requests to replay in replay mode
+	recorder      *recordingExecutor // nil unless -record is set
+	mirror        *mirrorExecutor    // nil unless -compareRemote is set
+	recorded      atomic.Int64       // requests recorded, including ones not kept as samples
+	errored       atomic.Int64       // of the requests recorded, those that failed or were invalid, but not by -malformed
+	inflight      *inflightLimit     // caps the requests in flight at -maxInflight
+	procs         *procPool          // nil unless -maxProcs is set
+	keybase       *keybase
+	offered       int // requests that passed -sampleRate, for -reservoir
+	aggregate     *aggregate
+	slowest       slowestList
+	slowMutex     sync.Mutex
+	state         []StateSample // of the chain, every -stateInterval
+	stateWarned   bool
+	stateMutex    sync.Mutex
+}
+
+// recorderBuffer is how many results can wait for the recorder before workers block on
+// it. At thousands of requests per second, that is several seconds' worth.
+const recorderBuffer = 16384
+
+// recordItem is a result for the recorder, or with synced set a request to close synced
+// once every result before it has been added.
+type recordItem struct {
+	log    ExecutionLog
+	synced chan struct{}
+}
+
+// record fills in what log needs from the state of the run as it completes, and hands it
+// to the recorder, so that workers don't wait on each other to add their results.
+func (r *Run) record(log ExecutionLog) {
+	log.ActiveWorkers = int(r.activeWorkers.Load())
+	if r.paced() && (r.args.CompareRemote == "" || log.Target != r.args.CompareRemote) {
+		// Requests to each of -remotes get their turn of the target rate
+		log.TargetQPS = r.targetRate() * float64(log.ActiveWorkers) / float64(max(len(r.args.Remotes), 1))
+	}
+	if r.mirror != nil && log.Target == "" {
+		log.Target = r.args.Remote
+	}
+	n := r.recorded.Add(1)
+	log.Warmup = n <= int64(r.args.WarmupRequests) || (r.args.WarmupDuration > 0 && log.Timestamp.Sub(r.start) < r.args.WarmupDuration)
+	if log.Fault == "" && (!log.Success || !log.Valid) {
+		r.errored.Add(1)
+	}
+	if m := r.args.MaxRequests; m > 0 && n >= int64(m) {
+		r.Stop()
+	}
+	r.closeMutex.RLock()
+	defer r.closeMutex.RUnlock()
+	if r.closed.Load() {
+		// Completed after the results were saved, e.g. on an interrupt
+		return
+	}
+	r.results <- recordItem{log: log}
+}
+
+// runRecorder adds the results workers record, one at a time, until Close.
+func (r *Run) runRecorder() {
+	added := 0
+	for item := range r.results {
+		if item.synced != nil {
+			close(item.synced)
+			continue
+		}
+		r.logMutex.Lock()
+		r.add(item.log)
+		r.logMutex.Unlock()
+		added++
+		if n := r.args.CheckpointRequests; n > 0 && added%n == 0 {
+			select {
+			case r.flush <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// sync waits for the recorder to add every result recorded so far.
+func (r *Run) sync() {
+	r.closeMutex.RLock()
+	defer r.closeMutex.RUnlock()
+	if r.closed.Load() {
+		return
+	}
+	synced := make(chan struct{})
+	r.results <- recordItem{synced: synced}
+	<-synced
+}
+
+// add adds log to the summary and samples and watches it for anomalies. r.logMutex must
+// be held.
+func (r *Run) add(log ExecutionLog) {
+	r.aggregate.add(log)
+	r.keep(log)
+	if log.Fault != "" {
+		// Broken on purpose, so its errors say nothing about the node
+		return
+	}
+	if r.statsd != nil && !log.Warmup {
+		r.statsd.observe(log)
+	}
+	if !log.Warmup {
+		for _, anomaly := range r.anomalies.observe(log) {
+			fmt.Printf("WARNING: [%s] %s\n", log.Timestamp.Format(time.RFC3339Nano), anomaly)
+		}
+		events, texts := r.alerts.observe(log)
+		for i, event := range events {
+			r.alert(event, texts[i])
+		}
+	}
+	if scale, reason := r.backoff.observe(log); scale > 0 {
+		direction := "Backing off"
+		if scale > math.Float64frombits(r.rateScale.Load()) {
+			direction = "Recovering"
+		}
+		r.rateScale.Store(math.Float64bits(scale))
+		fmt.Printf("INFO: [%s] %s to %.0f%% of the target rate: %s\n", log.Timestamp.Format(time.RFC3339Nano), direction, scale*100, reason)
+	}
+	if reason := r.breaker.observe(log.ErrorCode != ""); reason != "" {
+		select {
+		case r.abort <- reason:
+			r.alert("aborted", "aborting the run after "+reason)
+		default:
+		}
+	}
+}
+
+// keep adds log to the samples, subject to -sampleRate and -reservoir. Reservoir
+// sampling keeps every sample offered with the same probability, however long the run.
+func (r *Run) keep(log ExecutionLog) {
+	if rate := r.args.SampleRate; rate > 0 && rate < 1 && randomFloat64() >= rate {
+		return
+	}
+	r.offered++
+	if r.args.Reservoir == 0 || len(r.logs) < r.args.Reservoir {
+		r.logs = append(r.logs, log)
+	} else if i := randomIntn(r.offered); i < r.args.Reservoir {
+		r.logs[i] = log
+	}
+	if r.degraded.Load() {
+		r.spillLogs(len(r.logs))
+	} else if n := r.args.MaxSamples; n > 0 && len(r.logs) >= n {
+		// Keep the newer half, so that the end-of-run breakdowns still have samples
+		r.spillLogs(len(r.logs) - n/2)
+	}
+}
+
+// spillLogs writes out and drops the oldest n samples in memory. r.logMutex must be held.
+func (r *Run) spillLogs(n int) {
+	if r.spill != nil {
+		if err := r.spill.Flush(r.logs); err != nil {
+			fmt.Println("WARNING: Failed to write results:", err)
+		}
+		r.spill.drop(n)
+	}
+	r.spilled += n
+	r.logs = slices.Clone(r.logs[n:])
+}
+
+// SpillTo makes samples dropped from memory by -maxSamples or -memoryLimit be written to
+// w first. Results must then be written with FlushTo rather than w.Flush.
+func (r *Run) SpillTo(w *ResultsWriter) {
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	r.spill = w
+}
+
+// FlushTo writes the samples in memory that w hasn't written yet. Unlike w.Flush(r.Logs()),
+// it can't race with samples being spilled.
+func (r *Run) FlushTo(w *ResultsWriter) error {
+	r.sync()
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	return w.Flush(r.logs)
+}
+
+// Spilled returns the number of samples dropped from memory, which Logs no longer returns.
+func (r *Run) Spilled() int {
+	r.sync()
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	return r.spilled
+}
+
+// NewRun sets up a run. password is passed to gnokey on stdin when it is not empty.
+func NewRun(args Config, password string) (*Run, error) {
+	r := &Run{args: args, abort: make(chan string, 1), flush: make(chan struct{}, 1), start: time.Now(), done: make(chan struct{}), aggregate: newAggregate(),
+		inflight: newInflightLimit(args.MaxInflight)}
+	r.results = make(chan recordItem, recorderBuffer)
+	r.qps.Store(int64(args.MaxQPS))
+	r.rateScale.Store(math.Float64bits(1))
+	r.backoff = newBackoffController(args.BackoffErrorRate, args.BackoffFactor)
+	r.shape = newLoadShape(args.Shape, args.ShapePeriod, args.ShapeFactor)
+	r.slowest.n = args.Slowest
+	r.anomalies = anomalyDetector{spikeThreshold: args.SpikeThreshold, errorBurst: args.ErrorBurst}
+	r.alerts = alertMonitor{maxErrorRate: args.AlertErrorRate, maxP95: args.AlertLatency}
+	r.breaker = circuitBreaker{maxErrorRate: args.AbortErrorRate, maxConsecutive: args.AbortConsecutiveErrors}
+
+	var err error
+	if r.rules, err = compileRules(args.Expect, args.ExpectRegex); err != nil {
+		return nil, err
+	}
+	if r.extractors, err = compileExtractors(args.Extract); err != nil {
+		return nil, err
+	}
+	if r.executor, err = newExecutor(args, password); err != nil {
+		return nil, err
+	}
+	if args.MaxProcs > 0 {
+		r.procs = newProcPool(args.MaxProcs)
+	}
+	if r.keybase, err = newKeybase(args); err != nil {
+		return nil, err
+	}
+	r.executor = keybaseExecutor{Executor: r.executor, keybase: r.keybase}
+	if args.Record != "" {
+		if r.recorder, err = newRecordingExecutor(r.executor, args.Record, r.start); err != nil {
+			return nil, fmt.Errorf("creating schedule: %w", err)
+		}
+		r.executor = r.recorder
+	}
+	if args.CompareRemote != "" {
+		mirrorArgs := args
+		mirrorArgs.Remote = args.CompareRemote
+		mirror, err := newExecutor(mirrorArgs, password)
+		if err != nil {
+			return nil, err
+		}
+		mirror = keybaseExecutor{Executor: mirror, keybase: r.keybase}
+		r.mirror = &mirrorExecutor{Executor: r.executor, mirror: mirror, args: mirrorArgs, run: r, inflight: newInflightLimit(args.MaxInflight), pending: map[string]chan struct{}{}}
+		r.executor = r.mirror
+	}
+	if args.Mode == "replay" {
+		if r.schedule, err = LoadSchedule(args.Schedule); err != nil {
+			return nil, fmt.Errorf("loading schedule: %w", err)
+		}
+	}
+	if args.CaptureDir != "" {
+		if err = os.MkdirAll(args.CaptureDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating capture directory: %w", err)
+		}
+		if args.Resume {
+			last, err := lastCapture(args.CaptureDir)
+			if err != nil {
+				return nil, fmt.Errorf("reading capture directory: %w", err)
+			}
+			r.captured.Store(last)
+		}
+		if args.Rotating() {
+			r.captureRotate = newRotation(args.RotateSize, args.RotateEvery)
+		}
+	}
+	if args.ManifestFile != "" {
+		if r.deployed, err = openManifest(args.ManifestFile); err != nil {
+			return nil, fmt.Errorf("creating manifest: %w", err)
+		}
+	}
+	if r.names, err = newNameRegistry(args.NamesFile); err != nil {
+		return nil, fmt.Errorf("loading names: %w", err)
+	}
+	if args.Script != "" {
+		if r.script, err = LoadScript(args.Script); err != nil {
+			return nil, fmt.Errorf("loading script: %w", err)
+		}
+	}
+	if args.Mode == "journey" {
+		if r.script, err = journeyScript(args); err != nil {
+			return nil, err
+		}
+	}
+	if args.StatsdAddr != "" {
+		if r.statsd, err = newStatsdSink(args.StatsdAddr, args.StatsdPrefix); err != nil {
+			return nil, err
+		}
+	}
+	if args.TargetsFile != "" {
+		if r.targets, err = loadTargets(args.TargetsFile, args.TargetOrder == "random"); err != nil {
+			return nil, fmt.Errorf("loading targets: %w", err)
+		}
+		fmt.Println("INFO: Loaded", len(r.targets.targets), "targets")
+	}
+	go r.runRecorder()
+	go r.monitorResources()
+	if args.StateInterval > 0 {
+		go r.monitorState()
+	}
+	return r, nil
+}
+
+// withRemote returns args sending to the next of -remotes in turn, if there are any.
+func (r *Run) withRemote(args Config) Config {
+	if len(args.Remotes) > 0 {
+		args.Remote = args.Remotes[(r.remoteIndex.Add(1)-1)%int64(len(args.Remotes))]
+	}
+	return args
+}
+
+// target returns the Target to record for a request sent with args: the remote it went
+// to when load is spread over -remotes.
+func (r *Run) target(args Config) string {
+	if len(args.Remotes) > 0 {
+		return args.Remote
+	}
+	return ""
+}
+
+// Stop tells the workers to finish their current request and exit.
+func (r *Run) Stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
+
+func (r *Run) stopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// targetRate is the rate each worker should currently send requests at.
+func (r *Run) targetRate() float64 {
+	return float64(r.qps.Load()) * r.shape.multiplier(time.Now()) * math.Float64frombits(r.rateScale.Load())
+}
+
+// paced reports whether every request is sent in a slot of the pacer, so that its rate
+// can be compared with the target. A script iteration sends any number of requests per
+// slot, a replay follows its schedule, and think time slows workers down on purpose.
+func (r *Run) paced() bool {
+	if r.args.ThinkTime > 0 {
+		return false
+	}
+	switch r.args.Mode {
+	case "script", "journey", "replay":
+		return false
+	}
+	return true
+}
+
+// TogglePause pauses load generation if it is running and resumes it otherwise,
+// returning whether it is now paused.
+func (r *Run) TogglePause() bool {
+	for {
+		paused := r.paused.Load()
+		if r.paused.CompareAndSwap(paused, !paused) {
+			return !paused
+		}
+	}
+}
+
+// waitWhilePaused blocks while load generation is paused, returning early if the run
+// is stopped.
+func (r *Run) waitWhilePaused() {
+	for r.paused.Load() && !r.stopped() {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Logs returns the logs recorded so far, or with -sampleRate or -reservoir the samples
+// kept, in the order they were recorded.
+func (r *Run) Logs() []ExecutionLog {
+	r.sync()
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	if r.args.Reservoir > 0 {
+		// Samples in the reservoir get replaced, so callers need their own copy
+		logs := slices.Clone(r.logs)
+		slices.SortStableFunc(logs, func(a, b ExecutionLog) int { return a.Timestamp.Compare(b.Timestamp) })
+		return logs
+	}
+	return r.logs[:len(r.logs):len(r.logs)]
+}
+
+// Summary returns the summary of every request recorded so far. Unlike summarizing
+// Logs, it is exact when -sampleRate or -reservoir drop samples, except that its
+// percentiles are estimated to within 1/32.
+func (r *Run) Summary() Summary {
+	r.sync()
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	if !r.args.Sampled() && r.spilled == 0 {
+		return Summarize(r.logs)
+	}
+	return r.aggregate.summary()
+}
+
+// Preload adds logs from an earlier run, e.g. one being resumed, in front of the logs this
+// run records.
+func (r *Run) Preload(logs []ExecutionLog) {
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	r.logs = append(logs[:len(logs):len(logs)], r.logs...)
+	r.recorded.Add(int64(len(logs)))
+	for _, log := range logs {
+		r.aggregate.add(log)
+	}
+}
+
+// Aborted receives the reason when the circuit breaker trips. The run keeps going until
+// it is stopped.
+func (r *Run) Aborted() <-chan string {
+	return r.abort
+}
+
+// Close waits for the results recorded so far to be added, stops the recorder and
+// releases the files the run writes to as it goes. Results recorded after it, by
+// requests still in flight, are dropped.
+func (r *Run) Close() {
+	r.sync()
+	r.closeMutex.Lock()
+	if !r.closed.Load() {
+		r.closed.Store(true)
+		close(r.results)
+		if r.args.StateInterval > 0 {
+			r.sampleState()
+		}
+	}
+	r.closeMutex.Unlock()
+	r.alerting.Wait()
+	if r.deployed != nil {
+		r.deployed.close()
+	}
+	r.names.close()
+	if r.recorder != nil {
+		r.recorder.close()
+	}
+	if r.statsd != nil {
+		r.statsd.close()
+	}
+	r.keybase.close()
+}
+
+// rng is shared by all workers; *rand.Rand is not safe for concurrent use on its own.
+var (
+	rng      = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rngMutex sync.Mutex
+)
+
+// Config describes the load a run generates. The CLI sets one field per flag, so the
+// flag documentation applies; DefaultConfig returns the flag defaults.
+type Config struct {
+	MaxThreads             int
+	MaxQPS                 int
+	Mode                   string
+	PackageName            string
+	FunctionName           string
+	CallArgs               []string
+	FuzzArgs               bool   // call with random arguments of the types the function takes
+	FuzzArgSize            int    // bytes, at most, of random strings
+	RenderPath             string // passed to Render in qrender mode
+	CacheProbe             bool   // bust the cache of half the qrender requests
+	Command                string // template of the command custom mode runs, see modeData
+	Remote                 string
+	KeyName                string
+	Home                   string // gnokey home directory, gnokey's own if empty
+	Keybase                string // one of Keybases
+	Address                string // of KeyName, looked up with gnokey list if empty
+	Memo                   string // template, expanded per transaction by Run.withMemo
+	Deposit                string // storage deposit of addpkg transactions, e.g. 1000000ugnot
+	Send                   string // coins attached to calls, e.g. 100ugnot
+	RunFile                string // Gno script executed by run mode
+	GasWanted              int64
+	GasFee                 int64 // ugnot
+	FuzzGasWanted          Range
+	FuzzGasFee             Range
+	GasEstimate            string
+	GasAdjustment          float64
+	Simulate               bool // only simulate transactions, set when estimating gas
+	BalanceCheck           string
+	PkgDir                 string
+	ChainID                string
+	Backend                string
+	CalibrateCmd           string
+	Overhead               time.Duration
+	PkgPrefix              string
+	Namespace              string
+	NameLength             int
+	NamesFile              string // package paths generated by earlier runs, not to reuse
+	WorkerPrefix           bool   // give each worker's package names a prefix of its own
+	ManifestFile           string
+	TargetsFile            string
+	TargetOrder            string
+	Generate               bool
+	GenFuncs               int
+	GenSize                int
+	GenSizeRange           Range // picks GenSize per package
+	GenImports             int
+	Workload               string
+	VerifyCount            int
+	Script                 string
+	Steps                  []string
+	Record                 string
+	Schedule               string
+	CompareRemote          string
+	Remotes                []string // spread requests over these instead of Remote
+	Chains                 []Chain  // profile each of these at once instead of Remote
+	SampleRate             float64
+	Malformed              float64 // fraction of requests to break on purpose
+	Reservoir              int
+	MaxSamples             int   // samples to keep in memory before writing out the older half
+	MemoryLimit            int64 // resident bytes above which no more samples are kept in memory
+	Slowest                int
+	SpikeThreshold         float64
+	ErrorBurst             float64
+	Webhooks               []string      // URLs to post alerts to
+	AlertErrorRate         float64       // alert when the rolling error rate reaches this
+	AlertLatency           time.Duration // alert when the rolling p95 reaches this
+	StatsdAddr             string        // statsd server to send per-request metrics to
+	BackoffErrorRate       float64       // back the rate off when this fraction of requests overload the node
+	BackoffFactor          float64       // to scale the rate by each time
+	RequestTimeout         time.Duration // abandon requests taking longer, 0 waits
+	StateInterval          time.Duration // sample the chain's state this often, 0 never
+	StatsdPrefix           string
+	Assert                 []string
+	Expect                 []string
+	ExpectRegex            []string
+	Extract                []string // name:regex of numbers to parse from the output, optionally mode=name:regex
+	AbortErrorRate         float64
+	AbortConsecutiveErrors int
+	WarmupDuration         time.Duration
+	WarmupRequests         int
+	ThinkTime              time.Duration
+	ThinkDist              string
+	Arrival                string
+	Shape                  string
+	ShapePeriod            time.Duration
+	ShapeFactor            float64
+	StartThreads           int
+	RampStep               int
+	RampInterval           time.Duration
+	Duration               time.Duration
+	MaxRequests            int // stop once this many requests have been recorded, 0 never
+	MaxInflight            int // requests in flight at once across all workers, 0 unlimited
+	MaxProcs               int // gnokey subprocesses running at once with the exec backend, 0 unlimited
+	Checkpoint             time.Duration
+	CheckpointRequests     int
+	Resume                 bool
+	Compress               bool // gzip the results file
+	RotateSize             int64
+	RotateEvery            time.Duration
+	CaptureDir             string
+}
+
+// DefaultConfig returns the defaults of the CLI flags.
+func DefaultConfig() Config {
+	return Config{
+		MaxThreads:     1,
+		MaxQPS:         1,
+		Mode:           "call",
+		Remote:         "localhost:26657",
+		KeyName:        "Dev",
+		Keybase:        "shared",
+		PkgDir:         ".",
+		ChainID:        DefaultChainId,
+		Backend:        "exec",
+		BalanceCheck:   "warn",
+		GasWanted:      gasWanted,
+		GasFee:         gasFee,
+		GasEstimate:    "off",
+		GasAdjustment:  1.5,
+		CalibrateCmd:   "true",
+		Namespace:      "r/",
+		NameLength:     MaxPackageLength,
+		TargetOrder:    "roundrobin",
+		GenFuncs:       1,
+		VerifyCount:    100,
+		FuzzArgSize:    1024,
+		ThinkDist:      "fixed",
+		Arrival:        "fixed",
+		Shape:          "steady",
+		ShapePeriod:    time.Minute,
+		ShapeFactor:    5,
+		RampInterval:   time.Minute,
+		SampleRate:     1,
+		Slowest:        10,
+		SpikeThreshold: 10,
+		ErrorBurst:     0.25,
+		StatsdPrefix:   "realm_profiler",
+		BackoffFactor:  0.5,
+	}
+}
+
+// Sampled reports whether some samples are dropped, by -sampleRate or -reservoir. A zero
+// SampleRate, as in a Config not made by DefaultConfig, keeps every sample.
+func (c Config) Sampled() bool {
+	return (c.SampleRate > 0 && c.SampleRate < 1) || c.Reservoir > 0
+}
+
+// Rotating reports whether results and captures are split up as they grow, by
+// -rotateSize or -rotateEvery.
+func (c Config) Rotating() bool {
+	return c.RotateSize > 0 || c.RotateEvery > 0
+}
+
+// Normalize fills in the settings whose defaults depend on other settings.
+func (c *Config) Normalize() {
+	if len(c.Remotes) > 0 {
+		c.Remote = c.Remotes[0]
+	}
+	if r, ok := remotes[c.Remote]; ok {
+		c.Remote = r.URL
+		if c.ChainID == DefaultChainId {
+			c.ChainID = r.ChainID
+		}
+	}
+	if r, ok := remotes[c.CompareRemote]; ok {
+		c.CompareRemote = r.URL
+	}
+	for i, addr := range c.Remotes {
+		if r, ok := remotes[addr]; ok {
+			c.Remotes[i] = r.URL
+		}
+	}
+	c.Namespace = strings.TrimSuffix(c.Namespace, "/") + "/"
+	if c.StartThreads == 0 {
+		c.StartThreads = c.MaxThreads
+		if c.RampStep > 0 {
+			c.StartThreads = 1
+		}
+	}
+	if c.Workload != "" && c.FunctionName == "" && c.Mode == "addpkg+call" {
+		c.FunctionName = WorkloadFunction(c.Workload)
+	}
+}
+
+// errNotCommitted is the response of an addpkg of addpkg+call that gnokey printed no
+// transaction hash and height for, so that the call isn't sent.
+var errNotCommitted = errors.New("addpkg was not committed: no tx hash and height in its output")
+
+// Fields gnokey prints after a successful maketx --broadcast
+var (
+	heightPattern  = regexp.MustCompile(`HEIGHT:\s+(\d+)`)
+	txHashPattern  = regexp.MustCompile(`TX HASH:\s+([A-Za-z0-9+/=]+)`)
+	gasUsedPattern = regexp.MustCompile(`GAS USED:\s+(\d+)`)
+
+	// Flags of the maketx commands GenerateCommand builds
+	gasWantedFlagPattern = regexp.MustCompile(`--gas-wanted (\d+)`)
+	gasFeeFlagPattern    = regexp.MustCompile(`--gas-fee (\d+)ugnot`)
+	coinsFlagPattern     = regexp.MustCompile(`--(?:deposit|send) (\d+)ugnot`)
+)
+
+// manifest records the packages deployed by addpkg modes so later runs can target them.
+type manifest struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *csv.Writer
+}
+
+// Start runs the worker threads until the run is stopped and they have finished their
+// in-flight requests. When ramping, only startThreads start right away and each further
+// batch of rampStep waits for another rampInterval. In replay mode it sends the schedule
+// instead, returning when it has all been sent.
+func (r *Run) Start() {
+	args := r.args
+	if r.mirror != nil {
+		defer r.mirror.wg.Wait()
+	}
+	if args.Mode == "replay" {
+		r.replay()
+		return
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for started := 0; started < args.MaxThreads; started++ {
+		if started >= args.StartThreads && (started-args.StartThreads)%args.RampStep == 0 {
+			select {
+			case <-time.After(args.RampInterval):
+			case <-r.done:
+				return
+			}
+			fmt.Println("INFO: Ramping up to", min(started+args.RampStep, args.MaxThreads), "worker threads")
+		}
+		wg.Add(1)
+		r.activeWorkers.Add(1)
+		go func() {
+			defer func() {
+				r.activeWorkers.Add(-1)
+				wg.Done()
+			}()
+			executeTask(r, started)
+		}()
+	}
+}
+
+// executeTask sends requests from the worker numbered worker until the run stops.
+func executeTask(r *Run, worker int) {
+	args := r.args
+	mode := args.Mode
+	var prefix string
+	if args.WorkerPrefix {
+		prefix = workerPrefix(worker)
+		args.PkgPrefix += prefix
+	}
+	limiter := newPacer(args, r.targetRate)
+
+	firstLoop := true
+
+	for iteration := 1; !r.stopped(); iteration++ {
+		if !firstLoop && args.ThinkTime > 0 {
+			time.Sleep(thinkTime(args.ThinkTime, args.ThinkDist))
+		}
+		r.waitWhilePaused()
+		limiter.wait()
+		if r.stopped() {
+			return
+		}
+
+		if mode == "script" || mode == "journey" {
+			r.runScript(iteration, firstLoop)
+			firstLoop = false
+			continue
+		}
+
+		// Spread load over the targets file if there is one
+		packageName := args.PackageName
+		taskArgs := r.withRemote(args)
+		if r.targets != nil {
+			t := r.targets.pick()
+			packageName = t.PkgPath
+			if t.Function != "" {
+				taskArgs.FunctionName = t.Function
+			}
+		}
+
+		// Must send 2 requests for addpkg+call as both may require passing a gnokey password
+		// via stdin
+		firstMode := mode
+		if firstMode == "addpkg+call" {
+			firstMode = "addpkg"
+		}
+
+		// Pick the name here rather than in GenerateCommand: addpkg+call needs the same
+		// one for both commands, and the manifest needs to know what was deployed
+		name := packageName
+		if name == "" && firstMode == "addpkg" {
+			var err error
+			if name, err = r.names.newName(args); err != nil {
+				fmt.Println("WARNING: Stopping the run:", err)
+				r.Stop()
+				return
+			}
+		}
+
+		var pkgSize int64
+		if args.Generate || args.Workload != "" {
+			dir, size, err := writeTaskPackage(args, path.Base(pkgPath(args, name)))
+			if err != nil {
+				fmt.Println("WARNING: Failed to generate package: ", err)
+				continue
+			}
+			taskArgs.PkgDir = dir
+			pkgSize = size
+		}
+
+		var fault string
+		if args.Malformed > 0 && randomFloat64() < args.Malformed {
+			name, taskArgs, fault = malform(firstMode, name, taskArgs)
+		} else if args.FuzzArgs {
+			fuzzed, err := r.withFuzzedArgs(name, taskArgs)
+			if err != nil {
+				fmt.Println("WARNING: Failed to fuzz arguments:", err)
+			}
+			taskArgs = fuzzed
+		}
+		var cache string
+		if args.CacheProbe && fault == "" {
+			cache = CacheRepeat
+			if randomFloat64() < 0.5 {
+				cache = CacheBust
+				taskArgs.RenderPath = cacheBust(taskArgs.RenderPath)
+			}
+		}
+		var callArgSize int64
+		if mode == "call" {
+			callArgSize = argSize(taskArgs)
+		}
+
+		firstArgs := r.txArgs(firstMode, name, taskArgs)
+		request := r.executor.Describe(firstMode, name, firstArgs)
+		if firstLoop {
+			fmt.Println("INFO: Executing", request)
+		}
+
+		// TODO: Break this down into key signing, RPC round trip and CheckTx/DeliverTx wait.
+		// That needs an in-process client; gnokey only lets us time the whole invocation.
+		// TODO: With an in-process client, add an option packing N calls into one
+		// transaction, to measure what batching gains over one message per transaction.
+		// gnokey maketx only builds single-message transactions.
+		wait, ok := r.acquireSlot()
+		if !ok {
+			if args.Generate || args.Workload != "" {
+				os.RemoveAll(taskArgs.PkgDir)
+			}
+			return
+		}
+		start := time.Now()
+		out, timing, err := r.executor.Execute(firstMode, name, firstArgs)
+		r.releaseSlot()
+		// Don't count the cost of spawning bash and gnokey against the node
+		duration := max(time.Since(start)-args.Overhead, 0)
+		end := time.Now()
+		var verr error
+		if err != nil {
+			fmt.Println("WARNING: Errors executing request: ", err)
+		} else if verr = checkResponse(r.rules, firstMode, out); verr != nil {
+			fmt.Println("WARNING: Invalid response: ", verr)
+		} else if firstMode == "addpkg" && r.deployed != nil && fault == "" {
+			if txHash, height, ok := parseTxResult(out); ok {
+				r.deployed.add(pkgPath(args, name), txHash, height)
+			}
+		}
+
+		// Calling a package that isn't in a block yet would only fail, so the call waits
+		// for the addpkg to commit. gnokey returns once it has, printing its hash and
+		// height.
+		// TODO: Add an option pipelining the call right behind the addpkg, with the next
+		// sequence number. That needs signing and broadcasting separately; gnokey maketx
+		// fetches the sequence itself.
+		var step string
+		if mode == "addpkg+call" {
+			step = "1:addpkg"
+			if err == nil && verr == nil && !args.Simulate {
+				if _, _, ok := parseTxResult(out); !ok {
+					verr = errNotCommitted
+					fmt.Println("WARNING: Invalid response: ", verr)
+				}
+			}
+		}
+
+		if args.Generate || args.Workload != "" {
+			os.RemoveAll(taskArgs.PkgDir)
+		}
+
+		fmt.Println("Completed request in", FormatDuration(duration)+".")
+
+		r.recordRequest(ExecutionLog{
+			Start:        start,
+			Timestamp:    end,
+			ResponseTime: duration,
+			HTTP:         timing,
+			QueueWait:    wait,
+			Success:      err == nil,
+			Valid:        err == nil && verr == nil,
+			ErrorCode:    classifyError(out, err, verr),
+			Fault:        fault,
+			PkgSize:      pkgSize,
+			ArgSize:      callArgSize,
+			Target:       r.target(taskArgs),
+			Fingerprint:  fingerprint(request),
+			Cache:        cache,
+			Worker:       prefix,
+			Step:         step,
+		}, firstMode, out, captureSection(request, out, err))
+
+		if mode == "addpkg+call" && err == nil && verr == nil {
+			// The call is its own sample, with its own mode, so that the time and failures
+			// of each step show up separately
+			r.executeCall(name, taskArgs, firstLoop, prefix)
+		}
+		firstLoop = false
+	}
+}
+
+// executeCall sends and records the call step of addpkg+call, once the package name is
+// deployed.
+func (r *Run) executeCall(name string, taskArgs Config, firstLoop bool, prefix string) {
+	// The call can only be simulated once the package is deployed, so simulate before
+	// starting the clock
+	callArgs := r.txArgs("call", name, taskArgs)
+	request := r.executor.Describe("call", name, callArgs)
+	if firstLoop {
+		fmt.Println("INFO: Executing", request)
+	}
+	wait, ok := r.acquireSlot()
+	if !ok {
+		return
+	}
+	start := time.Now()
+	out, timing, err := r.executor.Execute("call", name, callArgs)
+	r.releaseSlot()
+	duration := max(time.Since(start)-r.args.Overhead, 0)
+	end := time.Now()
+	var verr error
+	if err != nil {
+		fmt.Println("WARNING: Errors executing request: ", err)
+	} else if verr = checkResponse(r.rules, "call", out); verr != nil {
+		fmt.Println("WARNING: Invalid response: ", verr)
+	}
+	fmt.Println("Completed request in", FormatDuration(duration)+".")
+
+	r.recordRequest(ExecutionLog{
+		Start:        start,
+		Timestamp:    end,
+		ResponseTime: duration,
+		HTTP:         timing,
+		QueueWait:    wait,
+		Success:      err == nil,
+		Valid:        err == nil && verr == nil,
+		ErrorCode:    classifyError(out, err, verr),
+		ArgSize:      argSize(callArgs),
+		Target:       r.target(taskArgs),
+		Fingerprint:  fingerprint(request),
+		Worker:       prefix,
+		Step:         "2:call",
+	}, "call", out, captureSection(request, out, err))
+}
+
+// GenerateCommand builds the gnokey command for mode. packageName may be a bare name,
+// which is placed under the configured namespace, or a full gno.land/... path; if it is
+// empty a random name is generated.
+func GenerateCommand(mode, packageName string, args Config) string {
+	if mode == "addpkg+call" {
+		panic("Programming error: addpkg+call should be 2 separate calls to GenerateCommand.")
+	}
+	m, ok := modes[mode]
+	if !ok {
+		panic("Invalid mode")
+	}
+	if packageName == "" {
+		packageName = randomPackageName(args)
+	}
+	return m.Command(pkgPath(args, packageName), args)
+}
+
+// writeTaskPackage writes the generated or workload package that replaces pkgdir, and
+// returns its directory and size in bytes.
+func writeTaskPackage(args Config, name string) (string, int64, error) {
+	size := args.GenSize
+	if !args.GenSizeRange.IsZero() {
+		size = int(args.GenSizeRange.random())
+	}
+	src := generatePackage(name, packageSpec{Funcs: args.GenFuncs, Size: size, Imports: args.GenImports})
+	if args.Workload != "" {
+		var err error
+		if src, err = workloadSource(workloads[args.Workload], name); err != nil {
+			return "", 0, err
+		}
+	}
+	dir, err := writePackage(name, src)
+	return dir, int64(len(src)), err
+}
+
+// pkgPath returns the full package path for name, leaving it alone if it already is one.
+func pkgPath(args Config, name string) string {
+	if strings.HasPrefix(name, "gno.land/") {
+		return name
+	}
+	return "gno.land/" + args.Namespace + name
+}
+
+// shellQuote quotes s as a single bash word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// workerPrefix returns the prefix of the package names of worker with -workerPrefix,
+// e.g. w3_, which keeps concurrent deploys off each other's paths.
+func workerPrefix(worker int) string {
+	return "w" + strconv.Itoa(worker) + "_"
+}
+
+func randomPackageName(args Config) string {
+	return args.PkgPrefix + randomString(args.NameLength)
+}
+
+// ExecuteCommand runs command with bash, passing password on stdin, and returns its
+// stdout. Failures are returned as errors carrying the command's stderr.
+func ExecuteCommand(command, password string) (string, error) {
+	return executeCommand(command, password, 0)
+}
+
+// executeCommand runs command like ExecuteCommand, killing it if it takes longer than
+// timeout, unless that is 0.
+func executeCommand(command, password string, timeout time.Duration) (string, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	// gnokey can outlive the shell that is killed, holding its output open
+	cmd.WaitDelay = time.Second
+
+	// Ensure password is passed correctly via stdin
+	if password != "" {
+		cmd.Stdin = strings.NewReader(password + "\n") // Ensures newline termination
+	} else {
+		cmd.Stdin = strings.NewReader("\n") // Ensures stdin isn't empty
+	}
+
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %v: %w", timeout, err)
+	}
+
+	// Print stderr for debugging or noticing when something has crashed
+	if err != nil {
+		fmt.Println("Command error:", err)
+		fmt.Println("stderr:", stderr.String())
+		return out.String(), &commandError{err: err, stderr: stderr.String()}
+	}
+
+	return out.String(), nil
+}
+
+// parseTxResult extracts the tx hash and block height from gnokey maketx output.
+func parseTxResult(out string) (string, int64, bool) {
+	hash := txHashPattern.FindStringSubmatch(out)
+	height := heightPattern.FindStringSubmatch(out)
+	if hash == nil || height == nil {
+		return "", 0, false
+	}
+	h, err := strconv.ParseInt(height[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return hash[1], h, true
+}
+
+// txMetrics is what the transactions of a request offered and spent.
+type txMetrics struct {
+	height    int64 // block the last transaction was committed in
+	gasUsed   int64
+	fee       int64 // ugnot paid
+	gasWanted int64 // offered by the first transaction
+	gasFee    int64
+	sent      int64 // ugnot deposited or sent, on top of fees
+	txHashes  []string
+}
+
+// parseTxMetrics extracts what transactions offered and spent from the -captureDir
+// sections of a request, each holding a gnokey maketx command and its output. Every
+// committed transaction prints its gas used and pays the full gas fee it offered.
+func parseTxMetrics(sections ...string) txMetrics {
+	var m txMetrics
+	for _, section := range sections {
+		fee := int64(gasFee)
+		if match := gasFeeFlagPattern.FindStringSubmatch(section); match != nil {
+			fee, _ = strconv.ParseInt(match[1], 10, 64)
+			if m.gasFee == 0 {
+				m.gasFee = fee
+			}
+		}
+		if match := gasWantedFlagPattern.FindStringSubmatch(section); match != nil && m.gasWanted == 0 {
+			m.gasWanted, _ = strconv.ParseInt(match[1], 10, 64)
+		}
+		for _, match := range heightPattern.FindAllStringSubmatch(section, -1) {
+			m.height, _ = strconv.ParseInt(match[1], 10, 64)
+		}
+		var sent int64
+		if match := coinsFlagPattern.FindStringSubmatch(section); match != nil {
+			sent, _ = strconv.ParseInt(match[1], 10, 64)
+		}
+		for _, match := range gasUsedPattern.FindAllStringSubmatch(section, -1) {
+			gas, _ := strconv.ParseInt(match[1], 10, 64)
+			m.gasUsed += gas
+			m.fee += fee
+			m.sent += sent
+		}
+		for _, match := range txHashPattern.FindAllStringSubmatch(section, -1) {
+			m.txHashes = append(m.txHashes, match[1])
+		}
+	}
+	return m
+}
+
+func openManifest(path string) (*manifest, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{file: file, writer: csv.NewWriter(file)}
+	m.writer.Write([]string{"PkgPath", "TxHash", "Height"})
+	m.writer.Flush()
+	return m, m.writer.Error()
+}
+
+// add records a deployed package, flushing right away so an interrupted run keeps it.
+func (m *manifest) add(pkgPath, txHash string, height int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writer.Write([]string{pkgPath, txHash, strconv.FormatInt(height, 10)})
+	m.writer.Flush()
+	if err := m.writer.Error(); err != nil {
+		fmt.Println("WARNING: Failed to write to manifest:", err)
+	}
+}
+
+func (m *manifest) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writer.Flush()
+	m.file.Close()
+}
+
+// MedianResponseTime returns the median response time of logs, which must not be empty.
+func MedianResponseTime(logs []ExecutionLog) time.Duration {
+	durations := make([]time.Duration, len(logs))
+	for i, log := range logs {
+		durations[i] = log.ResponseTime
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2]
+}
+
+func randomString(length int) string {
+	const charset = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, length)
+	rngMutex.Lock()
+	defer rngMutex.Unlock()
+	for i := range b {
+		b[i] = charset[rng.Intn(len(charset))]
+	}
+	return string(b)
+}
+
+func randomFloat64() float64 {
+	rngMutex.Lock()
+	defer rngMutex.Unlock()
+	return rng.Float64()
+}
+
+func randomIntn(n int) int {
+	rngMutex.Lock()
+	defer rngMutex.Unlock()
+	return rng.Intn(n)
+}
+
+func randomExpFloat64() float64 {
+	rngMutex.Lock()
+	defer rngMutex.Unlock()
+	return rng.ExpFloat64()
+}
+
+// SeedRandom reseeds the random source used for package names and pacing.
+func SeedRandom(seed int64) {
+	rngMutex.Lock()
+	defer rngMutex.Unlock()
+	rng = rand.New(rand.NewSource(seed))
+}
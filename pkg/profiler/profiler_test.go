@@ -0,0 +1,3039 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRandomStringUnique(t *testing.T) {
+	r1 := randomString(32)
+	r2 := randomString(32)
+
+	if r1 == r2 {
+		t.Errorf("Random calls not uinmque")
+	}
+}
+
+func TestExecuteQueryDecodesResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"realm-profiler","result":{"response":{"ResponseBase":{"Error":null,"Data":"aGVsbG8=","Log":""}}}}`)
+	}))
+	defer server.Close()
+
+	data, timing, err := executeQuery(server.URL, "vm/qrender", []byte("gno.land/r/test:"), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("Expected data %q, got %q", "hello", data)
+	}
+	if timing.TTFB <= 0 {
+		t.Errorf("Expected TTFB to be recorded, got %v", timing.TTFB)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, _, err := executeQuery(server.URL, "vm/qrender", []byte("gno.land/r/test:"), 20*time.Millisecond)
+	if code := classifyError("", err, nil); code != ErrTimeout {
+		t.Errorf("Expected a slow query to time out, got %q from %v", code, err)
+	}
+	start := time.Now()
+	_, err = executeCommand("sleep 5", "", 50*time.Millisecond)
+	if code := classifyError("", err, nil); code != ErrTimeout {
+		t.Errorf("Expected a slow command to time out, got %q from %v", code, err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the command to be killed, it took %v", elapsed)
+	}
+}
+
+func TestRandomStringSeeded(t *testing.T) {
+	SeedRandom(42)
+	r1 := randomString(32)
+	SeedRandom(42)
+	r2 := randomString(32)
+
+	if r1 != r2 {
+		t.Errorf("Same seed produced different strings: %q and %q", r1, r2)
+	}
+}
+
+func TestGenerateCommandPkgPath(t *testing.T) {
+	args := Config{Remote: "localhost:26657", KeyName: "Dev", PkgDir: ".", ChainID: "dev", Namespace: "r/alice/", PkgPrefix: "loadtest_", NameLength: 8}
+
+	cmd := GenerateCommand("addpkg", "", args)
+	if !regexp.MustCompile(`--pkgpath 'gno\.land/r/alice/loadtest_[a-z]{8}'`).MatchString(cmd) {
+		t.Errorf("Generated package path doesn't use namespace, prefix and length: %s", cmd)
+	}
+
+	cmd = GenerateCommand("call", "gno.land/p/demo/avl", args)
+	if !strings.Contains(cmd, "--pkgpath 'gno.land/p/demo/avl'") {
+		t.Errorf("Full package path was not used as is: %s", cmd)
+	}
+}
+
+func TestParseTxResult(t *testing.T) {
+	output := "OK!\nGAS WANTED: 800000\nGAS USED:   371210\nHEIGHT:     1234\nEVENTS:     []\nTX HASH:    Zm9vYmFyYmF6+/=\n"
+
+	txHash, height, ok := parseTxResult(output)
+	if !ok {
+		t.Fatalf("Expected output to parse")
+	}
+	if txHash != "Zm9vYmFyYmF6+/=" || height != 1234 {
+		t.Errorf("Unexpected tx hash %q or height %d", txHash, height)
+	}
+
+	if _, _, ok := parseTxResult("Error: insufficient funds"); ok {
+		t.Errorf("Expected failed output not to parse")
+	}
+}
+
+func TestCostAccounting(t *testing.T) {
+	tx := "OK!\nGAS WANTED: 800000\nGAS USED:   1000\nHEIGHT:     10\n"
+	if m := parseTxMetrics(tx + tx); m.height != 10 || m.gasUsed != 2000 || m.fee != 2*gasFee {
+		t.Errorf("Expected two transactions' gas and fees, got %+v", m)
+	}
+	if m := parseTxMetrics("Error: insufficient funds"); m.gasUsed != 0 || m.fee != 0 {
+		t.Errorf("Expected failed transactions not to cost anything, got %+v", m)
+	}
+
+	args := testArgs()
+	args.Deposit = "5000ugnot"
+	deploy := captureSection(GenerateCommand("addpkg", "foo", args), tx, nil)
+	if !strings.Contains(deploy, " --deposit 5000ugnot --gas-fee") {
+		t.Errorf("Expected the deposit in the command: %s", deploy)
+	}
+	if m := parseTxMetrics(deploy); m.sent != 5000 {
+		t.Errorf("Expected the deposit to be counted, got %+v", m)
+	}
+	args.Send = "100ugnot"
+	call := captureSection(GenerateCommand("call", "foo", args), tx+tx, nil)
+	if !strings.Contains(call, " --send 100ugnot --gas-fee") {
+		t.Errorf("Expected the coins sent in the command: %s", call)
+	}
+	if m := parseTxMetrics(call); m.sent != 200 {
+		t.Errorf("Expected the coins sent by both transactions to be counted, got %+v", m)
+	}
+
+	stats := Summarize([]ExecutionLog{
+		{Mode: "addpkg", Fee: gasFee, GasUsed: 500, Warmup: true},
+		{Mode: "call", Fee: gasFee, GasUsed: 100},
+		{Mode: "call", Fee: gasFee, GasUsed: 100},
+		{Mode: "qrender"},
+	})
+	if stats.Cost != (Cost{Fee: 3 * gasFee, GasUsed: 700}) || stats.Costs["call"] != (Cost{Fee: 2 * gasFee, GasUsed: 200}) || len(stats.Costs) != 2 {
+		t.Errorf("Unexpected costs %+v by mode %+v", stats.Cost, stats.Costs)
+	}
+	var buf bytes.Buffer
+	WriteStats(&buf, stats, nil)
+	if !strings.Contains(buf.String(), "Fees paid:        30000000ugnot (30 GNOT) (700 gas used)") {
+		t.Errorf("Summary is missing the fees:\n%s", buf.String())
+	}
+}
+
+func TestCountTxs(t *testing.T) {
+	tx := "OK!\nGAS USED:   1000\nHEIGHT:     10\nTX HASH:    aGFzaA==\n"
+	if m := parseTxMetrics(tx, strings.Replace(tx, "aGFzaA==", "aGFzaDI=", 1)); !slices.Equal(m.txHashes, []string{"aGFzaA==", "aGFzaDI="}) {
+		t.Errorf("Expected both tx hashes, got %q", m.txHashes)
+	}
+
+	stats := CountTxs([]ExecutionLog{
+		{Mode: "addpkg+call", Success: true, TxHash: "a b"},
+		{Mode: "call", Success: true, TxHash: "c"},
+		{Mode: "call", Success: true, TxHash: "c"},
+		{Mode: "call", ErrorCode: ErrDuplicateTx},
+		{Mode: "call", ErrorCode: ErrTimeout},
+		{Mode: "qrender", ErrorCode: ErrTimeout},
+	})
+	if stats != (TxStats{Committed: 3, AcceptedTwice: 1, RejectedDuplicate: 1, Unconfirmed: 1}) {
+		t.Errorf("Unexpected transaction stats %+v", stats)
+	}
+	if code := classifyError("Error: tx already exists in cache", errors.New("exit status 1"), nil); code != ErrDuplicateTx {
+		t.Errorf("Expected a duplicate tx, got %s", code)
+	}
+}
+
+func TestLoadTargets(t *testing.T) {
+	dir := t.TempDir()
+
+	manifestPath := filepath.Join(dir, "manifest.csv")
+	os.WriteFile(manifestPath, []byte("PkgPath,TxHash,Height\ngno.land/r/a,aGFzaA==,10\ngno.land/r/b,aGFzaA==,11\n"), 0o644)
+	list, err := loadTargets(manifestPath, false)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	for _, want := range []string{"gno.land/r/a", "gno.land/r/b", "gno.land/r/a"} {
+		if got := list.pick(); got.PkgPath != want || got.Function != "" {
+			t.Errorf("Expected %q with no function, got %+v", want, got)
+		}
+	}
+
+	plainPath := filepath.Join(dir, "targets.txt")
+	os.WriteFile(plainPath, []byte("# boards\ngno.land/r/demo/boards,CreateBoard\n"), 0o644)
+	list, err = loadTargets(plainPath, false)
+	if err != nil {
+		t.Fatalf("Failed to load targets: %v", err)
+	}
+	if got := list.pick(); got != (target{PkgPath: "gno.land/r/demo/boards", Function: "CreateBoard"}) {
+		t.Errorf("Unexpected target %+v", got)
+	}
+}
+
+func TestGeneratePackage(t *testing.T) {
+	src := generatePackage("synthetic", packageSpec{Funcs: 3, Size: 4096, Imports: 2})
+
+	for _, want := range []string{"package synthetic", `"strings"`, `"strconv"`, "func F2(x int) int", "func Main()"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("Expected generated source to contain %q", want)
+		}
+	}
+	if len(src) < 4096-64 || len(src) > 4096 {
+		t.Errorf("Expected about 4096 bytes of source, got %d", len(src))
+	}
+}
+
+func TestPackageSizes(t *testing.T) {
+	args := testArgs()
+	args.GenFuncs = 1
+	args.GenSizeRange = Range{1000, 100000}
+	for range 5 {
+		dir, size, err := writeTaskPackage(args, "sized")
+		if err != nil {
+			t.Fatalf("Failed to write package: %v", err)
+		}
+		os.RemoveAll(dir)
+		if size < 1000-64 || size > 100000 {
+			t.Errorf("Expected a package of 1000 to 100000 bytes, got %d", size)
+		}
+	}
+
+	logs := []ExecutionLog{
+		{ResponseTime: 10 * time.Millisecond, Success: true, Valid: true, PkgSize: 1500},
+		{ResponseTime: 30 * time.Millisecond, Success: true, Valid: true, PkgSize: 40000},
+		{ResponseTime: 50 * time.Millisecond, ErrorCode: ErrUnknown, PkgSize: 60000},
+	}
+	buckets := SummarizePackageSizes(logs)
+	if len(buckets) != 2 || buckets[0].Size != 1024 || buckets[1].Size != 32768 || buckets[1].Failed != 1 {
+		t.Errorf("Unexpected buckets %+v", buckets)
+	}
+	var buf bytes.Buffer
+	WriteStats(&buf, Summarize(logs), logs)
+	if !strings.Contains(buf.String(), "32KB+") || !strings.Contains(buf.String(), "Largest package deployed: 40000 bytes, smallest that failed: 60000 bytes") {
+		t.Errorf("Unexpected package size breakdown:\n%s", buf.String())
+	}
+}
+
+func TestWorkloadSource(t *testing.T) {
+	for _, name := range WorkloadNames() {
+		src, err := workloadSource(workloads[name], "loadtest_abc")
+		if err != nil {
+			t.Fatalf("Failed to read %s workload: %v", name, err)
+		}
+		if !strings.Contains(src, "\npackage loadtest_abc\n") {
+			t.Errorf("Expected %s workload to be renamed, got:\n%s", name, src)
+		}
+		if !strings.Contains(src, "func "+workloads[name].Function+"()") {
+			t.Errorf("Expected %s workload to define %s", name, workloads[name].Function)
+		}
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	rules, err := compileRules([]string{"OK!", "qrender=data:"}, []string{`GAS USED:\s+\d+`})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	if err := checkResponse(rules, "call", "OK!\nGAS USED:   1234\n"); err != nil {
+		t.Errorf("Expected call response to pass, got %v", err)
+	}
+	if err := checkResponse(rules, "call", "GAS USED:   1234\n"); err == nil {
+		t.Errorf("Expected response without OK! to fail")
+	}
+	if err := checkResponse(rules, "qrender", "OK!\nGAS USED:   1\n"); err == nil {
+		t.Errorf("Expected qrender response without data: to fail")
+	}
+	if _, err := compileRules(nil, []string{"("}); err == nil {
+		t.Errorf("Expected invalid regex to be rejected")
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	failed := &commandError{err: errors.New("exit status 1"), stderr: "--= Error =--\nData: insufficient funds error\n"}
+
+	cases := []struct {
+		out    string
+		err    error
+		verr   error
+		expect string
+	}{
+		{"OK!", nil, nil, ""},
+		{"OK!", nil, errors.New("response doesn't contain"), ErrValidation},
+		{"", failed, nil, ErrInsufficientFunds},
+		{"", errors.New("dial tcp 127.0.0.1:26657: connect: connection refused"), nil, ErrConnRefused},
+		{"Data: package already exists: gno.land/r/foo", errors.New("exit status 1"), nil, ErrPackageExists},
+		{"Data: mempool is full: number of txs 5000 (max: 5000)", errors.New("exit status 1"), nil, ErrMempoolFull},
+		{"", &commandError{err: errors.New("exit status 1"), stderr: "open /root/.config/gno/data/keys.db/LOCK: resource temporarily unavailable"}, nil, ErrKeybaseLocked},
+		{"", errors.New("read tcp 10.0.0.1:40000->10.0.0.2:26657: read: resource temporarily unavailable"), nil, ErrUnknown},
+		{"", errors.New("exit status 2"), nil, ErrUnknown},
+	}
+	for _, c := range cases {
+		if got := classifyError(c.out, c.err, c.verr); got != c.expect {
+			t.Errorf("classifyError(%q, %v, %v) = %q, expected %q", c.out, c.err, c.verr, got, c.expect)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	consecutive := circuitBreaker{maxConsecutive: 3}
+	for i, failed := range []bool{true, true, false, true, true} {
+		if reason := consecutive.observe(failed); reason != "" {
+			t.Fatalf("Tripped early at request %d: %s", i, reason)
+		}
+	}
+	if reason := consecutive.observe(true); reason == "" {
+		t.Errorf("Expected 3 consecutive errors to trip the breaker")
+	}
+
+	rate := circuitBreaker{maxErrorRate: 0.5}
+	for i := 0; i < abortMinRequests-1; i++ {
+		if reason := rate.observe(true); reason != "" {
+			t.Fatalf("Tripped before %d requests: %s", abortMinRequests, reason)
+		}
+	}
+	if reason := rate.observe(true); reason == "" {
+		t.Errorf("Expected a 100%% error rate to trip the breaker")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoffController(0.2, 0.5)
+	feed := func(log ExecutionLog, n int) (scales []float64) {
+		for i := 0; i < n; i++ {
+			if scale, _ := b.observe(log); scale > 0 {
+				scales = append(scales, scale)
+			}
+		}
+		return scales
+	}
+	timeout := ExecutionLog{ErrorCode: ErrTimeout}
+	ok := ExecutionLog{Success: true, Valid: true}
+	if scales := feed(ExecutionLog{ErrorCode: ErrInsufficientFunds}, 2*BackoffWindow); len(scales) > 0 {
+		t.Errorf("Expected errors the requests cause not to back off, got %v", scales)
+	}
+	b = newBackoffController(0.2, 0.5)
+	if scales := feed(timeout, 2*backoffMinRequests); !slices.Equal(scales, []float64{0.5, 0.25}) {
+		t.Errorf("Expected the rate to be halved twice, got %v", scales)
+	}
+	if scales := feed(ok, 4*backoffMinRequests); !slices.Equal(scales, []float64{0.5, 1}) {
+		t.Errorf("Expected the rate to recover a step at a time, got %v", scales)
+	}
+
+	args := testArgs()
+	args.MaxQPS = 8
+	args.BackoffErrorRate = 0.5
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < backoffMinRequests; i++ {
+		r.record(ExecutionLog{Timestamp: time.Now(), ErrorCode: ErrMempoolFull})
+	}
+	r.sync()
+	if rate := r.targetRate(); rate != 4 {
+		t.Errorf("Expected a full mempool to back the rate off to 4, got %v", rate)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 95: 95 * time.Millisecond, 100: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%v) = %v, expected %v", p, got, want)
+		}
+	}
+}
+
+func TestThinkTime(t *testing.T) {
+	mean := 100 * time.Millisecond
+	if got := thinkTime(mean, "fixed"); got != mean {
+		t.Errorf("Expected fixed think time of %v, got %v", mean, got)
+	}
+
+	SeedRandom(1)
+	var total time.Duration
+	for i := 0; i < 10000; i++ {
+		d := thinkTime(mean, "uniform")
+		if d < 0 || d >= 2*mean {
+			t.Fatalf("Uniform think time %v out of range", d)
+		}
+		total += thinkTime(mean, "exponential")
+	}
+	if avg := total / 10000; avg < 90*time.Millisecond || avg > 110*time.Millisecond {
+		t.Errorf("Expected exponential think times to average about %v, got %v", mean, avg)
+	}
+}
+
+func TestPoissonPacerRate(t *testing.T) {
+	SeedRandom(1)
+	p := &poissonPacer{rate: func() float64 { return 1000 }}
+	start := time.Now()
+	for i := 0; i < 200; i++ {
+		p.wait()
+	}
+	// 200 arrivals at 1000/s should take about 200ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected about 200ms for 200 arrivals, took %v", elapsed)
+	}
+}
+
+func TestPoissonPacerZeroRate(t *testing.T) {
+	// A rate of 0 holds requests back until it picks up, rather than sleeping an
+	// undefined time
+	var calls atomic.Int32
+	p := &poissonPacer{rate: func() float64 {
+		if calls.Add(1) <= 2 {
+			return 0
+		}
+		return 1000
+	}}
+	start := time.Now()
+	p.wait()
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("Expected the request to wait for the rate to pick up, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterWindows(t *testing.T) {
+	for _, c := range []struct {
+		rate   float64
+		limits []int // of the first windows
+	}{
+		{5, []int{5, 5, 5}},
+		{1, []int{1, 1, 1}},
+		{0.5, []int{1, 0, 1, 0}},
+		{0.25, []int{1, 0, 0, 0, 1}},
+		{0, []int{0, 0}},
+	} {
+		l := &rateLimiter{rate: func() float64 { return c.rate }, credit: 1}
+		var limits []int
+		for range c.limits {
+			limits = append(limits, l.windowLimit())
+		}
+		if !slices.Equal(limits, c.limits) {
+			t.Errorf("Expected windows of %v at %v, got %v", c.limits, c.rate, limits)
+		}
+	}
+
+	// Backing off below 1 a second takes effect from the next window
+	rate := 20.0
+	l := newRateLimiter(func() float64 { return rate })
+	l.wait()
+	rate = 0.1
+	l.windowStart = l.windowStart.Add(-time.Second)
+	l.wait()
+	if l.limit != 1 {
+		t.Errorf("Expected one request in the first window after backing off, got %d", l.limit)
+	}
+
+	// and recovering is seen within a second, not after the 10s a request takes at 0.1
+	start := time.Now()
+	rate = 20
+	l.wait()
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("Expected the rate to recover within a second, took %v", elapsed)
+	}
+}
+
+func TestLoadShapeMultiplier(t *testing.T) {
+	start := time.Now()
+
+	spike := newLoadShape("spike", time.Minute, 5)
+	spike.start = start
+	if m := spike.multiplier(start.Add(time.Second)); m != 5 {
+		t.Errorf("Expected a spike at the start of the period, got %v", m)
+	}
+	if m := spike.multiplier(start.Add(30 * time.Second)); m != 1 {
+		t.Errorf("Expected no spike mid-period, got %v", m)
+	}
+
+	sine := newLoadShape("sine", time.Minute, 3)
+	sine.start = start
+	if m := sine.multiplier(start); m != 1 {
+		t.Errorf("Expected the sine wave to start at 1x, got %v", m)
+	}
+	if m := sine.multiplier(start.Add(30 * time.Second)); m != 3 {
+		t.Errorf("Expected the sine wave to peak at 3x, got %v", m)
+	}
+}
+
+// testArgs returns the flag defaults, for tests that need a complete set of arguments
+func testArgs() Config {
+	args := DefaultConfig()
+	args.Normalize()
+	return args
+}
+
+func TestControllerMergesAgentResults(t *testing.T) {
+	agent1 := httptest.NewServer(agentHandler("", "s3cret"))
+	defer agent1.Close()
+	agent2 := httptest.NewServer(agentHandler("", "s3cret"))
+	defer agent2.Close()
+
+	args := testArgs()
+	args.Mode = "calibrate"
+	args.MaxQPS = 20
+	args.Duration = 300 * time.Millisecond
+
+	if _, err := RunController([]string{agent1.URL}, args, 1, "wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected agents to refuse a wrong secret, got %v", err)
+	}
+	custom := args
+	custom.CalibrateCmd = "touch /tmp/pwned"
+	if _, err := RunController([]string{agent1.URL}, custom, 1, "s3cret"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected agents to refuse a command, got %v", err)
+	}
+	custom = args
+	custom.ManifestFile = "/etc/passwd"
+	if errs := AgentErrors(custom); len(errs) != 1 {
+		t.Errorf("Expected agents to refuse a file, got %v", errs)
+	}
+	custom = args
+	custom.Webhooks = []string{"http://10.0.0.1/hook"}
+	if _, err := RunController([]string{agent1.URL}, custom, 1, "s3cret"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected agents to refuse a webhook, got %v", err)
+	}
+	custom = args
+	custom.StatsdAddr = "10.0.0.1:8125"
+	if errs := AgentErrors(custom); len(errs) != 1 {
+		t.Errorf("Expected agents to refuse a statsd server, got %v", errs)
+	}
+
+	logs, err := RunController([]string{agent1.URL, agent2.URL}, args, 1, "s3cret")
+	if err != nil {
+		t.Fatalf("Controller failed: %v", err)
+	}
+	perAgent := map[string]int{}
+	for _, log := range logs {
+		perAgent[log.Agent]++
+		if !log.Success {
+			t.Errorf("Expected calibrate requests to succeed: %+v", log)
+		}
+	}
+	if perAgent[agent1.URL] == 0 || perAgent[agent2.URL] == 0 {
+		t.Errorf("Expected results from both agents, got %v", perAgent)
+	}
+}
+
+func TestWriteReadLogs(t *testing.T) {
+	logs := []ExecutionLog{{
+		Timestamp:     time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC),
+		ResponseTime:  1500*time.Millisecond + 123*time.Nanosecond,
+		HTTP:          HTTPTiming{TTFB: 250*time.Millisecond + 7*time.Nanosecond},
+		QueueWait:     3 * time.Millisecond,
+		ErrorCode:     ErrOutOfGas,
+		ActiveWorkers: 3,
+		Agent:         "10.0.0.1:7070",
+		Capture:       "000001.txt",
+		Step:          "2:call",
+		Height:        42,
+		GasUsed:       123456,
+		Mode:          "call",
+		Fee:           10000000,
+		GasWanted:     800000,
+		GasFee:        10000000,
+		Fault:         FaultChainID,
+		PkgSize:       4096,
+		TxHash:        "aGFzaA== aGFzaDI=",
+		TargetQPS:     2.5,
+		Start:         time.Date(2025, 1, 2, 3, 4, 3, 623456666, time.UTC),
+		Fingerprint:   "0123456789abcdef",
+		RunID:         "20250102T030000Z",
+		ResponseSize:  4096,
+		Cache:         CacheBust,
+		Worker:        "w3_",
+		Fields:        map[string]float64{"renderedBytes": 1024, "ratio": 0.25},
+	}}
+	var buf bytes.Buffer
+	if err := WriteLogs(&buf, logs); err != nil {
+		t.Fatalf("Failed to write logs: %v", err)
+	}
+	read, err := ReadLogs(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read logs: %v", err)
+	}
+	if len(read) != 1 || !reflect.DeepEqual(read[0], logs[0]) {
+		t.Errorf("Round trip changed the logs:\n%+v\n%+v", logs, read)
+	}
+}
+
+func TestResultsResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	log := ExecutionLog{Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ResponseTime: time.Second, Success: true, Valid: true}
+
+	w, _, err := OpenResults(path, false)
+	if err != nil {
+		t.Fatalf("Failed to create results: %v", err)
+	}
+	// A second checkpoint must only append the new row
+	w.Flush([]ExecutionLog{log})
+	w.Flush([]ExecutionLog{log, log})
+	w.file.Close()
+
+	w, previous, err := OpenResults(path, true)
+	if err != nil {
+		t.Fatalf("Failed to resume results: %v", err)
+	}
+	if len(previous) != 2 {
+		t.Fatalf("Expected 2 previous results, got %d", len(previous))
+	}
+	w.Flush(append(previous, log))
+	w.file.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	logs, err := ReadLogs(file)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	if len(logs) != 3 {
+		t.Errorf("Expected 3 results after resuming, got %d", len(logs))
+	}
+}
+
+func TestCompressedResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv.gz")
+	log := ExecutionLog{Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ResponseTime: time.Second, Success: true, Valid: true}
+
+	// Without Close, like after a crash: the flushed rows must still be readable
+	w, _, err := OpenResults(path, false)
+	if err != nil {
+		t.Fatalf("Failed to create results: %v", err)
+	}
+	w.Flush([]ExecutionLog{log, log})
+	w.file.Close()
+
+	w, previous, err := OpenResults(path, true)
+	if err != nil {
+		t.Fatalf("Failed to resume results: %v", err)
+	}
+	if len(previous) != 2 {
+		t.Fatalf("Expected 2 previous results, got %d", len(previous))
+	}
+	w.Flush(append(previous, log))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close results: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		t.Errorf("Expected gzipped results")
+	}
+	logs, err := LoadResults(path)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	if len(logs) != 3 || !reflect.DeepEqual(logs[2], log) {
+		t.Errorf("Expected 3 results after resuming, got %+v", logs)
+	}
+}
+
+func TestResultsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.csv.gz")
+	log := ExecutionLog{Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ResponseTime: time.Second, Success: true, Valid: true}
+
+	w, _, err := OpenResults(path, false)
+	if err != nil {
+		t.Fatalf("Failed to create results: %v", err)
+	}
+	// Every checkpoint goes over the size, so each one ends up in its own file
+	w.Rotate(1, 0)
+	w.Flush([]ExecutionLog{log})
+	w.Flush([]ExecutionLog{log, log, log})
+	w.Flush([]ExecutionLog{log, log, log, log})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close results: %v", err)
+	}
+
+	for i, want := range []int{1, 2, 1, 0} {
+		name := path
+		if i < 3 {
+			name = filepath.Join(dir, fmt.Sprintf("results-%04d.csv.gz", i+1))
+		}
+		logs, err := LoadResults(name)
+		if err != nil {
+			t.Fatalf("Failed to read rotated results: %v", err)
+		}
+		if len(logs) != want {
+			t.Errorf("Expected %d results in %s, got %d", want, name, len(logs))
+		}
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	logs := []ExecutionLog{
+		{Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ResponseTime: time.Second, Success: true, Valid: true, Height: 42, GasUsed: 123456},
+		{Timestamp: time.Date(2025, 1, 2, 3, 4, 6, 0, time.UTC), ResponseTime: 2 * time.Second, ErrorCode: ErrTimeout},
+	}
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, logs); err != nil {
+		t.Fatalf("Failed to write Parquet: %v", err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("Expected Parquet magic at both ends")
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer <= 0 || footer > len(data)-12 {
+		t.Fatalf("Footer length %d doesn't fit in %d bytes", footer, len(data))
+	}
+	meta := data[len(data)-8-footer : len(data)-8]
+	for _, col := range parquetColumns {
+		if !bytes.Contains(meta, []byte(col.name)) {
+			t.Errorf("Footer is missing column %s", col.name)
+		}
+	}
+
+	// The first column chunk starts right after the magic, with a gzipped page of
+	// microsecond timestamps
+	var header thriftWriter
+	header.i32(1, parquetDataPage)
+	header.i32(2, 16)
+	if !bytes.HasPrefix(data[4:], header.buf.Bytes()) {
+		t.Errorf("Expected a 16 byte data page first, got % x", data[4:12])
+	}
+}
+
+func TestCapture(t *testing.T) {
+	args := testArgs()
+	args.CaptureDir = filepath.Join(t.TempDir(), "capture")
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	failure := &commandError{err: errors.New("exit status 1"), stderr: "insufficient funds"}
+	name := r.capture(captureSection("gnokey maketx call", "partial output", failure))
+	if name != "000001.txt" {
+		t.Fatalf("Unexpected capture file name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(args.CaptureDir, name))
+	if err != nil {
+		t.Fatalf("Failed to read capture: %v", err)
+	}
+	for _, want := range []string{"$ gnokey maketx call", "exit status 1", "partial output", "insufficient funds"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Capture is missing %q:\n%s", want, data)
+		}
+	}
+
+	// A resumed run numbers its captures after those already there
+	resumed := args
+	resumed.Resume = true
+	if r, err = NewRun(resumed, ""); err != nil {
+		t.Fatalf("Failed to set up resumed run: %v", err)
+	}
+	if name := r.capture("resumed"); name != "000002.txt" {
+		t.Errorf("Expected the resumed run to capture to 000002.txt, got %q", name)
+	}
+	if again, _ := os.ReadFile(filepath.Join(args.CaptureDir, "000001.txt")); !bytes.Equal(again, data) {
+		t.Errorf("Expected the first run's capture to be kept, got:\n%s", again)
+	}
+
+	// Rotated captures go into numbered subdirectories
+	args.CaptureDir = filepath.Join(t.TempDir(), "rotated")
+	args.RotateSize = 10
+	if r, err = NewRun(args, ""); err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	var names []string
+	for range 3 {
+		names = append(names, r.capture("0123456789"))
+	}
+	want := []string{filepath.Join("0001", "000001.txt"), filepath.Join("0002", "000002.txt"), filepath.Join("0003", "000003.txt")}
+	if !slices.Equal(names, want) {
+		t.Errorf("Expected captures %v, got %v", want, names)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	args := testArgs()
+	args.Mode = "addpkg+call"
+	args.PackageName = "foo"
+	args.FunctionName = "Bar"
+	var buf bytes.Buffer
+	if err := WriteDryRun(&buf, args); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "maketx addpkg --pkgpath 'gno.land/r/foo'") || !strings.Contains(lines[1], "--func Bar") {
+		t.Errorf("Unexpected dry run output:\n%s", buf.String())
+	}
+
+	args.Mode = "qrender"
+	args.Backend = "rpc"
+	buf.Reset()
+	if err := WriteDryRun(&buf, args); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"method":"abci_query"`) {
+		t.Errorf("Expected an RPC request, got:\n%s", buf.String())
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	r, err := NewRun(testArgs(), "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	r.record(ExecutionLog{Timestamp: time.Now(), ResponseTime: time.Second, Success: true, Valid: true})
+	server := httptest.NewServer(controlHandler(r, "s3cret"))
+	defer server.Close()
+	send := func(method, path, secret string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+
+	for _, secret := range []string{"", "wrong"} {
+		if resp := send("POST", "/pause", secret); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected a request with secret %q to be refused, got %s", secret, resp.Status)
+		}
+	}
+	if r.paused.Load() {
+		t.Errorf("Expected an unauthorized request to leave the run alone")
+	}
+
+	if resp := send("POST", "/qps?value=7", "s3cret"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to set QPS: %s", resp.Status)
+	}
+	if r.targetRate() != 7 {
+		t.Errorf("Expected target rate 7, got %v", r.targetRate())
+	}
+	if resp := send("POST", "/qps?value=0", "s3cret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected QPS 0 to be rejected, got %s", resp.Status)
+	}
+
+	send("POST", "/pause", "s3cret")
+	if !r.paused.Load() {
+		t.Errorf("Expected run to be paused")
+	}
+	send("POST", "/resume", "s3cret")
+	if r.paused.Load() {
+		t.Errorf("Expected run to be resumed")
+	}
+
+	resp := send("GET", "/stats", "s3cret")
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "Target QPS:       7") || !strings.Contains(string(body), "Requests:         1") {
+		t.Errorf("Unexpected stats:\n%s", body)
+	}
+
+	for addr, want := range map[string]string{":8080": "127.0.0.1:8080", "0.0.0.0:8080": "0.0.0.0:8080", "localhost:8080": "localhost:8080"} {
+		if got := controlAddr(addr); got != want {
+			t.Errorf("Expected control API address %s to listen on %s, got %s", addr, want, got)
+		}
+	}
+}
+
+// fakeExecutor answers requests without a node, so runs can be tested end to end.
+type fakeExecutor struct {
+	respond func(mode, packageName string) (string, error)
+	sent    func(mode, packageName string, args Config) // optional, called with every request
+}
+
+func (e fakeExecutor) Describe(mode, packageName string, args Config) string {
+	return "fake " + mode + " " + packageName
+}
+
+func (e fakeExecutor) Execute(mode, packageName string, args Config) (string, HTTPTiming, error) {
+	if e.sent != nil {
+		e.sent(mode, packageName, args)
+	}
+	out, err := e.respond(mode, packageName)
+	return out, HTTPTiming{}, err
+}
+
+// runFake runs args against respond until the run has recorded at least n requests.
+func runFake(t *testing.T, args Config, n int, respond func(mode, packageName string) (string, error)) []ExecutionLog {
+	t.Helper()
+	RegisterExecutor("fake", func(string) Executor { return fakeExecutor{respond: respond} })
+	args.Backend = "fake"
+	args.MaxQPS = 1000
+	args.Arrival = "poisson" // fixed windows would send the whole second's requests at once
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	go func() {
+		for len(r.Logs()) < n {
+			time.Sleep(time.Millisecond)
+		}
+		r.Stop()
+	}()
+	r.Start()
+	r.Close()
+	return r.Logs()
+}
+
+func TestRunWithFakeExecutor(t *testing.T) {
+	args := testArgs()
+	args.Mode = "addpkg"
+	args.ManifestFile = filepath.Join(t.TempDir(), "deployed.csv")
+	logs := runFake(t, args, 3, func(mode, packageName string) (string, error) {
+		if mode != "addpkg" {
+			t.Errorf("Expected addpkg requests, got %s", mode)
+		}
+		return "OK!\nGAS WANTED: 800000\nHEIGHT:     7\nTX HASH:    abc=\n", nil
+	})
+	for _, log := range logs {
+		if !log.Success || !log.Valid || log.ErrorCode != "" {
+			t.Errorf("Expected a successful request, got %+v", log)
+		}
+	}
+	targets, err := loadTargets(args.ManifestFile, false)
+	if err != nil || len(targets.targets) != len(logs) {
+		t.Errorf("Expected %d deployed packages in the manifest, got %v (%v)", len(logs), targets, err)
+	}
+
+	args = testArgs()
+	args.PackageName = "foo"
+	args.FunctionName = "Bar"
+	logs = runFake(t, args, 1, func(mode, packageName string) (string, error) {
+		return "", &commandError{err: errors.New("exit status 1"), stderr: "insufficient funds for gas"}
+	})
+	if logs[0].Success || logs[0].ErrorCode != ErrInsufficientFunds {
+		t.Errorf("Expected an insufficient_funds failure, got %+v", logs[0])
+	}
+}
+
+// useFakeGnokey puts testdata/bin/gnokey first on PATH for the rest of the test and returns
+// the file it keeps its call counter in.
+func useFakeGnokey(t *testing.T) string {
+	t.Helper()
+	bin, err := filepath.Abs(filepath.Join("testdata", "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	state := filepath.Join(t.TempDir(), "count")
+	t.Setenv("FAKE_GNOKEY_STATE", state)
+	return state
+}
+
+func TestEstimateBalance(t *testing.T) {
+	useFakeGnokey(t)
+	var queried string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queried = string(body)
+		// "25000000ugnot"
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"realm-profiler","result":{"response":{"ResponseBase":{"Error":null,"Data":"IjI1MDAwMDAwdWdub3Qi","Log":""}}}}`)
+	}))
+	defer server.Close()
+
+	args := testArgs()
+	args.Remote = server.URL
+	args.MaxThreads = 2
+	args.Duration = 2 * time.Second
+	args.PackageName = "foo"
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	e, err := r.EstimateBalance()
+	if err != nil {
+		t.Fatalf("Failed to estimate balance: %v", err)
+	}
+	if !strings.Contains(queried, "bank/balances/g1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5") {
+		t.Errorf("Expected the balance of the Dev key to be queried, got %s", queried)
+	}
+	// 2 threads at 1 call per second for 2s
+	if e.Balance != 25000000 || e.Cost != 4*gasFee || e.Sufficient() {
+		t.Errorf("Expected 25000000ugnot not to cover 4 calls, got %+v", e)
+	}
+	if e.Lasts() != 1250*time.Millisecond {
+		t.Errorf("Expected the balance to last 1.25s, got %v", e.Lasts())
+	}
+
+	args.Mode = "qrender"
+	if r, err = NewRun(args, ""); err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	if e, err := r.EstimateBalance(); err != nil || e.Address != "" {
+		t.Errorf("Expected queries not to need a balance, got %+v (%v)", e, err)
+	}
+}
+
+func TestExecuteCommandWithFakeGnokey(t *testing.T) {
+	useFakeGnokey(t)
+	args := testArgs()
+	args.PkgDir = "testdata/tester"
+
+	output, err := ExecuteCommand(GenerateCommand("addpkg", "test"+randomString(32), args), "password")
+	if err != nil {
+		t.Fatalf("Command execution failed: %v", err)
+	}
+	if hash, height, ok := parseTxResult(output); !ok || hash == "" || height != 42 {
+		t.Errorf("Expected a committed tx in the output, got:\n%s", output)
+	}
+
+	// Like gnokey, the fake refuses to sign without a password
+	output, err = ExecuteCommand(GenerateCommand("call", "test", args), "")
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) || !strings.Contains(cmdErr.stderr, "invalid account password") {
+		t.Errorf("Expected a password error, got %v with output %q", err, output)
+	}
+}
+
+func TestVerifyWithFakeGnokey(t *testing.T) {
+	useFakeGnokey(t)
+	args := testArgs()
+	args.Mode = "verify"
+	args.VerifyCount = 5
+	args.MaxQPS = 1000
+	args.Arrival = "poisson"
+	r, err := NewRun(args, "password")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	if !r.Verify() {
+		t.Error("Expected every increment to be reflected in the rendered count")
+	}
+	if logs := r.Logs(); len(logs) != args.VerifyCount {
+		t.Errorf("Expected %d recorded increments, got %d", args.VerifyCount, len(logs))
+	}
+}
+
+func TestVerifyFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		deploy    error
+		failEvery int // every failEvery-th increment fails
+		rendered  func(succeeded int) string
+		want      bool
+	}{
+		{"some increments fail", nil, 2, func(n int) string { return fmt.Sprintf("data: %d", n) }, true},
+		{"lost writes", nil, 2, func(n int) string { return fmt.Sprintf("data: %d", n-1) }, false},
+		{"duplicated writes", nil, 2, func(n int) string { return fmt.Sprintf("data: %d", n+1) }, false},
+		{"deploy fails", errors.New("exit status 1"), 2, func(n int) string { return "data: 0" }, false},
+		{"unexpected output", nil, 2, func(n int) string { return "data: (nil)" }, false},
+		{"overflowing count", nil, 1, func(n int) string { return "data: 99999999999999999999" }, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls, succeeded := 0, 0
+			RegisterExecutor("fake", func(string) Executor {
+				return fakeExecutor{respond: func(mode, packageName string) (string, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					switch mode {
+					case "addpkg":
+						return "OK!", tt.deploy
+					case "qrender":
+						return tt.rendered(succeeded), nil
+					}
+					if calls++; calls%tt.failEvery == 0 {
+						return "", errors.New("exit status 1")
+					}
+					succeeded++
+					return fmt.Sprintf("OK!\nHEIGHT:     42\nTX HASH:    tx%d", calls), nil
+				}}
+			})
+			args := testArgs()
+			args.Backend = "fake"
+			args.Mode = "verify"
+			args.VerifyCount = 6
+			args.MaxQPS = 1000
+			args.Arrival = "poisson"
+			r, err := NewRun(args, "")
+			if err != nil {
+				t.Fatalf("Failed to set up run: %v", err)
+			}
+			if got := r.Verify(); got != tt.want {
+				t.Errorf("Expected Verify to return %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGasEstimation(t *testing.T) {
+	state := useFakeGnokey(t)
+	args := testArgs()
+	args.PackageName = "foo"
+	args.FunctionName = "Inc"
+	args.GasEstimate = "once"
+	args.GasAdjustment = 2
+	r, err := NewRun(args, "password")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	// The fake gnokey simulates 123456 gas used
+	for range 2 {
+		if got := r.withGas("call", "foo", args); got.GasWanted != 246912 {
+			t.Errorf("Expected 246912 gas wanted, got %d", got.GasWanted)
+		}
+	}
+	if _, err := os.Stat(state); err == nil {
+		t.Errorf("Expected the simulation not to be broadcast")
+	}
+	if !strings.Contains(GenerateCommand("call", "foo", r.withGas("call", "foo", args)), "--gas-wanted 246912 --broadcast --chainid") {
+		t.Errorf("Expected the estimate in the command")
+	}
+	if got := r.withGas("qrender", "foo", args); got.GasWanted != args.GasWanted {
+		t.Errorf("Expected queries to keep gasWanted, got %d", got.GasWanted)
+	}
+}
+
+func TestRunMode(t *testing.T) {
+	useFakeGnokey(t)
+	args := testArgs()
+	args.Mode = "run"
+	args.RunFile = "scripts/it's.gno"
+	cmd := GenerateCommand("run", "", args)
+	if !strings.HasPrefix(cmd, "gnokey maketx run --gas-fee") || !strings.HasSuffix(cmd, ` Dev 'scripts/it'\''s.gno'`) {
+		t.Errorf("Unexpected run command: %s", cmd)
+	}
+	out, err := ExecuteCommand(cmd, "password")
+	if m := parseTxMetrics(captureSection(cmd, out, err)); err != nil || m.gasUsed != 123456 || m.fee != gasFee {
+		t.Errorf("Expected a committed transaction, got %+v, %v", m, err)
+	}
+	if gasKey("run", "", args) != "run scripts/it's.gno" {
+		t.Errorf("Expected run scripts to be estimated per file")
+	}
+}
+
+func TestQdocMode(t *testing.T) {
+	useFakeGnokey(t)
+	args := testArgs()
+	cmd := GenerateCommand("qdoc", "gno.land/r/demo/boards", args)
+	if cmd != "gnokey query vm/qdoc --data 'gno.land/r/demo/boards' --remote localhost:26657" {
+		t.Errorf("Unexpected qdoc command: %s", cmd)
+	}
+	if out, err := ExecuteCommand(cmd, ""); err != nil || !strings.Contains(out, `"package_path":"gno.land/r/demo/boards"`) {
+		t.Errorf("Unexpected qdoc response %q, %v", out, err)
+	}
+	if path, data := generateQuery("qdoc", "gno.land/r/demo/boards", ""); path != "vm/qdoc" || string(data) != "gno.land/r/demo/boards" {
+		t.Errorf("Unexpected qdoc query %s %q", path, data)
+	}
+	s, err := journeyScript(Config{Steps: []string{"qrender", "qdoc"}})
+	if err != nil || s.statements[1].op != "qdoc" {
+		t.Errorf("Expected a qdoc journey step, got %v", err)
+	}
+}
+
+func TestMemo(t *testing.T) {
+	args := testArgs()
+	args.Memo = "profiler $run #$request $mode"
+	r := Run{start: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+	for i, want := range []string{"profiler 20250102T030405Z #1 call", "profiler 20250102T030405Z #2 addpkg"} {
+		mode := []string{"call", "addpkg"}[i]
+		if got := r.withMemo(mode, args); got.Memo != want {
+			t.Errorf("Expected memo %q, got %q", want, got.Memo)
+		}
+	}
+	if got := r.withMemo("qrender", args); got.Memo != args.Memo {
+		t.Errorf("Expected queries to be left alone, got %q", got.Memo)
+	}
+	args.Memo = "it's #1"
+	if cmd := GenerateCommand("call", "foo", args); !strings.Contains(cmd, `--memo 'it'\''s #1' --broadcast`) {
+		t.Errorf("Expected the memo in the command: %s", cmd)
+	}
+}
+
+func TestGasFuzzing(t *testing.T) {
+	if rg, err := ParseRange("1000-2000000"); err != nil || rg != (Range{1000, 2000000}) {
+		t.Errorf("Unexpected range %v, %v", rg, err)
+	}
+	for _, bad := range []string{"", "a-b", "10-1", "0-5"} {
+		if _, err := ParseRange(bad); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+
+	args := testArgs()
+	args.FuzzGasWanted = Range{1000, 2000000}
+	args.FuzzGasFee = Range{1, 10000000}
+	var r Run
+	for range 100 {
+		got := r.withGas("call", "foo", args)
+		if got.GasWanted < 1000 || got.GasWanted > 2000000 || got.GasFee < 1 || got.GasFee > 10000000 {
+			t.Fatalf("Gas out of range: %d wanted, %dugnot", got.GasWanted, got.GasFee)
+		}
+	}
+	if got := r.withGas("qrender", "foo", args); got.GasWanted != args.GasWanted {
+		t.Errorf("Expected queries to keep gasWanted, got %d", got.GasWanted)
+	}
+
+	args.GasWanted, args.GasFee = 5000, 20
+	cmd := GenerateCommand("call", "foo", args)
+	m := parseTxMetrics(captureSection(cmd, "OK!\nGAS WANTED: 5000\nGAS USED:   1000\nHEIGHT:     10\n", nil))
+	if m.gasWanted != 5000 || m.gasFee != 20 || m.fee != 20 {
+		t.Errorf("Expected the offered gas and fee to be recorded, got %+v", m)
+	}
+
+	var buf bytes.Buffer
+	WriteGasFuzz(&buf, []ExecutionLog{
+		{ResponseTime: time.Second, GasWanted: 100, GasFee: 5, ErrorCode: ErrOutOfGas},
+		{ResponseTime: time.Second, GasWanted: 5000, GasFee: 20, Fee: 20, Success: true},
+		{ResponseTime: time.Second, GasWanted: 9000, GasFee: 30, Fee: 30, Success: true},
+	})
+	if !strings.Contains(buf.String(), ErrOutOfGas) || !regexp.MustCompile(`ok\s+2\s+1s\s+5000-9000\s+20-30ugnot\s+50`).MatchString(buf.String()) {
+		t.Errorf("Unexpected gas fuzzing breakdown:\n%s", buf.String())
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	args := testArgs()
+	seen := map[string]bool{}
+	for range 100 {
+		name, got, fault := malform("call", "gno.land/r/demo/counter", args)
+		seen[fault] = true
+		switch fault {
+		case FaultPkgPath:
+			if !strings.HasPrefix(name, "gno.land/r/missing_") {
+				t.Errorf("Expected a missing package, got %q", name)
+			}
+		case FaultFunction:
+			if got.FunctionName == args.FunctionName || name != "gno.land/r/demo/counter" {
+				t.Errorf("Expected only the function to change, got %q %q", name, got.FunctionName)
+			}
+		case FaultChainID:
+			if got.ChainID != "dev-wrong" {
+				t.Errorf("Expected a wrong chain ID, got %q", got.ChainID)
+			}
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected every fault to be picked for calls, got %v", seen)
+	}
+	for range 20 {
+		if _, _, fault := malform("qrender", "foo", args); fault != FaultPkgPath {
+			t.Errorf("Expected only bad package paths for qrender, got %s", fault)
+		}
+		if name, _, fault := malform("addpkg", "", args); fault == FaultPkgPath && !strings.HasPrefix(name, "gno.land/x/") {
+			t.Errorf("Expected an undeployable path, got %q", name)
+		}
+	}
+
+	logs := []ExecutionLog{
+		{ResponseTime: time.Second, Success: true, Valid: true},
+		{ResponseTime: 10 * time.Millisecond, ErrorCode: ErrUnknown, Fault: FaultFunction},
+		{ResponseTime: 20 * time.Millisecond, Success: true, Valid: true, Fault: FaultFunction},
+	}
+	stats := Summarize(logs)
+	if stats.Requests != 1 || stats.Failed != 0 || stats.Malformed != 2 {
+		t.Errorf("Expected malformed requests to be left out of the summary, got %+v", stats)
+	}
+	var buf bytes.Buffer
+	WriteStats(&buf, stats, logs)
+	if !regexp.MustCompile(`badFunction\s+2\s+1\s+10ms\s+20ms`).MatchString(buf.String()) {
+		t.Errorf("Unexpected malformed breakdown:\n%s", buf.String())
+	}
+}
+
+func TestFuzzArgs(t *testing.T) {
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		// Post(title string, n int8, ok bool), Render(path string), Transfer(to []byte)
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"realm-profiler","result":{"response":{"ResponseBase":{"Error":null,"Data":"W3siRnVuY05hbWUiOiJQb3N0IiwiUGFyYW1zIjpbeyJOYW1lIjoidGl0bGUiLCJUeXBlIjoic3RyaW5nIiwiVmFsdWUiOiIifSx7Ik5hbWUiOiJuIiwiVHlwZSI6ImludDgiLCJWYWx1ZSI6IiJ9LHsiTmFtZSI6Im9rIiwiVHlwZSI6ImJvb2wiLCJWYWx1ZSI6IiJ9XSwiUmVzdWx0cyI6W119LHsiRnVuY05hbWUiOiJSZW5kZXIiLCJQYXJhbXMiOlt7Ik5hbWUiOiJwYXRoIiwiVHlwZSI6InN0cmluZyIsIlZhbHVlIjoiIn1dLCJSZXN1bHRzIjpbXX0seyJGdW5jTmFtZSI6IlRyYW5zZmVyIiwiUGFyYW1zIjpbeyJOYW1lIjoidG8iLCJUeXBlIjoiW11ieXRlIiwiVmFsdWUiOiIifV0sIlJlc3VsdHMiOltdfV0=","Log":""}}}}`)
+	}))
+	defer server.Close()
+
+	args := testArgs()
+	args.Remote = server.URL
+	args.FunctionName = "Post"
+	args.FuzzArgSize = 100
+	var r Run
+	for range 50 {
+		got, err := r.withFuzzedArgs("board", args)
+		if err != nil {
+			t.Fatalf("Failed to fuzz arguments: %v", err)
+		}
+		if got.FunctionName != "Post" || len(got.CallArgs) != 3 || len(got.CallArgs[0]) > 100+3 {
+			t.Fatalf("Unexpected call %s%q", got.FunctionName, got.CallArgs)
+		}
+		if n, err := strconv.ParseInt(got.CallArgs[1], 10, 8); err != nil || n < -128 || n > 127 {
+			t.Errorf("Expected an int8, got %q", got.CallArgs[1])
+		}
+		if _, err := strconv.ParseBool(got.CallArgs[2]); err != nil {
+			t.Errorf("Expected a bool, got %q", got.CallArgs[2])
+		}
+	}
+	if queries != 1 {
+		t.Errorf("Expected the functions to be queried once, got %d queries", queries)
+	}
+
+	args.FunctionName = ""
+	for range 20 {
+		if got, _ := r.withFuzzedArgs("other", args); got.FunctionName == "Transfer" {
+			t.Errorf("Expected functions taking []byte to be skipped")
+		}
+	}
+	args.FunctionName = "Transfer"
+	if _, err := r.withFuzzedArgs("third", args); err == nil {
+		t.Errorf("Expected an error for a function that can't be fuzzed")
+	}
+
+	if code := classifyError("", errors.New("panic: index out of range"), nil); code != ErrRealmPanic {
+		t.Errorf("Expected a realm panic, got %s", code)
+	}
+	logs := []ExecutionLog{{Mode: "call", ArgSize: 0}, {Mode: "call", ArgSize: 3}, {Mode: "call", ArgSize: 900}, {Mode: "qrender"}}
+	if buckets := SummarizeArgSizes(logs); len(buckets) != 3 || buckets[2].Size != 512 {
+		t.Errorf("Unexpected argument size buckets %+v", buckets)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	s, err := parseScript(strings.NewReader(`
+# deploy, call and read back
+let name load$iteration
+addpkg $name
+expect OK!
+pick fn Inc Dec
+call $package $fn 1
+chance 0.5 qrender $package
+expectRegex data: \d+
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse script: %v", err)
+	}
+	if s.Requests() != 3 {
+		t.Errorf("Expected 3 requests, got %d", s.Requests())
+	}
+	if qrender := s.statements[4]; qrender.op != "qrender" || qrender.chance != 0.5 || len(qrender.rules) != 1 {
+		t.Errorf("Expected a conditional qrender with one rule, got %+v", qrender)
+	}
+	if st := s.statements[0]; st.text != "load$iteration" {
+		t.Errorf("Expected let value load$iteration, got %q", st.text)
+	}
+
+	for _, bad := range []string{"expect OK!\ncall a b", "let x 1", "frobnicate", "qrender", "chance 2 balanceQuery", "balanceQuery\nexpectRegex ("} {
+		if _, err := parseScript(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "journey.txt")
+	err := os.WriteFile(script, []byte("addpkg board$iteration\ncall $package Post hello\nlet msg hello\nqrender $package\nexpect $msg\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := testArgs()
+	args.Mode = "script"
+	args.Script = script
+	var mu sync.Mutex
+	var sent []string
+	logs := runFake(t, args, 3, func(mode, packageName string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, mode+" "+packageName)
+		if mode == "qrender" {
+			return "data: nothing", nil
+		}
+		return "OK!", nil
+	})
+	if len(sent) < 3 || sent[0] != "addpkg board1" || sent[1] != "call gno.land/r/board1" || sent[2] != "qrender gno.land/r/board1" {
+		t.Errorf("Unexpected requests: %v", sent)
+	}
+	if !logs[0].Valid || !logs[1].Valid || logs[2].Valid || logs[2].ErrorCode != ErrValidation {
+		t.Errorf("Expected only the qrender to fail validation, got %+v", logs[:3])
+	}
+
+	args.CallArgs = []string{"1", "it's"}
+	if cmd := GenerateCommand("call", "foo", args); !strings.Contains(cmd, `--args '1' --args 'it'\''s' `) {
+		t.Errorf("Expected quoted call arguments, got %s", cmd)
+	}
+}
+
+func TestJourney(t *testing.T) {
+	args := testArgs()
+	args.Mode = "journey"
+	args.Steps = []string{"addpkg", "call", "qrender"}
+	args.FunctionName = "Post"
+	logs := runFake(t, args, 6, func(mode, packageName string) (string, error) {
+		if mode == "call" {
+			time.Sleep(2 * time.Millisecond)
+		}
+		return "OK!", nil
+	})
+	for i, want := range []string{"1:addpkg", "2:call", "3:qrender", "1:addpkg"} {
+		if logs[i].Step != want {
+			t.Errorf("Expected request %d to be step %s, got %q", i, want, logs[i].Step)
+		}
+	}
+
+	steps, byStep := SummarizeSteps(logs)
+	if len(steps) != 3 || steps[1] != "2:call" {
+		t.Fatalf("Expected 3 steps in order, got %v", steps)
+	}
+	if byStep["2:call"].P50 < 2*time.Millisecond || byStep["3:qrender"].P50 >= 2*time.Millisecond {
+		t.Errorf("Expected only the call step to be slow, got %+v", byStep)
+	}
+	modes, byMode := SummarizeModes(logs)
+	if !slices.Equal(modes, []string{"addpkg", "call", "qrender"}) || byMode["call"].P50 < 2*time.Millisecond || byMode["qrender"].P50 >= 2*time.Millisecond {
+		t.Errorf("Expected calls and renders to be summarized apart, got %v %+v", modes, byMode)
+	}
+
+	if _, err := journeyScript(Config{Steps: []string{"addpkg", "deploy"}}); err == nil {
+		t.Error("Expected an error for an unknown step")
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	schedule := filepath.Join(t.TempDir(), "schedule.jsonl")
+	args := testArgs()
+	args.Mode = "script"
+	args.Script = filepath.Join(t.TempDir(), "script.txt")
+	args.Record = schedule
+	if err := os.WriteFile(args.Script, []byte("call foo Add $iteration\nqrender foo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recorded := runFake(t, args, 4, func(mode, packageName string) (string, error) { return "OK!", nil })
+
+	requests, err := LoadSchedule(schedule)
+	if err != nil {
+		t.Fatalf("Failed to load schedule: %v", err)
+	}
+	if len(requests) != len(recorded) {
+		t.Fatalf("Expected %d scheduled requests, got %d", len(recorded), len(requests))
+	}
+	want := ScheduledRequest{Offset: requests[0].Offset, Mode: "call", Package: "gno.land/r/foo", Function: "Add", Args: []string{"1"}}
+	if !reflect.DeepEqual(requests[0], want) || requests[1].Mode != "qrender" || requests[2].Args[0] != "2" {
+		t.Errorf("Unexpected schedule: %+v", requests)
+	}
+	for i := 1; i < len(requests); i++ {
+		if requests[i].Offset < requests[i-1].Offset {
+			t.Errorf("Expected offsets in order, got %v after %v", requests[i].Offset, requests[i-1].Offset)
+		}
+	}
+
+	args = testArgs()
+	args.Mode = "replay"
+	args.Schedule = schedule
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) { return "OK!", nil }}
+	})
+	args.Backend = "fake"
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up replay: %v", err)
+	}
+	start := time.Now()
+	r.Start()
+	if logs := r.Logs(); len(logs) != len(requests) {
+		t.Errorf("Expected %d replayed requests, got %d", len(requests), len(logs))
+	}
+	if elapsed := time.Since(start); elapsed < requests[len(requests)-1].Offset {
+		t.Errorf("Replay took %v, less than the recorded %v", elapsed, requests[len(requests)-1].Offset)
+	}
+}
+
+func TestMaxInflight(t *testing.T) {
+	schedule := filepath.Join(t.TempDir(), "schedule.jsonl")
+	if err := os.WriteFile(schedule, []byte(strings.Repeat(`{"Offset":0,"Mode":"qrender","Package":"gno.land/r/foo"}`+"\n", 6)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var inflight, peak atomic.Int32
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) {
+			n := inflight.Add(1)
+			defer inflight.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(20 * time.Millisecond)
+			return "OK!", nil
+		}}
+	})
+	args := testArgs()
+	args.Backend = "fake"
+	args.Mode = "replay"
+	args.Schedule = schedule
+	args.MaxInflight = 2
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up replay: %v", err)
+	}
+	r.Start()
+	r.Close()
+	if n := len(r.Logs()); n != 6 {
+		t.Errorf("Expected 6 replayed requests, got %d", n)
+	}
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", p)
+	}
+	if w := r.InflightWaits(); w < 1 || w > 4 {
+		t.Errorf("Expected up to 4 requests to wait, got %d", w)
+	}
+}
+
+func TestProcPool(t *testing.T) {
+	pool := newProcPool(1)
+	waits := make(chan time.Duration, 3)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			waits <- pool.acquire()
+			time.Sleep(50 * time.Millisecond)
+			pool.release()
+		}()
+	}
+	wg.Wait()
+	close(waits)
+	var waited int
+	for wait := range waits {
+		if wait > 0 {
+			waited++
+		}
+	}
+	stats := pool.stats
+	if stats.Started != 3 || stats.Queued != 2 || waited != 2 || stats.MaxQueue != 2 || stats.MaxWait < 50*time.Millisecond {
+		t.Errorf("Unexpected stats %+v with %d requests waiting", stats, waited)
+	}
+
+	var b strings.Builder
+	WriteProcPool(&b, stats)
+	if !strings.Contains(b.String(), "2 of 3 requests queued for one of 1 processes, up to 2 at once") || !strings.Contains(b.String(), "WARNING") {
+		t.Errorf("Unexpected output:\n%s", b.String())
+	}
+
+	// Replayed requests record how long they queued, apart from their response time
+	schedule := filepath.Join(t.TempDir(), "schedule.jsonl")
+	if err := os.WriteFile(schedule, []byte(strings.Repeat(`{"Offset":0,"Mode":"qrender","Package":"gno.land/r/foo"}`+"\n", 3)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "OK!", nil
+		}}
+	})
+	args := testArgs()
+	args.Backend = "fake"
+	args.Mode = "replay"
+	args.Schedule = schedule
+	args.MaxProcs = 1
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up replay: %v", err)
+	}
+	r.Start()
+	r.Close()
+	waited = 0
+	for _, log := range r.Logs() {
+		if log.QueueWait > 0 {
+			waited++
+		}
+		if log.ResponseTime > 40*time.Millisecond {
+			t.Errorf("Expected the queue wait to be left out of the response time, got %v", log.ResponseTime)
+		}
+	}
+	if waited != 2 {
+		t.Errorf("Expected 2 of 3 requests to record a queue wait, got %d", waited)
+	}
+}
+
+func TestKeybase(t *testing.T) {
+	args := testArgs()
+	args.Keybase = "serialize"
+	k, err := newKeybase(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signing, peak atomic.Int32
+	e := keybaseExecutor{keybase: k, Executor: fakeExecutor{respond: func(mode, packageName string) (string, error) {
+		if mode != "call" {
+			return "OK!", nil
+		}
+		n := signing.Add(1)
+		defer signing.Add(-1)
+		peak.Store(max(peak.Load(), n))
+		time.Sleep(10 * time.Millisecond)
+		return "", &commandError{err: errors.New("exit status 1"), stderr: "keys.db/LOCK: resource temporarily unavailable"}
+	}}}
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.Execute("call", "foo", args)
+		}()
+		go func() {
+			defer wg.Done()
+			e.Execute("qrender", "foo", args)
+		}()
+	}
+	wg.Wait()
+	stats := KeybaseStats{Locked: k.locked.Load(), Waited: k.waited.Load(), Wait: time.Duration(k.wait.Load())}
+	if peak.Load() != 1 || stats.Locked != 3 || stats.Waited == 0 || stats.Wait <= 0 {
+		t.Errorf("Unexpected stats %+v with up to %d transactions signing at once", stats, peak.Load())
+	}
+	var b strings.Builder
+	WriteKeybase(&b, stats, "shared")
+	if !strings.Contains(b.String(), "3 transactions failed on a locked keybase") || !strings.Contains(b.String(), "-keybase copy") {
+		t.Errorf("Unexpected output:\n%s", b.String())
+	}
+
+	args.Keybase = "copy"
+	args.Home = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(args.Home, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(args.Home, "data", "key"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	args.MaxThreads = 2
+	if k, err = newKeybase(args); err != nil {
+		t.Fatal(err)
+	}
+	first, second := <-k.homes, <-k.homes
+	if first == second || first == args.Home {
+		t.Errorf("Expected a copy of the home per thread, got %s and %s", first, second)
+	}
+	if b, err := os.ReadFile(filepath.Join(second, "data", "key")); err != nil || string(b) != "secret" {
+		t.Errorf("Expected the keybase to be copied, got %q, %v", b, err)
+	}
+	if !strings.Contains(GenerateCommand("call", "foo", Config{Home: first, ChainID: "dev", KeyName: "Dev"}), "--home '"+first+"' ") {
+		t.Error("Expected --home in the command")
+	}
+	k.close()
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("Expected the copies to be removed, got %v", err)
+	}
+}
+
+func TestCompareRemote(t *testing.T) {
+	var mu sync.Mutex
+	sent := map[string][]string{}
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{
+			respond: func(mode, packageName string) (string, error) { return "OK!", nil },
+			sent: func(mode, packageName string, args Config) {
+				mu.Lock()
+				defer mu.Unlock()
+				sent[args.Remote] = append(sent[args.Remote], mode+" "+pkgPath(args, packageName)+" "+strings.Join(args.CallArgs, ","))
+			},
+		}
+	})
+	args := testArgs()
+	args.Backend = "fake"
+	args.Mode = "journey"
+	args.Steps = []string{"addpkg", "call"}
+	args.Remote = "a:26657"
+	args.CompareRemote = "b:26657"
+	args.MaxQPS = 1000
+	args.Arrival = "poisson"
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	go func() {
+		for len(r.Logs()) < 8 {
+			time.Sleep(time.Millisecond)
+		}
+		r.Stop()
+	}()
+	r.Start()
+
+	logs := r.Logs()
+	a, b := FilterTarget(logs, "a:26657"), FilterTarget(logs, "b:26657")
+	if len(a) == 0 || len(a) != len(b) || len(a)+len(b) != len(logs) {
+		t.Errorf("Expected every sample on both targets, got %d and %d of %d", len(a), len(b), len(logs))
+	}
+	// Only requests to the same package keep their order on the mirror
+	mirrored := slices.Clone(sent["b:26657"])
+	for i, req := range mirrored {
+		if strings.HasPrefix(req, "call ") && !slices.Contains(mirrored[:i], "addpkg "+strings.Fields(req)[1]+" ") {
+			t.Errorf("Mirrored %q before its addpkg", req)
+		}
+	}
+	slices.Sort(mirrored)
+	primary := slices.Clone(sent["a:26657"])
+	slices.Sort(primary)
+	if !reflect.DeepEqual(primary, mirrored) {
+		t.Errorf("Expected identical requests on both targets:\n%v\n%v", primary, mirrored)
+	}
+}
+
+func TestCompareRemoteMaxInflight(t *testing.T) {
+	// Mirrored requests to the same package wait for one another, so use one each
+	var lines strings.Builder
+	for i := range 6 {
+		fmt.Fprintf(&lines, `{"Offset":0,"Mode":"qrender","Package":"gno.land/r/foo%d"}`+"\n", i)
+	}
+	schedule := filepath.Join(t.TempDir(), "schedule.jsonl")
+	if err := os.WriteFile(schedule, []byte(lines.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var inflight, peak atomic.Int32
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{
+			respond: func(mode, packageName string) (string, error) { return "OK!", nil },
+			sent: func(mode, packageName string, args Config) {
+				if args.Remote != "b:26657" {
+					return
+				}
+				n := inflight.Add(1)
+				defer inflight.Add(-1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				time.Sleep(30 * time.Millisecond) // the mirror stalls
+			},
+		}
+	})
+	args := testArgs()
+	args.Backend = "fake"
+	args.Mode = "replay"
+	args.Schedule = schedule
+	args.Remote = "a:26657"
+	args.CompareRemote = "b:26657"
+	args.MaxInflight = 2
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up replay: %v", err)
+	}
+	r.Start()
+	r.Close()
+	logs := r.Logs()
+	if a, b := FilterTarget(logs, "a:26657"), FilterTarget(logs, "b:26657"); len(a) != 6 || len(b) != 6 {
+		t.Errorf("Expected 6 requests on each target, got %d and %d", len(a), len(b))
+	}
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Expected at most 2 mirrored requests in flight, got %d", p)
+	}
+	for _, log := range FilterTarget(logs, "a:26657") {
+		if log.ResponseTime > 20*time.Millisecond {
+			t.Errorf("Expected the wait for the mirror to be left out of the response time, got %v", log.ResponseTime)
+		}
+	}
+	if w := r.InflightWaits(); w < 1 {
+		t.Errorf("Expected requests to wait for the mirror, got %d", w)
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	logs := []ExecutionLog{
+		{Start: start, Timestamp: start.Add(time.Second), ResponseTime: time.Second, Success: true, Valid: true},
+		{Start: start.Add(500 * time.Millisecond), Timestamp: start.Add(3500 * time.Millisecond), ResponseTime: 3 * time.Second, Success: false},
+		{Start: start.Add(2500 * time.Millisecond), Timestamp: start.Add(4500 * time.Millisecond), ResponseTime: 2 * time.Second, Success: true, Valid: true},
+	}
+	buckets := TimeSeries(logs, time.Second)
+	if len(buckets) != 3 {
+		t.Fatalf("Expected 3 buckets, got %+v", buckets)
+	}
+	if b := buckets[0]; b.Requests != 2 || b.Errors != 1 || b.P50 != time.Second || b.P99 != 3*time.Second {
+		t.Errorf("Unexpected first bucket: %+v", b)
+	}
+	if buckets[1].Requests != 0 || buckets[2].Requests != 1 || !buckets[2].Start.Equal(start.Add(2*time.Second)) {
+		t.Errorf("Unexpected later buckets: %+v", buckets[1:])
+	}
+
+	// Results of older versions without a start time are bucketed by their estimated one
+	old := []ExecutionLog{{Timestamp: start.Add(3 * time.Second), ResponseTime: 3 * time.Second}, {Timestamp: start.Add(time.Second)}}
+	if b := TimeSeries(old, time.Second); len(b) != 2 || b[0].Requests != 1 || !b[0].Start.Equal(start) {
+		t.Errorf("Expected both requests bucketed by start time, got %+v", b)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTimeSeries(&buf, logs, 2*time.Second); err != nil {
+		t.Fatalf("Failed to write time series: %v", err)
+	}
+	want := "Time,Requests,QPS,Errors,P50,P95,P99,TargetQPS\n" +
+		"2025-01-02T03:04:05Z,2,1.000000,1,1.000000000,3.000000000,3.000000000,0.000000\n" +
+		"2025-01-02T03:04:07Z,1,0.500000,0,2.000000000,2.000000000,2.000000000,0.000000\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected time series:\n%s", buf.String())
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	for _, p := range []float64{50, 95, 99, 100} {
+		want := time.Duration(p*10) * time.Millisecond
+		if got := h.percentile(p); got < want || float64(got-want) > float64(want)/32 {
+			t.Errorf("Expected p%v within 1/32 above %v, got %v", p, want, got)
+		}
+	}
+	if h.percentile(100) != time.Second {
+		t.Errorf("Expected p100 to be the exact maximum, got %v", h.percentile(100))
+	}
+}
+
+func TestSampling(t *testing.T) {
+	args := testArgs()
+	args.PackageName = "foo"
+	args.Reservoir = 5
+	args.SampleRate = 0.5
+	results := filepath.Join(t.TempDir(), "results.csv")
+	w, _, err := OpenResults(results, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Rewrite()
+
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) { return "OK!", nil }}
+	})
+	args.Backend = "fake"
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		r.record(ExecutionLog{Timestamp: time.Now(), ResponseTime: time.Duration(i) * time.Millisecond, Success: true, Valid: i%10 != 0})
+		if i%50 == 0 {
+			if err := w.Flush(r.Logs()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Flush(r.Logs()); err != nil {
+		t.Fatal(err)
+	}
+
+	if logs := r.Logs(); len(logs) != args.Reservoir {
+		t.Errorf("Expected the reservoir to hold %d samples, got %d", args.Reservoir, len(logs))
+	}
+	if stats := r.Summary(); stats.Requests != 200 || stats.Invalid != 20 || stats.Max != 199*time.Millisecond {
+		t.Errorf("Expected exact totals for every request, got %+v", stats)
+	}
+	written, err := LoadResults(results)
+	if err != nil || len(written) != args.Reservoir {
+		t.Errorf("Expected the results file to be rewritten with %d samples, got %d (%v)", args.Reservoir, len(written), err)
+	}
+}
+
+func TestSlowest(t *testing.T) {
+	args := testArgs()
+	args.Slowest = 3
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []int{5, 1, 9, 3, 7, 2} {
+		out := fmt.Sprintf("OK!\nHEIGHT:     %d\nTX HASH:    abc=\n", ms)
+		r.recordRequest(ExecutionLog{Timestamp: time.Now(), ResponseTime: time.Duration(ms) * time.Millisecond, Success: true, Valid: true},
+			"call", out, captureSection(fmt.Sprintf("request %d", ms), out, nil))
+	}
+	r.recordRequest(ExecutionLog{ResponseTime: time.Second, Warmup: true}, "call", "")
+
+	slowest := r.Slowest()
+	if len(slowest) != 3 {
+		t.Fatalf("Expected the 3 slowest requests, got %+v", slowest)
+	}
+	for i, ms := range []int64{9, 7, 5} {
+		if slowest[i].ResponseTime != time.Duration(ms)*time.Millisecond || slowest[i].Height != ms ||
+			!strings.Contains(slowest[i].Output, fmt.Sprintf("$ request %d", ms)) {
+			t.Errorf("Expected request %d to be the one taking %dms, got %+v", i, ms, slowest[i])
+		}
+	}
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	d := anomalyDetector{spikeThreshold: 10, errorBurst: 0.5}
+	ok := func(ms int) ExecutionLog {
+		return ExecutionLog{ResponseTime: time.Duration(ms) * time.Millisecond, Success: true, Valid: true}
+	}
+	for i := 0; i < anomalyMinRequests; i++ {
+		if anomalies := d.observe(ok(100 + i%5)); len(anomalies) > 0 {
+			t.Fatalf("Expected no anomalies while steady, got %v", anomalies)
+		}
+	}
+	if anomalies := d.observe(ok(130)); len(anomalies) > 0 {
+		t.Errorf("Expected jitter not to be a spike, got %v", anomalies)
+	}
+	if anomalies := d.observe(ok(2000)); len(anomalies) != 1 || !strings.Contains(anomalies[0], "latency spike: 2s") {
+		t.Errorf("Expected a latency spike, got %v", anomalies)
+	}
+
+	var bursts int
+	for i := 0; i < AnomalyWindow; i++ {
+		for _, anomaly := range d.observe(ExecutionLog{ErrorCode: ErrTimeout}) {
+			if strings.HasPrefix(anomaly, "error burst") {
+				bursts++
+			}
+		}
+	}
+	if bursts != 1 {
+		t.Errorf("Expected a single error burst warning, got %d", bursts)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	m := alertMonitor{maxErrorRate: 0.5, maxP95: time.Second}
+	var events []string
+	observe := func(log ExecutionLog, n int) {
+		for i := 0; i < n; i++ {
+			e, _ := m.observe(log)
+			events = append(events, e...)
+		}
+	}
+	observe(ExecutionLog{ResponseTime: 100 * time.Millisecond, Success: true, Valid: true}, AlertWindow)
+	observe(ExecutionLog{ResponseTime: 2 * time.Second, ErrorCode: ErrTimeout}, AlertWindow)
+	observe(ExecutionLog{ResponseTime: 100 * time.Millisecond, Success: true, Valid: true}, AlertWindow)
+	// Each threshold alerts once when crossed and once when it recovers
+	if want := []string{"threshold", "threshold", "recovered", "recovered"}; !slices.Equal(events, want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+
+	var received []Alert
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+		mu.Lock()
+		received = append(received, alert)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	args := testArgs()
+	args.Mode = "balanceQuery"
+	args.Webhooks = []string{server.URL}
+	args.AlertErrorRate = 0.5
+	// Close, at the end of runFake, waits for the alert to be posted
+	runFake(t, args, alertMinRequests+5, func(mode, packageName string) (string, error) {
+		return "", errors.New("connection refused")
+	})
+	mu.Lock()
+	if len(received) != 1 || received[0].Event != "threshold" || !strings.Contains(received[0].Text, "error rate 100%") {
+		t.Errorf("Expected one error rate alert, got %+v", received)
+	}
+	mu.Unlock()
+	if errs := SendAlert([]string{server.URL, "http://127.0.0.1:1"}, Alert{Text: "test"}); len(errs) != 1 {
+		t.Errorf("Expected the unreachable webhook to fail, got %v", errs)
+	}
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	args := testArgs()
+	args.Mode = "addpkg+call"
+	args.StatsdAddr = conn.LocalAddr().String()
+	args.StatsdPrefix = "test.profiler"
+	calls := 0
+	runFake(t, args, 2, func(mode, packageName string) (string, error) {
+		if calls++; calls == 1 {
+			return "", errors.New("connection refused")
+		}
+		return "OK!", nil
+	})
+
+	var metrics []string
+	buf := make([]byte, 1500)
+	for len(metrics) < 7 {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected statsd packets, got %q: %v", metrics, err)
+		}
+		metrics = append(metrics, strings.Split(string(buf[:n]), "\n")...)
+	}
+	for _, want := range []string{"test.profiler.addpkg.requests:1|c", "test.profiler.addpkg.errors.connection_refused:1|c", "test.profiler.activeWorkers:1|g"} {
+		if !slices.Contains(metrics, want) {
+			t.Errorf("Expected %s among %q", want, metrics)
+		}
+	}
+	if !strings.HasPrefix(metrics[0], "test.profiler.addpkg.responseTime:") || !strings.HasSuffix(metrics[0], "|ms") {
+		t.Errorf("Expected a timing first, got %q", metrics[0])
+	}
+	if name := statsdName("my.query"); name != "my_query" {
+		t.Errorf("Expected a safe metric name, got %q", name)
+	}
+}
+
+func TestPushSummary(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(data)
+	}))
+	defer server.Close()
+
+	stats := Summarize([]ExecutionLog{
+		{ResponseTime: 100 * time.Millisecond, Success: true, Valid: true},
+		{ResponseTime: 300 * time.Millisecond, ErrorCode: ErrTimeout},
+	})
+	args := testArgs()
+	labels := PushLabels(args, []string{"mode=nightly", "pkg=gno.land/r/demo/boards"})
+	if err := PushSummary(server.URL+"/", "ci", labels, stats, 2*time.Second); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if want := "/metrics/job/ci/remote/localhost:26657/mode/nightly/pkg@base64/Z25vLmxhbmQvci9kZW1vL2JvYXJkcw"; method != http.MethodPut || path != want {
+		t.Errorf("Expected PUT %s, got %s %s", want, method, path)
+	}
+	for _, want := range []string{"realm_profiler_requests 2\n", "realm_profiler_errors{code=\"timeout\"} 1\n", "realm_profiler_latency_seconds{quantile=\"0.5\"} 0.1\n", "realm_profiler_throughput 1\n", "# TYPE realm_profiler_error_rate gauge\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestGrafanaDashboard(t *testing.T) {
+	for datasource, want := range map[string]string{
+		"prometheus": `realm_profiler_latency_seconds{job="ci"}`,
+		"graphite":   "aliasByNode(stats.timers.test.profiler.*.responseTime.{median,upper_90}, 4, 6)",
+	} {
+		var buf bytes.Buffer
+		if err := WriteGrafanaDashboard(&buf, datasource, "ci", "test.profiler"); err != nil {
+			t.Fatalf("Failed to write the %s dashboard: %v", datasource, err)
+		}
+		var dashboard struct {
+			Panels []struct {
+				Datasource struct{ Type string }
+				Targets    []struct{ Expr, Target string }
+			}
+		}
+		if err := json.Unmarshal(buf.Bytes(), &dashboard); err != nil {
+			t.Fatalf("Invalid %s dashboard: %v", datasource, err)
+		}
+		if len(dashboard.Panels) < 4 || dashboard.Panels[0].Datasource.Type != datasource {
+			t.Fatalf("Unexpected %s dashboard:\n%s", datasource, buf.String())
+		}
+		if target := dashboard.Panels[0].Targets[0]; target.Expr+target.Target != want {
+			t.Errorf("Expected the first %s query to be %s, got %+v", datasource, want, target)
+		}
+	}
+	if err := WriteGrafanaDashboard(io.Discard, "influx", "", ""); err == nil {
+		t.Errorf("Expected an unknown datasource to be rejected")
+	}
+}
+
+func TestAnonymizer(t *testing.T) {
+	a := NewAnonymizer("salt")
+	args := testArgs()
+	args.KeyName = "loadtest"
+	args.PackageName = "gno.land/r/acme/secret"
+	args.Webhooks = []string{"https://hooks.slack.com/services/T0/B0/x"}
+	a.Config(&args)
+	if args.KeyName == "loadtest" || args.Remote == "localhost:26657" || len(args.Webhooks) > 0 {
+		t.Errorf("Expected the key, remote and webhooks to be replaced: %+v", args)
+	}
+	if !strings.HasPrefix(args.PackageName, "gno.land/r/anon/p") {
+		t.Errorf("Expected a realm path pseudonym, got %s", args.PackageName)
+	}
+
+	output := "gnokey maketx call -pkgpath gno.land/r/acme/secret -func Render -remote localhost:26657 loadtest\n" +
+		"loadtester sent from " + BalanceAddress
+	text := a.Text(output)
+	for _, secret := range []string{"acme", "localhost", BalanceAddress, "loadtest "} {
+		if strings.Contains(text, secret) {
+			t.Errorf("Expected %q to be replaced:\n%s", secret, text)
+		}
+	}
+	if !strings.Contains(text, args.PackageName) || !strings.Contains(text, args.Remote) || !strings.Contains(text, "loadtester") {
+		t.Errorf("Expected the same pseudonyms as the settings, and longer words left alone:\n%s", text)
+	}
+	if again := NewAnonymizer("salt"); again.Address(BalanceAddress) != a.Address(BalanceAddress) {
+		t.Errorf("Expected the same salt to give the same pseudonyms")
+	}
+	if NewAnonymizer("").Address(BalanceAddress) == NewAnonymizer("").Address(BalanceAddress) {
+		t.Errorf("Expected random salts to give different pseudonyms")
+	}
+
+	logs := []ExecutionLog{{Target: "node:26657", TxHash: "aGFzaA== aGFzaDI=", Fingerprint: "0123456789abcdef"}}
+	a.Logs(logs)
+	if logs[0].Target == "node:26657" || len(strings.Fields(logs[0].TxHash)) != 2 || logs[0].Fingerprint == "0123456789abcdef" {
+		t.Errorf("Expected the target, hashes and fingerprint to be replaced: %+v", logs[0])
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	args := testArgs()
+	args.Mode = "qrender"
+	logs := runFake(t, args, 4, func(mode, packageName string) (string, error) {
+		return strings.Repeat("x", 1000), nil
+	})
+	for _, log := range logs {
+		if log.ResponseSize != 1000 {
+			t.Errorf("Expected the response size to be recorded, got %+v", log)
+		}
+	}
+
+	start := time.Now()
+	logs = []ExecutionLog{
+		{Mode: "qrender", ResponseSize: 100, Start: start, Timestamp: start.Add(time.Second)},
+		{Mode: "qrender", ResponseSize: 3000, Start: start.Add(time.Second), Timestamp: start.Add(2 * time.Second)},
+		{Mode: "qrender", ResponseSize: 5000, Warmup: true, Start: start, Timestamp: start.Add(time.Second)},
+		{Mode: "call", Start: start, Timestamp: start.Add(4 * time.Second)},
+		{Mode: "qdoc"},
+	}
+	bandwidth := SummarizeBandwidth(logs)
+	if len(bandwidth) != 1 {
+		t.Fatalf("Expected only qrender to have read anything, got %+v", bandwidth)
+	}
+	if b := bandwidth[0]; b.Requests != 2 || b.Bytes != 3100 || b.MaxBytes != 3000 || b.Mean() != 1550 || b.Rate != 775 {
+		t.Errorf("Unexpected bandwidth %+v", b)
+	}
+	var out bytes.Buffer
+	WriteSummary(&out, logs)
+	if !strings.Contains(out.String(), "Response bandwidth:") || !strings.Contains(out.String(), "Latency by response size:") {
+		t.Errorf("Expected bandwidth in the summary:\n%s", out.String())
+	}
+}
+
+func TestCacheProbe(t *testing.T) {
+	args := testArgs()
+	args.Mode = "qrender"
+	args.PackageName = "gno.land/r/demo/boards"
+	args.RenderPath = "page/2"
+	if cmd := GenerateCommand("qrender", args.PackageName, args); !strings.Contains(cmd, "'gno.land/r/demo/boards:page/2'") {
+		t.Errorf("Expected the render path in %q", cmd)
+	}
+	if busted := cacheBust("page/2?sort=new"); !strings.HasPrefix(busted, "page/2?sort=new&nocache=") {
+		t.Errorf("Expected a parameter added to the query, got %q", busted)
+	}
+
+	args.CacheProbe = true
+	kinds := map[string]int{}
+	for _, log := range runFake(t, args, 40, func(mode, packageName string) (string, error) { return "ok", nil }) {
+		kinds[log.Cache]++
+	}
+	if kinds[CacheRepeat] == 0 || kinds[CacheBust] == 0 || len(kinds) != 2 {
+		t.Errorf("Expected repeated and cache-busting requests, got %v", kinds)
+	}
+
+	var logs []ExecutionLog
+	for i := 0; i < 10; i++ {
+		logs = append(logs,
+			ExecutionLog{Mode: "qrender", Success: true, Valid: true, Cache: CacheRepeat, ResponseTime: 10 * time.Millisecond},
+			ExecutionLog{Mode: "qrender", Success: true, Valid: true, Cache: CacheBust, ResponseTime: 40 * time.Millisecond})
+	}
+	c, ok := SummarizeCaching(logs)
+	if !ok || c.Repeat.Requests != 10 || c.Bust.Requests != 10 || c.Speedup() != 0.75 {
+		t.Errorf("Unexpected cache effect %+v", c)
+	}
+	var out bytes.Buffer
+	WriteSummary(&out, logs)
+	if !strings.Contains(out.String(), "75% faster at the median: the node likely caches reads") {
+		t.Errorf("Expected caching to be detected:\n%s", out.String())
+	}
+}
+
+func TestStateGrowth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "status":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"realm-profiler","result":{"sync_info":{"latest_block_height":"120","latest_app_hash":"AB12"}}}`)
+		case "block":
+			if req.Params["height"] != "120" {
+				t.Errorf("Expected the latest block to be asked for, got %v", req.Params)
+			}
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"realm-profiler","result":{"block_meta":{"header":{"height":"120","total_txs":"4567"}}}}`)
+		}
+	}))
+	defer server.Close()
+	s, err := nodeState(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Height != 120 || s.TotalTxs != 4567 || s.AppHash != "AB12" {
+		t.Errorf("Unexpected state %+v", s)
+	}
+
+	start := time.Now()
+	samples := []StateSample{
+		{Time: start, Height: 100, TotalTxs: 1000},
+		{Time: start.Add(time.Minute), Height: 110, TotalTxs: 2000},
+		{Time: start.Add(2 * time.Minute), Height: 120, TotalTxs: 3000},
+	}
+	var logs []ExecutionLog
+	for i := 0; i < 4; i++ {
+		logs = append(logs,
+			ExecutionLog{Mode: "call", Success: true, Valid: true, Start: start.Add(time.Duration(i) * time.Second), ResponseTime: time.Second},
+			ExecutionLog{Mode: "call", Success: true, Valid: true, Start: start.Add(time.Minute + time.Duration(i)*time.Second), ResponseTime: 2 * time.Second},
+			ExecutionLog{Mode: "qrender", Success: true, Valid: true, Start: start.Add(time.Minute), ResponseTime: time.Millisecond})
+	}
+	intervals := SummarizeStateGrowth(logs, samples)
+	if len(intervals) != 2 || intervals[0].Requests != 4 || intervals[1].Requests != 4 || intervals[1].From.TotalTxs != 2000 {
+		t.Fatalf("Unexpected intervals %+v", intervals)
+	}
+	if slowdown := StateGrowthSlowdown(intervals); slowdown != 1 {
+		t.Errorf("Expected transactions to be twice as slow, got %v", slowdown)
+	}
+	var out bytes.Buffer
+	WriteStateGrowth(&out, intervals)
+	if !strings.Contains(out.String(), "grew by 20 blocks and 2000 transactions") || !strings.Contains(out.String(), "100% slower") {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+}
+
+func TestNameRegistry(t *testing.T) {
+	args := testArgs()
+	path := filepath.Join(t.TempDir(), "names.txt")
+	names, err := newNameRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SeedRandom(7)
+	first, err := names.newName(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names.close()
+
+	// A restart with the same seed draws the same name first
+	names, err = newNameRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer names.close()
+	SeedRandom(7)
+	second, err := names.newName(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || names.collisions() != 1 {
+		t.Errorf("Expected %s to be drawn again after a collision, got %s with %d collisions", first, second, names.collisions())
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Fields(string(data)); len(lines) != 2 || lines[0] != pkgPath(args, first) || lines[1] != pkgPath(args, second) {
+		t.Errorf("Unexpected names file:\n%s", data)
+	}
+
+	args.NameLength = 1
+	small, _ := newNameRegistry("")
+	for c := 'a'; c <= 'z'; c++ {
+		small.used[pkgPath(args, args.PkgPrefix+string(c))] = true
+	}
+	if _, err := small.newName(args); err == nil {
+		t.Errorf("Expected an error once every name is used")
+	}
+
+	// Scripts draw their names from the registry too
+	registry, _ := newNameRegistry("")
+	v := newScriptVars(testArgs(), 1, registry)
+	st, err := parseStatement("addpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, name, _ := scriptRequest(st, v)
+	random := v.expand("$random")
+	if !registry.used[pkgPath(testArgs(), name)] || !registry.used[pkgPath(testArgs(), random)] || v.err != nil {
+		t.Errorf("Expected %s and %s to be registered", name, random)
+	}
+}
+
+func TestWorkerPrefix(t *testing.T) {
+	args := testArgs()
+	args.Mode = "addpkg"
+	args.MaxThreads, args.StartThreads = 3, 3
+	args.PkgPrefix = "load_"
+	args.WorkerPrefix = true
+	var mu sync.Mutex
+	names := map[string]bool{}
+	logs := runFake(t, args, 12, func(mode, packageName string) (string, error) {
+		mu.Lock()
+		names[packageName] = true
+		mu.Unlock()
+		return "OK!", nil
+	})
+	for name := range names {
+		if !regexp.MustCompile(`^load_w[0-2]_[a-z]{20}$`).MatchString(name) {
+			t.Errorf("Expected the worker's prefix in %q", name)
+		}
+	}
+	for _, log := range logs {
+		if !slices.Contains([]string{"w0_", "w1_", "w2_"}, log.Worker) {
+			t.Errorf("Expected the worker's prefix in the results, got %q", log.Worker)
+		}
+	}
+	args.Mode = "call"
+	if errs := args.Validate(); len(errs) == 0 {
+		t.Errorf("Expected workerPrefix to be rejected in call mode")
+	}
+}
+
+func TestAddpkgCallWaitsForCommit(t *testing.T) {
+	args := testArgs()
+	args.Mode = "addpkg+call"
+	args.FunctionName = "Increment"
+	var mu sync.Mutex
+	var sent []string
+	committed := false
+	logs := runFake(t, args, 2, func(mode, packageName string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, mode)
+		if mode == "addpkg" && !committed {
+			committed = true
+			return "OK!\n", nil
+		}
+		return "OK!\nHEIGHT:     7\nTX HASH:    abc=\n", nil
+	})
+	if len(logs) < 2 || logs[0].Valid || logs[0].ErrorCode != ErrValidation || !logs[1].Valid {
+		t.Fatalf("Expected the uncommitted addpkg to fail and the next to succeed, got %+v", logs)
+	}
+	if !slices.Equal(sent[:3], []string{"addpkg", "addpkg", "call"}) {
+		t.Errorf("Expected no call without a committed addpkg, sent %v", sent)
+	}
+}
+
+func TestAddpkgCallSteps(t *testing.T) {
+	args := testArgs()
+	args.Mode = "addpkg+call"
+	args.FunctionName = "Increment"
+	logs := runFake(t, args, 4, func(mode, packageName string) (string, error) {
+		if mode == "call" {
+			time.Sleep(5 * time.Millisecond)
+			return "", errors.New("out of gas in location: VMCall")
+		}
+		return "OK!\nHEIGHT:     7\nTX HASH:    abc=\n", nil
+	})
+	steps, byStep := SummarizeSteps(logs)
+	if !slices.Equal(steps, []string{"1:addpkg", "2:call"}) {
+		t.Fatalf("Expected a sample per step, got %v", steps)
+	}
+	if s := byStep["1:addpkg"]; s.Failed != 0 {
+		t.Errorf("Expected the deploys to succeed, got %+v", s)
+	}
+	if s := byStep["2:call"]; s.Failed != s.Requests || s.Errors[ErrOutOfGas] != s.Requests || s.P50 < 5*time.Millisecond {
+		t.Errorf("Expected the calls to be timed and fail on their own, got %+v", s)
+	}
+	for _, log := range logs {
+		if _, want, _ := strings.Cut(log.Step, ":"); log.Mode != want {
+			t.Errorf("Expected step %s to be recorded as %s, got %q", log.Step, want, log.Mode)
+		}
+	}
+}
+
+// okMode is a Mode whose responses fail unless they say OK.
+type okMode struct{}
+
+func (okMode) Command(path string, args Config) string { return "echo " + path }
+func (okMode) Validate(Config) []error                 { return nil }
+func (okMode) ParseResult(out string) error {
+	if !strings.Contains(out, "OK") {
+		return errors.New("not OK")
+	}
+	return nil
+}
+
+func TestRegisterMode(t *testing.T) {
+	args := testArgs()
+	args.Mode = "nosuch"
+	if errs := args.Validate(); len(errs) == 0 || !strings.Contains(fmt.Sprint(errs), "mode must be one of") {
+		t.Errorf("Expected an unknown mode to be rejected, got %v", errs)
+	}
+
+	RegisterMode("ok", okMode{})
+	defer delete(modes, "ok")
+	if !slices.Contains(Modes(), "ok") || !slices.Contains(Modes(), "addpkg+call") {
+		t.Errorf("Expected registered and run modes in %v", Modes())
+	}
+	args.Mode = "ok"
+	args.PackageName = "gno.land/r/demo/counter"
+	if errs := args.Validate(); len(errs) != 0 {
+		t.Errorf("Expected a registered mode to be valid, got %v", errs)
+	}
+	if cmd := GenerateCommand("ok", args.PackageName, args); cmd != "echo gno.land/r/demo/counter" {
+		t.Errorf("Unexpected command %q", cmd)
+	}
+	var n atomic.Int32
+	valid := map[bool]int{}
+	for _, log := range runFake(t, args, 20, func(mode, packageName string) (string, error) {
+		if n.Add(1)%2 == 0 {
+			return "not yet", nil
+		}
+		return "OK", nil
+	}) {
+		valid[log.Valid]++
+	}
+	if valid[true] == 0 || valid[false] == 0 {
+		t.Errorf("Expected the mode's parser to reject some responses, got %v", valid)
+	}
+
+	file := filepath.Join(t.TempDir(), "modes.txt")
+	os.WriteFile(file, []byte("# extra modes\nqeval: gnokey query vm/qeval --data '{{.Package}}.Count()' --remote {{.Remote}}\n\nbad: {{.Nope}}\n"), 0o644)
+	if err := LoadModeFile(file); err != nil {
+		t.Fatalf("Failed to load modes: %v", err)
+	}
+	defer delete(modes, "qeval")
+	defer delete(modes, "bad")
+	args.Mode = "qeval"
+	if cmd := GenerateCommand("qeval", args.PackageName, args); cmd != "gnokey query vm/qeval --data 'gno.land/r/demo/counter.Count()' --remote "+args.Remote {
+		t.Errorf("Unexpected command %q", cmd)
+	}
+	args.Mode = "bad"
+	if errs := args.Validate(); len(errs) == 0 {
+		t.Error("Expected a template using an unknown field to be rejected")
+	}
+	os.WriteFile(file, []byte("verify: echo\n"), 0o644)
+	if err := LoadModeFile(file); err == nil {
+		t.Error("Expected replacing a run mode to fail")
+	}
+}
+
+func TestCustomMode(t *testing.T) {
+	args := testArgs()
+	args.Mode = "custom"
+	args.PackageName = "gno.land/r/demo/users"
+	if errs := args.Validate(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "command must be specified") {
+		t.Errorf("Expected -command to be required, got %v", errs)
+	}
+	args.Command = "gnokey query vm/qrender --data '{{.Package}}:{{.Nope}}'"
+	if errs := args.Validate(); len(errs) == 0 {
+		t.Error("Expected a template using an unknown field to be rejected")
+	}
+	args.Command = "gnokey query vm/qrender --data '{{.Package}}:{{.RandString 8}}' --remote {{.Remote}}"
+	if errs := args.Validate(); len(errs) != 0 {
+		t.Errorf("Expected a valid custom mode, got %v", errs)
+	}
+	cmd := GenerateCommand("custom", args.PackageName, args)
+	if !regexp.MustCompile(`^gnokey query vm/qrender --data 'gno.land/r/demo/users:[a-z]{8}' --remote `).MatchString(cmd) {
+		t.Errorf("Unexpected command %q", cmd)
+	}
+	if GenerateCommand("custom", args.PackageName, args) == cmd {
+		t.Error("Expected RandString to differ between requests")
+	}
+
+	args.Mode = "call"
+	args.Command = "echo"
+	if errs := args.Validate(); !strings.Contains(fmt.Sprint(errs), "command can only be used in custom mode") {
+		t.Errorf("Expected -command to be rejected outside custom mode, got %v", errs)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	args := testArgs()
+	args.Mode = "qrender"
+	args.PackageName = "gno.land/r/demo/boards"
+	args.Extract = []string{"posts:(\\d+) posts", "call=events:events: ([0-9,]+)"}
+	RegisterParser("qrender", func(out string) map[string]float64 {
+		return map[string]float64{"lines": float64(strings.Count(out, "\n"))}
+	})
+	defer func() { parsers["qrender"] = parsers["qrender"][:1] }()
+	logs := runFake(t, args, 5, func(mode, packageName string) (string, error) {
+		return "height: 0\ndata: 12 posts, events: 1,000\n", nil
+	})
+	want := map[string]float64{"renderedBytes": 23, "posts": 12, "lines": 2}
+	for _, log := range logs {
+		if !reflect.DeepEqual(log.Fields, want) {
+			t.Errorf("Expected fields %v, got %v", want, log.Fields)
+		}
+	}
+	stats := SummarizeFields(logs)
+	if len(stats) != 3 || stats[1].Name != "posts" || stats[1].Requests != len(logs) || stats[1].P50 != 12 {
+		t.Errorf("Unexpected field stats %+v", stats)
+	}
+	if formatFields(want) != "lines=2 posts=12 renderedBytes=23" {
+		t.Errorf("Unexpected column %q", formatFields(want))
+	}
+
+	args.Extract = []string{"no regex"}
+	if errs := args.Validate(); !strings.Contains(fmt.Sprint(errs), "expected name:regex") {
+		t.Errorf("Expected a malformed extract to be rejected, got %v", errs)
+	}
+	// Library callers that skip Validate get the error from NewRun
+	if _, err := NewRun(args, ""); err == nil || !strings.Contains(err.Error(), "expected name:regex") {
+		t.Errorf("Expected NewRun to reject a malformed extract, got %v", err)
+	}
+	args.Extract = nil
+	args.ExpectRegex = []string{"("}
+	if _, err := NewRun(args, ""); err == nil {
+		t.Error("Expected NewRun to reject a malformed expectRegex")
+	}
+}
+
+func TestMaxRequestsProgress(t *testing.T) {
+	args := testArgs()
+	args.Mode = "qdoc"
+	args.PackageName = "gno.land/r/demo/boards"
+	args.MaxRequests = 10
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) { return "", errors.New("boom") }}
+	})
+	args.Backend = "fake"
+	args.MaxQPS = 1000
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	r.Start() // returns on its own after -maxRequests
+	r.Close()
+	p := r.Progress()
+	if n := len(r.Logs()); n < 10 || n > 10+args.MaxThreads {
+		t.Errorf("Expected about 10 requests, got %d", n)
+	}
+	if p.Fraction() != 1 || p.Errors != p.Requests {
+		t.Errorf("Unexpected progress %+v", p)
+	}
+
+	p = Progress{Elapsed: 15 * time.Second, Duration: time.Minute, Requests: 50, MaxRequests: 100}
+	if p.Fraction() != 0.5 {
+		t.Errorf("Expected the closer of duration and requests, got %v", p.Fraction())
+	}
+	if eta, ok := p.ETA(); !ok || eta != 15*time.Second {
+		t.Errorf("Expected an ETA of 15s, got %v", eta)
+	}
+	if _, ok := (Progress{Elapsed: time.Second}).ETA(); ok {
+		t.Error("Expected no ETA without -duration or -maxRequests")
+	}
+}
+
+func TestSummaryTable(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	var logs []ExecutionLog
+	for i := range 10 {
+		log := ExecutionLog{Mode: "call", Start: start.Add(time.Duration(i) * time.Second), ResponseTime: 10 * time.Millisecond, Success: i > 0, Valid: true}
+		log.Timestamp = log.Start.Add(log.ResponseTime)
+		if i == 0 {
+			log.ErrorCode = ErrOutOfGas
+		}
+		logs = append(logs, log)
+	}
+	var plain, colored bytes.Buffer
+	WriteSummaryTable(&plain, Summarize(logs), logs, false)
+	WriteSummaryTable(&colored, Summarize(logs), logs, true)
+	if strings.Contains(plain.String(), "\033[") {
+		t.Errorf("Expected no colors:\n%s", plain.String())
+	}
+	for _, re := range []string{`Requests\s+10\n`, `Throughput\s+1\.11/s`, `Errors\s+1 \(10\.0%\)`, ErrOutOfGas + `\s+1\n`, `\s+10ms\s+10ms\s+10ms\s+10ms\n`} {
+		if !regexp.MustCompile(re).MatchString(plain.String()) {
+			t.Errorf("Expected %s in the summary:\n%s", re, plain.String())
+		}
+	}
+	if !strings.Contains(colored.String(), colorRed+"   1 (10.0%)") {
+		t.Errorf("Expected a 10%% error rate in red:\n%q", colored.String())
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                                     "0s",
+		850 * time.Nanosecond:                 "850ns",
+		850 * time.Microsecond:                "850µs",
+		999700 * time.Nanosecond:              "1ms",
+		12345678 * time.Nanosecond:            "12.3ms",
+		10 * time.Millisecond:                 "10ms",
+		1049 * time.Millisecond:               "1.05s",
+		59999 * time.Millisecond:              "1m0s",
+		2*time.Minute + 3400*time.Millisecond: "2m3s",
+		time.Hour + 2*time.Minute + 3*time.Second: "1h2m3s",
+		-1500 * time.Microsecond:                  "-1.5ms",
+	} {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%d) = %q, expected %q", d, got, want)
+		}
+	}
+	if got := FormatSize(1536); got != "1.5KB" {
+		t.Errorf("FormatSize(1536) = %q", got)
+	}
+}
+
+func TestCloseWhileRunning(t *testing.T) {
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) {
+			time.Sleep(time.Millisecond)
+			return "OK!", nil
+		}}
+	})
+	args := DefaultConfig()
+	args.MaxThreads = 4
+	args.Normalize()
+	args.Backend = "fake"
+	args.Mode = "qdoc"
+	args.PackageName = "gno.land/r/demo/boards"
+	args.MaxQPS = 1000
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatalf("Failed to set up run: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Start()
+		close(done)
+	}()
+	for len(r.Logs()) < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	// As on an interrupt: the results are saved while requests are still completing
+	r.Close()
+	time.Sleep(20 * time.Millisecond)
+	r.Stop()
+	<-done
+}
+
+func TestAssertionsAndJUnit(t *testing.T) {
+	stats := Summarize([]ExecutionLog{
+		{ResponseTime: 100 * time.Millisecond, Success: true, Valid: true},
+		{ResponseTime: 300 * time.Millisecond, Success: true, Valid: true},
+		{ResponseTime: 900 * time.Millisecond, ErrorCode: ErrTimeout},
+	})
+	results, err := CheckAssertions([]string{"p50<500ms", "p99 <= 500ms", "errorRate<50%", "requests>=3"}, stats)
+	if err != nil {
+		t.Fatalf("Failed to check assertions: %v", err)
+	}
+	var passed []bool
+	for _, r := range results {
+		passed = append(passed, r.Passed)
+	}
+	if !reflect.DeepEqual(passed, []bool{true, false, true, true}) || results[1].Value != "900ms" || results[2].Value != "33.33%" {
+		t.Errorf("Unexpected assertion results: %+v", results)
+	}
+	for _, bad := range []string{"p95", "p42<1s", "p95<fast", "errorRate=0"} {
+		if _, err := ParseAssertion(bad); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, "call", 90*time.Second, "Requests: 3", "aborted after 10 consecutive errors", results); err != nil {
+		t.Fatalf("Failed to write JUnit: %v", err)
+	}
+	for _, want := range []string{
+		`<testsuite name="realm-profiler" tests="5" failures="2" time="90.000">`,
+		`<failure message="aborted after 10 consecutive errors">`,
+		`<testcase name="p99 &lt;= 500ms" classname="realm-profiler.assertion" time="0">`,
+		`<failure message="p99 &lt;= 500ms failed: actual value 900ms">`,
+		`<system-out><![CDATA[Requests: 3]]></system-out>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("JUnit XML is missing %s:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+	useFakeGnokey(t)
+	args := testArgs()
+	args.PackageName = "foo"
+	args.MaxQPS = 20
+	args.Duration = 300 * time.Millisecond
+	modes := DefaultSuiteModes(args)
+	if !slices.Equal(modes, []string{"balanceQuery", "qrender", "qdoc", "addpkg"}) {
+		t.Fatalf("Expected call to be left out without a function, got %v", modes)
+	}
+	if a := SuiteArgs(args, "addpkg"); a.PackageName != "" || a.Workload != "counter" {
+		t.Errorf("Expected addpkg to deploy the counter workload under random names, got %+v", a)
+	}
+
+	logs, err := RunSuite(args, modes, "password", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, byMode := GroupByMode(logs)
+	for _, mode := range modes {
+		if s := Summarize(byMode[mode]); s.Requests == 0 || s.ErrorRate() != 0 {
+			t.Errorf("Expected %s requests without errors, got %+v", mode, s)
+		}
+	}
+	var out bytes.Buffer
+	WriteSuite(&out, modes, logs)
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != len(modes)+1 || !strings.HasPrefix(lines[4], "addpkg") {
+		t.Errorf("Unexpected scorecard:\n%s", out.String())
+	}
+}
+
+func TestRunContention(t *testing.T) {
+	var writing atomic.Bool
+	RegisterExecutor("fake", func(string) Executor {
+		return fakeExecutor{respond: func(mode, packageName string) (string, error) {
+			if mode == "call" {
+				writing.Store(true)
+			} else if writing.Load() {
+				time.Sleep(4 * time.Millisecond)
+			} else {
+				time.Sleep(time.Millisecond)
+			}
+			return "OK!", nil
+		}}
+	})
+	args := testArgs()
+	args.Backend = "fake"
+	args.PackageName, args.FunctionName = "foo", "Increment"
+	args.Duration = 300 * time.Millisecond
+	rates := ContentionRates{ReadThreads: 1, ReadQPS: 50, WriteThreads: 1, WriteQPS: 20}
+	if reads, writes := ContentionArgs(args, rates); reads.Mode != "qrender" || reads.FunctionName != "" || reads.MaxQPS != 50 || writes.Mode != "call" || writes.MaxQPS != 20 {
+		t.Errorf("Unexpected args %+v %+v", reads, writes)
+	}
+
+	reads, writes, err := RunContention(args, rates, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := SummarizeContention(reads, writes)
+	if c.Baseline.Requests == 0 || c.Contended.Requests == 0 || c.Writes.Requests == 0 {
+		t.Fatalf("Expected reads in both phases and writes, got %+v", c)
+	}
+	if slowdown := c.Slowdown(func(s Summary) time.Duration { return s.P50 }); slowdown < 1 {
+		t.Errorf("Expected the writes to slow the reads down, got %+.0f%%", 100*slowdown)
+	}
+	var out bytes.Buffer
+	WriteContention(&out, c)
+	if !strings.Contains(out.String(), "reads with writes") || !strings.Contains(out.String(), "Writes changed read latency by +") {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+}
+
+func TestRemotePresets(t *testing.T) {
+	args := testArgs()
+	args.Remote, args.CompareRemote = "test5", "portal-loop"
+	args.Normalize()
+	if args.Remote != "https://rpc.test5.gno.land:443" || args.ChainID != "test5" || args.CompareRemote != "https://rpc.gno.land:443" {
+		t.Errorf("Expected the test5 endpoint and chain ID, got %s %s %s", args.Remote, args.ChainID, args.CompareRemote)
+	}
+	if RemoteChainID(args.Remote) != "test5" || RemoteChainID("localhost:26657") != DefaultChainId {
+		t.Errorf("Unexpected chain IDs of remotes")
+	}
+
+	args = testArgs()
+	args.Remote, args.ChainID = "portal-loop", "custom"
+	args.Normalize()
+	if args.ChainID != "custom" {
+		t.Errorf("Expected an explicit chain ID to be kept, got %s", args.ChainID)
+	}
+}
+
+func TestRemotesSummary(t *testing.T) {
+	useFakeGnokey(t)
+	args := testArgs()
+	args.Mode = "balanceQuery"
+	args.MaxQPS = 20
+	args.Remotes = []string{"node1:26657", "node2:26657"}
+	args.Normalize()
+	if args.Remote != "node1:26657" {
+		t.Errorf("Expected the first of remotes as remote, got %s", args.Remote)
+	}
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(300*time.Millisecond, r.Stop)
+	r.Start()
+	logs := r.Logs()
+	targets, byTarget := SummarizeTargets(logs)
+	if !slices.Equal(targets, args.Remotes) {
+		t.Fatalf("Expected results by endpoint, got %v", targets)
+	}
+	if n1, n2 := byTarget[targets[0]].Requests, byTarget[targets[1]].Requests; n1+n2 != len(logs) || n1-n2 > 1 || n2-n1 > 1 {
+		t.Errorf("Expected requests to alternate between endpoints, got %d and %d", n1, n2)
+	}
+	var out bytes.Buffer
+	WriteSummary(&out, logs)
+	if !strings.Contains(out.String(), "Latency by endpoint:") || !strings.Contains(out.String(), "node2:26657") {
+		t.Errorf("Expected the summary to break latency down by endpoint:\n%s", out.String())
+	}
+}
+
+func TestRunChains(t *testing.T) {
+	c, err := ParseChain("test5,,loadtest,2")
+	if err != nil || c != (Chain{Remote: "test5", KeyName: "loadtest", MaxQPS: 2}) || c.String() != "test5,,loadtest,2" {
+		t.Errorf("Unexpected chain %+v, %v", c, err)
+	}
+	if a := c.apply(testArgs()); a.Remote != "https://rpc.test5.gno.land:443" || a.ChainID != "test5" || a.KeyName != "loadtest" || a.MaxQPS != 2 {
+		t.Errorf("Unexpected args for chain %+v", a)
+	}
+	for _, bad := range []string{"", ",dev", "a,b,c,d,e", "a,b,c,fast"} {
+		if _, err := ParseChain(bad); err == nil {
+			t.Errorf("Expected chain %q to be rejected", bad)
+		}
+	}
+
+	useFakeGnokey(t)
+	args := testArgs()
+	args.Mode = "balanceQuery"
+	args.Duration = 300 * time.Millisecond
+	args.Chains = []Chain{{Remote: "node1:26657", MaxQPS: 20}, {Remote: "node2:26657", ChainID: "other"}}
+	logs, err := RunChains(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, byTarget := SummarizeTargets(logs)
+	if len(targets) != 2 || byTarget["node1:26657"].Requests <= byTarget["node2:26657"].Requests {
+		t.Errorf("Expected each chain at its own rate, got %v", byTarget)
+	}
+}
+
+func TestBlockPhases(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var r rpcRequest
+		json.NewDecoder(req.Body).Decode(&r)
+		height, _ := strconv.Atoi(r.Params["height"])
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"block_meta":{"header":{"height":"%d","time":%q}}}}`,
+			height, base.Add(time.Duration(height)*time.Second).Format(time.RFC3339Nano))
+	}))
+	defer node.Close()
+
+	// Blocks every second: submitted 0.1s and 0.9s after block 9, committed in block 10
+	logs := []ExecutionLog{
+		{Timestamp: base.Add(9100 * time.Millisecond).Add(1500 * time.Millisecond), ResponseTime: 1500 * time.Millisecond, Height: 10},
+		{Timestamp: base.Add(9900 * time.Millisecond).Add(700 * time.Millisecond), ResponseTime: 700 * time.Millisecond, Height: 10},
+		{Timestamp: base, ResponseTime: time.Second},
+	}
+	heights := BlockHeights(logs)
+	if !slices.Equal(heights, []int64{9, 10}) {
+		t.Fatalf("Unexpected heights %v", heights)
+	}
+	times, err := BlockTimes(node.URL, heights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := SummarizeBlockPhases(logs, times)
+	if phases[0].Requests != 1 || phases[0].BlockWait != 900*time.Millisecond || phases[3].Requests != 1 || phases[3].BlockWait != 100*time.Millisecond {
+		t.Errorf("Unexpected phases %+v", phases)
+	}
+	var out bytes.Buffer
+	WriteBlockPhases(&out, phases)
+	if !strings.Contains(out.String(), "75-100%") {
+		t.Errorf("Unexpected block phases output:\n%s", out.String())
+	}
+}
+
+func TestRateShortfalls(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	var logs []ExecutionLog
+	add := func(second, n int, latency time.Duration) {
+		for i := 0; i < n; i++ {
+			sent := start.Add(time.Duration(second) * time.Second)
+			logs = append(logs, ExecutionLog{Start: sent, Timestamp: sent.Add(latency), ResponseTime: latency,
+				Success: true, Valid: true, ActiveWorkers: 2, TargetQPS: 10})
+		}
+	}
+	add(0, 100, 10*time.Millisecond)  // on target
+	add(10, 50, 10*time.Millisecond)  // behind with idle workers: the generator
+	add(20, 20, 900*time.Millisecond) // behind with busy workers: the node
+	add(30, 1, 10*time.Millisecond)   // cut short by the end of the run
+
+	intervals, behind := RateShortfalls(logs, RateWindow)
+	if intervals != 3 || len(behind) != 2 {
+		t.Fatalf("Expected 2 of 3 intervals behind, got %d of %d: %+v", len(behind), intervals, behind)
+	}
+	if behind[0].NodeBound || behind[0].Achieved != 5 || behind[0].Target != 10 || !behind[1].NodeBound {
+		t.Errorf("Unexpected intervals: %+v", behind)
+	}
+	var out bytes.Buffer
+	writeRate(&out, logs)
+	if !strings.Contains(out.String(), "Below target rate: 2 of 3 intervals") || !strings.Contains(out.String(), "1 of them") {
+		t.Errorf("Unexpected rate summary:\n%s", out.String())
+	}
+}
+
+func TestResourceMonitor(t *testing.T) {
+	if _, ok := processCPU(); !ok && runtime.GOOS != "windows" {
+		t.Errorf("Expected the CPU time of the process")
+	}
+	if residentMemory() <= 0 {
+		t.Errorf("Expected some resident memory")
+	}
+
+	var m resourceMonitor
+	start := time.Now()
+	cores := time.Duration(runtime.NumCPU())
+	if _, measured := m.sample(start, time.Second, true, 10<<20); measured {
+		t.Errorf("Expected the first sample to only set the baseline")
+	}
+	// Every core busy for the whole interval, then half of them
+	m.sample(start.Add(time.Second), time.Second+cores*time.Second, true, 30<<20)
+	m.sample(start.Add(2*time.Second), time.Second+cores*3*time.Second/2, true, 20<<20)
+	u := m.usage
+	if u.Samples != 2 || u.Saturated != 1 || math.Abs(u.PeakCPU-1) > 1e-9 || math.Abs(u.MeanCPU-0.75) > 1e-9 || u.PeakRSS != 30<<20 {
+		t.Errorf("Unexpected usage %+v", u)
+	}
+	var out bytes.Buffer
+	WriteResources(&out, u)
+	if !strings.Contains(out.String(), "30.0MB peak resident") || !strings.Contains(out.String(), "saturated this machine's CPU in 1 of 2 samples") {
+		t.Errorf("Unexpected resources output:\n%s", out.String())
+	}
+}
+
+func TestMaxSamplesSpill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	results, _, err := OpenResults(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := testArgs()
+	args.MaxSamples = 10
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.SpillTo(results)
+	for i := 0; i < 25; i++ {
+		r.record(ExecutionLog{Timestamp: time.Unix(int64(i), 0), ResponseTime: time.Duration(i+1) * time.Millisecond, Success: true, Valid: true})
+		if i == 12 {
+			// A checkpoint between spills
+			if err := r.FlushTo(results); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if n := len(r.Logs()); n >= args.MaxSamples || r.Spilled()+n != 25 {
+		t.Errorf("Expected fewer than %d samples in memory, got %d with %d spilled", args.MaxSamples, n, r.Spilled())
+	}
+	if s := r.Summary(); s.Requests != 25 {
+		t.Errorf("Expected the summary to count every request, got %d", s.Requests)
+	}
+	if err := r.FlushTo(results); err != nil {
+		t.Fatal(err)
+	}
+	results.Close()
+	logs, err := LoadResults(path)
+	if err != nil || len(logs) != 25 {
+		t.Fatalf("Expected every sample in the results file, got %d (%v)", len(logs), err)
+	}
+	for i, log := range logs {
+		if log.Timestamp.Unix() != int64(i) {
+			t.Fatalf("Expected the samples in order, got %v at %d", log.Timestamp, i)
+		}
+	}
+
+	r.args.MemoryLimit = 1
+	r.watchMemory(2)
+	r.record(ExecutionLog{Timestamp: time.Unix(25, 0), Success: true, Valid: true})
+	if !r.degraded.Load() || len(r.Logs()) != 0 {
+		t.Errorf("Expected no samples in memory over the memory limit, got %d", len(r.Logs()))
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	args := testArgs()
+	args.CheckpointRequests = 100
+	r, err := NewRun(args, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				r.record(ExecutionLog{Timestamp: time.Now(), ResponseTime: time.Millisecond, Success: true, Valid: true})
+			}
+		}()
+	}
+	wg.Wait()
+	// Every result recorded before Logs is called is in it, though the recorder adds them
+	// in the background
+	if n := len(r.Logs()); n != 4000 {
+		t.Errorf("Expected 4000 samples, got %d", n)
+	}
+	select {
+	case <-r.flush:
+	default:
+		t.Error("Expected a checkpoint to be requested")
+	}
+	r.Close()
+	if n := r.Summary().Requests; n != 4000 {
+		t.Errorf("Expected 4000 requests after Close, got %d", n)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	args := testArgs()
+	args.PackageName = "gno.land/r/demo/counter"
+	args.FunctionName = "Incr"
+	logs := runFake(t, args, 3, func(string, string) (string, error) { return "OK!\n", nil })
+	want := fingerprint("fake call gno.land/r/demo/counter")
+	for _, log := range logs {
+		if log.Fingerprint != want {
+			t.Errorf("Expected fingerprint %s, got %q", want, log.Fingerprint)
+		}
+	}
+	if len(want) != 16 || fingerprint("a", "b") == fingerprint("a") {
+		t.Errorf("Unexpected fingerprints %q and %q", want, fingerprint("a", "b"))
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	args := testArgs()
+	args.PackageName = "gno.land/r/demo/counter"
+	if errs := args.Validate(); len(errs) != 0 {
+		t.Errorf("Expected a valid config, got %v", errs)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"missing package", func(c *Config) { c.PackageName = "" }, []string{"package or targets"}},
+		{"no rate", func(c *Config) { c.MaxQPS = 0 }, []string{"maxQueriesPerSec"}},
+		{"several problems", func(c *Config) {
+			c.Mode = "balanceQuery"
+			c.ThinkDist = "weird"
+			c.SampleRate = 2
+		}, []string{"Cannot specify packageName", "thinkDist", "sampleRate"}},
+		{"one problem per loop", func(c *Config) {
+			c.Chains = []Chain{{Remote: "a"}, {Remote: "a"}, {Remote: "a"}}
+			c.Duration = time.Minute
+		}, []string{"own remote"}},
+	} {
+		c := args
+		tc.modify(&c)
+		errs := c.Validate()
+		if len(errs) != len(tc.want) {
+			t.Errorf("%s: expected %d problems, got %v", tc.name, len(tc.want), errs)
+			continue
+		}
+		for i, want := range tc.want {
+			if !strings.Contains(errs[i].Error(), want) {
+				t.Errorf("%s: expected %q, got %v", tc.name, want, errs[i])
+			}
+		}
+	}
+}
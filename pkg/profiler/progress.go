@@ -0,0 +1,51 @@
+package profiler
+
+import "time"
+
+// Progress is how far a run with -duration or -maxRequests is towards stopping.
+type Progress struct {
+	Elapsed     time.Duration
+	Duration    time.Duration // 0 unless -duration is set
+	Requests    int64
+	MaxRequests int // 0 unless -maxRequests is set
+	Errors      int64
+	Queued      int // requests waiting for one of -maxProcs subprocesses
+}
+
+// Progress returns how far the run is, counting every request recorded so far.
+func (r *Run) Progress() Progress {
+	p := Progress{
+		Elapsed:     time.Since(r.start),
+		Duration:    r.args.Duration,
+		Requests:    r.recorded.Load(),
+		MaxRequests: r.args.MaxRequests,
+		Errors:      r.errored.Load(),
+	}
+	if r.procs != nil {
+		p.Queued = r.procs.queueLength()
+	}
+	return p
+}
+
+// Fraction returns the part of the run done, by whichever of -duration and -maxRequests
+// it will reach first, or 0 if it has neither.
+func (p Progress) Fraction() float64 {
+	var f float64
+	if p.Duration > 0 {
+		f = float64(p.Elapsed) / float64(p.Duration)
+	}
+	if p.MaxRequests > 0 {
+		f = max(f, float64(p.Requests)/float64(p.MaxRequests))
+	}
+	return min(f, 1)
+}
+
+// ETA returns how much longer the run is likely to take at the pace so far, or false
+// before anything is done to estimate it from.
+func (p Progress) ETA() (time.Duration, bool) {
+	f := p.Fraction()
+	if f <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(p.Elapsed) * (1 - f) / f), true
+}
@@ -0,0 +1,111 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LabelPattern matches a valid Prometheus label name.
+var LabelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// WritePrometheus writes the summary of a run that took elapsed in the Prometheus text
+// format, as gauges named realm_profiler_*.
+func WritePrometheus(w io.Writer, s Summary, elapsed time.Duration) error {
+	var b bytes.Buffer
+	gauge := func(name, help string, samples ...string) {
+		fmt.Fprintf(&b, "# HELP realm_profiler_%s %s\n# TYPE realm_profiler_%s gauge\n", name, help, name)
+		for _, sample := range samples {
+			fmt.Fprintf(&b, "realm_profiler_%s%s\n", name, sample)
+		}
+	}
+	value := func(v float64) string {
+		return " " + strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	gauge("requests", "Requests in the summary, leaving out warm-up.", value(float64(s.Requests)))
+	gauge("failed", "Requests that failed.", value(float64(s.Failed)))
+	gauge("invalid", "Requests that succeeded but failed validation.", value(float64(s.Invalid)))
+	gauge("error_rate", "Fraction of requests that failed or failed validation.", value(s.ErrorRate()))
+	var byCode []string
+	for _, code := range s.ErrorCodes() {
+		byCode = append(byCode, fmt.Sprintf(`{code=%q}`, code)+value(float64(s.Errors[code])))
+	}
+	gauge("errors", "Failed requests by error code.", byCode...)
+	gauge("latency_seconds", "Response time percentiles.",
+		`{quantile="0.5"}`+value(s.P50.Seconds()),
+		`{quantile="0.95"}`+value(s.P95.Seconds()),
+		`{quantile="0.99"}`+value(s.P99.Seconds()),
+		`{quantile="1"}`+value(s.Max.Seconds()))
+	if elapsed > 0 {
+		gauge("throughput", "Requests per second over the run.", value(float64(s.Requests)/elapsed.Seconds()))
+		gauge("duration_seconds", "How long the run took.", value(elapsed.Seconds()))
+	}
+	gauge("fee_ugnot", "Gas fees paid by the run's transactions.", value(float64(s.Cost.Fee)))
+	gauge("gas_used", "Gas used by the run's transactions.", value(float64(s.Cost.GasUsed)))
+	gauge("last_run_timestamp_seconds", "When the run's metrics were pushed.", value(float64(time.Now().Unix())))
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// PushSummary replaces the metrics of the group of job and labels on the Prometheus
+// Pushgateway at gateway with the summary of a run, so that short runs such as CI jobs
+// can be graphed without being scraped. labels are name=value pairs, e.g. mode=call.
+func PushSummary(gateway, job string, labels []string, s Summary, elapsed time.Duration) error {
+	var body bytes.Buffer
+	if err := WritePrometheus(&body, s, elapsed); err != nil {
+		return err
+	}
+	path := "/metrics/job" + pushLabelValue(job)
+	for _, label := range labels {
+		name, value, _ := strings.Cut(label, "=")
+		path += "/" + name + pushLabelValue(value)
+	}
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(gateway, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := sinkClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// pushLabelValue returns the URL path element of a grouping label value, in base64 if
+// it can't be used as it is, e.g. a package path. Names that take base64 values get an
+// @base64 suffix, so this returns the separator too.
+func pushLabelValue(value string) string {
+	switch {
+	case value == "":
+		return "@base64/="
+	case strings.Contains(value, "/"):
+		return "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + url.PathEscape(value)
+}
+
+// PushLabels returns the grouping labels of a run: its mode and remote, overridden or
+// added to by extra name=value pairs.
+func PushLabels(c Config, extra []string) []string {
+	labels := []string{"mode=" + c.Mode, "remote=" + c.Remote}
+	for _, label := range extra {
+		name, _, _ := strings.Cut(label, "=")
+		labels = slices.DeleteFunc(labels, func(l string) bool { return strings.HasPrefix(l, name+"=") })
+		labels = append(labels, label)
+	}
+	return labels
+}
@@ -0,0 +1,127 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// RateWindow is the width of the intervals the achieved rate is compared with the
+// target over.
+const RateWindow = 10 * time.Second
+
+// rateShortfall is how far below the target the achieved rate must be for an interval to
+// count as falling behind.
+const rateShortfall = 0.9
+
+// RateInterval is an interval of a run in which fewer requests completed than the target
+// rate asked for.
+type RateInterval struct {
+	Start    time.Time
+	Target   float64 // QPS
+	Achieved float64
+	// NodeBound is set when the workers were busy waiting for responses: at their
+	// mean response time they couldn't have sent more. Otherwise the generator itself
+	// couldn't keep up, e.g. because the machine ran out of CPU to spawn gnokey.
+	NodeBound bool
+}
+
+type rateKey struct{ agent, target string }
+
+type rateBucket struct {
+	requests int
+	target   float64 // sum of TargetQPS
+	workers  int     // sum of ActiveWorkers
+}
+
+// RateShortfalls compares the rate requests were sent at with the target rate over each
+// complete interval of width, returning the intervals that fell behind. Requests to
+// different agents and targets are paced separately, so their targets add up. Requests
+// without a target rate, e.g. those of scripts, are left out.
+func RateShortfalls(logs []ExecutionLog, width time.Duration) (intervals int, behind []RateInterval) {
+	var first, last time.Time
+	for _, log := range logs {
+		if log.TargetQPS <= 0 {
+			continue
+		}
+		started := log.Started()
+		if first.IsZero() || started.Before(first) {
+			first = started
+		}
+		if started.After(last) {
+			last = started
+		}
+	}
+	// The last interval is cut short by the end of the run
+	intervals = int(last.Sub(first) / width)
+	if first.IsZero() || intervals == 0 {
+		return 0, nil
+	}
+	buckets := make([]map[rateKey]*rateBucket, intervals)
+	busy := make([]time.Duration, intervals)
+	for _, log := range logs {
+		i := int(log.Started().Sub(first) / width)
+		if log.TargetQPS <= 0 || i >= intervals {
+			continue
+		}
+		if buckets[i] == nil {
+			buckets[i] = map[rateKey]*rateBucket{}
+		}
+		key := rateKey{log.Agent, log.Target}
+		b := buckets[i][key]
+		if b == nil {
+			b = &rateBucket{}
+			buckets[i][key] = b
+		}
+		b.requests++
+		b.target += log.TargetQPS
+		b.workers += log.ActiveWorkers
+		busy[i] += log.ResponseTime
+	}
+	for i, bucket := range buckets {
+		interval := RateInterval{Start: first.Add(time.Duration(i) * width)}
+		// Workers of one agent are shared by all its targets
+		workers := map[string]float64{}
+		for key, b := range bucket {
+			interval.Target += b.target / float64(b.requests)
+			interval.Achieved += float64(b.requests) / width.Seconds()
+			workers[key.agent] = max(workers[key.agent], float64(b.workers)/float64(b.requests))
+		}
+		if interval.Target == 0 || interval.Achieved >= rateShortfall*interval.Target {
+			continue
+		}
+		// Each worker waits for its response before sending its next request, so workers
+		// that spent the interval waiting couldn't have sent more
+		var available float64
+		for _, n := range workers {
+			available += n * width.Seconds()
+		}
+		interval.NodeBound = busy[i].Seconds() >= rateShortfall*available
+		behind = append(behind, interval)
+	}
+	return intervals, behind
+}
+
+// writeRate prints how many intervals fell behind the target rate, and whether the
+// node or the generator was to blame.
+func writeRate(w io.Writer, logs []ExecutionLog) {
+	intervals, behind := RateShortfalls(logs, RateWindow)
+	if len(behind) == 0 {
+		return
+	}
+	generator := 0
+	worst := behind[0]
+	for _, b := range behind {
+		if !b.NodeBound {
+			generator++
+		}
+		if b.Achieved/b.Target < worst.Achieved/worst.Target {
+			worst = b
+		}
+	}
+	fmt.Fprintf(w, "Below target rate: %d of %d intervals of %v (worst %.1f of %.1f QPS at %s)\n",
+		len(behind), intervals, RateWindow, worst.Achieved, worst.Target, worst.Start.Format(time.TimeOnly))
+	if generator > 0 {
+		fmt.Fprintf(w, "  %d of them with responses fast enough: the generator couldn't keep up, not the node\n", generator)
+	}
+}
@@ -0,0 +1,37 @@
+package profiler
+
+import "sort"
+
+// remote is a public network selectable by name with -remote.
+type remote struct {
+	URL     string
+	ChainID string
+}
+
+var remotes = map[string]remote{
+	"portal-loop": {URL: "https://rpc.gno.land:443", ChainID: "portal-loop"},
+	"staging":     {URL: "https://rpc.staging.gno.land:443", ChainID: "staging"},
+	"test4":       {URL: "https://rpc.test4.gno.land:443", ChainID: "test4"},
+	"test5":       {URL: "https://rpc.test5.gno.land:443", ChainID: "test5"},
+}
+
+// RemoteNames returns the network names accepted by -remote, sorted.
+func RemoteNames() []string {
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RemoteChainID returns the chain ID of the public network at addr, given as a name or
+// its endpoint, or DefaultChainId for any other node.
+func RemoteChainID(addr string) string {
+	for name, r := range remotes {
+		if addr == name || addr == r.URL {
+			return r.ChainID
+		}
+	}
+	return DefaultChainId
+}
@@ -0,0 +1,167 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ScheduledRequest is one request of a schedule written by -record: what was sent, and
+// when relative to the start of the run. Replaying it against another node only changes
+// where it is sent.
+type ScheduledRequest struct {
+	Offset   time.Duration
+	Mode     string
+	Package  string   `json:",omitempty"` // full package path
+	Function string   `json:",omitempty"`
+	Args     []string `json:",omitempty"`
+	PkgDir   string   `json:",omitempty"` // for addpkg
+}
+
+func newScheduledRequest(offset time.Duration, mode, packageName string, args Config) ScheduledRequest {
+	req := ScheduledRequest{Offset: offset, Mode: mode}
+	switch mode {
+	case "addpkg":
+		req.Package, req.PkgDir = pkgPath(args, packageName), args.PkgDir
+	case "call":
+		req.Package, req.Function, req.Args = pkgPath(args, packageName), args.FunctionName, args.CallArgs
+	case "qrender", "qdoc":
+		req.Package = pkgPath(args, packageName)
+	}
+	return req
+}
+
+// recordingExecutor writes every request to a schedule before passing it on.
+type recordingExecutor struct {
+	Executor
+	start time.Time
+	mu    sync.Mutex
+	file  *os.File
+	enc   *json.Encoder
+}
+
+func newRecordingExecutor(e Executor, path string, start time.Time) (*recordingExecutor, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingExecutor{Executor: e, start: start, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (e *recordingExecutor) Execute(mode, packageName string, args Config) (string, HTTPTiming, error) {
+	req := newScheduledRequest(time.Since(e.start), mode, packageName, args)
+	e.mu.Lock()
+	if err := e.enc.Encode(req); err != nil {
+		fmt.Println("WARNING: Failed to record request: ", err)
+	}
+	e.mu.Unlock()
+	return e.Executor.Execute(mode, packageName, args)
+}
+
+func (e *recordingExecutor) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.file.Close()
+}
+
+// LoadSchedule reads a schedule written by -record.
+func LoadSchedule(path string) ([]ScheduledRequest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readSchedule(file)
+}
+
+func readSchedule(r io.Reader) ([]ScheduledRequest, error) {
+	var schedule []ScheduledRequest
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var req ScheduledRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		schedule = append(schedule, req)
+	}
+	return schedule, scanner.Err()
+}
+
+// requestArgs returns args with the settings of the scheduled request applied.
+func (req ScheduledRequest) requestArgs(args Config) Config {
+	args.FunctionName, args.CallArgs = req.Function, req.Args
+	if req.PkgDir != "" {
+		args.PkgDir = req.PkgDir
+	}
+	return args
+}
+
+// replay sends every request of the schedule at its recorded offset from the start of
+// the replay, each on its own goroutine so that a slow node doesn't delay the requests
+// after it, unless -maxInflight are already in flight. It returns once they have all
+// completed or the run is stopped.
+func (r *Run) replay() {
+	schedule := r.schedule
+	fmt.Println("INFO: Replaying", len(schedule), "requests")
+	start := time.Now()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, req := range schedule {
+		select {
+		case <-time.After(time.Until(start.Add(req.Offset))):
+		case <-r.done:
+			return
+		}
+		r.waitWhilePaused()
+		if r.stopped() {
+			return
+		}
+		wait, ok := r.acquireSlot()
+		if !ok {
+			return
+		}
+		wg.Add(1)
+		r.activeWorkers.Add(1)
+		go func() {
+			defer func() {
+				r.releaseSlot()
+				r.activeWorkers.Add(-1)
+				wg.Done()
+			}()
+			r.sendScheduled(r.executor, r.args, req, "", wait)
+		}()
+	}
+}
+
+// sendScheduled sends req with e, using args for everything the request doesn't set, and
+// records the result as sent to target, after it queued for wait for a subprocess.
+func (r *Run) sendScheduled(e Executor, args Config, req ScheduledRequest, target string, wait time.Duration) {
+	args = r.txArgs(req.Mode, req.Package, req.requestArgs(args))
+	request := e.Describe(req.Mode, req.Package, args)
+	start := time.Now()
+	out, timing, err := e.Execute(req.Mode, req.Package, args)
+	duration := max(time.Since(start)-args.Overhead, 0)
+	var verr error
+	if err != nil {
+		fmt.Println("WARNING: Errors executing request: ", err)
+	} else if verr = checkResponse(r.rules, req.Mode, out); verr != nil {
+		fmt.Println("WARNING: Invalid response: ", verr)
+	}
+	r.recordRequest(ExecutionLog{
+		Start:        start,
+		Timestamp:    time.Now(),
+		ResponseTime: duration,
+		HTTP:         timing,
+		QueueWait:    wait,
+		Success:      err == nil,
+		Valid:        err == nil && verr == nil,
+		ErrorCode:    classifyError(out, err, verr),
+		Target:       target,
+		Fingerprint:  fingerprint(request),
+	}, req.Mode, out, captureSection(request, out, err))
+}
@@ -0,0 +1,149 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SaturatedCPU is the share of the machine's CPU above which the profiler is considered
+// to be saturating it, making its results suspect.
+const SaturatedCPU = 0.9
+
+// resourceInterval is how often the profiler samples its own resource usage.
+const resourceInterval = 5 * time.Second
+
+// ResourceUsage is what the profiler itself used during a run. CPU is that of the process
+// and the commands it spawned, as a share of every core of the machine.
+type ResourceUsage struct {
+	MeanCPU   float64
+	PeakCPU   float64
+	PeakRSS   int64 // bytes of resident memory
+	Samples   int
+	Saturated int // samples above SaturatedCPU
+}
+
+type resourceMonitor struct {
+	mu      sync.Mutex
+	usage   ResourceUsage
+	sumCPU  float64
+	lastCPU time.Duration
+	last    time.Time
+}
+
+// sample records the resource usage since the previous sample, returning the CPU share
+// and whether it could be measured.
+func (m *resourceMonitor) sample(now time.Time, cpu time.Duration, cpuOK bool, rss int64) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.PeakRSS = max(m.usage.PeakRSS, rss)
+	elapsed := now.Sub(m.last)
+	previous := m.lastCPU
+	m.last, m.lastCPU = now, cpu
+	if !cpuOK || previous == 0 || elapsed <= 0 {
+		return 0, false
+	}
+	share := float64(cpu-previous) / float64(elapsed) / float64(runtime.NumCPU())
+	m.usage.Samples++
+	m.sumCPU += share
+	m.usage.MeanCPU = m.sumCPU / float64(m.usage.Samples)
+	m.usage.PeakCPU = max(m.usage.PeakCPU, share)
+	if share > SaturatedCPU {
+		m.usage.Saturated++
+	}
+	return share, true
+}
+
+// monitorResources samples the profiler's own CPU and memory until the run stops, and
+// warns when the machine's CPU is saturated.
+func (r *Run) monitorResources() {
+	cpu, ok := processCPU()
+	r.resources.sample(time.Now(), cpu, ok, residentMemory())
+	ticker := time.NewTicker(resourceInterval)
+	defer ticker.Stop()
+	saturated := false
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			cpu, ok := processCPU()
+			rss := residentMemory()
+			share, measured := r.resources.sample(now, cpu, ok, rss)
+			r.watchMemory(rss)
+			if measured && share > SaturatedCPU && !saturated {
+				fmt.Printf("WARNING: The profiler is using %.0f%% of this machine's CPU; latencies may include its own queuing\n", 100*share)
+			}
+			saturated = measured && share > SaturatedCPU
+		}
+	}
+}
+
+// memoryWarning is the share of -memoryLimit at which the watchdog starts warning.
+const memoryWarning = 0.8
+
+// watchMemory warns when the profiler's resident memory nears -memoryLimit, and once it
+// crosses it stops keeping samples in memory, leaving only the aggregate summary and the
+// results file, rather than risk being killed for running out of memory.
+func (r *Run) watchMemory(rss int64) {
+	limit := r.args.MemoryLimit
+	if limit <= 0 || r.degraded.Load() {
+		return
+	}
+	switch {
+	case rss > limit:
+		fmt.Printf("WARNING: Using %s of memory, over -memoryLimit; keeping only aggregate stats from now on (the results file still gets every sample)\n", FormatSize(float64(rss)))
+		r.degraded.Store(true)
+	case rss > int64(memoryWarning*float64(limit)) && !r.memoryWarned:
+		fmt.Printf("WARNING: Using %s of memory, %.0f%% of -memoryLimit\n", FormatSize(float64(rss)), 100*float64(rss)/float64(limit))
+		r.memoryWarned = true
+	}
+}
+
+// Resources returns the profiler's own resource usage so far.
+func (r *Run) Resources() ResourceUsage {
+	r.resources.mu.Lock()
+	defer r.resources.mu.Unlock()
+	return r.resources.usage
+}
+
+// residentMemory returns the resident memory of the process, or the memory the Go
+// runtime got from the OS where that isn't available.
+func residentMemory() int64 {
+	if file, err := os.Open("/proc/self/status"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:"); ok {
+				kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+				if err == nil {
+					return kb << 10
+				}
+			}
+		}
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.Sys)
+}
+
+// WriteResources prints the profiler's own resource usage, warning if it saturated the
+// machine.
+func WriteResources(w io.Writer, usage ResourceUsage) {
+	if usage.Samples == 0 && usage.PeakRSS == 0 {
+		return
+	}
+	if usage.Samples > 0 {
+		fmt.Fprintf(w, "Profiler CPU:      %.0f%% mean, %.0f%% peak of %d cores\n", 100*usage.MeanCPU, 100*usage.PeakCPU, runtime.NumCPU())
+	}
+	fmt.Fprintf(w, "Profiler memory:   %s peak resident\n", FormatSize(float64(usage.PeakRSS)))
+	if usage.Saturated > 0 {
+		fmt.Fprintf(w, "WARNING: The profiler saturated this machine's CPU in %d of %d samples; results may reflect the generator rather than the node\n", usage.Saturated, usage.Samples)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package profiler
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPU returns the CPU time used by the process and the commands it has spawned,
+// such as gnokey.
+func processCPU() (time.Duration, bool) {
+	var total time.Duration
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var usage syscall.Rusage
+		if err := syscall.Getrusage(who, &usage); err != nil {
+			return 0, false
+		}
+		total += time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	}
+	return total, true
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package profiler
+
+import "time"
+
+// processCPU isn't implemented on Windows.
+func processCPU() (time.Duration, bool) {
+	return 0, false
+}
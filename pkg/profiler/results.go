@@ -0,0 +1,477 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var csvHeader = []string{
+	"Timestamp", "ResponseTime", "DNS", "Connect", "TLSHandshake", "TTFB", "Transfer",
+	"Success", "Valid", "ErrorCode", "Warmup", "ActiveWorkers", "Agent", "Capture",
+	"Step", "Target", "Height", "GasUsed", "Mode", "Fee", "GasWanted", "GasFee", "Fault", "PkgSize", "ArgSize", "TxHash", "Sent", "TargetQPS", "Start", "Fingerprint", "RunID", "ResponseSize", "Cache", "Worker", "Fields", "QueueWait",
+}
+
+// ResultsWriter appends results to the CSV file as they come in, so that periodic
+// checkpoints only write the rows recorded since the previous one.
+type ResultsWriter struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	gz      *gzip.Writer // nil unless the file is compressed
+	writer  *csv.Writer
+	written int
+	rewrite bool
+	rotate  *rotation // nil unless the file is rotated
+	closed  bool
+}
+
+func newResultsWriter(path string, file *os.File) *ResultsWriter {
+	w := &ResultsWriter{path: path}
+	w.use(file)
+	return w
+}
+
+// use makes w write to file, gzipped if w.path ends in .gz.
+func (w *ResultsWriter) use(file *os.File) {
+	w.file = file
+	if strings.HasSuffix(w.path, ".gz") {
+		w.gz = gzip.NewWriter(file)
+		w.writer = csv.NewWriter(w.gz)
+	} else {
+		w.writer = csv.NewWriter(file)
+	}
+}
+
+// OpenResults creates the results file, or with resume appends to an existing one and
+// returns the rows already in it. Results are gzipped if path ends in .gz.
+func OpenResults(path string, resume bool) (*ResultsWriter, []ExecutionLog, error) {
+	compress := strings.HasSuffix(path, ".gz")
+	if !resume || compress {
+		// A gzip stream cut short by a crash can't be appended to, so resuming a
+		// compressed file writes the previous rows again into a new one.
+		var previous []ExecutionLog
+		if resume {
+			var err error
+			if previous, err = LoadResults(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, fmt.Errorf("%w to resume", err)
+			}
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		w := newResultsWriter(path, file)
+		w.writer.Write(csvHeader)
+		for _, log := range previous {
+			w.writer.Write(logRecord(log))
+		}
+		w.written = len(previous)
+		return w, previous, w.flush()
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous, err := ReadLogs(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("reading %s to resume: %w", path, err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	w := newResultsWriter(path, file)
+	w.written = len(previous)
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		w.writer.Write(csvHeader)
+		w.writer.Flush()
+	}
+	return w, previous, w.writer.Error()
+}
+
+// Rewrite makes every Flush replace the rows in the file, for runs whose logs aren't only
+// appended to, such as ones with -reservoir.
+func (w *ResultsWriter) Rewrite() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rewrite = true
+}
+
+// Rotate makes every Flush move the file aside once it holds maxSize bytes or was started
+// every ago, to path-0001.csv and so on, and start a new one. Either may be 0 to only
+// rotate on the other.
+func (w *ResultsWriter) Rotate(maxSize int64, every time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rotate = newRotation(maxSize, every)
+}
+
+// Flush writes the rows of logs that haven't been written yet. logs must start with
+// every row flushed before, unless the writer rewrites the file.
+func (w *ResultsWriter) Flush(logs []ExecutionLog) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	if w.rewrite {
+		if err := w.file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if w.gz != nil {
+			w.gz.Reset(w.file)
+		}
+		w.writer.Write(csvHeader)
+		w.written = 0
+	}
+	for _, log := range logs[min(w.written, len(logs)):] {
+		w.writer.Write(logRecord(log))
+	}
+	w.written = max(w.written, len(logs))
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.rotate == nil {
+		return nil
+	}
+	if info, err := w.file.Stat(); err == nil {
+		w.rotate.size = info.Size()
+	}
+	if now := time.Now(); w.rotate.due(now) {
+		w.rotate.next(now)
+		return w.startNext()
+	}
+	return nil
+}
+
+// drop forgets the first n rows written, for when the caller stops passing them to Flush.
+func (w *ResultsWriter) drop(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = max(w.written-n, 0)
+}
+
+// startNext moves the finished file aside and starts a new one. w.mu must be held.
+func (w *ResultsWriter) startNext() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.path, rotatedName(w.path, w.rotate.n)); err != nil {
+		return err
+	}
+	file, err := os.Create(w.path)
+	if err != nil {
+		return err
+	}
+	w.use(file)
+	w.writer.Write(csvHeader)
+	return w.flush()
+}
+
+// flush writes out everything buffered, so that the file is readable up to here even if
+// the run crashes. w.mu must be held.
+func (w *ResultsWriter) flush() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.file.Sync()
+}
+
+// Close finishes the file. Flushing does nothing after it, e.g. for a last checkpoint
+// racing with the end of the run.
+func (w *ResultsWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.finish()
+}
+
+// finish flushes and closes the current file. w.mu must be held.
+func (w *ResultsWriter) finish() error {
+	if err := w.flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	return w.file.Close()
+}
+
+// Checkpoint calls save with the logs so far every -checkpoint and every
+// -checkpointRequests requests until the run stops, so that a crash late in a long run
+// loses little.
+func (r *Run) Checkpoint(save func(logs []ExecutionLog)) {
+	if r.args.Checkpoint == 0 && r.args.CheckpointRequests == 0 {
+		return
+	}
+	var tick <-chan time.Time
+	if r.args.Checkpoint > 0 {
+		ticker := time.NewTicker(r.args.Checkpoint)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-r.flush:
+		case <-r.done:
+			return
+		}
+		save(r.Logs())
+	}
+}
+
+// LoadResults reads a results file written by a run, gzipped or not.
+func LoadResults(path string) ([]ExecutionLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	logs, err := ReadLogs(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return logs, nil
+}
+
+// AppendResults appends logs to the results file at path, creating it with a header if
+// it doesn't exist, without reading what is already in it. A compressed file gets
+// another gzip member, which readers take as the continuation of the same stream.
+func AppendResults(path string, logs []ExecutionLog) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w := newResultsWriter(path, file)
+	if info.Size() == 0 {
+		w.writer.Write(csvHeader)
+	}
+	for _, log := range logs {
+		w.writer.Write(logRecord(log))
+	}
+	return w.Close()
+}
+
+// WriteLogs writes logs as CSV, header included.
+func WriteLogs(w io.Writer, logs []ExecutionLog) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	for _, log := range logs {
+		writer.Write(logRecord(log))
+		writer.Flush()
+	}
+	return writer.Error()
+}
+
+func logRecord(log ExecutionLog) []string {
+	return []string{
+		log.Timestamp.Format(time.RFC3339Nano),
+		formatSeconds(log.ResponseTime),
+		formatSeconds(log.HTTP.DNS),
+		formatSeconds(log.HTTP.Connect),
+		formatSeconds(log.HTTP.TLSHandshake),
+		formatSeconds(log.HTTP.TTFB),
+		formatSeconds(log.HTTP.Transfer),
+		strconv.FormatBool(log.Success),
+		strconv.FormatBool(log.Valid),
+		log.ErrorCode,
+		strconv.FormatBool(log.Warmup),
+		strconv.Itoa(log.ActiveWorkers),
+		log.Agent,
+		log.Capture,
+		log.Step,
+		log.Target,
+		strconv.FormatInt(log.Height, 10),
+		strconv.FormatInt(log.GasUsed, 10),
+		log.Mode,
+		strconv.FormatInt(log.Fee, 10),
+		strconv.FormatInt(log.GasWanted, 10),
+		strconv.FormatInt(log.GasFee, 10),
+		log.Fault,
+		strconv.FormatInt(log.PkgSize, 10),
+		strconv.FormatInt(log.ArgSize, 10),
+		log.TxHash,
+		strconv.FormatInt(log.Sent, 10),
+		strconv.FormatFloat(log.TargetQPS, 'f', -1, 64),
+		formatTime(log.Start),
+		log.Fingerprint,
+		log.RunID,
+		strconv.FormatInt(log.ResponseSize, 10),
+		log.Cache,
+		log.Worker,
+		formatFields(log.Fields),
+		formatSeconds(log.QueueWait),
+	}
+}
+
+// formatSeconds writes d in seconds to the nanosecond, e.g. 0.012345678.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 9, 64)
+}
+
+// formatTime writes t to the nanosecond, or nothing if it is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseSeconds parses seconds written by formatSeconds, or with fewer decimals by older
+// versions, without the rounding error of going through a float64.
+func parseSeconds(s string) (time.Duration, error) {
+	return time.ParseDuration(s + "s")
+}
+
+// ReadLogs parses results written by WriteLogs, decompressing them if they are gzipped.
+// Columns are looked up by name, so files from older versions with fewer columns can
+// still be read.
+func ReadLogs(r io.Reader) ([]ExecutionLog, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	if _, ok := columns["ResponseTime"]; !ok {
+		return nil, fmt.Errorf("missing ResponseTime column")
+	}
+
+	var logs []ExecutionLog
+	for line, record := range records[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		seconds := func(name string) time.Duration {
+			d, _ := parseSeconds(field(name))
+			return d
+		}
+
+		var log ExecutionLog
+		if log.Timestamp, err = time.Parse(time.RFC3339Nano, field("Timestamp")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+2, err)
+		}
+		log.ResponseTime = seconds("ResponseTime")
+		log.QueueWait = seconds("QueueWait")
+		log.HTTP = HTTPTiming{
+			DNS:          seconds("DNS"),
+			Connect:      seconds("Connect"),
+			TLSHandshake: seconds("TLSHandshake"),
+			TTFB:         seconds("TTFB"),
+			Transfer:     seconds("Transfer"),
+		}
+		// Files from before these columns existed only recorded successes
+		log.Success = field("Success") != "false"
+		log.Valid = field("Valid") != "false"
+		log.ErrorCode = field("ErrorCode")
+		log.Warmup = field("Warmup") == "true"
+		log.ActiveWorkers, _ = strconv.Atoi(field("ActiveWorkers"))
+		log.Agent = field("Agent")
+		log.Capture = field("Capture")
+		log.Step = field("Step")
+		log.Target = field("Target")
+		log.Height, _ = strconv.ParseInt(field("Height"), 10, 64)
+		log.GasUsed, _ = strconv.ParseInt(field("GasUsed"), 10, 64)
+		log.Mode = field("Mode")
+		log.Fee, _ = strconv.ParseInt(field("Fee"), 10, 64)
+		log.GasWanted, _ = strconv.ParseInt(field("GasWanted"), 10, 64)
+		log.GasFee, _ = strconv.ParseInt(field("GasFee"), 10, 64)
+		log.Fault = field("Fault")
+		log.PkgSize, _ = strconv.ParseInt(field("PkgSize"), 10, 64)
+		log.ArgSize, _ = strconv.ParseInt(field("ArgSize"), 10, 64)
+		log.TxHash = field("TxHash")
+		log.Sent, _ = strconv.ParseInt(field("Sent"), 10, 64)
+		log.TargetQPS, _ = strconv.ParseFloat(field("TargetQPS"), 64)
+		log.Fingerprint = field("Fingerprint")
+		log.RunID = field("RunID")
+		log.ResponseSize, _ = strconv.ParseInt(field("ResponseSize"), 10, 64)
+		log.Cache = field("Cache")
+		log.Worker = field("Worker")
+		log.Fields = parseFieldsColumn(field("Fields"))
+		if start := field("Start"); start != "" {
+			if log.Start, err = time.Parse(time.RFC3339Nano, start); err != nil {
+				return nil, fmt.Errorf("line %d: invalid start time: %w", line+2, err)
+			}
+		}
+		logs = append(logs, log)
+	}
+	return logs, nil
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns r, ungzipped if it starts like a gzip stream.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return unfinishedGzip{gz}, nil
+}
+
+// unfinishedGzip reads a gzip stream that may not have been closed, like the results of
+// a run that crashed or is still going. Everything flushed before the end is read.
+type unfinishedGzip struct {
+	*gzip.Reader
+}
+
+func (r unfinishedGzip) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,44 @@
+package profiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// rotation decides when a long run moves on to a new results file or capture directory,
+// after -rotateSize bytes or -rotateEvery, whichever comes first.
+type rotation struct {
+	maxSize int64
+	every   time.Duration
+	n       int   // rotations so far, which number the files
+	size    int64 // bytes in the current file
+	start   time.Time
+}
+
+func newRotation(maxSize int64, every time.Duration) *rotation {
+	return &rotation{maxSize: maxSize, every: every, start: time.Now()}
+}
+
+func (r *rotation) due(now time.Time) bool {
+	return r.maxSize > 0 && r.size >= r.maxSize || r.every > 0 && now.Sub(r.start) >= r.every
+}
+
+func (r *rotation) next(now time.Time) {
+	r.n++
+	r.size = 0
+	r.start = now
+}
+
+// rotatedName returns the name of the nth file rotated out of path, e.g. pc_profiler-0001.csv
+// for pc_profiler.csv, or pc_profiler-0001.csv.gz for pc_profiler.csv.gz.
+func rotatedName(path string, n int) string {
+	base, gz := strings.CutSuffix(path, ".gz")
+	ext := filepath.Ext(base)
+	name := fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(base, ext), n, ext)
+	if gz {
+		name += ".gz"
+	}
+	return name
+}
@@ -0,0 +1,165 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// HTTPTiming is the breakdown of a single RPC request. Phases that did not happen
+// (e.g. DNS and connect on a reused keep-alive connection) are left at zero.
+type HTTPTiming struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	TTFB         time.Duration // from writing the request to the first response byte
+	Transfer     time.Duration // from the first response byte to the end of the body
+}
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Params  map[string]string `json:"params"`
+}
+
+type rpcResponse struct {
+	Result struct {
+		Response struct {
+			ResponseBase struct {
+				Error json.RawMessage
+				Data  []byte
+				Log   string
+			}
+		} `json:"response"`
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+var rpcClient = &http.Client{Timeout: 30 * time.Second}
+
+// httpURL turns a gnokey style address ("localhost:26657") into an HTTP URL.
+func httpURL(remote string) string {
+	if strings.HasPrefix(remote, "http://") || strings.HasPrefix(remote, "https://") {
+		return remote
+	}
+	return "http://" + remote
+}
+
+// generateQuery returns the ABCI query path and data that the rpc backend sends for the
+// given mode, mirroring what GenerateCommand asks gnokey to do. renderPath is passed to
+// Render in qrender mode.
+func generateQuery(mode, packageName, renderPath string) (string, []byte) {
+	switch mode {
+	case "balanceQuery":
+		return "bank/balances/" + BalanceAddress, nil
+	case "qrender":
+		return "vm/qrender", []byte(packageName + ":" + renderPath)
+	case "qdoc":
+		return "vm/qdoc", []byte(packageName)
+	}
+	panic("Invalid mode for rpc backend")
+}
+
+// queryBody returns the JSON-RPC request that executeQuery sends.
+func queryBody(path string, data []byte) ([]byte, error) {
+	return json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      "realm-profiler",
+		Method:  "abci_query",
+		Params: map[string]string{
+			"path": path,
+			// amino expects []byte params as base64
+			"data": base64.StdEncoding.EncodeToString(data),
+		},
+	})
+}
+
+// executeQuery sends an abci_query straight to the node's JSON-RPC endpoint, bypassing
+// gnokey, and traces where the time went. It gives up after timeout, unless that is 0,
+// or the 30 seconds of rpcClient.
+func executeQuery(remote, path string, data []byte, timeout time.Duration) ([]byte, HTTPTiming, error) {
+	var timing HTTPTiming
+
+	body, err := queryBody(path, data)
+	if err != nil {
+		return nil, timing, err
+	}
+
+	var dnsStart, connectStart, tlsStart, wroteRequest, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { timing.DNS = time.Since(dnsStart) },
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			timing.Connect = time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timing.TLSHandshake = time.Since(tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+			timing.TTFB = firstByte.Sub(wroteRequest)
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, httpURL(remote), bytes.NewReader(body))
+	if err != nil {
+		return nil, timing, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	ctx := httptrace.WithClientTrace(req.Context(), trace)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := rpcClient.Do(req)
+	if err != nil {
+		return nil, timing, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if !firstByte.IsZero() {
+		timing.Transfer = time.Since(firstByte)
+	}
+	if err != nil {
+		return nil, timing, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, timing, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	var decoded rpcResponse
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, timing, fmt.Errorf("decoding RPC response: %w", err)
+	}
+	if decoded.Error != nil {
+		return nil, timing, fmt.Errorf("RPC error %d: %s %s", decoded.Error.Code, decoded.Error.Message, decoded.Error.Data)
+	}
+	base := decoded.Result.Response.ResponseBase
+	if len(base.Error) > 0 && string(base.Error) != "null" {
+		return base.Data, timing, errors.New(strings.TrimSpace(base.Log))
+	}
+	return base.Data, timing, nil
+}
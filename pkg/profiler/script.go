@@ -0,0 +1,357 @@
+package profiler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Script is the per-iteration logic of -mode script: every worker runs it from the top
+// once per request slot. A script is one statement per line; blank lines and lines
+// starting with # are ignored.
+//
+//	let NAME VALUE           set a variable (VALUE is the rest of the line)
+//	pick NAME CHOICE...      set a variable to one of the choices at random
+//	chance P STATEMENT       run STATEMENT with probability P, e.g. chance 0.1 qrender $pkg
+//	addpkg [PACKAGE]         deploy -pkgdir, under a random name if PACKAGE is omitted
+//	call PACKAGE FUNCTION [ARG...]
+//	qrender PACKAGE
+//	qdoc PACKAGE
+//	balanceQuery
+//	expect TEXT              the previous request's response must contain TEXT
+//	expectRegex REGEX        the previous request's response must match REGEX (not expanded)
+//
+// $NAME and ${NAME} are replaced by variables, and by the built-ins $iteration (the
+// worker's iteration, from 1), $random (a fresh random name each time it is used) and
+// $package (the package path of the last request). Every request is recorded as its own
+// result, and fails validation if it doesn't meet the expect lines after it.
+type Script struct {
+	statements []scriptStatement
+}
+
+type scriptStatement struct {
+	line   int
+	op     string
+	step   string   // recorded in the Step column, for requests
+	words  []string // arguments, before variable expansion
+	text   string   // the rest of the line, for let
+	chance float64  // probability the statement runs, 1 unless prefixed by chance
+	rules  []validationRule
+}
+
+// scriptRequests are the script statements that send a request, with the number of
+// arguments each takes (-1 for any number from the minimum).
+var scriptRequests = map[string]struct{ min, max int }{
+	"addpkg":       {0, 1},
+	"call":         {2, -1},
+	"qrender":      {1, 1},
+	"qdoc":         {1, 1},
+	"balanceQuery": {0, 0},
+}
+
+// LoadScript parses the script at path.
+func LoadScript(path string) (*Script, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s, err := parseScript(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func parseScript(r io.Reader) (*Script, error) {
+	s := &Script{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		keyword, rest, _ := strings.Cut(text, " ")
+		rest = strings.TrimSpace(rest)
+		if keyword == "expect" || keyword == "expectRegex" {
+			n := len(s.statements)
+			if n == 0 || !isScriptRequest(s.statements[n-1].op) {
+				return nil, fmt.Errorf("line %d: %s must follow a request", line, keyword)
+			}
+			rule := validationRule{substring: rest}
+			if keyword == "expectRegex" {
+				re, err := regexp.Compile(rest)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid regex: %w", line, err)
+				}
+				rule = validationRule{pattern: re}
+			}
+			s.statements[n-1].rules = append(s.statements[n-1].rules, rule)
+			continue
+		}
+		st, err := parseStatement(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		st.line = line
+		if isScriptRequest(st.op) {
+			st.step = fmt.Sprintf("%d:%s", s.Requests()+1, st.op)
+		}
+		s.statements = append(s.statements, st)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if s.Requests() == 0 {
+		return nil, errors.New("script sends no requests")
+	}
+	return s, nil
+}
+
+func parseStatement(text string) (scriptStatement, error) {
+	words := strings.Fields(text)
+	st := scriptStatement{op: words[0], words: words[1:], chance: 1}
+	switch st.op {
+	case "let":
+		if len(st.words) < 1 {
+			return st, errors.New("let needs a variable name")
+		}
+		_, st.text, _ = strings.Cut(strings.TrimSpace(strings.TrimPrefix(text, "let")), st.words[0])
+		st.text = strings.TrimSpace(st.text)
+	case "pick":
+		if len(st.words) < 2 {
+			return st, errors.New("pick needs a variable name and at least one choice")
+		}
+	case "chance":
+		if len(st.words) < 2 {
+			return st, errors.New("chance needs a probability and a statement")
+		}
+		p, err := strconv.ParseFloat(st.words[0], 64)
+		if err != nil || p < 0 || p > 1 {
+			return st, fmt.Errorf("chance probability must be between 0 and 1, got %q", st.words[0])
+		}
+		_, inner, _ := strings.Cut(strings.TrimPrefix(text, "chance"), st.words[0])
+		inner = strings.TrimSpace(inner)
+		if strings.HasPrefix(inner, "expect") {
+			return st, errors.New("expect cannot be made conditional; it applies whenever its request runs")
+		}
+		nested, err := parseStatement(inner)
+		if err != nil {
+			return st, err
+		}
+		nested.chance *= p
+		return nested, nil
+	default:
+		n, ok := scriptRequests[st.op]
+		if !ok {
+			return st, fmt.Errorf("unknown statement %q", st.op)
+		}
+		if len(st.words) < n.min || (n.max >= 0 && len(st.words) > n.max) {
+			return st, fmt.Errorf("wrong number of arguments to %s", st.op)
+		}
+	}
+	return st, nil
+}
+
+func isScriptRequest(op string) bool {
+	_, ok := scriptRequests[op]
+	return ok
+}
+
+// Requests returns the number of request statements in the script.
+func (s *Script) Requests() int {
+	n := 0
+	for _, st := range s.statements {
+		if isScriptRequest(st.op) {
+			n++
+		}
+	}
+	return n
+}
+
+// scriptVars are the variables of one iteration of a script.
+type scriptVars struct {
+	args  Config
+	vars  map[string]string
+	names *nameRegistry // draws $random and addpkg names, nil in dry runs
+	err   error         // set when names has run out of unused names
+}
+
+func newScriptVars(args Config, iteration int, names *nameRegistry) *scriptVars {
+	v := &scriptVars{args: args, vars: map[string]string{"iteration": strconv.Itoa(iteration)}, names: names}
+	if args.PackageName != "" {
+		v.vars["package"] = pkgPath(args, args.PackageName)
+	}
+	return v
+}
+
+func (v *scriptVars) expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "random" {
+			return v.newName()
+		}
+		return v.vars[name]
+	})
+}
+
+// newName returns a package name not used before in the run or -namesFile.
+func (v *scriptVars) newName() string {
+	if v.names == nil {
+		return randomPackageName(v.args)
+	}
+	name, err := v.names.newName(v.args)
+	if err != nil {
+		v.err = err
+	}
+	return name
+}
+
+func (v *scriptVars) expandAll(words []string) []string {
+	expanded := make([]string, len(words))
+	for i, w := range words {
+		expanded[i] = v.expand(w)
+	}
+	return expanded
+}
+
+// expandRules expands the variables in expect rules. Regexes are left alone, since $ is
+// meaningful in them.
+func (v *scriptVars) expandRules(rules []validationRule) []validationRule {
+	expanded := make([]validationRule, len(rules))
+	for i, rule := range rules {
+		if rule.pattern == nil {
+			rule.substring = v.expand(rule.substring)
+		}
+		expanded[i] = rule
+	}
+	return expanded
+}
+
+// scriptRequest resolves a request statement to the mode, package name and args the
+// executor is called with.
+func scriptRequest(st scriptStatement, v *scriptVars) (string, string, Config) {
+	words := v.expandAll(st.words)
+	args := v.args
+	name := ""
+	switch st.op {
+	case "addpkg":
+		if len(words) > 0 {
+			name = words[0]
+		} else {
+			name = v.newName()
+		}
+	case "call":
+		name = words[0]
+		args.FunctionName = words[1]
+		args.CallArgs = words[2:]
+	case "qrender", "qdoc":
+		name = words[0]
+	}
+	return st.op, name, args
+}
+
+// runScript runs one iteration of the script, recording every request it sends.
+func (r *Run) runScript(iteration int, firstLoop bool) {
+	// Every request of an iteration goes to the same remote, so that e.g. a call finds
+	// the package its addpkg deployed
+	v := newScriptVars(r.withRemote(r.args), iteration, r.names)
+	for _, st := range r.script.statements {
+		if r.stopped() {
+			return
+		}
+		if st.chance < 1 && randomFloat64() >= st.chance {
+			continue
+		}
+		switch st.op {
+		case "let":
+			v.vars[st.words[0]] = v.expand(st.text)
+			continue
+		case "pick":
+			choices := v.expandAll(st.words[1:])
+			v.vars[st.words[0]] = choices[randomIntn(len(choices))]
+			continue
+		}
+
+		mode, name, args := scriptRequest(st, v)
+		if v.err != nil {
+			fmt.Println("WARNING: Stopping the run:", v.err)
+			r.Stop()
+			return
+		}
+		if mode != "balanceQuery" {
+			v.vars["package"] = pkgPath(args, name)
+		}
+		args = r.txArgs(mode, name, args)
+		request := r.executor.Describe(mode, name, args)
+		if firstLoop {
+			fmt.Println("INFO: Executing", request)
+		}
+
+		wait, ok := r.acquireSlot()
+		if !ok {
+			return
+		}
+		start := time.Now()
+		out, timing, err := r.executor.Execute(mode, name, args)
+		r.releaseSlot()
+		duration := max(time.Since(start)-args.Overhead, 0)
+		var verr error
+		if err != nil {
+			fmt.Println("WARNING: Errors executing request: ", err)
+		} else if verr = checkResponse(r.rules, mode, out); verr == nil {
+			verr = checkResponse(v.expandRules(st.rules), mode, out)
+		}
+		if verr != nil {
+			fmt.Printf("WARNING: Invalid response (script line %d): %v\n", st.line, verr)
+		} else if err == nil && mode == "addpkg" && r.deployed != nil {
+			if txHash, height, ok := parseTxResult(out); ok {
+				r.deployed.add(pkgPath(args, name), txHash, height)
+			}
+		}
+
+		r.recordRequest(ExecutionLog{
+			Start:        start,
+			Timestamp:    time.Now(),
+			ResponseTime: duration,
+			HTTP:         timing,
+			QueueWait:    wait,
+			Success:      err == nil,
+			Valid:        err == nil && verr == nil,
+			ErrorCode:    classifyError(out, err, verr),
+			Step:         st.step,
+			Target:       r.target(args),
+			Fingerprint:  fingerprint(request),
+		}, mode, out, captureSection(request, out, err))
+	}
+}
+
+// writeScriptDryRun writes the requests of the first iteration of a script, showing every
+// request whatever its chance of running.
+func writeScriptDryRun(w io.Writer, e Executor, s *Script, args Config) {
+	v := newScriptVars(args, 1, nil)
+	for _, st := range s.statements {
+		switch st.op {
+		case "let":
+			v.vars[st.words[0]] = v.expand(st.text)
+			continue
+		case "pick":
+			fmt.Fprintf(w, "# %s picked from %s\n", st.words[0], strings.Join(st.words[1:], " "))
+			v.vars[st.words[0]] = v.expand(st.words[1])
+			continue
+		}
+		mode, name, reqArgs := scriptRequest(st, v)
+		if mode != "balanceQuery" {
+			v.vars["package"] = pkgPath(reqArgs, name)
+		}
+		if st.chance < 1 {
+			fmt.Fprintf(w, "# with probability %g:\n", st.chance)
+		}
+		fmt.Fprintln(w, e.Describe(mode, name, reqArgs))
+	}
+}
@@ -0,0 +1,87 @@
+package profiler
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSlowOutput is how much of a slow request's output is kept.
+const maxSlowOutput = 16 << 10
+
+// SlowRequest is one of the -slowest requests of a run, with what it sent and got back.
+type SlowRequest struct {
+	Timestamp    time.Time
+	ResponseTime time.Duration
+	Mode         string
+	Height       int64  `json:",omitempty"` // block the transaction was committed in
+	ErrorCode    string `json:",omitempty"`
+	Output       string // the command or request, its stdout and its stderr
+}
+
+// slowestList keeps the n slowest requests, slowest first.
+type slowestList struct {
+	n        int
+	requests []SlowRequest
+}
+
+// qualifies reports whether a request taking d would make the list.
+func (l *slowestList) qualifies(d time.Duration) bool {
+	return l.n > 0 && (len(l.requests) < l.n || d > l.requests[len(l.requests)-1].ResponseTime)
+}
+
+func (l *slowestList) add(req SlowRequest) {
+	i := sort.Search(len(l.requests), func(i int) bool { return l.requests[i].ResponseTime < req.ResponseTime })
+	l.requests = append(l.requests, SlowRequest{})
+	copy(l.requests[i+1:], l.requests[i:])
+	l.requests[i] = req
+	if len(l.requests) > l.n {
+		l.requests = l.requests[:l.n]
+	}
+}
+
+// recordRequest records the result of a request in mode, writing its raw output to
+// -captureDir and keeping it if it is one of the -slowest.
+func (r *Run) recordRequest(log ExecutionLog, mode, out string, sections ...string) {
+	log.Capture = r.capture(sections...)
+	log.Mode = mode
+	if isQueryMode(mode) {
+		log.ResponseSize = int64(len(out))
+	}
+	log.Fields = r.parseFields(mode, out)
+	// Transaction fields are parsed from the sections of output, or from out
+	txSections := sections
+	if len(txSections) == 0 {
+		txSections = []string{out}
+	}
+	tx := parseTxMetrics(txSections...)
+	log.Height, log.GasUsed, log.Fee, log.GasWanted, log.GasFee = tx.height, tx.gasUsed, tx.fee, tx.gasWanted, tx.gasFee
+	log.TxHash, log.Sent = strings.Join(tx.txHashes, " "), tx.sent
+	r.record(log)
+
+	r.slowMutex.Lock()
+	defer r.slowMutex.Unlock()
+	if log.Warmup || !r.slowest.qualifies(log.ResponseTime) {
+		return
+	}
+	output := strings.Join(sections, "\n")
+	if len(output) > maxSlowOutput {
+		output = output[:maxSlowOutput] + "\n[truncated]"
+	}
+	r.slowest.add(SlowRequest{
+		Timestamp:    log.Timestamp,
+		ResponseTime: log.ResponseTime,
+		Mode:         mode,
+		Height:       log.Height,
+		ErrorCode:    log.ErrorCode,
+		Output:       output,
+	})
+}
+
+// Slowest returns the -slowest requests recorded so far, slowest first.
+func (r *Run) Slowest() []SlowRequest {
+	r.slowMutex.Lock()
+	defer r.slowMutex.Unlock()
+	return slices.Clone(r.slowest.requests)
+}
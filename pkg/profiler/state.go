@@ -0,0 +1,194 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// StateGrowthWarning is how much slower at the median transactions may get from the
+// first interval of -stateInterval to the last before it is reported as degradation.
+const StateGrowthWarning = 0.2
+
+// StateSample is a proxy for how much state the chain holds at a point of a run: its
+// height, the transactions it has committed since genesis and its app hash.
+type StateSample struct {
+	Time     time.Time
+	Height   int64
+	TotalTxs int64
+	AppHash  string
+}
+
+// nodeState asks the node's JSON-RPC endpoint for its latest block.
+func nodeState(remote string) (StateSample, error) {
+	var status struct {
+		SyncInfo struct {
+			Height  int64  `json:"latest_block_height,string"`
+			AppHash string `json:"latest_app_hash"`
+		} `json:"sync_info"`
+	}
+	if err := callRPC(remote, "status", map[string]string{}, &status); err != nil {
+		return StateSample{}, err
+	}
+	var block struct {
+		BlockMeta struct {
+			Header struct {
+				TotalTxs int64 `json:"total_txs,string"`
+			} `json:"header"`
+		} `json:"block_meta"`
+	}
+	params := map[string]string{"height": fmt.Sprint(status.SyncInfo.Height)}
+	if err := callRPC(remote, "block", params, &block); err != nil {
+		return StateSample{}, err
+	}
+	return StateSample{
+		Time:     time.Now(),
+		Height:   status.SyncInfo.Height,
+		TotalTxs: block.BlockMeta.Header.TotalTxs,
+		AppHash:  status.SyncInfo.AppHash,
+	}, nil
+}
+
+// callRPC calls method on the node's JSON-RPC endpoint and decodes its result.
+func callRPC(remote, method string, params map[string]string, result any) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: "realm-profiler", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp, err := rpcClient.Post(httpURL(remote), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	var decoded struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("decoding RPC response: %w", err)
+	}
+	if decoded.Error != nil {
+		return fmt.Errorf("RPC error: %s %s", decoded.Error.Message, decoded.Error.Data)
+	}
+	if err := json.Unmarshal(decoded.Result, result); err != nil {
+		return fmt.Errorf("decoding %s result: %w", method, err)
+	}
+	return nil
+}
+
+// monitorState samples the state of the chain every -stateInterval until the run stops.
+// Close takes the last sample.
+func (r *Run) monitorState() {
+	ticker := time.NewTicker(r.args.StateInterval)
+	defer ticker.Stop()
+	r.sampleState()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.sampleState()
+		}
+	}
+}
+
+// sampleState adds a sample of the chain's state, warning the first time it fails.
+func (r *Run) sampleState() {
+	s, err := nodeState(r.args.Remote)
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if err != nil {
+		if !r.stateWarned {
+			fmt.Println("WARNING: Failed to sample the state of the chain:", err)
+			r.stateWarned = true
+		}
+		return
+	}
+	r.state = append(r.state, s)
+}
+
+// StateSamples returns the samples of the chain's state taken with -stateInterval.
+func (r *Run) StateSamples() []StateSample {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	return append([]StateSample(nil), r.state...)
+}
+
+// StateInterval is the transactions sent between two samples of the chain's state, and
+// the state the chain had grown to by the start of it.
+type StateInterval struct {
+	From, To StateSample
+	Summary
+}
+
+// SummarizeStateGrowth splits the transactions of logs by the StateSample interval they
+// were sent in, to show latency as a function of the state accumulated on chain.
+func SummarizeStateGrowth(logs []ExecutionLog, samples []StateSample) []StateInterval {
+	if len(samples) < 2 {
+		return nil
+	}
+	byInterval := make([][]ExecutionLog, len(samples)-1)
+	for _, log := range logs {
+		if !isTxMode(log.Mode) && log.Mode != "addpkg+call" {
+			continue
+		}
+		start := log.Started()
+		for i := range byInterval {
+			if !start.Before(samples[i].Time) && start.Before(samples[i+1].Time) {
+				byInterval[i] = append(byInterval[i], log)
+				break
+			}
+		}
+	}
+	intervals := make([]StateInterval, 0, len(byInterval))
+	for i, intervalLogs := range byInterval {
+		intervals = append(intervals, StateInterval{From: samples[i], To: samples[i+1], Summary: Summarize(intervalLogs)})
+	}
+	return intervals
+}
+
+// StateGrowthSlowdown returns how much slower transactions were at the median in the
+// last interval with any than in the first, as a fraction of the first.
+func StateGrowthSlowdown(intervals []StateInterval) float64 {
+	var first, last time.Duration
+	for _, in := range intervals {
+		if in.Requests == 0 {
+			continue
+		}
+		if first == 0 {
+			first = in.P50
+		}
+		last = in.P50
+	}
+	if first == 0 {
+		return 0
+	}
+	return float64(last)/float64(first) - 1
+}
+
+// WriteStateGrowth prints the latency of transactions as the chain's state grew, and
+// warns if it degraded by StateGrowthWarning or more.
+func WriteStateGrowth(w io.Writer, intervals []StateInterval) {
+	if len(intervals) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Latency by chain state:\n  %-10s %12s %8s %8s %12s %12s\n", "height", "total txs", "requests", "errors", "p50", "p95")
+	for _, in := range intervals {
+		fmt.Fprintf(w, "  %-10d %12d %8d %8d %12v %12v\n", in.From.Height, in.From.TotalTxs, in.Requests, in.Failed+in.Invalid,
+			FormatDuration(in.P50), FormatDuration(in.P95))
+	}
+	last := intervals[len(intervals)-1].To
+	fmt.Fprintf(w, "The chain grew by %d blocks and %d transactions.\n", last.Height-intervals[0].From.Height, last.TotalTxs-intervals[0].From.TotalTxs)
+	if slowdown := StateGrowthSlowdown(intervals); slowdown >= StateGrowthWarning {
+		fmt.Fprintf(w, "WARNING: Transactions got %.0f%% slower at the median as the state grew.\n", 100*slowdown)
+	}
+}
@@ -0,0 +1,56 @@
+package profiler
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// statsdUnsafe matches what can't go in a statsd or Graphite metric name.
+var statsdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// statsdSink sends a timing and counters for every request to a statsd server over UDP,
+// e.g. a Graphite or Datadog agent, one packet per request. Losing packets is
+// acceptable, so errors are ignored.
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+// newStatsdSink sends to the statsd server at addr, naming metrics prefix.name.
+func newStatsdSink(addr, prefix string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to statsd: %w", err)
+	}
+	return &statsdSink{conn: conn, prefix: prefix}, nil
+}
+
+// observe sends, for the mode of log, prefix.<mode>.responseTime in milliseconds,
+// prefix.<mode>.requests, prefix.<mode>.errors.<code> if it failed, and the
+// prefix.activeWorkers gauge.
+func (s *statsdSink) observe(log ExecutionLog) {
+	mode := statsdName(log.Mode)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s.%s.responseTime:%.3f|ms\n", s.prefix, mode, float64(log.ResponseTime.Microseconds())/1000)
+	fmt.Fprintf(&b, "%s.%s.requests:1|c\n", s.prefix, mode)
+	if log.ErrorCode != "" {
+		fmt.Fprintf(&b, "%s.%s.errors.%s:1|c\n", s.prefix, mode, statsdName(log.ErrorCode))
+	}
+	fmt.Fprintf(&b, "%s.activeWorkers:%d|g", s.prefix, log.ActiveWorkers)
+	s.conn.Write([]byte(b.String()))
+}
+
+func (s *statsdSink) close() {
+	s.conn.Close()
+}
+
+// statsdName makes s safe to use as part of a metric name, e.g. my.query becomes
+// my_query.
+func statsdName(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return statsdUnsafe.ReplaceAllString(s, "_")
+}
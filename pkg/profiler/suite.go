@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// SuiteModes are the modes the suite subcommand can run, in the order it runs them:
+// queries first, then transactions.
+var SuiteModes = []string{"balanceQuery", "qrender", "qdoc", "call", "addpkg"}
+
+// DefaultSuiteModes returns the SuiteModes args has what it needs for: qrender, qdoc and
+// call need -package, and call also needs -function.
+func DefaultSuiteModes(args Config) []string {
+	var modes []string
+	for _, mode := range SuiteModes {
+		switch mode {
+		case "qrender", "qdoc":
+			if args.PackageName == "" {
+				continue
+			}
+		case "call":
+			if args.PackageName == "" || args.FunctionName == "" {
+				continue
+			}
+		}
+		modes = append(modes, mode)
+	}
+	return modes
+}
+
+// SuiteArgs returns args for running mode as part of a suite, dropping the settings
+// that belong to other modes. addpkg deploys under random names, and deploys the counter
+// workload unless -pkgdir, -generate or -workload says otherwise.
+func SuiteArgs(args Config, mode string) Config {
+	args.Mode = mode
+	if mode != "call" {
+		args.FunctionName, args.CallArgs, args.Send = "", nil, ""
+	}
+	if mode == "addpkg" {
+		args.PackageName = ""
+		if args.PkgDir == "." && !args.Generate && args.Workload == "" {
+			args.Workload = "counter"
+		}
+	} else {
+		args.PkgDir, args.Generate, args.Workload, args.GenSizeRange = ".", false, "", Range{}
+		args.Deposit, args.ManifestFile = "", ""
+	}
+	if mode == "balanceQuery" {
+		args.PackageName = ""
+	}
+	return args
+}
+
+// RunSuite runs each of modes at the configured rate for args.Duration, one after
+// another, and returns the results of all of them. Closing stop ends the mode running
+// and skips the rest.
+func RunSuite(args Config, modes []string, password string, stop <-chan struct{}) ([]ExecutionLog, error) {
+	var logs []ExecutionLog
+	for _, mode := range modes {
+		select {
+		case <-stop:
+			return logs, nil
+		default:
+		}
+		fmt.Printf("INFO: Running %s for %v\n", mode, args.Duration)
+		r, err := NewRun(SuiteArgs(args, mode), password)
+		if err != nil {
+			return logs, fmt.Errorf("%s: %w", mode, err)
+		}
+		timer := time.AfterFunc(args.Duration, r.Stop)
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+				r.Stop()
+			case <-done:
+			}
+		}()
+		r.Start()
+		close(done)
+		timer.Stop()
+		r.Close()
+		logs = append(logs, r.Logs()...)
+	}
+	return logs, nil
+}
+
+// WriteSuite prints the scorecard of a suite: requests, latency percentiles and error
+// rate per mode, in the order they ran.
+func WriteSuite(w io.Writer, modes []string, logs []ExecutionLog) {
+	_, byMode := GroupByMode(logs)
+	fmt.Fprintf(w, "%-16s %8s %12s %12s %12s %8s\n", "mode", "requests", "p50", "p95", "p99", "err%")
+	for _, mode := range modes {
+		s := Summarize(byMode[mode])
+		fmt.Fprintf(w, "%-16s %8d %12v %12v %12v %7.1f%%\n", mode, s.Requests,
+			FormatDuration(s.P50), FormatDuration(s.P95), FormatDuration(s.P99), 100*s.ErrorRate())
+	}
+}
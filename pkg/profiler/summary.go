@@ -0,0 +1,285 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary holds the end-of-run totals of a run, leaving out warm-up samples.
+type Summary struct {
+	Warmup    int
+	Malformed int // broken on purpose by -malformed
+	Requests  int
+	Failed    int
+	Invalid   int // succeeded but failed validation
+	P50       time.Duration
+	P95       time.Duration
+	P99       time.Duration
+	Max       time.Duration
+	Errors    map[string]int  // by ErrorCode
+	Cost      Cost            // of every request, warm-up included
+	Costs     map[string]Cost // by Mode
+}
+
+// Cost is what the transactions of a run spent.
+type Cost struct {
+	Fee     int64 // ugnot
+	GasUsed int64
+	Sent    int64 // ugnot deposited or sent, on top of fees
+}
+
+func (c *Cost) add(log ExecutionLog) {
+	c.Fee += log.Fee
+	c.GasUsed += log.GasUsed
+	c.Sent += log.Sent
+}
+
+// addCost counts what log spent towards the totals and its mode's.
+func (s *Summary) addCost(log ExecutionLog) {
+	if log.Fee == 0 && log.GasUsed == 0 && log.Sent == 0 {
+		return
+	}
+	s.Cost.add(log)
+	c := s.Costs[log.Mode]
+	c.add(log)
+	s.Costs[log.Mode] = c
+}
+
+// Summarize computes the summary of logs.
+func Summarize(logs []ExecutionLog) Summary {
+	stats := Summary{Errors: map[string]int{}, Costs: map[string]Cost{}}
+	var durations []time.Duration
+	for _, log := range logs {
+		stats.addCost(log)
+		if log.Warmup {
+			stats.Warmup++
+			continue
+		}
+		if log.Fault != "" {
+			stats.Malformed++
+			continue
+		}
+		durations = append(durations, log.ResponseTime)
+		switch {
+		case !log.Success:
+			stats.Failed++
+		case !log.Valid:
+			stats.Invalid++
+		}
+		if log.ErrorCode != "" {
+			stats.Errors[log.ErrorCode]++
+		}
+	}
+	stats.Requests = len(durations)
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		stats.P50 = percentile(durations, 50)
+		stats.P95 = percentile(durations, 95)
+		stats.P99 = percentile(durations, 99)
+		stats.Max = durations[len(durations)-1]
+	}
+	return stats
+}
+
+// ErrorRate returns the fraction of requests that failed or failed validation.
+func (s Summary) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failed+s.Invalid) / float64(s.Requests)
+}
+
+// ErrorCodes returns the error categories seen, sorted.
+func (s Summary) ErrorCodes() []string {
+	codes := make([]string, 0, len(s.Errors))
+	for code := range s.Errors {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// WriteSummary prints end-of-run totals and latency percentiles for the recorded
+// requests, leaving out warm-up samples.
+func WriteSummary(w io.Writer, logs []ExecutionLog) {
+	WriteStats(w, Summarize(logs), logs)
+}
+
+// WriteStats prints stats like WriteSummary, e.g. the exact stats of a run that only kept
+// some of its samples. The breakdown by step still comes from logs.
+func WriteStats(w io.Writer, stats Summary, logs []ExecutionLog) {
+	if stats.Warmup > 0 {
+		fmt.Fprintln(w, "Warm-up requests:", stats.Warmup, "(excluded below)")
+	}
+	if stats.Malformed > 0 {
+		fmt.Fprintln(w, "Malformed requests:", stats.Malformed, "(excluded below)")
+	}
+	fmt.Fprintln(w, "Requests:        ", stats.Requests)
+	fmt.Fprintln(w, "Failed:          ", stats.Failed)
+	fmt.Fprintln(w, "Logical failures:", stats.Invalid, "(succeeded but failed validation)")
+
+	if stats.Requests > 0 {
+		fmt.Fprintln(w, "Latency p50:     ", FormatDuration(stats.P50))
+		fmt.Fprintln(w, "Latency p95:     ", FormatDuration(stats.P95))
+		fmt.Fprintln(w, "Latency p99:     ", FormatDuration(stats.P99))
+		fmt.Fprintln(w, "Latency max:     ", FormatDuration(stats.Max))
+	}
+	writeRate(w, logs)
+	writeCosts(w, stats, logs)
+
+	if len(stats.Errors) > 0 {
+		fmt.Fprintln(w, "Errors by category:")
+		for _, code := range stats.ErrorCodes() {
+			fmt.Fprintf(w, "  %-20s %d\n", code, stats.Errors[code])
+		}
+	}
+	writeBreakdowns(w, logs)
+}
+
+// writeCosts prints what the transactions of the run paid and sent.
+func writeCosts(w io.Writer, stats Summary, logs []ExecutionLog) {
+	if stats.Cost.Fee > 0 {
+		fmt.Fprintf(w, "Fees paid:        %s (%d gas used)\n", formatUgnot(stats.Cost.Fee), stats.Cost.GasUsed)
+		if len(stats.Costs) > 1 {
+			for _, mode := range slices.Sorted(maps.Keys(stats.Costs)) {
+				c := stats.Costs[mode]
+				fmt.Fprintf(w, "  %-20s %s (%d gas used)\n", mode, formatUgnot(c.Fee), c.GasUsed)
+			}
+		}
+	}
+	if stats.Cost.Sent > 0 {
+		fmt.Fprintf(w, "Deposited/sent:   %s\n", formatUgnot(stats.Cost.Sent))
+	}
+
+	writeTxs(w, logs)
+}
+
+// writeBreakdowns prints latency by mode, endpoint and step, and the other breakdowns
+// that apply to the requests of logs.
+func writeBreakdowns(w io.Writer, logs []ExecutionLog) {
+	modes, byMode := SummarizeModes(logs)
+	if len(modes) > 0 {
+		fmt.Fprintf(w, "Latency by mode:\n  %-16s %8s %8s %12s %12s %12s\n", "", "requests", "errors", "p50", "p95", "p99")
+		for _, mode := range modes {
+			s := byMode[mode]
+			fmt.Fprintf(w, "  %-16s %8d %8d %12v %12v %12v\n", mode, s.Requests, s.Failed+s.Invalid,
+				FormatDuration(s.P50), FormatDuration(s.P95), FormatDuration(s.P99))
+		}
+	}
+
+	targets, byTarget := SummarizeTargets(logs)
+	if len(targets) > 0 {
+		fmt.Fprintf(w, "Latency by endpoint:\n  %-32s %8s %8s %12s %12s %12s\n", "", "requests", "err%", "p50", "p95", "p99")
+		for _, target := range targets {
+			s := byTarget[target]
+			fmt.Fprintf(w, "  %-32s %8d %7.1f%% %12v %12v %12v\n", target, s.Requests, 100*s.ErrorRate(),
+				FormatDuration(s.P50), FormatDuration(s.P95), FormatDuration(s.P99))
+		}
+	}
+
+	steps, byStep := SummarizeSteps(logs)
+	if len(steps) > 0 {
+		fmt.Fprintf(w, "Latency by step:\n  %-16s %8s %8s %12s %12s %12s\n", "", "requests", "errors", "p50", "p95", "p99")
+		for _, step := range steps {
+			s := byStep[step]
+			fmt.Fprintf(w, "  %-16s %8d %8d %12v %12v %12v\n", step, s.Requests, s.Failed+s.Invalid,
+				FormatDuration(s.P50), FormatDuration(s.P95), FormatDuration(s.P99))
+		}
+	}
+
+	writePackageSizes(w, logs)
+	writeArgSizes(w, logs)
+	writeBandwidth(w, logs)
+	writeCaching(w, logs)
+	writeFields(w, logs)
+	writeFaults(w, logs)
+}
+
+// formatUgnot formats an amount of ugnot, with GNOT alongside.
+func formatUgnot(ugnot int64) string {
+	return fmt.Sprintf("%dugnot (%s GNOT)", ugnot, strconv.FormatFloat(float64(ugnot)/1e6, 'f', -1, 64))
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// SummarizeSteps computes a summary per Step of a journey or script, returning the steps
+// in order. It returns nothing for runs without steps.
+func SummarizeSteps(logs []ExecutionLog) ([]string, map[string]Summary) {
+	byStep := map[string][]ExecutionLog{}
+	for _, log := range logs {
+		if log.Step != "" {
+			byStep[log.Step] = append(byStep[log.Step], log)
+		}
+	}
+	steps := make([]string, 0, len(byStep))
+	summaries := make(map[string]Summary, len(byStep))
+	for step, stepLogs := range byStep {
+		steps = append(steps, step)
+		summaries[step] = Summarize(stepLogs)
+	}
+	sort.Slice(steps, func(i, j int) bool { return stepNumber(steps[i]) < stepNumber(steps[j]) })
+	return steps, summaries
+}
+
+// GroupByMode splits logs by Mode, returning the modes sorted.
+func GroupByMode(logs []ExecutionLog) ([]string, map[string][]ExecutionLog) {
+	byMode := map[string][]ExecutionLog{}
+	for _, log := range logs {
+		byMode[log.Mode] = append(byMode[log.Mode], log)
+	}
+	return slices.Sorted(maps.Keys(byMode)), byMode
+}
+
+// SummarizeModes computes a summary per Mode, so that e.g. the reads and writes of a
+// script aren't averaged together. It returns nothing for runs of a single mode.
+func SummarizeModes(logs []ExecutionLog) ([]string, map[string]Summary) {
+	modes, byMode := GroupByMode(logs)
+	if len(modes) < 2 {
+		return nil, nil
+	}
+	summaries := make(map[string]Summary, len(modes))
+	for _, mode := range modes {
+		summaries[mode] = Summarize(byMode[mode])
+	}
+	return modes, summaries
+}
+
+// SummarizeTargets computes a summary per Target, so that a slow replica among -remotes
+// stands out. It returns the targets sorted, or nothing for runs against a single remote.
+func SummarizeTargets(logs []ExecutionLog) ([]string, map[string]Summary) {
+	byTarget := map[string][]ExecutionLog{}
+	for _, log := range logs {
+		if log.Target != "" {
+			byTarget[log.Target] = append(byTarget[log.Target], log)
+		}
+	}
+	if len(byTarget) < 2 {
+		return nil, nil
+	}
+	summaries := make(map[string]Summary, len(byTarget))
+	for target, targetLogs := range byTarget {
+		summaries[target] = Summarize(targetLogs)
+	}
+	return slices.Sorted(maps.Keys(byTarget)), summaries
+}
+
+// stepNumber returns the position in a Step like 2:call.
+func stepNumber(step string) int {
+	n, _, _ := strings.Cut(step, ":")
+	i, _ := strconv.Atoi(n)
+	return i
+}
@@ -0,0 +1,84 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ANSI escapes of the console summary.
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// Error rates from which the console summary shows errors in yellow and in red.
+const (
+	errorRateWarning  = 0.01
+	errorRateCritical = 0.05
+)
+
+// palette paints text with ANSI colors, or leaves it as it is for logs and files.
+type palette bool
+
+func (p palette) paint(color, s string) string {
+	if !p || color == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// errorColor returns the color of an error rate: green without errors, none for a few,
+// then yellow and red from errorRateWarning and errorRateCritical.
+func errorColor(rate float64) string {
+	switch {
+	case rate >= errorRateCritical:
+		return colorRed
+	case rate >= errorRateWarning:
+		return colorYellow
+	case rate > 0:
+		return ""
+	}
+	return colorGreen
+}
+
+// WriteSummaryTable prints the summary for the console: the requests, throughput, errors
+// by category and latency percentiles as aligned tables, with color unless color is
+// false, then the same breakdowns as WriteStats.
+func WriteSummaryTable(w io.Writer, stats Summary, logs []ExecutionLog, color bool) {
+	p := palette(color)
+	rule := strings.Repeat("─", 60)
+	fmt.Fprintln(w, p.paint(colorBold, "Summary"))
+	fmt.Fprintln(w, rule)
+	fmt.Fprintf(w, "  %-20s %12d\n", "Requests", stats.Requests)
+	if stats.Warmup > 0 || stats.Malformed > 0 {
+		fmt.Fprintf(w, "  %-20s %12d\n", "  warm-up, excluded", stats.Warmup)
+		fmt.Fprintf(w, "  %-20s %12d\n", "  malformed, excluded", stats.Malformed)
+	}
+	if span := logSpan(logs); span > 0 && stats.Requests > 0 {
+		fmt.Fprintf(w, "  %-20s %12s\n", "Throughput", fmt.Sprintf("%.2f/s", float64(stats.Requests)/span.Seconds()))
+	}
+	errors := stats.Failed + stats.Invalid
+	rate := fmt.Sprintf("%12s", fmt.Sprintf("%d (%.1f%%)", errors, 100*stats.ErrorRate()))
+	fmt.Fprintf(w, "  %-20s %s\n", "Errors", p.paint(errorColor(stats.ErrorRate()), rate))
+	fmt.Fprintf(w, "  %-20s %12d\n", "  failed", stats.Failed)
+	fmt.Fprintf(w, "  %-20s %12d\n", "  failed validation", stats.Invalid)
+	for _, code := range stats.ErrorCodes() {
+		fmt.Fprintf(w, "  %-20s %s\n", "  "+code, p.paint(colorRed, fmt.Sprintf("%12d", stats.Errors[code])))
+	}
+
+	if stats.Requests > 0 {
+		fmt.Fprintln(w, rule)
+		fmt.Fprintln(w, p.paint(colorBold, fmt.Sprintf("  %-20s %12s %12s %12s %12s", "Latency", "p50", "p95", "p99", "max")))
+		fmt.Fprintf(w, "  %-20s %12v %12v %12v %12v\n", "", FormatDuration(stats.P50), FormatDuration(stats.P95),
+			FormatDuration(stats.P99), FormatDuration(stats.Max))
+	}
+	fmt.Fprintln(w, rule)
+
+	writeRate(w, logs)
+	writeCosts(w, stats, logs)
+	writeBreakdowns(w, logs)
+}
@@ -0,0 +1,77 @@
+package profiler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// target is an existing package (and optionally function) that call and qrender modes
+// can be pointed at instead of a single -package.
+type target struct {
+	PkgPath  string
+	Function string
+}
+
+type targetList struct {
+	targets []target
+	random  bool
+	next    atomic.Uint64
+}
+
+// loadTargets reads a targets file. It accepts a manifest written by -manifest as well as
+// plain lists with one "pkgpath" or "pkgpath,function" per line.
+func loadTargets(path string, random bool) (*targetList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	functionColumn := 1
+	if len(records) > 0 && records[0][0] == "PkgPath" {
+		functionColumn = -1
+		for i, column := range records[0] {
+			if column == "Function" {
+				functionColumn = i
+			}
+		}
+		records = records[1:]
+	}
+
+	list := &targetList{random: random}
+	for _, record := range records {
+		t := target{PkgPath: strings.TrimSpace(record[0])}
+		if t.PkgPath == "" {
+			continue
+		}
+		if functionColumn >= 0 && functionColumn < len(record) {
+			t.Function = strings.TrimSpace(record[functionColumn])
+		}
+		list.targets = append(list.targets, t)
+	}
+	if len(list.targets) == 0 {
+		return nil, fmt.Errorf("no targets found in %s", path)
+	}
+	return list, nil
+}
+
+// pick returns the next target, shared across all workers.
+func (l *targetList) pick() target {
+	if l.random {
+		rngMutex.Lock()
+		defer rngMutex.Unlock()
+		return l.targets[rng.Intn(len(l.targets))]
+	}
+	return l.targets[(l.next.Add(1)-1)%uint64(len(l.targets))]
+}
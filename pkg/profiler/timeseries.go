@@ -0,0 +1,88 @@
+package profiler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Bucket aggregates the requests that were sent in one interval of a run.
+type Bucket struct {
+	Start    time.Time
+	Requests int
+	Errors   int // failed or failed validation
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Target   float64 // mean target QPS of the requests, 0 if they had none
+}
+
+// TimeSeries aggregates logs into consecutive buckets of the given width, starting at the
+// first request. Buckets without requests are included, so gaps show up when plotted.
+func TimeSeries(logs []ExecutionLog, width time.Duration) []Bucket {
+	if len(logs) == 0 || width <= 0 {
+		return nil
+	}
+	first, last := logs[0].Started(), logs[0].Started()
+	for _, log := range logs {
+		started := log.Started()
+		if started.Before(first) {
+			first = started
+		}
+		if started.After(last) {
+			last = started
+		}
+	}
+	durations := make([][]time.Duration, int(last.Sub(first)/width)+1)
+	paced := make([]int, len(durations))
+	buckets := make([]Bucket, len(durations))
+	for i := range buckets {
+		buckets[i].Start = first.Add(time.Duration(i) * width)
+	}
+	for _, log := range logs {
+		i := int(log.Started().Sub(first) / width)
+		durations[i] = append(durations[i], log.ResponseTime)
+		if !log.Success || !log.Valid {
+			buckets[i].Errors++
+		}
+		if log.TargetQPS > 0 {
+			buckets[i].Target += log.TargetQPS
+			paced[i]++
+		}
+	}
+	for i, d := range durations {
+		sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+		buckets[i].Requests = len(d)
+		buckets[i].P50 = percentile(d, 50)
+		buckets[i].P95 = percentile(d, 95)
+		buckets[i].P99 = percentile(d, 99)
+		if paced[i] > 0 {
+			buckets[i].Target /= float64(paced[i])
+		}
+	}
+	return buckets
+}
+
+// WriteTimeSeries writes the time series of logs as CSV, one row per bucket. QPS is the
+// achieved rate over the bucket, and TargetQPS the rate the requests were paced at.
+func WriteTimeSeries(w io.Writer, logs []ExecutionLog, width time.Duration) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Time", "Requests", "QPS", "Errors", "P50", "P95", "P99", "TargetQPS"})
+	for _, b := range TimeSeries(logs, width) {
+		writer.Write([]string{
+			b.Start.Format(time.RFC3339Nano),
+			strconv.Itoa(b.Requests),
+			fmt.Sprintf("%f", float64(b.Requests)/width.Seconds()),
+			strconv.Itoa(b.Errors),
+			formatSeconds(b.P50),
+			formatSeconds(b.P95),
+			formatSeconds(b.P99),
+			fmt.Sprintf("%f", b.Target),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,443 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	pkgPrefixPattern    = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	coinsPattern        = regexp.MustCompile(`^\d+[a-z][a-z0-9/]*(,\d+[a-z][a-z0-9/]*)*$`)
+	statsdPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+)
+
+// Validate returns every problem with the settings, e.g. flags that don't apply to the
+// mode, rather than stopping at the first. It expects c to be Normalized. Runs started
+// with problems may fail in unexpected ways.
+func (c Config) Validate() []error {
+	var errs []error
+
+	// Validate mode-based argument requirements
+	errs = append(errs, validateMode(c)...)
+	if c.TargetsFile != "" {
+		if c.Mode != "call" && c.Mode != "qrender" && c.Mode != "qdoc" {
+			errs = append(errs, errors.New("targets can only be used in call, qrender and qdoc modes."))
+		}
+		if c.PackageName != "" {
+			errs = append(errs, errors.New("Cannot specify both package and targets."))
+		}
+	}
+	if c.TargetOrder != "roundrobin" && c.TargetOrder != "random" {
+		errs = append(errs, errors.New("targetOrder must be roundrobin or random."))
+	}
+
+	//if c.MaxThreads > 1 {
+	//	fmt.Println("Error: More than 1 thread not yet supported (TODO).")
+	//	os.Exit(1)
+	//}
+
+	if c.Mode != "run" && c.RunFile != "" {
+		errs = append(errs, errors.New("runFile can only be used in run mode."))
+	}
+
+	if c.Mode == "calibrate" {
+		if c.PackageName != "" || c.FunctionName != "" {
+			errs = append(errs, errors.New("Cannot specify package or function in calibrate mode."))
+		}
+		if c.Overhead != 0 {
+			errs = append(errs, errors.New("Cannot subtract overhead in calibrate mode."))
+		}
+	}
+
+	if c.PkgPrefix != "" && !pkgPrefixPattern.MatchString(c.PkgPrefix) {
+		errs = append(errs, errors.New("pkgPrefix must start with a lowercase letter and contain only lowercase letters, digits and underscores."))
+	}
+	if !strings.HasPrefix(c.Namespace, "r/") && !strings.HasPrefix(c.Namespace, "p/") {
+		errs = append(errs, errors.New("namespace must be r/, p/ or a sub-path of one of them such as r/<user>/."))
+	}
+	if c.NameLength < 1 {
+		errs = append(errs, errors.New("nameLength must be at least 1."))
+	}
+
+	if c.ManifestFile != "" && c.Mode != "addpkg" && c.Mode != "addpkg+call" && c.Mode != "script" && c.Mode != "journey" {
+		errs = append(errs, errors.New("manifest can only be written in addpkg, journey and script modes."))
+	}
+
+	if c.Generate {
+		if c.Mode != "addpkg" && c.Mode != "addpkg+call" {
+			errs = append(errs, errors.New("generate can only be used in addpkg modes."))
+		}
+		if c.PkgDir != "." {
+			errs = append(errs, errors.New("Cannot specify pkgdir together with generate."))
+		}
+		if c.GenFuncs < 0 || c.GenSize < 0 {
+			errs = append(errs, errors.New("genFuncs and genSize cannot be negative."))
+		}
+		if c.GenImports < 0 || c.GenImports > MaxGenImports {
+			errs = append(errs, fmt.Errorf("genImports must be between 0 and %d.", MaxGenImports))
+		}
+	} else if !c.GenSizeRange.IsZero() {
+		errs = append(errs, errors.New("genSizeRange can only be used with generate."))
+	}
+
+	if c.Workload != "" {
+		if !slices.Contains(WorkloadNames(), c.Workload) {
+			errs = append(errs, fmt.Errorf("workload must be one of %s", strings.Join(WorkloadNames(), ", ")))
+		}
+		if c.Mode != "addpkg" && c.Mode != "addpkg+call" {
+			errs = append(errs, errors.New("workload can only be used in addpkg modes."))
+		}
+		if c.PkgDir != "." || c.Generate {
+			errs = append(errs, errors.New("Cannot specify pkgdir or generate together with workload."))
+		}
+	}
+
+	if c.Mode == "verify" {
+		if c.PackageName != "" || c.FunctionName != "" || c.TargetsFile != "" {
+			errs = append(errs, errors.New("Cannot specify package, function or targets in verify mode."))
+		}
+		if c.PkgDir != "." || c.Generate || c.Workload != "" || c.ManifestFile != "" {
+			errs = append(errs, errors.New("verify mode always deploys its own counter realm."))
+		}
+		if c.VerifyCount < 1 {
+			errs = append(errs, errors.New("verifyCount must be at least 1."))
+		}
+	}
+
+	if c.Mode == "journey" {
+		if len(c.Steps) == 0 {
+			errs = append(errs, errors.New("steps must be specified in journey mode."))
+		}
+		for _, step := range c.Steps {
+			if !slices.Contains(JourneySteps, step) {
+				errs = append(errs, fmt.Errorf("steps must be among %s", strings.Join(JourneySteps, ", ")))
+				break
+			}
+		}
+		// Steps after an addpkg use the package it deployed
+		for _, step := range c.Steps {
+			if step == "addpkg" {
+				break
+			}
+			if (step == "call" || step == "qrender" || step == "qdoc") && c.PackageName == "" {
+				errs = append(errs, errors.New("package must be specified when a journey calls, renders or documents a package before deploying one."))
+				break
+			}
+		}
+		if c.TargetsFile != "" {
+			errs = append(errs, errors.New("Cannot specify targets in journey mode."))
+		}
+	} else if len(c.Steps) > 0 {
+		errs = append(errs, errors.New("steps can only be used in journey mode."))
+	}
+
+	if c.Mode == "replay" {
+		if c.Schedule == "" {
+			errs = append(errs, errors.New("schedule must be specified in replay mode."))
+		}
+		if c.PackageName != "" || c.FunctionName != "" || c.TargetsFile != "" {
+			errs = append(errs, errors.New("Cannot specify package, function or targets in replay mode; the schedule names them."))
+		}
+		if _, err := LoadSchedule(c.Schedule); c.Schedule != "" && err != nil {
+			errs = append(errs, fmt.Errorf("loading schedule: %w", err))
+		}
+	} else if c.Schedule != "" {
+		errs = append(errs, errors.New("schedule can only be used in replay mode."))
+	}
+	if c.Record != "" {
+		if c.Mode == "verify" || c.Mode == "calibrate" {
+			errs = append(errs, errors.New("Cannot record verify or calibrate runs."))
+		}
+		// Their packages are written to temporary directories that are gone by replay time
+		if c.Generate || c.Workload != "" {
+			errs = append(errs, errors.New("Cannot record runs that deploy generated or workload packages."))
+		}
+	}
+
+	if len(c.Chains) > 0 {
+		switch {
+		case len(c.Remotes) > 0 || c.CompareRemote != "":
+			errs = append(errs, errors.New("Cannot specify chain together with remotes or compareRemote."))
+		case c.Mode == "verify" || c.Mode == "calibrate":
+			errs = append(errs, errors.New("chain cannot be used in verify or calibrate mode."))
+		case c.Duration == 0:
+			errs = append(errs, errors.New("duration must be set when profiling several chains."))
+		case c.Sampled():
+			errs = append(errs, errors.New("sampleRate and reservoir cannot be used with chain yet."))
+		}
+		seen := map[string]bool{}
+		for _, chain := range c.Chains {
+			if seen[chain.Remote] {
+				errs = append(errs, errors.New("Each chain must have its own remote."))
+				break
+			}
+			seen[chain.Remote] = true
+		}
+	}
+	if len(c.Remotes) > 0 {
+		switch {
+		case c.CompareRemote != "":
+			errs = append(errs, errors.New("Cannot specify both remotes and compareRemote."))
+		case c.Mode == "verify" || c.Mode == "calibrate":
+			errs = append(errs, errors.New("remotes cannot be used in verify or calibrate mode."))
+		}
+	}
+	if c.CompareRemote != "" {
+		switch {
+		case c.CompareRemote == c.Remote:
+			errs = append(errs, errors.New("compareRemote must be a different remote."))
+		case c.Mode == "verify" || c.Mode == "calibrate" || c.Mode == "addpkg+call":
+			errs = append(errs, errors.New("compareRemote cannot be used in verify, calibrate or addpkg+call mode; use a journey for addpkg then call."))
+		case c.Generate || c.Workload != "":
+			// Each generated package directory is removed as soon as the primary request returns
+			errs = append(errs, errors.New("compareRemote cannot be used with generated or workload packages."))
+		}
+	}
+
+	if c.Mode == "script" {
+		if c.Script == "" {
+			errs = append(errs, errors.New("script must be specified in script mode."))
+		}
+		if c.PackageName != "" || c.FunctionName != "" || c.TargetsFile != "" {
+			errs = append(errs, errors.New("Cannot specify package, function or targets in script mode; the script names them."))
+		}
+		if _, err := LoadScript(c.Script); c.Script != "" && err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.Script != "" {
+		errs = append(errs, errors.New("script can only be used in script mode."))
+	}
+
+	if err := ValidateRules(c.Expect, c.ExpectRegex); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := compileExtractors(c.Extract); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.AbortErrorRate < 0 || c.AbortErrorRate > 1 {
+		errs = append(errs, errors.New("abortErrorRate must be between 0 and 1."))
+	}
+	if c.AbortConsecutiveErrors < 0 {
+		errs = append(errs, errors.New("abortConsecutiveErrors cannot be negative."))
+	}
+
+	for _, a := range c.Assert {
+		if _, err := ParseAssertion(a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.SpikeThreshold < 0 {
+		errs = append(errs, errors.New("spikeThreshold cannot be negative."))
+	}
+	if c.ErrorBurst < 0 || c.ErrorBurst > 1 {
+		errs = append(errs, errors.New("errorBurst must be between 0 and 1."))
+	}
+
+	for _, webhook := range c.Webhooks {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("webhook must be an http or https URL, not %q.", webhook))
+		}
+	}
+	if c.AlertErrorRate < 0 || c.AlertErrorRate > 1 {
+		errs = append(errs, errors.New("alertErrorRate must be between 0 and 1."))
+	}
+	if c.AlertLatency < 0 {
+		errs = append(errs, errors.New("alertLatency cannot be negative."))
+	}
+
+	if c.BackoffErrorRate < 0 || c.BackoffErrorRate > 1 {
+		errs = append(errs, errors.New("backoffErrorRate must be between 0 and 1."))
+	}
+	if c.BackoffErrorRate > 0 && (c.BackoffFactor <= 0 || c.BackoffFactor >= 1) {
+		errs = append(errs, errors.New("backoffFactor must be between 0 and 1, exclusive."))
+	}
+	if c.StateInterval < 0 {
+		errs = append(errs, errors.New("stateInterval cannot be negative."))
+	}
+	if c.RequestTimeout < 0 {
+		errs = append(errs, errors.New("requestTimeout cannot be negative."))
+	}
+	if c.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddr); err != nil {
+			errs = append(errs, fmt.Errorf("statsd must be a host:port, not %q.", c.StatsdAddr))
+		}
+		if !statsdPrefixPattern.MatchString(c.StatsdPrefix) {
+			errs = append(errs, errors.New("statsdPrefix must be dot-separated letters, digits, dashes and underscores."))
+		}
+	}
+
+	if c.ThinkTime < 0 {
+		errs = append(errs, errors.New("thinkTime cannot be negative."))
+	}
+	if !slices.Contains(ThinkDistributions, c.ThinkDist) {
+		errs = append(errs, fmt.Errorf("thinkDist must be one of %s", strings.Join(ThinkDistributions, ", ")))
+	}
+
+	if c.MaxQPS < 1 {
+		errs = append(errs, errors.New("maxQueriesPerSec must be at least 1."))
+	}
+	if !slices.Contains(ArrivalProcesses, c.Arrival) {
+		errs = append(errs, fmt.Errorf("arrival must be one of %s", strings.Join(ArrivalProcesses, ", ")))
+	}
+
+	if !slices.Contains(LoadShapes, c.Shape) {
+		errs = append(errs, fmt.Errorf("shape must be one of %s", strings.Join(LoadShapes, ", ")))
+	}
+	if c.ShapePeriod <= 0 {
+		errs = append(errs, errors.New("shapePeriod must be positive."))
+	}
+	if c.ShapeFactor < 1 {
+		errs = append(errs, errors.New("shapeFactor must be at least 1."))
+	}
+
+	if c.StartThreads < 1 || c.StartThreads > c.MaxThreads {
+		errs = append(errs, errors.New("startThreads must be between 1 and maxThreads."))
+	}
+	if c.StartThreads < c.MaxThreads && c.RampStep < 1 {
+		errs = append(errs, errors.New("rampStep must be at least 1 when startThreads is below maxThreads."))
+	}
+	if c.RampStep > 0 && c.RampInterval <= 0 {
+		errs = append(errs, errors.New("rampInterval must be positive."))
+	}
+
+	if c.Duration < 0 {
+		errs = append(errs, errors.New("duration cannot be negative."))
+	}
+	if c.MaxRequests < 0 {
+		errs = append(errs, errors.New("maxRequests cannot be negative."))
+	}
+	if c.MaxInflight < 0 {
+		errs = append(errs, errors.New("maxInflight cannot be negative."))
+	}
+	if c.MaxProcs < 0 {
+		errs = append(errs, errors.New("maxProcs cannot be negative."))
+	} else if c.MaxProcs > 0 && c.Backend != "exec" {
+		errs = append(errs, errors.New("maxProcs needs the exec backend, which runs gnokey in subprocesses."))
+	}
+
+	if c.Deposit != "" {
+		if !coinsPattern.MatchString(c.Deposit) {
+			errs = append(errs, errors.New("deposit must be an amount of coins like 1000000ugnot."))
+		}
+		if c.Mode != "addpkg" && c.Mode != "addpkg+call" && c.Mode != "script" && c.Mode != "journey" && c.Mode != "verify" && c.Mode != "replay" {
+			errs = append(errs, errors.New("deposit can only be used in modes that deploy packages."))
+		}
+	}
+	if c.Send != "" {
+		if !coinsPattern.MatchString(c.Send) {
+			errs = append(errs, errors.New("send must be an amount of coins like 100ugnot."))
+		}
+		if c.Mode != "call" && c.Mode != "addpkg+call" && c.Mode != "script" && c.Mode != "journey" && c.Mode != "replay" {
+			errs = append(errs, errors.New("send can only be used in modes that call functions."))
+		}
+	}
+	if c.FuzzArgs && c.Mode != "call" {
+		errs = append(errs, errors.New("fuzzArgs can only be used in call mode."))
+	}
+	if c.FuzzArgSize < 0 {
+		errs = append(errs, errors.New("fuzzArgSize cannot be negative."))
+	}
+	if strings.Contains(c.RenderPath, "'") {
+		errs = append(errs, errors.New("renderPath cannot contain single quotes."))
+	}
+	if c.WorkerPrefix && c.Mode != "addpkg" && c.Mode != "addpkg+call" {
+		errs = append(errs, errors.New("workerPrefix can only be used in addpkg and addpkg+call modes."))
+	}
+	if c.Command != "" && c.Mode != "custom" {
+		errs = append(errs, errors.New("command can only be used in custom mode."))
+	}
+	if c.CacheProbe && c.Mode != "qrender" {
+		errs = append(errs, errors.New("cacheProbe can only be used in qrender mode."))
+	}
+	if c.Malformed < 0 || c.Malformed > 1 {
+		errs = append(errs, errors.New("malformed must be between 0 and 1."))
+	}
+	if c.Malformed > 0 && c.Mode != "addpkg" && c.Mode != "call" && c.Mode != "qrender" && c.Mode != "qdoc" {
+		errs = append(errs, errors.New("malformed can only be used in addpkg, call, qrender and qdoc modes."))
+	}
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		errs = append(errs, errors.New("sampleRate must be above 0 and at most 1."))
+	}
+	if c.Slowest < 0 {
+		errs = append(errs, errors.New("slowest cannot be negative."))
+	}
+	if c.Reservoir < 0 {
+		errs = append(errs, errors.New("reservoir cannot be negative."))
+	}
+	if c.MaxSamples < 0 || c.MemoryLimit < 0 {
+		errs = append(errs, errors.New("maxSamples and memoryLimit cannot be negative."))
+	}
+	if c.MaxSamples > 0 || c.MemoryLimit > 0 {
+		switch {
+		case c.MaxSamples == 1:
+			errs = append(errs, errors.New("maxSamples must be at least 2."))
+		case c.Reservoir > 0:
+			errs = append(errs, errors.New("maxSamples and memoryLimit cannot be used with reservoir, which already bounds the samples kept."))
+		case len(c.Chains) > 0:
+			errs = append(errs, errors.New("maxSamples and memoryLimit cannot be used with chain yet."))
+		}
+	}
+	if c.Sampled() && c.Resume {
+		// The summary of the samples already on disk would no longer be exact
+		errs = append(errs, errors.New("Cannot resume runs that use sampleRate or reservoir."))
+	}
+
+	if c.Checkpoint < 0 || c.CheckpointRequests < 0 {
+		errs = append(errs, errors.New("checkpoint intervals cannot be negative."))
+	}
+	if c.RotateSize < 0 || c.RotateEvery < 0 {
+		errs = append(errs, errors.New("rotateSize and rotateEvery cannot be negative."))
+	}
+	if c.Rotating() {
+		// Results are only written, and so rotated, at checkpoints
+		if c.Checkpoint == 0 && c.CheckpointRequests == 0 {
+			errs = append(errs, errors.New("rotateSize and rotateEvery need checkpoint or checkpointRequests."))
+		}
+		if c.Resume || c.Reservoir > 0 {
+			errs = append(errs, errors.New("rotateSize and rotateEvery cannot be used with resume or reservoir."))
+		}
+	}
+
+	if !slices.Contains(GasEstimates, c.GasEstimate) {
+		errs = append(errs, fmt.Errorf("gasEstimate must be one of %s", strings.Join(GasEstimates, ", ")))
+	}
+	if c.GasWanted <= 0 || c.GasFee <= 0 || c.GasAdjustment <= 0 {
+		errs = append(errs, errors.New("gasWanted, gasFee and gasAdjustment must be positive."))
+	}
+	if fuzz := !c.FuzzGasWanted.IsZero() || !c.FuzzGasFee.IsZero(); fuzz && c.GasEstimate != "off" {
+		errs = append(errs, errors.New("fuzzGasWanted and fuzzGasFee cannot be used with gasEstimate."))
+	} else if fuzz && c.Backend != "exec" {
+		errs = append(errs, errors.New("fuzzGasWanted and fuzzGasFee need the exec backend."))
+	}
+	if c.GasEstimate != "off" && c.Backend != "exec" {
+		errs = append(errs, errors.New("gasEstimate needs the exec backend to simulate transactions."))
+	}
+
+	if !slices.Contains(Keybases, c.Keybase) {
+		errs = append(errs, fmt.Errorf("keybase must be one of %s", strings.Join(Keybases, ", ")))
+	} else if c.Keybase != "shared" && c.Backend != "exec" {
+		errs = append(errs, errors.New("keybase needs the exec backend, which signs with gnokey."))
+	}
+	if !slices.Contains(BalanceChecks, c.BalanceCheck) {
+		errs = append(errs, fmt.Errorf("balanceCheck must be one of %s", strings.Join(BalanceChecks, ", ")))
+	}
+
+	if c.Overhead < 0 {
+		errs = append(errs, errors.New("overhead cannot be negative."))
+	}
+
+	if !slices.Contains(Backends(), c.Backend) {
+		errs = append(errs, fmt.Errorf("backend must be one of %s", strings.Join(Backends(), ", ")))
+	}
+	if c.Backend == "rpc" && c.Mode != "balanceQuery" && c.Mode != "qrender" && c.Mode != "qdoc" {
+		errs = append(errs, errors.New("rpc backend only supports balanceQuery, qrender and qdoc modes."))
+	}
+	return errs
+}
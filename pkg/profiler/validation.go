@@ -0,0 +1,69 @@
+package profiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// validationRule is an expected-output assertion from -expect or -expectRegex. Responses
+// that fail one are logical failures even when the command itself succeeded.
+type validationRule struct {
+	mode      string // empty applies to every mode
+	substring string
+	pattern   *regexp.Regexp
+}
+
+// splitRuleMode separates an optional "mode=" scope from a rule, where mode is a
+// registered Mode or calibrate.
+func splitRuleMode(rule string) (string, string) {
+	if mode, expected, ok := strings.Cut(rule, "="); ok {
+		if _, registered := modes[mode]; registered || mode == "calibrate" {
+			return mode, expected
+		}
+	}
+	return "", rule
+}
+
+// ValidateRules checks that every -expect and -expectRegex rule is well formed.
+func ValidateRules(substrings, patterns []string) error {
+	_, err := compileRules(substrings, patterns)
+	return err
+}
+
+func compileRules(substrings, patterns []string) ([]validationRule, error) {
+	var rules []validationRule
+	for _, s := range substrings {
+		mode, expected := splitRuleMode(s)
+		rules = append(rules, validationRule{mode: mode, substring: expected})
+	}
+	for _, p := range patterns {
+		mode, expected := splitRuleMode(p)
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expectRegex %q: %w", p, err)
+		}
+		rules = append(rules, validationRule{mode: mode, pattern: re})
+	}
+	return rules, nil
+}
+
+// checkResponse returns an error if the Mode of mode finds out failed, or describing the
+// first rule for mode that out fails.
+func checkResponse(rules []validationRule, mode, out string) error {
+	if err := parseResult(mode, out); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.mode != "" && rule.mode != mode {
+			continue
+		}
+		if rule.pattern != nil && !rule.pattern.MatchString(out) {
+			return fmt.Errorf("response doesn't match %q", rule.pattern)
+		}
+		if rule.pattern == nil && !strings.Contains(out, rule.substring) {
+			return fmt.Errorf("response doesn't contain %q", rule.substring)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var renderedCountPattern = regexp.MustCompile(`data:\s*(\d+)`)
+
+// Verify deploys a counter realm, increments it VerifyCount times from MaxThreads
+// workers and then checks the rendered count against the number of txs that succeeded.
+// It returns false if writes were lost or duplicated, or the check couldn't be done.
+func (r *Run) Verify() bool {
+	args := r.args
+	name, err := r.names.newName(args)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return false
+	}
+	counter := workloads["counter"]
+
+	src, err := workloadSource(counter, name)
+	if err != nil {
+		fmt.Println("Error reading counter realm:", err)
+		return false
+	}
+	dir, err := writePackage(name, src)
+	if err != nil {
+		fmt.Println("Error writing counter realm:", err)
+		return false
+	}
+	defer os.RemoveAll(dir)
+
+	deployArgs := args
+	deployArgs.PkgDir = dir
+	deployArgs = r.txArgs("addpkg", name, deployArgs)
+	fmt.Println("INFO: Deploying counter realm", pkgPath(args, name))
+	if _, _, err := r.executor.Execute("addpkg", name, deployArgs); err != nil {
+		fmt.Println("Error: Failed to deploy counter realm:", err)
+		return false
+	}
+
+	callArgs := args
+	callArgs.FunctionName = counter.Function
+	jobs := make(chan struct{}, args.VerifyCount)
+	for i := 0; i < args.VerifyCount; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	fmt.Println("INFO: Sending", args.VerifyCount, "increments from", args.MaxThreads, "threads...")
+	var succeeded atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < args.MaxThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter := newPacer(args, r.targetRate)
+			for range jobs {
+				limiter.wait()
+				txArgs := r.txArgs("call", name, callArgs)
+				wait, ok := r.acquireSlot()
+				if !ok {
+					return
+				}
+				start := time.Now()
+				request := r.executor.Describe("call", name, txArgs)
+				out, timing, err := r.executor.Execute("call", name, txArgs)
+				r.releaseSlot()
+				duration := max(time.Since(start)-args.Overhead, 0)
+				_, _, committed := parseTxResult(out)
+				if err == nil && committed {
+					succeeded.Add(1)
+				}
+				var verr error
+				if !committed {
+					verr = errors.New("no tx hash in output")
+				}
+				r.recordRequest(ExecutionLog{
+					Start:        start,
+					Timestamp:    time.Now(),
+					ResponseTime: duration,
+					HTTP:         timing,
+					QueueWait:    wait,
+					Success:      err == nil,
+					Valid:        err == nil && committed,
+					ErrorCode:    classifyError(out, err, verr),
+					Fingerprint:  fingerprint(request),
+				}, "call", out, captureSection(request, out, err))
+			}
+		}()
+	}
+	wg.Wait()
+
+	out, _, err := r.executor.Execute("qrender", name, args)
+	if err != nil {
+		fmt.Println("Error: Failed to render counter realm:", err)
+		return false
+	}
+	match := renderedCountPattern.FindStringSubmatch(out)
+	if match == nil {
+		fmt.Printf("Error: Unexpected qrender output: %q\n", out)
+		return false
+	}
+	rendered, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		fmt.Println("Error: Unexpected rendered count:", err)
+		return false
+	}
+
+	ok := succeeded.Load()
+	fmt.Println("Successful increments:", ok)
+	fmt.Println("Failed increments:    ", int64(args.VerifyCount)-ok)
+	fmt.Println("Rendered count:       ", rendered)
+	switch {
+	case rendered < ok:
+		fmt.Println("FAIL: Lost writes:", ok-rendered)
+	case rendered > ok:
+		fmt.Println("FAIL: Duplicated writes:", rendered-ok)
+	default:
+		fmt.Println("OK: Every successful increment is reflected in the realm's state.")
+	}
+	return rendered == ok
+}
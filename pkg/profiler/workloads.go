@@ -0,0 +1,49 @@
+package profiler
+
+import (
+	"embed"
+	"regexp"
+	"sort"
+)
+
+//go:embed workloads/*.gno
+var workloadFiles embed.FS
+
+// workload is a built-in realm template selectable with -workload.
+type workload struct {
+	File     string
+	Function string // called by addpkg+call unless -function is given
+}
+
+var workloads = map[string]workload{
+	"counter": {File: "workloads/counter.gno", Function: "Increment"},
+	"map":     {File: "workloads/map.gno", Function: "Insert"},
+	"avl":     {File: "workloads/avl.gno", Function: "Write"},
+	"events":  {File: "workloads/events.gno", Function: "Emit"},
+}
+
+var packageClause = regexp.MustCompile(`(?m)^package \w+$`)
+
+// WorkloadNames returns the names accepted by -workload, sorted.
+func WorkloadNames() []string {
+	names := make([]string, 0, len(workloads))
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WorkloadFunction returns the function addpkg+call calls on workload name.
+func WorkloadFunction(name string) string {
+	return workloads[name].Function
+}
+
+// workloadSource returns the template's source renamed to package name.
+func workloadSource(w workload, name string) (string, error) {
+	src, err := workloadFiles.ReadFile(w.File)
+	if err != nil {
+		return "", err
+	}
+	return packageClause.ReplaceAllLiteralString(string(src), "package "+name), nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// loadModes registers the modes of -modeFile and of the -plugin Go plugins, whose init
+// functions call profiler.RegisterMode.
+func loadModes(opts runOptions) error {
+	if opts.ModeFile != "" {
+		if err := profiler.LoadModeFile(opts.ModeFile); err != nil {
+			return err
+		}
+	}
+	for _, path := range opts.Plugins {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("loading plugin: %w", err)
+		}
+	}
+	return nil
+}
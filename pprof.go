@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// servePprof serves the profiler's own CPU, heap and goroutine profiles on addr, for when
+// the load generator rather than the node is the bottleneck.
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	fmt.Printf("INFO: pprof listening on http://%s/debug/pprof/\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Println("WARNING: pprof stopped:", err)
+	}
+}
@@ -3,118 +3,461 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/csv"
-	"flag"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
+	"net/url"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
 )
 
 const (
-	gasFee           = 10000000
-	gasWanted        = 800000
-	csvFile          = "pc_profiler.csv"
-	MaxPackageLength = 20
-	BalanceQuery     = "gnokey query bank/balances/g1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5"
-	DefaultChainId   = "dev"
+	csvFile      = "pc_profiler.csv"
+	metadataFile = "pc_profiler_meta.json"
+	summaryFile  = "pc_profiler_summary.txt"
+	summaryJSON  = "pc_profiler_summary.json"
+	slowestFile  = "pc_profiler_slowest.json"
 )
 
-type ExecutionLog struct {
-	Timestamp    time.Time
-	ResponseTime time.Duration
+// RunMetadata is saved next to the CSV so a run can be understood (and reproduced) later.
+type RunMetadata struct {
+	Seed          int64
+	StartTime     time.Time
+	EndTime       time.Time
+	Aborted       bool
+	AbortReason   string
+	Balances      []profiler.BalanceChange `json:",omitempty"`
+	Resources     *profiler.ResourceUsage  `json:",omitempty"` // the profiler's own CPU and memory
+	State         []profiler.StateSample   `json:",omitempty"` // of the chain, with -stateInterval
+	Collisions    int                      `json:",omitempty"` // generated package names drawn again
+	InflightWaits int64                    `json:",omitempty"` // requests that waited for one of -maxInflight to complete
+	ProcPool      *profiler.ProcPoolStats  `json:",omitempty"` // with -maxProcs
+	Keybase       *profiler.KeybaseStats   `json:",omitempty"` // contention for the keybase
+	Args          profiler.Config
 }
 
-type CommandLineArgs struct {
-	MaxThreads   int
-	MaxQPS       int
-	Mode         string
-	PackageName  string
-	FunctionName string
-	Remote       string
-	KeyName      string
-	PkgDir       string
-	ChainID      string
+// validateArgs prints every problem with args and opts and exits if there are any.
+func validateArgs(args profiler.Config, opts runOptions) {
+	exitOnErrors(append(args.Validate(), runErrors(args, opts)...))
 }
 
-func validateArgs(args CommandLineArgs) {
+// errorOutput is where exitOnErrors prints, the real stdout even with -silent.
+var errorOutput io.Writer = os.Stdout
 
-	// Validate mode-based argument requirements
-	if args.Mode == "addpkg" && args.FunctionName != "" {
-		fmt.Println("Error: function argument should not be provided in addpkg mode")
-		os.Exit(1)
+// exitOnErrors prints errs and exits if there are any.
+func exitOnErrors(errs []error) {
+	for _, err := range errs {
+		fmt.Fprintln(errorOutput, "Error:", err)
 	}
-	if args.Mode == "call" && args.PackageName == "" {
-		fmt.Println("Error: package argument must be specified in call mode.")
+	if len(errs) > 0 {
 		os.Exit(1)
 	}
+}
 
-	if args.Mode == "balanceQuery" {
-		if args.PackageName != "" {
-			fmt.Println("Error: Cannot specify packageName in balanceQuery mode.")
-			os.Exit(1)
+// runErrors returns the problems with opts, which only the CLI has.
+func runErrors(args profiler.Config, opts runOptions) []error {
+	var errs []error
+	if len(opts.Agents) > 0 {
+		if opts.AgentSecret == "" {
+			errs = append(errs, errors.New("agentSecret must be set when sending a run to agents."))
 		}
-		if args.FunctionName != "" {
-			fmt.Println("Error: Cannot specify function in balanceQuery mode.")
-			os.Exit(1)
+		if args.Duration == 0 {
+			errs = append(errs, errors.New("duration must be set when sending a run to agents."))
+		}
+		if args.Mode == "verify" {
+			errs = append(errs, errors.New("verify mode cannot be run on agents."))
+		}
+		if args.Sampled() {
+			errs = append(errs, errors.New("sampleRate and reservoir cannot be used with agents yet."))
+		}
+		if len(args.Chains) > 0 {
+			errs = append(errs, errors.New("Cannot send a run of several chains to agents."))
+		}
+		if args.MaxSamples > 0 || args.MemoryLimit > 0 {
+			errs = append(errs, errors.New("maxSamples and memoryLimit cannot be used with agents yet."))
+		}
+		errs = append(errs, profiler.AgentErrors(args)...)
+	}
+	if opts.ControlAddr != "" && opts.ControlSecret == "" {
+		errs = append(errs, errors.New("controlSecret must be set to serve the control API."))
+	}
+	if opts.Repeat != "" {
+		if _, err := parseRecurrence(opts.Repeat); err != nil {
+			errs = append(errs, err)
 		}
-		if args.PkgDir != "." {
-			fmt.Println("Error: Cannot specify pkgDir in balanceQuery mode.")
+		switch {
+		case args.Duration == 0:
+			errs = append(errs, errors.New("duration must be set when repeating a run."))
+		case args.Resume:
+			errs = append(errs, errors.New("resume cannot be used with repeat, whose runs are appended to "+historyFile+" instead."))
+		case args.Rotating():
+			errs = append(errs, errors.New("rotateSize and rotateEvery cannot be used with repeat."))
+		}
+	}
+	if opts.Pushgateway != "" {
+		if u, err := url.Parse(opts.Pushgateway); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("pushgateway must be an http or https URL, not %q.", opts.Pushgateway))
+		}
+		if opts.PushJob == "" {
+			errs = append(errs, errors.New("pushJob cannot be empty."))
+		}
+	}
+	for _, label := range opts.PushLabels {
+		if name, _, ok := strings.Cut(label, "="); !ok || !profiler.LabelPattern.MatchString(name) || name == "job" {
+			errs = append(errs, fmt.Errorf("pushLabel must be name=value with a Prometheus label name other than job, not %q.", label))
+		}
+	}
+	if opts.TimeSeries.Bucket <= 0 {
+		errs = append(errs, errors.New("bucket must be positive."))
+	}
+	return errs
+}
+
+func main() {
+	// Without a subcommand the flags are run's, as before there were subcommands
+	name, argv := "run", os.Args[1:]
+	if len(argv) > 0 && !strings.HasPrefix(argv[0], "-") {
+		name, argv = argv[0], argv[1:]
+	}
+	runCommand(name, argv)
+}
+
+// runOptions control how startRun drives a run, as opposed to what load it generates.
+type runOptions struct {
+	Agents        []string // controller mode: fan the run out to these agents
+	AgentSecret   string   // sent to agents, which only accept runs with it
+	ControlAddr   string
+	ControlSecret string // required by the control API
+	Seed          int64
+	DryRun        bool
+	TimeSeries    timeSeriesOptions
+	JUnit         string // file to write JUnit XML to
+	Parquet       string // file to also write the results to as Parquet
+	SplitModes    bool   // also write the results of each mode to its own file
+	Repeat        string // schedule to repeat the run on, see parseRecurrence
+	Pushgateway   string // Prometheus Pushgateway to push the summary to
+	PushJob       string
+	PushLabels    []string // name=value grouping labels, on top of the mode and remote
+	ModeFile      string   // file of template modes to register, see profiler.LoadModeFile
+	Plugins       []string // Go plugins registering modes
+	Progress      bool     // show a progress bar in runs with -duration or -maxRequests
+	NoColor       bool     // print the summary without ANSI colors
+	Silent        bool     // print only a summary line at the end
+}
+
+// startRun validates args, generates load until the run stops and saves the results.
+func startRun(args profiler.Config, opts runOptions) {
+	validateArgs(args, opts)
+	agents := opts.Agents
+	// The real stdout with -silent, which only gets the summary line
+	var stdout *os.File
+	if opts.Silent && !opts.DryRun {
+		stdout = silence()
+	}
+
+	seed := useSeed(opts.Seed)
+	metadata := RunMetadata{Seed: seed, StartTime: time.Now(), Args: args}
+
+	if opts.DryRun {
+		if err := profiler.WriteDryRun(os.Stdout, args); err != nil {
+			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
+		return
 	}
 
-	//if args.MaxThreads > 1 {
-	//	fmt.Println("Error: More than 1 thread not yet supported (TODO).")
-	//	os.Exit(1)
-	//}
+	password := readPassword()
+
+	r, err := profiler.NewRun(args, password)
+	if err != nil {
+		exitOnErrors([]error{err})
+	}
+	var balance *profiler.BalanceChange
+	if len(agents) == 0 && len(args.Chains) == 0 {
+		// Agents and chains send from their own keys
+		balance = checkBalance(args, r)
+	}
+
+	resultsPath := csvFile
+	if args.Compress {
+		resultsPath += ".gz"
+	}
+	results, previous, err := profiler.OpenResults(resultsPath, args.Resume)
+	if err != nil {
+		exitOnErrors([]error{fmt.Errorf("opening results file: %w", err)})
+	}
+	if len(previous) > 0 {
+		fmt.Println("INFO: Resuming after", len(previous), "results already in", resultsPath)
+		r.Preload(previous)
+	}
+
+	if args.Reservoir > 0 {
+		results.Rewrite()
+	}
+	if args.Rotating() {
+		results.Rotate(args.RotateSize, args.RotateEvery)
+	}
+	// Samples dropped from memory are written out first, under the run's lock
+	spilling := args.MaxSamples > 0 || args.MemoryLimit > 0
+	if spilling {
+		r.SpillTo(results)
+	}
+	flush := func(logs []profiler.ExecutionLog) error {
+		if spilling {
+			return r.FlushTo(results)
+		}
+		return results.Flush(logs)
+	}
+	// When samples are dropped, only the run itself has the exact summary
+	stats := func(logs []profiler.ExecutionLog) profiler.Summary {
+		if args.Sampled() || r.Spilled() > 0 {
+			return r.Summary()
+		}
+		return profiler.Summarize(logs)
+	}
+	// saveResults saves and prints everything about the run, and returns whether it met
+	// every -assert. failure says why the run itself failed, if it did.
+	saveResults := func(logs []profiler.ExecutionLog, failure string) bool {
+		if err := flush(logs); err != nil {
+			fmt.Println("Failed to write CSV file:", err)
+		}
+		if err := results.Close(); err != nil {
+			fmt.Println("Failed to close CSV file:", err)
+		}
+		saveParquet(opts.Parquet, logs)
+		if opts.SplitModes {
+			saveModeResults(logs)
+		}
+		saveSummary(args, stats(logs), logs)
+		opts.TimeSeries.save(logs)
+		printSummary(args, stats(logs), logs, opts)
+		resources := r.Resources()
+		profiler.WriteResources(os.Stdout, resources)
+		metadata.Resources = &resources
+		if metadata.Collisions = r.NameCollisions(); metadata.Collisions > 0 {
+			fmt.Println("Package name collisions:", metadata.Collisions, "(drawn again before sending)")
+		}
+		if metadata.InflightWaits = r.InflightWaits(); metadata.InflightWaits > 0 {
+			fmt.Println("Requests delayed by -maxInflight:", metadata.InflightWaits)
+		}
+		keybase := r.Keybase()
+		profiler.WriteKeybase(os.Stdout, keybase, args.Keybase)
+		if keybase != (profiler.KeybaseStats{}) {
+			metadata.Keybase = &keybase
+		}
+		if pool, ok := r.ProcPool(); ok {
+			profiler.WriteProcPool(os.Stdout, pool)
+			metadata.ProcPool = &pool
+		}
+		saveSlowest(r.Slowest())
+		r.Close()
+		if args.StateInterval > 0 {
+			metadata.State = r.StateSamples()
+			profiler.WriteStateGrowth(os.Stdout, profiler.SummarizeStateGrowth(logs, metadata.State))
+		}
+		metadata.EndTime = time.Now()
+		if balance != nil {
+			if change, ok := finalBalance(args, *balance, stats(logs)); ok {
+				metadata.Balances = []profiler.BalanceChange{change}
+			}
+		}
+		saveMetadata(metadata)
+		if opts.Pushgateway != "" {
+			labels := profiler.PushLabels(args, opts.PushLabels)
+			if err := profiler.PushSummary(opts.Pushgateway, opts.PushJob, labels, stats(logs), metadata.EndTime.Sub(metadata.StartTime)); err != nil {
+				fmt.Println("Failed to push metrics:", err)
+			} else {
+				fmt.Println("INFO: Pushed the summary to", opts.Pushgateway)
+			}
+		}
+		if args.Mode == "calibrate" && len(logs) > 0 {
+			median := profiler.MedianResponseTime(logs)
+			fmt.Printf("INFO: Median overhead of %q is %s. Pass -overhead %v to subtract it from other runs.\n", args.CalibrateCmd, profiler.FormatDuration(median), median)
+		}
+		assertions, passed := printAssertions(args.Assert, stats(logs))
+		if !passed {
+			alertAssertions(args, assertions)
+		}
+		saveSummaryJSON(newRunSummary(metadata, stats(logs), assertions))
+		if opts.JUnit != "" {
+			var summary bytes.Buffer
+			writeRunSummary(&summary, args, stats(logs), logs)
+			saveJUnit(opts.JUnit, args.Mode, metadata.EndTime.Sub(metadata.StartTime), summary.String(), failure, assertions)
+		}
+		if stdout != nil {
+			fmt.Fprintln(stdout, summaryLine(stats(logs), resultsPath, failure, passed))
+		}
+		return passed
+	}
 
-	if args.Mode == "qrender" {
-		if args.PackageName == "" {
-			fmt.Println("Error: package must be specified in qrender mode.")
+	if len(agents) > 0 || len(args.Chains) > 0 {
+		var logs []profiler.ExecutionLog
+		if len(agents) > 0 {
+			logs, err = profiler.RunController(agents, args, seed, opts.AgentSecret)
+		} else {
+			logs, err = profiler.RunChains(args, password)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+		failure := ""
+		if err != nil {
+			failure = err.Error()
+		}
+		if !saveResults(append(previous, logs...), failure) || err != nil {
 			os.Exit(1)
 		}
+		return
+	}
 
-		if args.ChainID != DefaultChainId {
-			// TODO: Verify this is true of gnokey
-			fmt.Println("Error: Chain ID cannot be specified in qrender mode.")
+	// Handle graceful shutdown. The handler only stops the run; the results are saved once,
+	// by finish, after it has stopped.
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	aborted := make(chan string, 1)
+	go func() {
+		select {
+		case <-signalChan:
+			fmt.Println("\nStopping workers and saving logs...")
+		case reason := <-r.Aborted():
+			fmt.Println("\nAborting run after", reason, "- saving logs...")
+			aborted <- reason
+		}
+		r.Stop()
+	}()
+	// finish saves the results of the stopped run and exits 1 if it failed or was aborted.
+	finish := func(failure string) {
+		var reason string
+		select {
+		case reason = <-aborted:
+		default:
+			select {
+			case reason = <-r.Aborted(): // tripped as the run stopped, before the handler saw it
+			default:
+			}
+		}
+		if reason != "" {
+			metadata.Aborted = true
+			metadata.AbortReason = reason
+			failure = "aborted after " + reason
+		}
+		if !saveResults(r.Logs(), failure) || failure != "" {
 			os.Exit(1)
 		}
 	}
 
+	handleUserSignals(r)
+	go r.Checkpoint(func(logs []profiler.ExecutionLog) {
+		if err := flush(logs); err != nil {
+			fmt.Println("Failed to checkpoint results:", err)
+			return
+		}
+		saveSummary(args, stats(logs), logs)
+		opts.TimeSeries.save(logs)
+	})
+
+	if args.Mode == "verify" {
+		ok := r.Verify()
+		failure := ""
+		if !ok {
+			failure = "the rendered count doesn't match the successful increments"
+		}
+		finish(failure)
+		return
+	}
+
+	if opts.ControlAddr != "" {
+		go profiler.ServeControl(opts.ControlAddr, opts.ControlSecret, r)
+	}
+
+	fmt.Println("INFO: About to start worker threads...")
+	if args.Duration > 0 {
+		time.AfterFunc(args.Duration, func() {
+			fmt.Println("INFO: Reached duration, waiting for in-flight requests...")
+			r.Stop()
+		})
+	}
+	stopProgress := func() {}
+	if opts.Progress && !opts.Silent && (args.Duration > 0 || args.MaxRequests > 0) {
+		stopProgress = showProgress(r)
+	}
+	r.Start()
+	stopProgress()
+	finish("")
 }
 
-func main() {
-	// Command-line argument parsing
-	maxThreads := flag.Int("maxThreads", 1, "Max number of simultaneous threads")
-	maxQPS := flag.Int("maxQueriesPerSec", 1, "Max queries per second per thread")
-	mode := flag.String("mode", "call", "Mode: addpkg, addpkg+call, call, balanceQuery, or qrender")
-	packageName := flag.String("package", "", "Package name (required for addpkg mode or qrender mode)")
-	functionName := flag.String("function", "", "Function name (required for call modes)")
-	remote := flag.String("remote", "localhost:26657", "Remote endpoint")
-	keyName := flag.String("keyname", "Dev", "Key name")
-	pkgDir := flag.String("pkgdir", ".", "Package directory")
-	chainID := flag.String("chainid", DefaultChainId, "Chain ID")
-
-	flag.Parse()
-
-	validateArgs(CommandLineArgs{
-		MaxThreads:   *maxThreads,
-		MaxQPS:       *maxQPS,
-		Mode:         *mode,
-		PackageName:  *packageName,
-		FunctionName: *functionName,
-		Remote:       *remote,
-		KeyName:      *keyName,
-		PkgDir:       *pkgDir,
-		ChainID:      *chainID,
-	})
+// checkBalance compares the balance of the sending key with the fees the run is expected
+// to pay, so that it doesn't fail halfway through with insufficient funds. It returns the
+// balance before the run, or nil for runs without transactions or without a balance.
+func checkBalance(args profiler.Config, r *profiler.Run) *profiler.BalanceChange {
+	if args.BalanceCheck == "off" {
+		return nil
+	}
+	e, err := r.EstimateBalance()
+	if err != nil {
+		fmt.Println("WARNING: Could not check the balance:", err)
+		return nil
+	}
+	if e.Address == "" {
+		return nil // no transactions
+	}
+	balance := &profiler.BalanceChange{Address: e.Address, Before: e.Balance}
+	if e.Cost == 0 {
+		fmt.Printf("INFO: Balance of %s is %dugnot, which lasts about %v at the full rate\n", e.Address, e.Balance, e.Lasts().Round(time.Second))
+		return balance
+	}
+	fmt.Printf("INFO: Balance of %s is %dugnot, the run is estimated to pay up to %dugnot in fees\n", e.Address, e.Balance, e.Cost)
+	if e.Sufficient() {
+		return balance
+	}
+	message := fmt.Sprintf("the balance only covers about %v at the full rate", e.Lasts().Round(time.Second))
+	if args.BalanceCheck == "abort" {
+		exitOnErrors([]error{fmt.Errorf("Insufficient funds: %s. Top up the account, or pass -balanceCheck warn to run anyway.", message)})
+	}
+	fmt.Println("WARNING: Insufficient funds:", message)
+	return balance
+}
+
+// finalBalance queries the balance of the sending key again after the run and compares
+// its change with the fees the run paid. It returns false if the balance couldn't be
+// queried.
+func finalBalance(args profiler.Config, balance profiler.BalanceChange, stats profiler.Summary) (profiler.BalanceChange, bool) {
+	after, err := profiler.QueryBalance(args.Remote, balance.Address)
+	if err != nil {
+		fmt.Println("WARNING: Could not check the balance after the run:", err)
+		return balance, false
+	}
+	balance.After = after
+	fmt.Printf("Balance of %s changed by %+dugnot (fees paid: %dugnot, deposited/sent: %dugnot)\n", balance.Address, balance.After-balance.Before, stats.Cost.Fee, stats.Cost.Sent)
+	if d := balance.Discrepancy(stats.Cost.Fee + stats.Cost.Sent); d != 0 {
+		fmt.Printf("WARNING: The balance changed by %+dugnot more than the fees and deposits account for\n", -d)
+	}
+	return balance, true
+}
+
+// useSeed seeds the random source with seed, or with one from the clock if it is 0, and
+// returns the seed used.
+func useSeed(seed int64) int64 {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	profiler.SeedRandom(seed)
+	fmt.Println("INFO: Using random seed", seed)
+	return seed
+}
 
+// readPassword returns the gnokey password from REALM_PROFILER_PASSWORD, or reads it from
+// stdin if something is piped in.
+func readPassword() string {
+	if password, ok := os.LookupEnv(passwordEnv); ok {
+		return password
+	}
 	// Check if there is input from stdin
 	fi, err := os.Stdin.Stat()
 	if err != nil {
@@ -123,196 +466,260 @@ func main() {
 	}
 
 	// If stdin has data (it's not from a terminal), read the password
-	var password string
 	if (fi.Mode() & os.ModeCharDevice) == 0 {
 		stdinScanner := bufio.NewScanner(os.Stdin)
 		if stdinScanner.Scan() {
-			password = stdinScanner.Text()
+			return stdinScanner.Text()
 		}
-	} else {
-		password = "" // Default to empty string if no input is piped
 	}
+	return "" // Default to empty string if no input is piped
+}
 
-	// Channel to manage worker pool
-	sem := make(chan struct{}, *maxThreads)
-	var wg sync.WaitGroup
-
-	// Track execution times
-	var logs []ExecutionLog
-	var logMutex sync.Mutex
-
-	// Handle graceful shutdown
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-signalChan
-		fmt.Println("\nStopping workers and saving logs...")
-		saveLogs(logs)
-		os.Exit(0)
-	}()
-
-	fmt.Println("INFO: About to start worker threads...")
-
-	// Start worker threads
-	for {
-		sem <- struct{}{}
-		wg.Add(1)
-		go func() {
-			defer func() {
-				<-sem
-				wg.Done()
-			}()
-			executeTask(*mode, *packageName, *functionName, *remote, *keyName, *pkgDir, *chainID, *maxQPS, password, &logs, &logMutex)
-		}()
+func saveMetadata(metadata RunMetadata) {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		fmt.Println("Failed to encode run metadata:", err)
+		return
+	}
+	if err := os.WriteFile(metadataFile, data, 0o644); err != nil {
+		fmt.Println("Failed to write run metadata:", err)
 	}
 }
 
-func executeTask(mode, packageName, functionName, remote, keyName, pkgDir, chainID string, maxQPS int, password string, logs *[]ExecutionLog, logMutex *sync.Mutex) {
-	queryCount := 0
-	lastQueryTime := time.Now()
-
-	firstLoop := true
+// saveParquet writes logs to path as Parquet if -parquet was given.
+func saveParquet(path string, logs []profiler.ExecutionLog) {
+	if path == "" {
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Failed to create Parquet file:", err)
+		return
+	}
+	defer file.Close()
+	if err := profiler.WriteParquet(file, logs); err != nil {
+		fmt.Println("Failed to write Parquet file:", err)
+	}
+}
 
-	for {
-		if time.Since(lastQueryTime) >= time.Second {
-			queryCount = 0
-			lastQueryTime = time.Now()
+// saveModeResults writes the results of each mode to its own CSV file next to csvFile,
+// e.g. pc_profiler_call.csv, for runs that mix modes.
+func saveModeResults(logs []profiler.ExecutionLog) {
+	modes, byMode := profiler.GroupByMode(logs)
+	for _, mode := range modes {
+		if mode == "" {
+			continue
 		}
-		if queryCount >= maxQPS {
-			time.Sleep(time.Until(lastQueryTime.Add(time.Second)))
+		path := modeResultsFile(mode)
+		file, err := os.Create(path)
+		if err != nil {
+			fmt.Println("Failed to create results file:", err)
 			continue
 		}
-		queryCount++
-
-		// Must generate 2 commands for addpkg+call as both may require passing a gnokey password
-		// via stdin
-		firstMode := mode
-		if firstMode == "addpkg+call" {
-			firstMode = "addpkg"
-
-			//need the same packageName for both addpkg and call
-
-			if packageName == "" {
-				packageName = randomString(MaxPackageLength)
-			}
+		if err := profiler.WriteLogs(file, byMode[mode]); err != nil {
+			fmt.Println("Failed to write", path+":", err)
 		}
+		file.Close()
+	}
+}
 
-		cmdStr := generateCommand(firstMode, packageName, functionName, remote, keyName, pkgDir, chainID)
+// modeResultsFile returns the results file of mode for -splitModes.
+func modeResultsFile(mode string) string {
+	return strings.TrimSuffix(csvFile, ".csv") + "_" + mode + ".csv"
+}
 
-		if firstLoop {
-			fmt.Println("INFO: Executing", cmdStr)
-		}
+// saveSlowest writes the slowest requests of the run to slowestFile, for the report.
+func saveSlowest(slowest []profiler.SlowRequest) {
+	data, err := json.MarshalIndent(slowest, "", "  ")
+	if err != nil {
+		fmt.Println("Failed to encode slowest requests:", err)
+		return
+	}
+	if err := os.WriteFile(slowestFile, data, 0o644); err != nil {
+		fmt.Println("Failed to write slowest requests:", err)
+	}
+}
 
-		start := time.Now()
-		//out, err := executeCommand(cmdStr, password)
-		_, err := executeCommand(cmdStr, password)
-		if err != nil {
-			fmt.Println("WARNING: Errors executing command: ", err)
+// printAssertions checks and prints every -assert, returning the results and whether
+// they all passed.
+func printAssertions(assertions []string, stats profiler.Summary) ([]profiler.AssertionResult, bool) {
+	results, err := profiler.CheckAssertions(assertions, stats)
+	if err != nil {
+		// Already validated
+		fmt.Println("Error:", err)
+		return nil, false
+	}
+	passed := true
+	if len(results) > 0 {
+		fmt.Println("Assertions:")
+	}
+	for _, a := range results {
+		status := "PASS"
+		if !a.Passed {
+			status = "FAIL"
+			passed = false
 		}
+		fmt.Printf("  %s %-24s (actual %s)\n", status, a.Assertion, a.Value)
+	}
+	return results, passed
+}
 
-		if mode == "addpkg+call" {
-			cmdStr2 := generateCommand("call", packageName, functionName, remote, keyName, pkgDir, chainID)
-			executeCommand(cmdStr2, password)
-
-			//Must reset packageName so it's random for the next invocation
-			packageName = ""
-
-			if firstLoop {
-				fmt.Println("INFO: Executing", cmdStr2)
-			}
+// alertAssertions posts the -assert checks that failed to the -webhooks.
+func alertAssertions(args profiler.Config, assertions []profiler.AssertionResult) {
+	if len(args.Webhooks) == 0 {
+		return
+	}
+	var failed []string
+	for _, a := range assertions {
+		if !a.Passed {
+			failed = append(failed, fmt.Sprintf("%s (actual %s)", a.Assertion, a.Value))
 		}
-		duration := time.Since(start)
-		fmt.Println("Completed gnokey command in", duration.Seconds(), "seconds.")
-
-		firstLoop = false
-
-		logMutex.Lock()
-		*logs = append(*logs, ExecutionLog{Timestamp: time.Now(), ResponseTime: duration})
-		logMutex.Unlock()
+	}
+	alert := profiler.Alert{
+		Text:   "realm-profiler: assertions failed: " + strings.Join(failed, ", "),
+		Event:  "assertions",
+		Remote: args.Remote,
+		Mode:   args.Mode,
+		Time:   time.Now(),
+	}
+	for _, err := range profiler.SendAlert(args.Webhooks, alert) {
+		fmt.Println("WARNING: Failed to send alert:", err)
 	}
 }
 
-func generateCommand(mode, packageName, functionName, remote, keyName, pkgDir, chainID string) string {
-	if packageName == "" {
-		packageName = randomString(MaxPackageLength)
-	}
-	if functionName == "" {
-		functionName = "Main"
-	}
-
-	switch mode {
-	case "addpkg":
-		return fmt.Sprintf(
-			"gnokey maketx addpkg --pkgpath 'gno.land/r/%s' --pkgdir %s "+
-				"--gas-fee %dugnot --gas-wanted %d --broadcast "+
-				"--chainid %s --remote %s --insecure-password-stdin=true %s",
-			packageName, pkgDir, gasFee, gasWanted, chainID, remote, keyName,
-		)
-	case "addpkg+call":
-		panic("Programming error: addpkg+call should be 2 separate calls to generateCommand.")
-	case "call":
-		return fmt.Sprintf(
-			"gnokey maketx call --pkgpath 'gno.land/r/%s' --func %s "+
-				"--gas-fee %dugnot --gas-wanted %d --broadcast "+
-				"--chainid %s --remote %s --insecure-password-stdin=true %s",
-			packageName, functionName, gasFee, gasWanted, chainID, remote, keyName,
-		)
-	case "balanceQuery":
-		return BalanceQuery
-	case "qrender":
-		//TODO: support specifying args for qrender instead of only being able to call with ""
-		return fmt.Sprintf("gnokey query vm/qrender --data '%s:' --remote %s", packageName, remote)
-	}
-	panic("Invalid mode")
+// saveJUnit writes the outcome of the run as JUnit XML for CI systems.
+func saveJUnit(path, scenario string, elapsed time.Duration, summary, failure string, assertions []profiler.AssertionResult) {
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Failed to create JUnit file:", err)
+		return
+	}
+	defer file.Close()
+	if err := profiler.WriteJUnit(file, scenario, elapsed, summary, failure, assertions); err != nil {
+		fmt.Println("Failed to write JUnit file:", err)
+	}
 }
 
-func executeCommand(command, password string) (string, error) {
-	cmd := exec.Command("bash", "-c", command)
+// printSummary prints end-of-run totals and latency percentiles for the recorded
+// requests, leaving out warm-up samples.
+func printSummary(args profiler.Config, stats profiler.Summary, logs []profiler.ExecutionLog, opts runOptions) {
+	color := !opts.NoColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	profiler.WriteSummaryTable(os.Stdout, stats, logs, color)
+	writeComparisons(os.Stdout, args, logs)
+}
 
-	// Ensure password is passed correctly via stdin
-	if password != "" {
-		cmd.Stdin = strings.NewReader(password + "\n") // Ensures newline termination
-	} else {
-		cmd.Stdin = strings.NewReader("\n") // Ensures stdin isn't empty
+// silence sends everything printed to stdout from now on to the null device, for
+// -silent, and returns the real stdout for the summary line. Errors that stop the run
+// still go to it.
+func silence() *os.File {
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		fmt.Println("WARNING: Cannot silence the output:", err)
+		return stdout
 	}
+	os.Stdout = devNull
+	errorOutput = stdout
+	return stdout
+}
 
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+// summaryLine is the one line -silent prints about a run, e.g. for the log of a cron job.
+func summaryLine(stats profiler.Summary, resultsPath, failure string, passed bool) string {
+	line := fmt.Sprintf("%d requests, %d errors (%.1f%%), p50 %v, p95 %v, p99 %v; results in %s",
+		stats.Requests, stats.Failed+stats.Invalid, 100*stats.ErrorRate(),
+		profiler.FormatDuration(stats.P50), profiler.FormatDuration(stats.P95), profiler.FormatDuration(stats.P99), resultsPath)
+	if failure != "" {
+		line += "; " + failure
+	}
+	if !passed {
+		line += "; assertions failed"
+	}
+	return line
+}
 
-	// Print stderr for debugging or noticing when something has crashed
+// saveSummary writes the summary to summaryFile, replacing the previous checkpoint's.
+func saveSummary(args profiler.Config, stats profiler.Summary, logs []profiler.ExecutionLog) {
+	file, err := os.Create(summaryFile)
 	if err != nil {
-		fmt.Println("Command error:", err)
-		fmt.Println("stderr:", stderr.String())
+		fmt.Println("Failed to create summary file:", err)
+		return
 	}
+	defer file.Close()
+	writeRunSummary(file, args, stats, logs)
+}
+
+// RunSummary is the end-of-run summary saved as JSON, for scripts that would otherwise
+// have to aggregate the CSV themselves.
+type RunSummary struct {
+	Requests   int
+	Warmup     int
+	Failed     int
+	Invalid    int
+	ErrorRate  float64
+	Throughput float64 // requests per second
+	LatencyMs  struct{ P50, P95, P99, Max float64 }
+	Errors     map[string]int
+	Fee        int64 // ugnot paid in gas fees, warm-up included
+	GasUsed    int64
+	Sent       int64 // ugnot deposited or sent, on top of fees
+	CostByMode map[string]profiler.Cost
+	Assertions []profiler.AssertionResult `json:",omitempty"`
+	Metadata   RunMetadata
+}
 
-	return out.String(), err
+func newRunSummary(metadata RunMetadata, stats profiler.Summary, assertions []profiler.AssertionResult) RunSummary {
+	summary := RunSummary{
+		Requests:   stats.Requests,
+		Warmup:     stats.Warmup,
+		Failed:     stats.Failed,
+		Invalid:    stats.Invalid,
+		ErrorRate:  stats.ErrorRate(),
+		Errors:     stats.Errors,
+		Fee:        stats.Cost.Fee,
+		GasUsed:    stats.Cost.GasUsed,
+		Sent:       stats.Cost.Sent,
+		CostByMode: stats.Costs,
+		Assertions: assertions,
+		Metadata:   metadata,
+	}
+	if elapsed := metadata.EndTime.Sub(metadata.StartTime); elapsed > 0 {
+		summary.Throughput = float64(stats.Requests) / elapsed.Seconds()
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	summary.LatencyMs.P50, summary.LatencyMs.P95 = ms(stats.P50), ms(stats.P95)
+	summary.LatencyMs.P99, summary.LatencyMs.Max = ms(stats.P99), ms(stats.Max)
+	return summary
 }
 
-func saveLogs(logs []ExecutionLog) {
-	file, err := os.Create(csvFile)
+// saveSummaryJSON writes the end-of-run summary to summaryJSON.
+func saveSummaryJSON(summary RunSummary) {
+	data, err := json.MarshalIndent(summary, "", "  ")
 	if err != nil {
-		fmt.Println("Failed to create CSV file:", err)
+		fmt.Println("Failed to encode summary:", err)
 		return
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	writer.Write([]string{"Timestamp", "ResponseTime"})
-	for _, log := range logs {
-		writer.Write([]string{log.Timestamp.Format(time.RFC3339), fmt.Sprintf("%f", log.ResponseTime.Seconds())})
-		writer.Flush()
+	if err := os.WriteFile(summaryJSON, data, 0o644); err != nil {
+		fmt.Println("Failed to write summary:", err)
 	}
 }
 
-func randomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyz"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
+// writeRunSummary writes the summary of a run, followed for A/B runs by the comparison of
+// -remote (as the baseline) with -compareRemote.
+func writeRunSummary(w io.Writer, args profiler.Config, stats profiler.Summary, logs []profiler.ExecutionLog) {
+	profiler.WriteStats(w, stats, logs)
+	writeComparisons(w, args, logs)
+}
+
+// writeComparisons prints the A/B comparison of a run with -compareRemote and the gas
+// fuzzing results of one with -fuzzGasWanted or -fuzzGasFee.
+func writeComparisons(w io.Writer, args profiler.Config, logs []profiler.ExecutionLog) {
+	if args.CompareRemote != "" {
+		fmt.Fprintf(w, "\nA/B comparison (baseline %s, candidate %s):\n", args.Remote, args.CompareRemote)
+		writeComparison(w, profiler.Summarize(profiler.FilterTarget(logs, args.Remote)),
+			profiler.Summarize(profiler.FilterTarget(logs, args.CompareRemote)))
+	}
+	if !args.FuzzGasWanted.IsZero() || !args.FuzzGasFee.IsZero() {
+		fmt.Fprintln(w)
+		profiler.WriteGasFuzz(w, logs)
 	}
-	return string(b)
 }
@@ -1,66 +1,386 @@
 package main
 
 import (
-	"fmt"
-	"regexp"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
 )
 
-// Given common default values for the command, generate it and execute it using gnokey
-func TestGenerateAndExecuteCommand(t *testing.T) {
-	mode := "addpkg"
-	packageName := "test" + randomString(32)
-	functionName := ""
-	remote := "localhost:26657"
-	keyName := "Dev"
-	pkgDir := "."
-	chainID := "dev"
+func TestWarmupFlag(t *testing.T) {
+	var d time.Duration
+	var n int
+	f := warmupFlag{&d, &n}
+	if err := f.Set("30s"); err != nil || d != 30*time.Second {
+		t.Errorf("Expected 30s, got %v (%v)", d, err)
+	}
+	if err := f.Set("100"); err != nil || n != 100 {
+		t.Errorf("Expected 100 requests, got %d (%v)", n, err)
+	}
+	if err := f.Set("soon"); err == nil {
+		t.Errorf("Expected an invalid warmup to be rejected")
+	}
+}
 
-	cmd := generateCommand(mode, packageName, functionName, remote, keyName, pkgDir, chainID)
-	fmt.Println("DEBUG: ", cmd)
+func TestPresetArg(t *testing.T) {
+	for _, tc := range []struct {
+		argv []string
+		want string
+	}{
+		{[]string{"-mode", "qrender", "-profile", "smoke"}, "smoke"},
+		{[]string{"--profile=soak", "-duration", "1h"}, "soak"},
+		{[]string{"-profile", "smoke", "-profile=spike"}, "spike"},
+		{[]string{"-mode", "call", "--", "-profile", "smoke"}, ""},
+	} {
+		if got := presetArg(tc.argv); got != tc.want {
+			t.Errorf("presetArg(%q) = %q, expected %q", tc.argv, got, tc.want)
+		}
+	}
 
-	// Expected output regex patterns
-	heightPattern := regexp.MustCompile(`HEIGHT:\s+\d+`)
-	txHashPattern := regexp.MustCompile(`TX HASH:\s+[A-Za-z0-9+/=]+`)
+	args := profiler.DefaultConfig()
+	if err := profiler.ApplyPreset(&args, "stress"); err != nil {
+		t.Fatal(err)
+	}
+	if args.MaxThreads != 20 || args.Duration != 10*time.Minute || len(args.Assert) == 0 {
+		t.Errorf("Expected the stress preset to set threads, duration and assertions, got %+v", args)
+	}
+	if err := profiler.ApplyPreset(&args, "heavy"); err == nil {
+		t.Errorf("Expected an unknown preset to be rejected")
+	}
+}
 
-	password := ""
+func TestEnvFlags(t *testing.T) {
+	for name, want := range map[string]string{
+		"maxThreads":       "REALM_PROFILER_MAX_THREADS",
+		"keyname":          "REALM_PROFILER_KEYNAME",
+		"maxQueriesPerSec": "REALM_PROFILER_MAX_QUERIES_PER_SEC",
+		"chainid":          "REALM_PROFILER_CHAINID",
+		"no-color":         "REALM_PROFILER_NO_COLOR",
+	} {
+		if got := envName(name); got != want {
+			t.Errorf("envName(%q) = %q, expected %q", name, got, want)
+		}
+	}
+
+	t.Setenv("REALM_PROFILER_REMOTE", "test5")
+	t.Setenv("REALM_PROFILER_KEYNAME", "loadtest")
+	t.Setenv("REALM_PROFILER_GAS_FEE", "2000000")
+	args := profiler.DefaultConfig()
+	fs := newFlagSet("test", "")
+	nodeFlags(fs, &args)
+	parseFlags(fs, []string{"-keyname", "flag"})
+	if args.Remote != "test5" || args.GasFee != 2000000 {
+		t.Errorf("Expected the remote and gas fee from the environment, got %q and %d", args.Remote, args.GasFee)
+	}
+	if args.KeyName != "flag" {
+		t.Errorf("Expected the command line to override the environment, got %q", args.KeyName)
+	}
 
-	// Execute the command
-	output, err := executeCommand(cmd, password)
+	t.Setenv(passwordEnv, "secret")
+	if got := readPassword(); got != "secret" {
+		t.Errorf("Expected the password from the environment, got %q", got)
+	}
+}
 
-	// If execution should not fail
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.yaml")
+	config := `# nightly run
+mode: call
+maxThreads: 4   # one per core
+keyname: config
+expect:
+  - "OK!"
+  - 'it''s #1'
+remotes: [test5, localhost:26657]
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args, preset, err := presetConfig(nil)
 	if err != nil {
-		t.Errorf("Command execution failed: %v", err)
+		t.Fatal(err)
+	}
+	var opts runOptions
+	fs := newFlagSet("test", "")
+	runFlags(fs, &args, &opts, preset)
+	if errs := flagErrors(fs, []string{"-config", path, "-keyname", "flag"}); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if args.Mode != "call" || args.MaxThreads != 4 || args.KeyName != "flag" {
+		t.Errorf("Expected the mode and threads from the file and the key from the command line, got %q, %d and %q", args.Mode, args.MaxThreads, args.KeyName)
+	}
+	if !slices.Equal(args.Expect, []string{"OK!", "it's #1"}) || !slices.Equal(args.Remotes, []string{"test5", "localhost:26657"}) {
+		t.Errorf("Unexpected lists %q and %q", args.Expect, args.Remotes)
+	}
+
+	// Every problem is reported, not just the first
+	args.Normalize()
+	args.ThinkDist = "weird"
+	if errs := args.Validate(); len(errs) != 2 {
+		t.Errorf("Expected the missing package and the think time distribution to be reported, got %v", errs)
+	}
+
+	if err := os.WriteFile(path, []byte("maxThreads: many\nbogus: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs = newFlagSet("test", "")
+	runFlags(fs, &args, &opts, "")
+	if errs := flagErrors(fs, []string{"-config", path}); len(errs) != 2 {
+		t.Errorf("Expected the invalid value and the unknown flag to be reported, got %v", errs)
+	}
+	if err := os.WriteFile(path, []byte("load:\n  threads: 4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfig(path); err == nil {
+		t.Errorf("Expected nested mappings to be rejected")
+	}
+}
+
+func TestInitWizard(t *testing.T) {
+	// The first key is missing, so the wizard asks again
+	answers := "node:26657\ntest-chain\nmissing\ny\nnode:26657\n\nloadtest\nmap\n4\n\n1h\n"
+	var out bytes.Buffer
+	checked := 0
+	check := func(args profiler.Config) []error {
+		checked++
+		if args.KeyName == "missing" {
+			return []error{errors.New("gnokey has no key named missing")}
+		}
+		return nil
+	}
+	entries := runWizard(wizard{in: bufio.NewScanner(strings.NewReader(answers)), out: &out}, check)
+	if checked != 2 || !strings.Contains(out.String(), "WARNING: gnokey has no key named missing") {
+		t.Errorf("Expected the missing key to be reported and asked for again:\n%s", out.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "init.yaml")
+	if err := writeConfig(path, append(entries, configEntry{name: "expect", values: []string{"OK!", "- it's #1"}})); err != nil {
+		t.Fatal(err)
+	}
+	args := profiler.DefaultConfig()
+	var opts runOptions
+	fs := newFlagSet("test", "")
+	runFlags(fs, &args, &opts, "")
+	if errs := flagErrors(fs, []string{"-config", path}); len(errs) > 0 {
+		t.Fatalf("Unexpected errors reading the config back: %v", errs)
+	}
+	if args.Remote != "node:26657" || args.ChainID != "test-chain" || args.KeyName != "loadtest" || args.Mode != "addpkg+call" ||
+		args.Workload != "map" || args.MaxThreads != 4 || args.MaxQPS != 1 || args.Duration != time.Hour {
+		t.Errorf("Unexpected config from the wizard: %+v", args)
+	}
+	if !slices.Equal(args.Expect, []string{"OK!", "- it's #1"}) {
+		t.Errorf("Expected the list to be read back, got %q", args.Expect)
+	}
+}
+
+func TestRecurrence(t *testing.T) {
+	now := time.Date(2025, 1, 31, 10, 17, 30, 0, time.Local) // a Friday
+	for spec, want := range map[string]time.Time{
+		"1h":             now.Add(time.Hour),
+		"0 * * * *":      time.Date(2025, 1, 31, 11, 0, 0, 0, time.Local),
+		"*/15 * * * *":   time.Date(2025, 1, 31, 10, 30, 0, 0, time.Local),
+		"30 2 * * *":     time.Date(2025, 2, 1, 2, 30, 0, 0, time.Local),
+		"0 9 * * 1-5":    time.Date(2025, 2, 3, 9, 0, 0, 0, time.Local),
+		"0 0 * * 7":      time.Date(2025, 2, 2, 0, 0, 0, 0, time.Local),
+		"0 0 29 2 *":     time.Date(2028, 2, 29, 0, 0, 0, 0, time.Local),
+		"5,10 10 31 1 *": time.Date(2026, 1, 31, 10, 5, 0, 0, time.Local),
+	} {
+		rec, err := parseRecurrence(spec)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", spec, err)
+			continue
+		}
+		if got := rec.next(now); !got.Equal(want) {
+			t.Errorf("Expected %q to start next at %v, got %v", spec, want, got)
+		}
 	}
+	for _, spec := range []string{"-1h", "hourly", "* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := parseRecurrence(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
 
-	// Normalize whitespace and check static output parts
-	expectedStaticParts := []string{
-		"OK!",
-		"GAS WANTED: 800000",
-		"GAS USED:",
-		"EVENTS:     []",
+func TestAppendHistory(t *testing.T) {
+	for _, ext := range []string{".csv", ".csv.gz"} {
+		dir := t.TempDir()
+		results, history := filepath.Join(dir, "results"+ext), filepath.Join(dir, "history"+ext)
+		log := profiler.ExecutionLog{Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ResponseTime: time.Second, Success: true, Valid: true}
+		for i, runID := range []string{"20250102T030000Z", "20250102T040000Z"} {
+			// Each run writes its own results, with one more row than the last
+			w, _, err := profiler.OpenResults(results, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Flush(slices.Repeat([]profiler.ExecutionLog{log}, i+1))
+			w.Close()
+			if n, err := appendHistory(history, runID, results, time.Now().Add(-time.Minute)); err != nil || n != i+1 {
+				t.Fatalf("Expected %d results to be appended, got %d: %v", i+1, n, err)
+			}
+		}
+		// A run that failed before writing its results leaves those of the last one
+		if _, err := appendHistory(history, "20250102T050000Z", results, time.Now().Add(time.Minute)); !errors.Is(err, errStaleResults) {
+			t.Errorf("Expected stale results to be refused, got %v", err)
+		}
+		logs, err := profiler.LoadResults(history)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var runIDs []string
+		for _, log := range logs {
+			runIDs = append(runIDs, log.RunID)
+		}
+		if want := []string{"20250102T030000Z", "20250102T040000Z", "20250102T040000Z"}; !slices.Equal(runIDs, want) {
+			t.Errorf("Expected the results of both runs in %s with their IDs, got %q", ext, runIDs)
+		}
 	}
-	for _, part := range expectedStaticParts {
-		if !strings.Contains(output, part) {
-			t.Errorf("Expected output to contain %q but it was missing.\nActual output: %q", part, output)
+}
+
+func TestCompareAndReport(t *testing.T) {
+	baseline := profiler.Summarize([]profiler.ExecutionLog{
+		{ResponseTime: 100 * time.Millisecond, Success: true, Valid: true},
+		{ResponseTime: 200 * time.Millisecond, Success: true, Valid: true},
+	})
+	candidate := profiler.Summarize([]profiler.ExecutionLog{
+		{ResponseTime: 150 * time.Millisecond, Success: true, Valid: true},
+		{ResponseTime: 300 * time.Millisecond, ErrorCode: profiler.ErrTimeout},
+	})
+	var buf bytes.Buffer
+	writeComparison(&buf, baseline, candidate)
+	for _, want := range []string{"+50.0%", "+50.00pp"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Comparison is missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	writeReport(&buf, &RunMetadata{Args: profiler.DefaultConfig(), Aborted: true, AbortReason: "10 consecutive errors",
+		Balances: []profiler.BalanceChange{{Address: "g1abc", Before: 50000000, After: 39000000}}},
+		[]profiler.ExecutionLog{{ResponseTime: time.Second, ErrorCode: profiler.ErrTimeout}, {Mode: "call", Fee: 10000000, GasUsed: 123456, Success: true, Valid: true}},
+		[]profiler.SlowRequest{{ResponseTime: time.Second, Mode: "call", Height: 42, ErrorCode: profiler.ErrTimeout, Output: "$ gnokey maketx call"}})
+	for _, want := range []string{"| Mode | `call` |", "| Aborted | 10 consecutive errors |", "| `timeout` | 1 |",
+		"| `call` | 1s | 42 | timeout |", "| `call` | 10000000 | 123456 |",
+		"| `g1abc` | 50000000 | 39000000 | -11000000 | **-1000000** |", "### 1. 1s\n\n```\n$ gnokey maketx call\n```"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Report is missing %q:\n%s", want, buf.String())
 		}
 	}
+}
 
-	// Validate dynamic fields using regex
-	if !heightPattern.MatchString(output) {
-		t.Errorf("Expected output to contain HEIGHT with an integer, but got:\n%s", output)
+func TestRunSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metadata := RunMetadata{Seed: 7, StartTime: start, EndTime: start.Add(2 * time.Second), Args: profiler.DefaultConfig()}
+	stats := profiler.Summarize([]profiler.ExecutionLog{
+		{ResponseTime: 100 * time.Millisecond, Success: true, Valid: true},
+		{ResponseTime: 300 * time.Millisecond, ErrorCode: profiler.ErrTimeout},
+	})
+	summary := newRunSummary(metadata, stats, []profiler.AssertionResult{{Assertion: "p95<1s", Value: "300ms", Passed: true}})
+	if summary.Requests != 2 || summary.Throughput != 1 || summary.ErrorRate != 0.5 {
+		t.Errorf("Expected 2 requests at 1/s with half failing, got %+v", summary)
+	}
+	if summary.LatencyMs.P50 != 100 || summary.LatencyMs.Max != 300 {
+		t.Errorf("Expected latencies in milliseconds, got %+v", summary.LatencyMs)
 	}
-	if !txHashPattern.MatchString(output) {
-		t.Errorf("Expected output to contain TX HASH with a base64 string, but got:\n%s", output)
+	if summary.Errors[profiler.ErrTimeout] != 1 || len(summary.Assertions) != 1 || summary.Metadata.Seed != 7 {
+		t.Errorf("Expected the errors, assertions and metadata, got %+v", summary)
 	}
 }
 
-func TestRandomStringUnique(t *testing.T) {
-	r1 := randomString(32)
-	r2 := randomString(32)
+func TestFormatProgress(t *testing.T) {
+	p := profiler.Progress{Elapsed: 30 * time.Second, Duration: time.Minute, Requests: 120, Errors: 3}
+	want := "[===============               ]  50% 30s elapsed, 120 requests, 3 errors, ETA 30s"
+	if got := formatProgress(p); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
 
-	if r1 == r2 {
-		t.Errorf("Random calls not uinmque")
+	p.Queued = 4
+	want = "[===============               ]  50% 30s elapsed, 120 requests, 3 errors, 4 queued, ETA 30s"
+	if got := formatProgress(p); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestSummaryLine(t *testing.T) {
+	stats := profiler.Summary{Requests: 200, Failed: 3, Invalid: 1, P50: 12 * time.Millisecond, P95: 40 * time.Millisecond, P99: 90 * time.Millisecond}
+	want := "200 requests, 4 errors (2.0%), p50 12ms, p95 40ms, p99 90ms; results in pc_profiler.csv; aborted after 10 consecutive errors; assertions failed"
+	if got := summaryLine(stats, "pc_profiler.csv", "aborted after 10 consecutive errors", false); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestAbortedRunExitsNonZero(t *testing.T) {
+	if dir := os.Getenv("TEST_ABORTED_RUN_DIR"); dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		profiler.RegisterExecutor("failing", func(string) profiler.Executor { return failingExecutor{} })
+		args := profiler.DefaultConfig()
+		args.Backend = "failing"
+		args.Mode = "qrender"
+		args.PackageName = "gno.land/r/foo"
+		args.MaxQPS = 100
+		args.Arrival = "poisson" // fixed windows would send the whole second's requests at once
+		args.Duration = time.Minute
+		args.AbortConsecutiveErrors = 3
+		args.BalanceCheck = "off"
+		args.Normalize()
+		startRun(args, runOptions{TimeSeries: timeSeriesOptions{Bucket: time.Second}})
+		return
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAbortedRunExitsNonZero$")
+	cmd.Env = append(os.Environ(), "TEST_ABORTED_RUN_DIR="+dir, passwordEnv+"=")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected the aborted run to exit 1, got %v:\n%s", err, out)
+	}
+	if n := strings.Count(string(out), "\nSummary\n"); n != 1 {
+		t.Errorf("Expected the results to be saved once, got %d summaries:\n%s", n, out)
+	}
+	var metadata RunMetadata
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err == nil {
+		err = json.Unmarshal(data, &metadata)
+	}
+	if err != nil || !metadata.Aborted || metadata.AbortReason != "3 consecutive errors" {
+		t.Errorf("Expected the metadata to record the abort, got %+v (%v)", metadata, err)
+	}
+}
+
+// failingExecutor fails every request, to trip the circuit breaker.
+type failingExecutor struct{}
+
+func (failingExecutor) Describe(mode, packageName string, args profiler.Config) string {
+	return "fail " + mode
+}
+
+func (failingExecutor) Execute(mode, packageName string, args profiler.Config) (string, profiler.HTTPTiming, error) {
+	return "", profiler.HTTPTiming{}, errors.New("connection refused")
+}
+
+func TestRunErrorsSecrets(t *testing.T) {
+	args := profiler.DefaultConfig()
+	args.Normalize()
+	args.Webhooks = []string{"http://10.0.0.1/hook"}
+	errs := runErrors(args, runOptions{Agents: []string{"10.0.0.1:7070"}, ControlAddr: ":8080", TimeSeries: timeSeriesOptions{Bucket: time.Second}})
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	for _, want := range []string{"agentSecret must be set", "duration must be set", "cannot set webhook", "controlSecret must be set"} {
+		if !slices.ContainsFunc(messages, func(m string) bool { return strings.Contains(m, want) }) {
+			t.Errorf("Expected an error containing %q, got %q", want, messages)
+		}
 	}
 }
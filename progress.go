@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// progressWidth is the number of characters the progress bar fills.
+const progressWidth = 30
+
+// progressLogInterval is how often the progress is printed when stderr isn't a terminal,
+// e.g. in CI logs, where a bar can't be redrawn in place.
+const progressLogInterval = 10 * time.Second
+
+// showProgress draws a progress bar with the ETA and counts of r on stderr, redrawing it
+// every second on a terminal, until the function it returns is called.
+func showProgress(r *profiler.Run) (stop func()) {
+	terminal := isTerminal(os.Stderr)
+	interval := progressLogInterval
+	if terminal {
+		interval = time.Second
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				if terminal {
+					fmt.Fprint(os.Stderr, "\r\033[K")
+				}
+				return
+			case <-ticker.C:
+			}
+			if terminal {
+				fmt.Fprint(os.Stderr, "\r\033[K"+formatProgress(r.Progress()))
+			} else {
+				fmt.Fprintln(os.Stderr, formatProgress(r.Progress()))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// formatProgress renders p as a bar with the percentage done, counts and ETA.
+func formatProgress(p profiler.Progress) string {
+	f := p.Fraction()
+	filled := int(f * progressWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	eta := "?"
+	if d, ok := p.ETA(); ok {
+		eta = d.Round(time.Second).String()
+	}
+	var queued string
+	if p.Queued > 0 {
+		queued = fmt.Sprintf(", %d queued", p.Queued)
+	}
+	return fmt.Sprintf("[%s] %3.0f%% %v elapsed, %d requests, %d errors%s, ETA %s",
+		bar, 100*f, p.Elapsed.Round(time.Second), p.Requests, p.Errors, queued, eta)
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
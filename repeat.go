@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// historyFile accumulates the results of every run of -repeat, with their RunID.
+const historyFile = "pc_profiler_history.csv"
+
+// recurrence says when a repeated run starts next.
+type recurrence interface {
+	next(after time.Time) time.Time
+}
+
+// parseRecurrence parses -repeat: an interval such as 1h, or a cron expression of five
+// fields (minute, hour, day of month, month, day of week) such as "0 * * * *".
+func parseRecurrence(s string) (recurrence, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return nil, errors.New("repeat interval must be positive.")
+		}
+		return interval(d), nil
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("repeat must be an interval such as 1h or a cron expression such as \"0 * * * *\", not %q.", s)
+	}
+	var c cronSchedule
+	for i, f := range []struct {
+		set      *[]bool
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.day, 1, 31}, {&c.month, 1, 12}, {&c.weekday, 0, 7}} {
+		set, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron field %q: %w", fields[i], err)
+		}
+		*f.set = set
+	}
+	// Sunday is both 0 and 7
+	c.weekday[0] = c.weekday[0] || c.weekday[7]
+	c.anyDay, c.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// interval repeats a run this long after it last started.
+type interval time.Duration
+
+func (d interval) next(after time.Time) time.Time {
+	return after.Add(time.Duration(d))
+}
+
+// cronSchedule repeats a run at the minutes its fields match, in local time.
+type cronSchedule struct {
+	minute, hour, day, month, weekday []bool // indexed by value
+	anyDay, anyWeekday                bool
+}
+
+func (c cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every combination repeats within a few years, e.g. the 29th of February
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case !c.month[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay follows cron: if both the day of month and the day of week are restricted,
+// either may match.
+func (c cronSchedule) matchDay(t time.Time) bool {
+	day, weekday := c.day[t.Day()], c.weekday[t.Weekday()]
+	switch {
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// parseCronField returns which values from min to max a comma-separated list of *, n,
+// a-b and either with a /step matches.
+func parseCronField(s string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(s, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+		lo, hi := min, max
+		if span != "*" {
+			from, to, isRange := strings.Cut(span, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid value %q", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("values must be from %d to %d", min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// repeatRuns starts the run of argv straight away and then on the -repeat schedule, each
+// time in a new process, until interrupted. The results of every run are appended to
+// historyFile with a RunID, the time the run started, so the node can be monitored over
+// time. Each run still writes its own pc_profiler.csv and summary.
+func repeatRuns(argv []string, args profiler.Config, opts runOptions) {
+	rec, _ := parseRecurrence(opts.Repeat) // checked by runErrors
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	resultsPath, historyPath := csvFile, historyFile
+	if args.Compress {
+		resultsPath += ".gz"
+		historyPath += ".gz"
+	}
+	// The password is read once and handed to every run on stdin, and kept out of the
+	// environment of the runs and the gnokey processes they start
+	password := readPassword()
+	env := slices.DeleteFunc(os.Environ(), func(v string) bool { return strings.HasPrefix(v, passwordEnv+"=") })
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	for start := time.Now(); ; {
+		runID := start.UTC().Format("20060102T150405Z")
+		fmt.Println("INFO: Starting run", runID)
+		// A later flag overrides an earlier one, so the run doesn't repeat itself
+		cmd := exec.Command(executable, append(append([]string{"run"}, argv...), "-repeat=")...)
+		cmd.Stdin = strings.NewReader(password + "\n")
+		cmd.Stdout, cmd.Stderr, cmd.Env = os.Stdout, os.Stderr, env
+		if err := cmd.Start(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		stopping := false
+		select {
+		case err = <-done:
+		case sig := <-signalChan:
+			// Let the run save its results first
+			stopping = true
+			cmd.Process.Signal(sig)
+			err = <-done
+		}
+		if err != nil {
+			fmt.Printf("WARNING: Run %s failed: %v\n", runID, err)
+		}
+		if n, err := appendHistory(historyPath, runID, resultsPath, start); err != nil {
+			fmt.Println("WARNING: Could not add the results to", historyPath+":", err)
+		} else {
+			fmt.Printf("INFO: Added %d results of run %s to %s\n", n, runID, historyPath)
+		}
+		if stopping {
+			return
+		}
+
+		next := rec.next(start)
+		if now := time.Now(); !next.IsZero() && !next.After(now) {
+			next = rec.next(now)
+			fmt.Println("WARNING: The run took longer than the schedule allows, skipping to the next start")
+		}
+		if next.IsZero() {
+			fmt.Println("INFO: The schedule has no more runs")
+			return
+		}
+		fmt.Println("INFO: Next run at", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+			start = next
+		case <-signalChan:
+			return
+		}
+	}
+}
+
+// errStaleResults is returned by appendHistory when the run didn't write its results,
+// e.g. because it failed before it could, and the file still has those of an earlier run.
+var errStaleResults = errors.New("the run wrote no results")
+
+// appendHistory appends the results at resultsPath to the history file at path, as those
+// of runID, and returns how many there were. The results must have been written since
+// start, when the run started.
+func appendHistory(path, runID, resultsPath string, start time.Time) (int, error) {
+	info, err := os.Stat(resultsPath)
+	if err != nil {
+		return 0, err
+	}
+	// Some file systems only keep modification times to the second
+	if info.ModTime().Before(start.Truncate(time.Second)) {
+		return 0, errStaleResults
+	}
+	logs, err := profiler.LoadResults(resultsPath)
+	if err != nil {
+		return 0, err
+	}
+	for i := range logs {
+		logs[i].RunID = runID
+	}
+	return len(logs), profiler.AppendResults(path, logs)
+}
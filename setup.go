@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+func setupMain(argv []string) {
+	args := profiler.DefaultConfig()
+	fs := newFlagSet("setup", "[flags]")
+	count := fs.Int("count", 10, "Number of packages to deploy")
+	fs.StringVar(&args.ManifestFile, "manifest", "targets.csv", "File to record the deployed package paths in, for run -targets")
+	seed := fs.Int64("seed", 0, "Random seed for generated package names (0 picks one from the clock)")
+	nodeFlags(fs, &args)
+	packageFlags(fs, &args)
+	parseFlags(fs, argv)
+
+	args.Mode = "addpkg"
+	args.Normalize()
+	exitOnErrors(args.Validate())
+	if *count < 1 {
+		fmt.Println("Error: count must be at least 1.")
+		os.Exit(1)
+	}
+	useSeed(*seed)
+
+	deployed, err := profiler.DeployPackages(args, *count, readPassword())
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("INFO: Deployed %d of %d packages, recorded in %s\n", deployed, *count, args.ManifestFile)
+	function := "<function>"
+	if args.Workload != "" {
+		function = profiler.WorkloadFunction(args.Workload)
+	}
+	fmt.Printf("INFO: Load them with: realm-profiler run -mode call -function %s -targets %s\n", function, args.ManifestFile)
+	if deployed < *count {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// handleUserSignals makes `kill -USR1` dump the stats so far to stderr and `kill -USR2`
+// toggle pausing load generation.
+func handleUserSignals(r *profiler.Run) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGUSR1:
+				profiler.WriteStats(os.Stderr, r.Summary(), r.Logs())
+			case syscall.SIGUSR2:
+				if r.TogglePause() {
+					fmt.Println("INFO: Paused load generation")
+				} else {
+					fmt.Println("INFO: Resumed load generation")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "github.com/kristovatlas/realm-profiler/pkg/profiler"
+
+// handleUserSignals is a no-op: Windows has no SIGUSR1/SIGUSR2. Use -controlAddr instead.
+func handleUserSignals(r *profiler.Run) {}
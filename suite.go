@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+func suiteMain(argv []string) {
+	args := profiler.DefaultConfig()
+	args.Duration = 30 * time.Second
+	var modes []string
+	fs := newFlagSet("suite", "[flags]")
+	fs.Var((*commaList)(&modes), "modes", "Comma-separated modes to run (default every one of "+strings.Join(profiler.SuiteModes, ", ")+" the other flags allow)")
+	fs.StringVar(&args.PackageName, "package", args.PackageName, "Package for qrender, qdoc and call to target")
+	fs.StringVar(&args.FunctionName, "function", args.FunctionName, "Function for call to call")
+	fs.IntVar(&args.MaxThreads, "maxThreads", args.MaxThreads, "Number of threads for each mode")
+	fs.IntVar(&args.MaxQPS, "maxQueriesPerSec", args.MaxQPS, "Max queries per second per thread for each mode")
+	fs.DurationVar(&args.Duration, "duration", args.Duration, "How long to run each mode for")
+	seed := fs.Int64("seed", 0, "Random seed for generated package names (0 picks one from the clock)")
+	nodeFlags(fs, &args)
+	packageFlags(fs, &args)
+	parseFlags(fs, argv)
+
+	args.Normalize()
+	if args.Duration <= 0 {
+		fmt.Println("Error: duration must be positive.")
+		os.Exit(1)
+	}
+	if len(modes) == 0 {
+		modes = profiler.DefaultSuiteModes(args)
+	}
+	for _, mode := range modes {
+		if !slices.Contains(profiler.SuiteModes, mode) {
+			fmt.Println("Error: suite modes must be among", strings.Join(profiler.SuiteModes, ", "))
+			os.Exit(1)
+		}
+		exitOnErrors(profiler.SuiteArgs(args, mode).Validate())
+	}
+	useSeed(*seed)
+
+	stop := make(chan struct{})
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalChan
+		fmt.Println("\nStopping the suite...")
+		close(stop)
+	}()
+
+	logs, err := profiler.RunSuite(args, modes, readPassword(), stop)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+	results, _, ferr := profiler.OpenResults(csvFile, false)
+	if ferr == nil {
+		ferr = results.Flush(logs)
+		results.Close()
+	}
+	if ferr != nil {
+		fmt.Println("Failed to write CSV file:", ferr)
+	}
+	fmt.Println()
+	profiler.WriteSuite(os.Stdout, modes, logs)
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/kristovatlas/realm-profiler/pkg/profiler"
+)
+
+// queryModes send no transactions, so they don't need a key.
+var queryModes = []string{"balanceQuery", "qrender", "qdoc", "calibrate"}
+
+// validateMain checks a run's settings without generating any load: the flags, the
+// environment and the -config file, whether each remote answers, and whether gnokey has
+// the keys the run signs with. It reports every problem rather than stopping at the first.
+func validateMain(argv []string) {
+	var errs []error
+	args, preset, err := presetConfig(argv)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	var opts runOptions
+	fs := newFlagSet("validate", "[-config file] [run flags]")
+	runFlags(fs, &args, &opts, preset)
+	offline := fs.Bool("offline", false, "Only check the settings, without contacting the remotes or gnokey")
+	errs = append(errs, flagErrors(fs, argv)...)
+	if err := loadModes(opts); err != nil {
+		errs = append(errs, err)
+	}
+	args.Normalize()
+	errs = append(errs, args.Validate()...)
+	errs = append(errs, runErrors(args, opts)...)
+
+	if !*offline {
+		errs = append(errs, checkRemotes(args)...)
+		errs = append(errs, checkKeys(args)...)
+	}
+	for _, err := range errs {
+		fmt.Println("Error:", err)
+	}
+	if len(errs) > 0 {
+		if len(errs) == 1 {
+			fmt.Println("1 problem found.")
+		} else {
+			fmt.Printf("%d problems found.\n", len(errs))
+		}
+		os.Exit(1)
+	}
+	fmt.Println("OK: the run is ready to start.")
+}
+
+// checkRemotes checks that every remote the run sends to answers a query, resolving
+// the names of public networks.
+func checkRemotes(args profiler.Config) []error {
+	remotes := []string{args.Remote}
+	if len(args.Remotes) > 0 {
+		remotes = slices.Clone(args.Remotes)
+	}
+	if args.CompareRemote != "" {
+		remotes = append(remotes, args.CompareRemote)
+	}
+	if len(args.Chains) > 0 {
+		remotes = nil
+		for _, c := range args.Chains {
+			remotes = append(remotes, c.Remote)
+		}
+	}
+	var errs []error
+	for _, remote := range remotes {
+		resolved := profiler.Config{Remote: remote}
+		resolved.Normalize()
+		if _, err := profiler.QueryBalance(resolved.Remote, profiler.BalanceAddress); err != nil {
+			errs = append(errs, fmt.Errorf("remote %s doesn't answer: %w", resolved.Remote, err))
+			continue
+		}
+		fmt.Println("INFO: Remote", resolved.Remote, "answers")
+	}
+	return errs
+}
+
+// checkKeys checks that gnokey has the keys the run signs transactions with, unless it
+// only queries or -address is given.
+func checkKeys(args profiler.Config) []error {
+	if slices.Contains(queryModes, args.Mode) || args.Address != "" {
+		return nil
+	}
+	keys := []string{args.KeyName}
+	for _, c := range args.Chains {
+		if c.KeyName != "" && !slices.Contains(keys, c.KeyName) {
+			keys = append(keys, c.KeyName)
+		}
+	}
+	var errs []error
+	for _, key := range keys {
+		address, err := profiler.KeyAddress(key, args.Home)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("INFO: Key %s is %s\n", key, address)
+	}
+	return errs
+}